@@ -38,7 +38,7 @@ func (accs Accounts) ID() ID {
 
 	// Create a raw list of each component relevant to building an ID.
 	for i := range accountNames {
-		fmt.Fprintf(identityBuilder, "account %s %s\n", accountNames[i], accs[accountNames[i]])
+		fmt.Fprintf(identityBuilder, "account %s %s\n", accountNames[i], accs[accountNames[i]].identity())
 	}
 
 	// Aggregate and set the ID of this IDer
@@ -0,0 +1,204 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+)
+
+// AccountClass separates Accounts that hold money from Accounts that record money which is owed.
+type AccountClass string
+
+// These are the AccountClasses that are understood by this module. An Account without a class is treated as an
+// AssetAccount.
+const (
+	AssetAccount     AccountClass = "asset"
+	LiabilityAccount AccountClass = "liability"
+)
+
+// AccountSubtype describes what kind of Account something is, in more detail than its AccountClass. Any value may be
+// used, but the ones below are recommended so that tools can agree on them.
+type AccountSubtype string
+
+// These are the recommended AccountSubtypes.
+const (
+	CheckingAccount   AccountSubtype = "checking"
+	SavingsAccount    AccountSubtype = "savings"
+	CashAccount       AccountSubtype = "cash"
+	BrokerageAccount  AccountSubtype = "brokerage"
+	RetirementAccount AccountSubtype = "retirement"
+	CreditAccount     AccountSubtype = "credit"
+	LoanAccount       AccountSubtype = "loan"
+	MortgageAccount   AccountSubtype = "mortgage"
+)
+
+// AccountDetails describes an Account, beyond its Balance.
+//
+// Like every Account, the Balance of a LiabilityAccount counts toward the money that has been assigned to Budgets. So
+// money that is owed is recorded as a negative Balance: a credit card that has been used to spend USD 40 has a Balance
+// of USD -40.
+type AccountDetails struct {
+	Class       AccountClass
+	Subtype     AccountSubtype
+	Institution string
+
+	// Currency is the asset this Account is expected to hold. It is informational, and isn't enforced.
+	Currency AssetType
+
+	// Closed is set once an Account is no longer in use, but is being kept around for the sake of history.
+	Closed bool
+}
+
+// IsLiability determines whether an Account records money that is owed.
+func (d AccountDetails) IsLiability() bool {
+	return d.Class == LiabilityAccount
+}
+
+// IsZero determines whether no details have been set.
+func (d AccountDetails) IsZero() bool {
+	return d == AccountDetails{}
+}
+
+// MarshalText creates a deterministic string that uniquely represents these AccountDetails.
+func (d AccountDetails) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf(
+		"class %q subtype %q institution %q currency %q closed %t",
+		d.Class,
+		d.Subtype,
+		d.Institution,
+		d.Currency,
+		d.Closed)), nil
+}
+
+// AccountMetadata holds the AccountDetails of each Account in a State that has any, keyed by the name of the Account.
+type AccountMetadata map[string]AccountDetails
+
+// ID fetches a hash of the AccountDetails of every Account. Accounts whose AccountDetails are all zero are left out, so
+// they have the same ID as if they were missing.
+func (m AccountMetadata) ID() ID {
+	identityBuilder := identityBuilders.Get().(*bytes.Buffer)
+	identityBuilder.Reset()
+	defer identityBuilders.Put(identityBuilder)
+
+	for _, name := range m.Names() {
+		marshaled, _ := m[name].MarshalText()
+		fmt.Fprintf(identityBuilder, "account %q %s\n", name, marshaled)
+	}
+
+	return sha1.Sum(identityBuilder.Bytes())
+}
+
+// Names fetches the sorted names of the Accounts that have AccountDetails which aren't all zero.
+func (m AccountMetadata) Names() []string {
+	names := make([]string, 0, len(m))
+	for name, details := range m {
+		if !details.IsZero() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Empty determines whether there are any AccountDetails which aren't all zero.
+func (m AccountMetadata) Empty() bool {
+	for _, details := range m {
+		if !details.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal determines whether two instances of AccountMetadata describe every Account the same way.
+func (m AccountMetadata) Equal(other AccountMetadata) bool {
+	for name, details := range m {
+		if other[name] != details {
+			return false
+		}
+	}
+	for name, details := range other {
+		if m[name] != details {
+			return false
+		}
+	}
+	return true
+}
+
+// DeepCopy creates a duplicate AccountMetadata that can be modified without fear of modifying the original.
+func (m AccountMetadata) DeepCopy() AccountMetadata {
+	retval := make(AccountMetadata, len(m))
+	for name, details := range m {
+		retval[name] = details
+	}
+	return retval
+}
+
+// TotalAssets finds the total Balance of every Account that isn't a LiabilityAccount.
+func (s State) TotalAssets() Balance {
+	sum := make(Balance)
+	for name, balance := range s.Accounts {
+		if !s.Metadata[name].IsLiability() {
+			sum = sum.Add(balance)
+		}
+	}
+	return sum
+}
+
+// TotalLiabilities finds how much is owed across every LiabilityAccount. Because money that is owed is recorded as a
+// negative Balance, the total is negated so that a debt is reported as a positive amount.
+func (s State) TotalLiabilities() Balance {
+	sum := make(Balance)
+	for name, balance := range s.Accounts {
+		if s.Metadata[name].IsLiability() {
+			sum = sum.Sub(balance)
+		}
+	}
+	return sum
+}
+
+// NetWorth finds the value of every asset, minus everything that is owed.
+func (s State) NetWorth() Balance {
+	retval := s.TotalAssets().Sub(s.TotalLiabilities())
+	for asset, magnitude := range retval {
+		if magnitude.Cmp(zero) == 0 {
+			delete(retval, asset)
+		}
+	}
+	return retval
+}
+
+// AccountsByClass collects the Accounts of a single AccountClass. Accounts without a class are treated as
+// AssetAccounts.
+func (s State) AccountsByClass(class AccountClass) Accounts {
+	if class == "" {
+		class = AssetAccount
+	}
+
+	retval := make(Accounts)
+	for name, balance := range s.Accounts {
+		current := s.Metadata[name].Class
+		if current == "" {
+			current = AssetAccount
+		}
+		if current == class {
+			retval[name] = balance
+		}
+	}
+	return retval
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func ExampleState_NetWorth() {
+	subject := envelopes.State{
+		Accounts: envelopes.Accounts{
+			"checking": {"USD": big.NewRat(1500, 1)},
+			"credit":   {"USD": big.NewRat(-400, 1)},
+			"car loan": {"USD": big.NewRat(-9000, 1)},
+		},
+		Metadata: envelopes.AccountMetadata{
+			"checking": {Class: envelopes.AssetAccount, Subtype: envelopes.CheckingAccount},
+			"credit":   {Class: envelopes.LiabilityAccount, Subtype: envelopes.CreditAccount},
+			"car loan": {Class: envelopes.LiabilityAccount, Subtype: envelopes.LoanAccount},
+		},
+	}
+
+	fmt.Println("assets:", subject.TotalAssets())
+	fmt.Println("liabilities:", subject.TotalLiabilities())
+	fmt.Println("net worth:", subject.NetWorth())
+	// Output:
+	// assets: USD 1500.00
+	// liabilities: USD 9400.00
+	// net worth: USD -7900.00
+}
+
+func TestState_ID_metadata(t *testing.T) {
+	plain := envelopes.State{
+		Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(5, 1)}},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(5, 1)}},
+	}
+
+	withZero := plain
+	withZero.Metadata = envelopes.AccountMetadata{"checking": {}}
+	if plain.ID() != withZero.ID() {
+		t.Errorf("AccountDetails that are all zero should not change the ID")
+	}
+	if !plain.Equal(withZero) {
+		t.Errorf("AccountDetails that are all zero should not make States unequal")
+	}
+
+	described := plain
+	described.Metadata = envelopes.AccountMetadata{"checking": {Subtype: envelopes.CheckingAccount}}
+	if plain.ID() == described.ID() {
+		t.Errorf("AccountMetadata should change the ID")
+	}
+	if plain.Equal(described) {
+		t.Errorf("States with different AccountMetadata should not be Equal")
+	}
+
+	closed := plain
+	closed.Metadata = envelopes.AccountMetadata{"checking": {Subtype: envelopes.CheckingAccount, Closed: true}}
+	if described.ID() == closed.ID() {
+		t.Errorf("each field of AccountDetails should change the ID")
+	}
+}
+
+func TestState_DeepCopy_metadata(t *testing.T) {
+	original := envelopes.State{
+		Metadata: envelopes.AccountMetadata{"credit": {Class: envelopes.LiabilityAccount}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Metadata["credit"] = envelopes.AccountDetails{Class: envelopes.AssetAccount}
+	if original.Metadata["credit"].Class != envelopes.LiabilityAccount {
+		t.Errorf("modifying a copy changed the original")
+	}
+}
+
+func TestState_AccountsByClass(t *testing.T) {
+	subject := envelopes.State{
+		Accounts: envelopes.Accounts{
+			"checking": {"USD": big.NewRat(10, 1)},
+			"wallet":   {"USD": big.NewRat(2, 1)},
+			"credit":   {"USD": big.NewRat(-3, 1)},
+		},
+		Metadata: envelopes.AccountMetadata{
+			"checking": {Class: envelopes.AssetAccount},
+			"credit":   {Class: envelopes.LiabilityAccount},
+		},
+	}
+
+	assets := subject.AccountsByClass(envelopes.AssetAccount)
+	if got := assets.Names(); fmt.Sprint(got) != "[checking wallet]" {
+		t.Errorf("got assets: %v", got)
+	}
+
+	liabilities := subject.AccountsByClass(envelopes.LiabilityAccount)
+	if got := liabilities.Names(); fmt.Sprint(got) != "[credit]" {
+		t.Errorf("got liabilities: %v", got)
+	}
+}
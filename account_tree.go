@@ -0,0 +1,247 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AccountPath identifies an Account in a hierarchy of Accounts, for instance "Bank A/Checking" is the Account named
+// "Checking" grouped under "Bank A".
+//
+// The name of each Account in Accounts is the text of its AccountPath. It is written the same way as a BudgetPath, but
+// without the leading slash, so Accounts that aren't grouped keep the names they've always had. Names that aren't valid
+// AccountPaths, like ones holding a backslash that isn't part of an escape sequence, are still allowed. They are
+// treated as a single Account at the top of the hierarchy.
+type AccountPath []string
+
+// ParseAccountPath reads an AccountPath that was written by AccountPath.String. Only canonical text is accepted, so
+// that each Account has exactly one name.
+func ParseAccountPath(name string) (AccountPath, error) {
+	if name == "" {
+		return nil, fmt.Errorf("account names can not be empty")
+	}
+	if name[0] == budgetPathSeparator {
+		return nil, fmt.Errorf("account name %q can not start with %q", name, string(budgetPathSeparator))
+	}
+
+	parsed, err := ParseBudgetPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := AccountPath(parsed)
+	if retval.String() != name {
+		return nil, fmt.Errorf("account name %q is not written canonically", name)
+	}
+	return retval, nil
+}
+
+// accountPathOf finds the AccountPath of an Account, treating names that aren't valid AccountPaths as a single Account
+// at the top of the hierarchy.
+func accountPathOf(name string) AccountPath {
+	if parsed, err := ParseAccountPath(name); err == nil {
+		return parsed
+	}
+	return AccountPath{name}
+}
+
+// String writes an AccountPath as the name of an Account.
+func (p AccountPath) String() string {
+	if len(p) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(BudgetPath(p).String(), string(budgetPathSeparator))
+}
+
+// Child creates a new AccountPath that identifies the child with the given name of the Account identified by this one.
+func (p AccountPath) Child(name string) AccountPath {
+	return AccountPath(BudgetPath(p).Child(name))
+}
+
+// Parent creates a new AccountPath that identifies the group holding the Account identified by this one.
+func (p AccountPath) Parent() AccountPath {
+	return AccountPath(BudgetPath(p).Parent())
+}
+
+// Equal determines whether two AccountPaths identify the same Account.
+func (p AccountPath) Equal(other AccountPath) bool {
+	return BudgetPath(p).Equal(BudgetPath(other))
+}
+
+// Contains determines whether the Account identified by other is the one identified by this AccountPath, or one of its
+// descendants.
+func (p AccountPath) Contains(other AccountPath) bool {
+	return BudgetPath(p).Contains(BudgetPath(other))
+}
+
+// AccountTree shows Accounts as a hierarchy, the same way Budgets are arranged. A node with a nil Balance doesn't
+// represent an Account of its own; it only groups the Accounts beneath it.
+type AccountTree struct {
+	Balance  Balance
+	Children map[string]*AccountTree
+}
+
+// RecursiveBalance finds the balance of an AccountTree and all of its children.
+func (t AccountTree) RecursiveBalance() Balance {
+	sum := make(Balance)
+	sum = sum.Add(t.Balance)
+	for _, child := range t.Children {
+		sum = sum.Add(child.RecursiveBalance())
+	}
+	return sum
+}
+
+// ChildNames returns an alphabetically sorted list of the names of each of the children of this AccountTree.
+func (t AccountTree) ChildNames() []string {
+	results := make([]string, 0, len(t.Children))
+	for name := range t.Children {
+		results = append(results, name)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// Accounts flattens an AccountTree back into Accounts, naming each one by its AccountPath. Nodes without a Balance are
+// left out.
+func (t AccountTree) Accounts() Accounts {
+	retval := make(Accounts)
+	var flatten func(path AccountPath, node *AccountTree)
+	flatten = func(path AccountPath, node *AccountTree) {
+		if node.Balance != nil && len(path) > 0 {
+			retval[path.String()] = node.Balance
+		}
+		for name, child := range node.Children {
+			flatten(path.Child(name), child)
+		}
+	}
+	flatten(AccountPath{}, &t)
+	return retval
+}
+
+// Tree arranges Accounts into a hierarchy, using the AccountPath of each one. The root of the returned AccountTree
+// never has a Balance.
+//
+// Flattening the result with AccountTree.Accounts gives back the same Accounts, unless some of their names weren't
+// canonical AccountPaths. Those come back named by the canonical text of their single segment.
+func (accs Accounts) Tree() *AccountTree {
+	root := &AccountTree{}
+	for name, balance := range accs {
+		current := root
+		for _, segment := range accountPathOf(name) {
+			if current.Children == nil {
+				current.Children = make(map[string]*AccountTree)
+			}
+			next, ok := current.Children[segment]
+			if !ok {
+				next = &AccountTree{}
+				current.Children[segment] = next
+			}
+			current = next
+		}
+
+		if balance == nil {
+			balance = Balance{}
+		}
+		current.Balance = balance
+	}
+	return root
+}
+
+// RecursiveBalance finds the total balance of the Account at path, and every Account grouped beneath it. The empty
+// AccountPath totals every Account.
+func (accs Accounts) RecursiveBalance(path AccountPath) Balance {
+	sum := make(Balance)
+	for name, balance := range accs {
+		if path.Contains(accountPathOf(name)) {
+			sum = sum.Add(balance)
+		}
+	}
+	return sum
+}
+
+// MoveAccounts renames the Account at one AccountPath, along with every Account grouped beneath it, so that they are
+// found at another. If any of the new names is already in use, nothing is changed and an error is returned.
+func (accs Accounts) MoveAccounts(from, to AccountPath) error {
+	if len(from) == 0 || len(to) == 0 {
+		return fmt.Errorf("accounts can't be moved to or from the top of the hierarchy")
+	}
+	if from.Contains(to) {
+		return fmt.Errorf("%s can't be moved inside of itself", from)
+	}
+
+	renames := make(map[string]string)
+	for name := range accs {
+		path := accountPathOf(name)
+		if !from.Contains(path) {
+			continue
+		}
+
+		moved := make(AccountPath, 0, len(to)+len(path)-len(from))
+		moved = append(moved, to...)
+		moved = append(moved, path[len(from):]...)
+		renames[name] = moved.String()
+	}
+
+	if len(renames) == 0 {
+		return fmt.Errorf("no accounts found at %s", from)
+	}
+
+	for _, updated := range renames {
+		if _, movingAway := renames[updated]; accs.HasAccount(updated) && !movingAway {
+			return fmt.Errorf("an account named %q already exists", updated)
+		}
+	}
+
+	moved := make(Accounts, len(renames))
+	for original, updated := range renames {
+		moved[updated] = accs[original]
+		delete(accs, original)
+	}
+	for name, balance := range moved {
+		accs[name] = balance
+	}
+	return nil
+}
+
+// MoveAccounts behaves like Accounts.MoveAccounts, but also moves the AccountDetails of each Account that is renamed.
+func (s State) MoveAccounts(from, to AccountPath) error {
+	before := s.Accounts.Names()
+	err := s.Accounts.MoveAccounts(from, to)
+	if err != nil {
+		return err
+	}
+
+	moved := make(AccountMetadata)
+	for _, name := range before {
+		path := accountPathOf(name)
+		details, ok := s.Metadata[name]
+		if !ok || !from.Contains(path) {
+			continue
+		}
+
+		updated := make(AccountPath, 0, len(to)+len(path)-len(from))
+		updated = append(updated, to...)
+		updated = append(updated, path[len(from):]...)
+		moved[updated.String()] = details
+		delete(s.Metadata, name)
+	}
+	for name, details := range moved {
+		s.Metadata[name] = details
+	}
+	return nil
+}
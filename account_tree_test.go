@@ -0,0 +1,182 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func ExampleAccounts_RecursiveBalance() {
+	subject := envelopes.Accounts{
+		"Bank A/checking": {"USD": big.NewRat(1587, 100)},
+		"Bank A/savings":  {"USD": big.NewRat(500, 1)},
+		"cash":            {"USD": big.NewRat(20, 1)},
+	}
+
+	fmt.Println(subject.RecursiveBalance(envelopes.AccountPath{"Bank A"}))
+	fmt.Println(subject.RecursiveBalance(envelopes.AccountPath{}))
+	// Output:
+	// USD 515.87
+	// USD 535.87
+}
+
+func TestParseAccountPath(t *testing.T) {
+	testCases := []struct {
+		text string
+		want envelopes.AccountPath
+	}{
+		{"checking", envelopes.AccountPath{"checking"}},
+		{"Bank A/checking", envelopes.AccountPath{"Bank A", "checking"}},
+		{`Bank A/checking\/savings`, envelopes.AccountPath{"Bank A", "checking/savings"}},
+	}
+
+	for _, tc := range testCases {
+		got, err := envelopes.ParseAccountPath(tc.text)
+		if err != nil {
+			t.Errorf("%q: %v", tc.text, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%q: got %#v want %#v", tc.text, got, tc.want)
+		}
+		if got.String() != tc.text {
+			t.Errorf("%q: got %q when written back out", tc.text, got.String())
+		}
+	}
+
+	for _, text := range []string{"", "/checking", "Bank A//checking", `odd\name`, "checking/"} {
+		if _, err := envelopes.ParseAccountPath(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestAccounts_Tree(t *testing.T) {
+	subject := envelopes.Accounts{
+		"Bank A":          {"USD": big.NewRat(1, 1)},
+		"Bank A/checking": {"USD": big.NewRat(1587, 100)},
+		"Bank B/savings":  {"USD": big.NewRat(500, 1)},
+		`odd\name`:        {"USD": big.NewRat(2, 1)},
+	}
+
+	tree := subject.Tree()
+	if tree.Balance != nil {
+		t.Errorf("the root of the tree should not have a balance")
+	}
+	if got, want := fmt.Sprint(tree.ChildNames()), `[Bank A Bank B odd\name]`; got != want {
+		t.Errorf("got children %s want %s", got, want)
+	}
+	if tree.Children["Bank B"].Balance != nil {
+		t.Errorf("Bank B only groups other accounts, and should not have a balance")
+	}
+	if got, want := tree.Children["Bank A"].RecursiveBalance().String(), "USD 16.87"; got != want {
+		t.Errorf("got recursive balance %s want %s", got, want)
+	}
+
+	flattened := tree.Accounts()
+	if !flattened.HasAccount(`odd\\name`) || flattened.HasAccount(`odd\name`) {
+		t.Errorf("names that aren't canonical should come back in their canonical form: %v", flattened.Names())
+	}
+	delete(flattened, `odd\\name`)
+	delete(subject, `odd\name`)
+	if !flattened.ID().Equal(subject.ID()) {
+		t.Errorf("got %v want %v", flattened, subject)
+	}
+}
+
+func TestAccounts_MoveAccounts(t *testing.T) {
+	newSubject := func() envelopes.Accounts {
+		return envelopes.Accounts{
+			"Bank A/checking": {"USD": big.NewRat(1587, 100)},
+			"Bank A/savings":  {"USD": big.NewRat(500, 1)},
+			"Bank B":          {},
+			"cash":            {"USD": big.NewRat(20, 1)},
+		}
+	}
+
+	subject := newSubject()
+	if err := subject.MoveAccounts(envelopes.AccountPath{"Bank A"}, envelopes.AccountPath{"Bank B", "old"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Bank B/old/checking", "Bank B/old/savings", "Bank B", "cash"} {
+		if !subject.HasAccount(name) {
+			t.Errorf("expected to find %q", name)
+		}
+	}
+	if len(subject) != 4 {
+		t.Errorf("got %d accounts want 4: %v", len(subject), subject.Names())
+	}
+
+	failures := []struct {
+		from, to envelopes.AccountPath
+	}{
+		{envelopes.AccountPath{"Bank A", "checking"}, envelopes.AccountPath{"cash"}},
+		{envelopes.AccountPath{"Bank A"}, envelopes.AccountPath{"Bank A", "inner"}},
+		{envelopes.AccountPath{"Bank C"}, envelopes.AccountPath{"Bank D"}},
+		{envelopes.AccountPath{}, envelopes.AccountPath{"Bank D"}},
+	}
+	for _, tc := range failures {
+		subject = newSubject()
+		before := subject.ID()
+		if err := subject.MoveAccounts(tc.from, tc.to); err == nil {
+			t.Errorf("moving %s to %s: expected an error", tc.from, tc.to)
+		}
+		if !subject.ID().Equal(before) {
+			t.Errorf("moving %s to %s: accounts should not have changed", tc.from, tc.to)
+		}
+	}
+
+	// Swapping places through a name that's being moved away is allowed.
+	subject = envelopes.Accounts{
+		"a/a": {"USD": big.NewRat(1, 1)},
+		"a":   {"USD": big.NewRat(2, 1)},
+	}
+	if err := subject.MoveAccounts(envelopes.AccountPath{"a"}, envelopes.AccountPath{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if !subject.HasAccount("b") || !subject.HasAccount("b/a") || len(subject) != 2 {
+		t.Errorf("unexpected accounts after move: %v", subject.Names())
+	}
+}
+
+func TestState_MoveAccounts(t *testing.T) {
+	subject := envelopes.State{
+		Accounts: envelopes.Accounts{
+			"Bank A/credit": {"USD": big.NewRat(-40, 1)},
+			"cash":          {"USD": big.NewRat(20, 1)},
+		},
+		Metadata: envelopes.AccountMetadata{
+			"Bank A/credit": {Class: envelopes.LiabilityAccount},
+			"cash":          {Subtype: envelopes.CashAccount},
+		},
+	}
+
+	if err := subject.MoveAccounts(envelopes.AccountPath{"Bank A"}, envelopes.AccountPath{"Bank B"}); err != nil {
+		t.Fatal(err)
+	}
+	if !subject.Metadata["Bank B/credit"].IsLiability() {
+		t.Errorf("metadata should have moved along with its account")
+	}
+	if _, ok := subject.Metadata["Bank A/credit"]; ok {
+		t.Errorf("metadata should not remain at the old name")
+	}
+	if subject.Metadata["cash"].Subtype != envelopes.CashAccount {
+		t.Errorf("metadata of accounts that weren't moved should be left alone")
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// AssetKind describes what sort of thing an AssetType counts.
+type AssetKind uint8
+
+// These are the values that an AssetKind can have.
+const (
+	// UnknownAsset is the zero value, used for asset types that haven't been described.
+	UnknownAsset AssetKind = iota
+
+	// CurrencyAsset is money, like United States Dollars or Euros.
+	CurrencyAsset
+
+	// SecurityAsset is something that is traded, like shares of stock or a mutual fund.
+	SecurityAsset
+)
+
+var assetKindNames = [...]string{
+	UnknownAsset:  "unknown",
+	CurrencyAsset: "currency",
+	SecurityAsset: "security",
+}
+
+func (k AssetKind) String() string {
+	if int(k) < len(assetKindNames) {
+		return assetKindNames[k]
+	}
+	return fmt.Sprintf("AssetKind(%d)", uint8(k))
+}
+
+// AssetInfo describes an AssetType.
+type AssetInfo struct {
+	// Kind is whether the asset is a currency or a security.
+	Kind AssetKind
+
+	// MinorUnits is the number of decimal places in the smallest amount of the asset that can change hands. For
+	// currencies, this is the number given by ISO 4217, like 2 for cents or 0 for Japanese Yen.
+	MinorUnits int
+
+	// Symbol is how the asset is written when it isn't spelled out, like "$" or "€". It may be empty.
+	Symbol string
+
+	// Precision is the fewest decimal places used to display amounts of the asset.
+	Precision int
+}
+
+// AssetRegistry keeps track of the AssetInfo that describes each AssetType, and which AssetType amounts without a label
+// are assumed to be. It is safe for concurrent use.
+//
+// The zero value of AssetRegistry is ready to use. It knows about no asset types, and uses DefaultAsset as its default.
+type AssetRegistry struct {
+	lock         sync.RWMutex
+	assets       map[AssetType]AssetInfo
+	defaultAsset AssetType
+}
+
+const (
+	// unregisteredPrecision is the fewest decimal places used to display asset types that haven't been registered.
+	unregisteredPrecision = 3
+
+	// maxDisplayPrecision is the most decimal places that will be used to display an amount exactly. Amounts that need
+	// more than this are rounded to the Precision of their asset type instead.
+	maxDisplayPrecision = 8
+)
+
+// Assets is the AssetRegistry consulted by Balance.String, ParseBalance and ParseBalanceWithDefault. It starts out
+// knowing about common ISO 4217 currencies. Securities vary too much from one person to the next to be built in, so they
+// should be registered by whoever knows about them.
+var Assets = NewAssetRegistry(DefaultAsset)
+
+func init() {
+	// Symbols that are made entirely of letters, like "kr" or "Rp", are left out so that they can't be mistaken for the
+	// ticker symbol of a security while parsing.
+	currencies := []struct {
+		AssetType
+		minorUnits int
+		symbol     string
+	}{
+		{"AED", 2, ""},
+		{"ARS", 2, ""},
+		{"AUD", 2, "A$"},
+		{"BHD", 3, ""},
+		{"BRL", 2, "R$"},
+		{"CAD", 2, "CA$"},
+		{"CHF", 2, ""},
+		{"CLP", 0, ""},
+		{"CNY", 2, "CN¥"},
+		{"COP", 2, ""},
+		{"CZK", 2, ""},
+		{"DKK", 2, ""},
+		{"EGP", 2, ""},
+		{"EUR", 2, "€"},
+		{"GBP", 2, "£"},
+		{"HKD", 2, "HK$"},
+		{"HUF", 2, ""},
+		{"IDR", 2, ""},
+		{"ILS", 2, "₪"},
+		{"INR", 2, "₹"},
+		{"IQD", 3, ""},
+		{"ISK", 0, ""},
+		{"JOD", 3, ""},
+		{"JPY", 0, "¥"},
+		{"KRW", 0, "₩"},
+		{"KWD", 3, ""},
+		{"LYD", 3, ""},
+		{"MXN", 2, "MX$"},
+		{"MYR", 2, ""},
+		{"NGN", 2, "₦"},
+		{"NOK", 2, ""},
+		{"NZD", 2, "NZ$"},
+		{"OMR", 3, ""},
+		{"PHP", 2, "₱"},
+		{"PKR", 2, ""},
+		{"PLN", 2, "zł"},
+		{"RUB", 2, "₽"},
+		{"SAR", 2, ""},
+		{"SEK", 2, ""},
+		{"SGD", 2, "S$"},
+		{"THB", 2, "฿"},
+		{"TND", 3, ""},
+		{"TRY", 2, "₺"},
+		{"TWD", 2, "NT$"},
+		{"UAH", 2, "₴"},
+		{"USD", 2, "$"},
+		{"VND", 0, "₫"},
+		{"ZAR", 2, ""},
+	}
+
+	for _, currency := range currencies {
+		Assets.Register(currency.AssetType, AssetInfo{
+			Kind:       CurrencyAsset,
+			MinorUnits: currency.minorUnits,
+			Symbol:     currency.symbol,
+			Precision:  currency.minorUnits,
+		})
+	}
+}
+
+// NewAssetRegistry creates an AssetRegistry that knows about no asset types, and that treats amounts without a label
+// as defaultAsset.
+func NewAssetRegistry(defaultAsset AssetType) *AssetRegistry {
+	return &AssetRegistry{
+		assets:       make(map[AssetType]AssetInfo),
+		defaultAsset: defaultAsset,
+	}
+}
+
+// Register describes an AssetType, replacing any AssetInfo that was previously registered for it.
+func (r *AssetRegistry) Register(asset AssetType, info AssetInfo) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.assets == nil {
+		r.assets = make(map[AssetType]AssetInfo)
+	}
+	r.assets[asset] = info
+}
+
+// Lookup finds the AssetInfo that was registered for an AssetType. If none was, false is returned.
+func (r *AssetRegistry) Lookup(asset AssetType) (AssetInfo, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	info, ok := r.assets[asset]
+	return info, ok
+}
+
+// BySymbol finds the AssetType that was registered with a particular Symbol. If none was, or more than one was, false
+// is returned.
+func (r *AssetRegistry) BySymbol(symbol string) (AssetType, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if symbol == "" {
+		return "", false
+	}
+
+	var retval AssetType
+	found := false
+	for asset, info := range r.assets {
+		if info.Symbol != symbol {
+			continue
+		}
+		if found {
+			return "", false
+		}
+		retval = asset
+		found = true
+	}
+	return retval, found
+}
+
+// Default fetches the AssetType that amounts without a label are assumed to be.
+func (r *AssetRegistry) Default() AssetType {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.defaultAsset == "" {
+		return DefaultAsset
+	}
+	return r.defaultAsset
+}
+
+// SetDefault changes the AssetType that amounts without a label are assumed to be.
+func (r *AssetRegistry) SetDefault(asset AssetType) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.defaultAsset = asset
+}
+
+// FormatBalance writes a Balance so that it can be shown to people, and read back in by ParseBalance. Each magnitude is
+// written with the Precision registered for its AssetType, or three decimal places if none was registered. When more
+// places than that are needed to write a magnitude exactly, up to eight are used. An empty Balance is written as zero
+// of the default AssetType.
+func (r *AssetRegistry) FormatBalance(b Balance) string {
+	defaultAsset := r.Default()
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	defaultResult := fmt.Sprintf("%s %s", defaultAsset, r.formatMagnitude(defaultAsset, &big.Rat{}))
+	return b.format(defaultResult, r.formatMagnitude)
+}
+
+// formatMagnitude writes an amount of a single AssetType. The caller must hold r.lock.
+func (r *AssetRegistry) formatMagnitude(asset AssetType, magnitude *big.Rat) string {
+	places := unregisteredPrecision
+	if info, ok := r.assets[asset]; ok {
+		places = info.Precision
+	}
+
+	if exact, ok := DecimalPlaces(magnitude); ok && exact > places && exact <= maxDisplayPrecision {
+		places = exact
+	}
+	return magnitude.FloatString(places)
+}
+
+// Round creates a copy of a Balance, where the magnitude of each registered AssetType has been rounded to its
+// MinorUnits, with halves rounded away from zero. Magnitudes of asset types that haven't been registered are copied as
+// they are.
+func (r *AssetRegistry) Round(b Balance) Balance {
+	return r.quantize(b, roundRat)
+}
+
+// Truncate creates a copy of a Balance, where the magnitude of each registered AssetType has been rounded toward zero
+// to its MinorUnits. Unlike Round, the result never has a larger magnitude than b, so it is suitable for splitting a
+// Balance into portions that mustn't add up to more than the whole. Magnitudes of asset types that haven't been
+// registered are copied as they are.
+func (r *AssetRegistry) Truncate(b Balance) Balance {
+	return r.quantize(b, truncateRat)
+}
+
+// quantize applies rounder to the magnitude of each registered AssetType in b, with the MinorUnits of that AssetType.
+func (r *AssetRegistry) quantize(b Balance, rounder func(*big.Rat, int) *big.Rat) Balance {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	retval := make(Balance, len(b))
+	for asset, magnitude := range b {
+		if info, ok := r.assets[asset]; ok {
+			retval[asset] = rounder(magnitude, info.MinorUnits)
+		} else {
+			retval[asset] = new(big.Rat).Set(magnitude)
+		}
+	}
+	return retval
+}
+
+// roundRat finds the closest multiple of 10^-places to x, rounding halves away from zero.
+func roundRat(x *big.Rat, places int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+
+	quotient, remainder := new(big.Int), new(big.Int)
+	quotient.QuoRem(new(big.Int).Mul(x.Num(), scale), x.Denom(), remainder)
+
+	remainder.Abs(remainder).Lsh(remainder, 1)
+	if remainder.Cmp(x.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(x.Sign())))
+	}
+
+	return new(big.Rat).SetFrac(quotient, scale)
+}
+
+// truncateRat finds the multiple of 10^-places that is closest to x without being further from zero than x is.
+func truncateRat(x *big.Rat, places int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	quotient := new(big.Int).Quo(new(big.Int).Mul(x.Num(), scale), x.Denom())
+	return new(big.Rat).SetFrac(quotient, scale)
+}
+
+// DecimalPlaces finds how many decimal places are needed to write x exactly. If x can't be written as a terminating
+// decimal, like one third, false is returned.
+func DecimalPlaces(x *big.Rat) (int, bool) {
+	// A fraction in lowest terms can be written as a terminating decimal when its denominator has no prime factors other
+	// than two and five. The number of places needed is the larger of the two exponents.
+	denominator := new(big.Int).Set(x.Denom())
+	places := 0
+	for _, factor := range []int64{2, 5} {
+		divisor := big.NewInt(factor)
+		quotient, remainder := new(big.Int), new(big.Int)
+		exponent := 0
+		for {
+			quotient.QuoRem(denominator, divisor, remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			denominator.Set(quotient)
+			exponent++
+		}
+		if exponent > places {
+			places = exponent
+		}
+	}
+
+	return places, denominator.Cmp(big.NewInt(1)) == 0
+}
@@ -0,0 +1,137 @@
+package envelopes_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func ExampleAssetRegistry_Register() {
+	envelopes.Assets.Register("VTSAX", envelopes.AssetInfo{
+		Kind:       envelopes.SecurityAsset,
+		MinorUnits: 3,
+		Precision:  3,
+	})
+
+	fmt.Println(envelopes.Balance{"VTSAX": big.NewRat(10, 1)})
+	fmt.Println(envelopes.Balance{"JPY": big.NewRat(1200, 1)})
+	// Output:
+	// VTSAX 10.000
+	// JPY 1200
+}
+
+func TestAssetRegistry_BySymbol(t *testing.T) {
+	var subject envelopes.AssetRegistry
+	subject.Register("USD", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Symbol: "$", Precision: 2})
+	subject.Register("SEK", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Symbol: "kr", Precision: 2})
+	subject.Register("NOK", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Symbol: "kr", Precision: 2})
+	subject.Register("MSFT", envelopes.AssetInfo{Kind: envelopes.SecurityAsset, MinorUnits: 6, Precision: 3})
+
+	testCases := []struct {
+		symbol   string
+		expected envelopes.AssetType
+		found    bool
+	}{
+		{"$", "USD", true},
+		{"kr", "", false},
+		{"€", "", false},
+		{"", "", false},
+	}
+
+	for _, tc := range testCases {
+		got, found := subject.BySymbol(tc.symbol)
+		if got != tc.expected || found != tc.found {
+			t.Errorf("%q: got (%q, %v) want (%q, %v)", tc.symbol, got, found, tc.expected, tc.found)
+		}
+	}
+}
+
+func TestAssetRegistry_Default(t *testing.T) {
+	var subject envelopes.AssetRegistry
+	if got := subject.Default(); got != envelopes.DefaultAsset {
+		t.Errorf("got %q want %q", got, envelopes.DefaultAsset)
+	}
+	if got, want := subject.FormatBalance(envelopes.Balance{}), "USD 0.000"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	subject.SetDefault("EUR")
+	subject.Register("EUR", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Symbol: "€", Precision: 2})
+	if got, want := subject.FormatBalance(envelopes.Balance{}), "EUR 0.00"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestAssetRegistry_Round(t *testing.T) {
+	var subject envelopes.AssetRegistry
+	subject.Register("USD", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Precision: 2})
+	subject.Register("JPY", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 0, Precision: 0})
+
+	testCases := []struct {
+		envelopes.Balance
+		expected envelopes.Balance
+	}{
+		{envelopes.Balance{"USD": big.NewRat(1, 3)}, envelopes.Balance{"USD": big.NewRat(33, 100)}},
+		{envelopes.Balance{"USD": big.NewRat(2, 3)}, envelopes.Balance{"USD": big.NewRat(67, 100)}},
+		{envelopes.Balance{"USD": big.NewRat(5, 1000)}, envelopes.Balance{"USD": big.NewRat(1, 100)}},
+		{envelopes.Balance{"USD": big.NewRat(-5, 1000)}, envelopes.Balance{"USD": big.NewRat(-1, 100)}},
+		{envelopes.Balance{"JPY": big.NewRat(2401, 2)}, envelopes.Balance{"JPY": big.NewRat(1201, 1)}},
+		{envelopes.Balance{"MSFT": big.NewRat(1, 3)}, envelopes.Balance{"MSFT": big.NewRat(1, 3)}},
+	}
+
+	for _, tc := range testCases {
+		if got := subject.Round(tc.Balance); !got.Equal(tc.expected) {
+			t.Errorf("%v: got %v want %v", tc.Balance, got, tc.expected)
+		}
+	}
+}
+
+func TestAssetRegistry_Truncate(t *testing.T) {
+	var subject envelopes.AssetRegistry
+	subject.Register("USD", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 2, Precision: 2})
+	subject.Register("JPY", envelopes.AssetInfo{Kind: envelopes.CurrencyAsset, MinorUnits: 0, Precision: 0})
+
+	testCases := []struct {
+		envelopes.Balance
+		expected envelopes.Balance
+	}{
+		{envelopes.Balance{"USD": big.NewRat(2, 3)}, envelopes.Balance{"USD": big.NewRat(66, 100)}},
+		{envelopes.Balance{"USD": big.NewRat(-2, 3)}, envelopes.Balance{"USD": big.NewRat(-66, 100)}},
+		{envelopes.Balance{"USD": big.NewRat(5, 1000)}, envelopes.Balance{"USD": big.NewRat(0, 1)}},
+		{envelopes.Balance{"USD": big.NewRat(125, 100)}, envelopes.Balance{"USD": big.NewRat(125, 100)}},
+		{envelopes.Balance{"JPY": big.NewRat(2401, 2)}, envelopes.Balance{"JPY": big.NewRat(1200, 1)}},
+		{envelopes.Balance{"MSFT": big.NewRat(1, 3)}, envelopes.Balance{"MSFT": big.NewRat(1, 3)}},
+	}
+
+	for _, tc := range testCases {
+		if got := subject.Truncate(tc.Balance); !got.Equal(tc.expected) {
+			t.Errorf("%v: got %v want %v", tc.Balance, got, tc.expected)
+		}
+	}
+}
+
+func TestDecimalPlaces(t *testing.T) {
+	testCases := []struct {
+		*big.Rat
+		places int
+		ok     bool
+	}{
+		{big.NewRat(0, 1), 0, true},
+		{big.NewRat(12, 1), 0, true},
+		{big.NewRat(1, 2), 1, true},
+		{big.NewRat(-1, 8), 3, true},
+		{big.NewRat(191477, 100), 2, true},
+		{big.NewRat(1, 1000000000), 9, true},
+		{big.NewRat(1, 3), 0, false},
+		{big.NewRat(1, 30), 0, false},
+	}
+
+	for _, tc := range testCases {
+		places, ok := envelopes.DecimalPlaces(tc.Rat)
+		if ok != tc.ok || (ok && places != tc.places) {
+			t.Errorf("%s: got (%d, %v) want (%d, %v)", tc.Rat, places, ok, tc.places, tc.ok)
+		}
+	}
+}
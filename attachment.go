@@ -0,0 +1,64 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"crypto/sha1"
+	"fmt"
+)
+
+// Blob holds the contents of a file, like a scanned receipt or a bank statement, so that it can be kept alongside the
+// Transactions it documents.
+type Blob []byte
+
+// ID fetches a SHA1 hash of this Blob that will uniquely identify it. The contents are prefixed with a header naming
+// them as a Blob, so that a Blob never shares an ID with another kind of object, even if its contents happen to match
+// that object's MarshalText.
+func (b Blob) ID() ID {
+	hasher := sha1.New()
+	fmt.Fprintf(hasher, "blob %d\x00", len(b))
+	hasher.Write(b)
+
+	var retval ID
+	copy(retval[:], hasher.Sum(nil))
+	return retval
+}
+
+// Attachment refers to a Blob that documents a Transaction.
+type Attachment struct {
+	// Blob is the ID of the Blob holding the contents of the attachment.
+	Blob ID
+
+	// Filename is the name the attachment had when it was added, like "receipt.pdf".
+	Filename string
+
+	// MediaType describes the format of the contents, like "application/pdf" or "image/jpeg".
+	MediaType string
+}
+
+// MarshalText creates a deterministic string that uniquely represents this Attachment.
+func (a Attachment) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("blob %s filename %q media type %q", a.Blob, a.Filename, a.MediaType)), nil
+}
+
+// NewAttachment creates an Attachment that refers to contents. The Blob still needs to be written to a repository
+// separately.
+func NewAttachment(contents Blob, filename, mediaType string) Attachment {
+	return Attachment{
+		Blob:      contents.ID(),
+		Filename:  filename,
+		MediaType: mediaType,
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestBlob_ID(t *testing.T) {
+	// This is the ID git gives a blob holding "hello world\n", which makes it easy to check by hand with
+	// `git hash-object`.
+	const want = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+	if got := envelopes.Blob("hello world\n").ID().String(); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	comment := envelopes.Transaction{Comment: "hello world"}
+	marshaled, err := comment.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelopes.Blob(marshaled).ID().Equal(comment.ID()) {
+		t.Errorf("a Blob should not share an ID with the object its contents were marshaled from")
+	}
+}
+
+func TestTransaction_Attachments(t *testing.T) {
+	plain := envelopes.Transaction{Comment: "Dinner"}
+	attached := plain.DeepCopy()
+	attached.Attachments = []envelopes.Attachment{
+		envelopes.NewAttachment(envelopes.Blob("receipt"), "receipt.jpg", "image/jpeg"),
+	}
+
+	if attached.ID().Equal(plain.ID()) {
+		t.Errorf("Attachments should participate in a Transaction's ID")
+	}
+	if attached.Equal(plain) {
+		t.Errorf("Transactions with different Attachments should not be Equal")
+	}
+
+	renamed := attached.DeepCopy()
+	renamed.Attachments[0].Filename = "dinner.jpg"
+	if attached.Attachments[0].Filename != "receipt.jpg" {
+		t.Errorf("DeepCopy should not share Attachments with the original")
+	}
+	if renamed.ID().Equal(attached.ID()) {
+		t.Errorf("an Attachment's Filename should participate in a Transaction's ID")
+	}
+}
@@ -29,7 +29,8 @@ import (
 type AssetType string
 
 const (
-	// DefaultAsset is the label that will be used when parsing a balance given as just a number i.e. with no label.
+	// DefaultAsset is the label that will be used when parsing a balance given as just a number i.e. with no label, unless
+	// a different default is chosen with AssetRegistry.SetDefault.
 	DefaultAsset AssetType = "USD"
 )
 
@@ -191,23 +192,45 @@ func (b Balance) Normalize(rates Exchange) (*big.Rat, error) {
 	return sum, nil
 }
 
+// DeepCopy creates a duplicate Balance that can be modified without fear of modifying the original.
 func (b Balance) DeepCopy() Balance {
 	retval := make(Balance, len(b))
 
 	for k, v := range b {
-		retval[k] = v
+		retval[k] = new(big.Rat).Set(v)
 	}
 
 	return retval
 }
 
+// String writes a Balance the way it should be shown to people, using the precision that Assets has registered for each
+// asset type. The result can be read back in by ParseBalance.
 func (b Balance) String() string {
+	return Assets.FormatBalance(b)
+}
+
+// identity writes a Balance the way it is written into the IDs of Accounts, Budgets and Transactions. Every asset type
+// gets three decimal places, no matter what precision it is displayed with, so that IDs don't depend on the contents of
+// an AssetRegistry.
+func (b Balance) identity() string {
+	// In the default case, where balance is zero because there are no assets, we want to continue keeping the same IDs
+	// that were previously generated. Because previously a zero balance specifically meant that there were zero USD, to
+	// preserve the existing persist package's behavior without any breaking changes, we must assume the value
+	// "USD 0.00" here.
 	const defaultResult = "USD 0.00"
 	const precision = 3
 
+	return b.format(defaultResult, func(_ AssetType, magnitude *big.Rat) string {
+		return magnitude.FloatString(precision)
+	})
+}
+
+// format writes each asset type in a Balance next to its magnitude, as written by formatMagnitude. If there are no
+// asset types with a magnitude worth writing, defaultResult is returned instead.
+func (b Balance) format(defaultResult string, formatMagnitude func(AssetType, *big.Rat) string) string {
 	if len(b) == 1 { // When there's only a single asset type - we don't want to pare or deal with extra allocations.
 		for k := range b {
-			return fmt.Sprintf("%s %s", k, b[k].FloatString(precision))
+			return fmt.Sprintf("%s %s", k, formatMagnitude(k, b[k]))
 		}
 	} else if len(b) > 1 { // When there are multiple asset types, we want to remove unnecessary components
 		b.pare()
@@ -227,17 +250,14 @@ func (b Balance) String() string {
 		buf := &bytes.Buffer{}
 
 		for i := range keys {
-			fmt.Fprintf(buf, "%s %s:", keys[i], b[AssetType(keys[i])].FloatString(precision))
+			asset := AssetType(keys[i])
+			fmt.Fprintf(buf, "%s %s:", asset, formatMagnitude(asset, b[asset]))
 		}
 
 		buf.Truncate(buf.Len() - 1)
 		return buf.String()
 	}
 
-	// In the default case, where balance is zero because there are no assets, we want to continue keeping the same IDs
-	// that were previously generated. Because previously a zero balance specifically meant that there were zero USD, to
-	// preserve the existing persist package's behavior without any breaking changes, we must assume the value
-	// "USD 0.00" here.
 	return defaultResult
 }
 
@@ -246,7 +266,8 @@ var (
 )
 
 // ParseBalanceWithDefault extracts information about a balance from text. Any line items that do not have a label are
-// treated as the specified default asset type.
+// treated as the specified default asset type. Labels that aren't registered in Assets, but are the display symbol of
+// exactly one asset type that is, like "$" or "€", are treated as that asset type.
 // Lines with the same asset type are summed together.
 func ParseBalanceWithDefault(raw []byte, def AssetType) (Balance, error) {
 	var created Balance
@@ -277,6 +298,10 @@ func ParseBalanceWithDefault(raw []byte, def AssetType) (Balance, error) {
 
 			if id == "" {
 				id = def
+			} else if _, ok := Assets.Lookup(id); !ok {
+				if symbolized, ok := Assets.BySymbol(string(id)); ok {
+					id = symbolized
+				}
 			}
 
 			if created == nil {
@@ -301,9 +326,9 @@ func ParseBalanceWithDefault(raw []byte, def AssetType) (Balance, error) {
 }
 
 // ParseBalance converts between a string representation of an amount of dollars
-// into an int64 number of cents.
+// into an int64 number of cents. Any line items that do not have a label are treated as the default asset type of Assets.
 func ParseBalance(raw []byte) (result Balance, err error) {
-	return ParseBalanceWithDefault(raw, DefaultAsset)
+	return ParseBalanceWithDefault(raw, Assets.Default())
 }
 
 // pare removes components of a balance that are inconsequential - i.e. magnitude of zero.
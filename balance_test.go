@@ -11,13 +11,13 @@ import (
 func ExampleParseBalance() {
 	fmt.Println(envelopes.ParseBalance([]byte("USD 99.88")))
 	// Output:
-	// USD 99.880 <nil>
+	// USD 99.88 <nil>
 }
 
 func ExampleBalance_String() {
 	fmt.Println(envelopes.Balance{"USD": big.NewRat(9999, 100)})
 	// Output:
-	// USD 99.990
+	// USD 99.99
 }
 
 func ExampleBalance_Equal() {
@@ -76,7 +76,7 @@ func ExampleBalance_Scale() {
 	subject = subject.Scale(.5)
 	fmt.Println(subject)
 	// Output:
-	// USD 50.000
+	// USD 50.00
 }
 
 func TestBalance_String(t *testing.T) {
@@ -85,10 +85,10 @@ func TestBalance_String(t *testing.T) {
 		envelopes.Balance
 		expected string
 	}{
-		{envelopes.Balance{"USD": zero}, "USD 0.000"},
-		{envelopes.Balance{"USD": big.NewRat(1, 100)}, "USD 0.010"},
-		{envelopes.Balance{"USD": big.NewRat(-1, 100)}, "USD -0.010"},
-		{envelopes.Balance{"USD": big.NewRat(1000, 1)}, "USD 1000.000"},
+		{envelopes.Balance{"USD": zero}, "USD 0.00"},
+		{envelopes.Balance{"USD": big.NewRat(1, 100)}, "USD 0.01"},
+		{envelopes.Balance{"USD": big.NewRat(-1, 100)}, "USD -0.01"},
+		{envelopes.Balance{"USD": big.NewRat(1000, 1)}, "USD 1000.00"},
 		{
 			envelopes.Balance{
 				"FZROX": zero,
@@ -100,6 +100,11 @@ func TestBalance_String(t *testing.T) {
 		},
 		{envelopes.Balance{}, "USD 0.00"},
 		{envelopes.Balance{"MSFT": zero}, "MSFT 0.000"},
+		{envelopes.Balance{"MSFT": big.NewRat(123456, 10000)}, "MSFT 12.3456"},
+		{envelopes.Balance{"JPY": big.NewRat(1200, 1)}, "JPY 1200"},
+		{envelopes.Balance{"USD": big.NewRat(5, 1000)}, "USD 0.005"},
+		{envelopes.Balance{"USD": big.NewRat(1, 3)}, "USD 0.33"},
+		{envelopes.Balance{"BHD": big.NewRat(1, 2)}, "BHD 0.500"},
 	}
 
 	for _, tc := range testCases {
@@ -163,6 +168,9 @@ func testParseBalance_scalar(t *testing.T) {
 		{" USD 10.98\n", envelopes.Balance{"USD": big.NewRat(1098, 100)}},
 		{"USD 10.98\n", envelopes.Balance{"USD": big.NewRat(1098, 100)}},
 		{"FZROX 590.319", envelopes.Balance{"FZROX": big.NewRat(590319, 1000)}},
+		{"$12.50", envelopes.Balance{"USD": big.NewRat(1250, 100)}},
+		{"€ 3", envelopes.Balance{"EUR": big.NewRat(3, 1)}},
+		{"¥1,200", envelopes.Balance{"JPY": big.NewRat(1200, 1)}},
 	}
 
 	for _, tc := range testCases {
@@ -49,7 +49,9 @@ type Budget struct {
 // original without impacting the other.
 func (b Budget) DeepCopy() Budget {
 	var clone Budget
-	clone.Balance = b.Balance
+	if b.Balance != nil {
+		clone.Balance = b.Balance.DeepCopy()
+	}
 	clone.Children = make(map[string]*Budget, len(b.Children))
 
 	for childName, child := range b.Children {
@@ -85,7 +87,7 @@ func (b Budget) MarshalText() ([]byte, error) {
 	identityBuilder.Reset()
 	defer identityBuilders.Put(identityBuilder)
 
-	_, err := fmt.Fprintf(identityBuilder, "balance %s", b.Balance)
+	_, err := fmt.Fprintf(identityBuilder, "balance %s", b.Balance.identity())
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +100,8 @@ func (b Budget) MarshalText() ([]byte, error) {
 		}
 	}
 
-	return identityBuilder.Bytes(), nil
+	// The buffer goes back into the pool as soon as this returns, so the caller needs its own copy.
+	return append([]byte(nil), identityBuilder.Bytes()...), nil
 }
 
 // Equal determines whether or not two instances of Budget share the same balance and
@@ -0,0 +1,284 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	budgetPathSeparator = '/'
+	budgetPathEscape    = '\\'
+)
+
+// BudgetPath identifies a Budget in a tree of Budgets, by listing the name of each Budget that must be visited on the
+// way from the root to it. The root itself is identified by an empty BudgetPath.
+//
+// As text, a BudgetPath is written like a Unix path: "/savings/emergency". Slashes and backslashes inside of names are
+// escaped with a backslash, so the Budget named "cars/trucks" is written "/cars\/trucks". The same text is used on every
+// platform.
+type BudgetPath []string
+
+// ParseBudgetPath reads a BudgetPath that was written by BudgetPath.String. The leading slash is optional, and both ""
+// and "/" identify the root.
+func ParseBudgetPath(text string) (BudgetPath, error) {
+	if len(text) > 0 && text[0] == budgetPathSeparator {
+		text = text[1:]
+	}
+
+	retval := BudgetPath{}
+	if text == "" {
+		return retval, nil
+	}
+
+	var current strings.Builder
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			if c != budgetPathSeparator && c != budgetPathEscape {
+				return nil, fmt.Errorf("%q is not a valid escape sequence in a budget path", string(budgetPathEscape)+string(c))
+			}
+			current.WriteRune(c)
+			escaped = false
+		case c == budgetPathEscape:
+			escaped = true
+		case c == budgetPathSeparator:
+			if current.Len() == 0 {
+				return nil, errors.New("budget paths may not contain empty names")
+			}
+			retval = append(retval, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("budget path ended with an incomplete escape sequence")
+	}
+	if current.Len() == 0 {
+		return nil, errors.New("budget paths may not contain empty names")
+	}
+	return append(retval, current.String()), nil
+}
+
+// String writes a BudgetPath in a form that can be read by ParseBudgetPath.
+func (p BudgetPath) String() string {
+	if len(p) == 0 {
+		return string(budgetPathSeparator)
+	}
+
+	var builder strings.Builder
+	for _, name := range p {
+		builder.WriteRune(budgetPathSeparator)
+		for _, c := range name {
+			if c == budgetPathSeparator || c == budgetPathEscape {
+				builder.WriteRune(budgetPathEscape)
+			}
+			builder.WriteRune(c)
+		}
+	}
+	return builder.String()
+}
+
+// Child creates a new BudgetPath that identifies the child with the given name of the Budget identified by this one.
+func (p BudgetPath) Child(name string) BudgetPath {
+	retval := make(BudgetPath, len(p), len(p)+1)
+	copy(retval, p)
+	return append(retval, name)
+}
+
+// Parent creates a new BudgetPath that identifies the parent of the Budget identified by this one. The root is its own
+// parent.
+func (p BudgetPath) Parent() BudgetPath {
+	if len(p) == 0 {
+		return BudgetPath{}
+	}
+	retval := make(BudgetPath, len(p)-1)
+	copy(retval, p)
+	return retval
+}
+
+// Equal determines whether two BudgetPaths identify the same Budget.
+func (p BudgetPath) Equal(other BudgetPath) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains determines whether the Budget identified by other is the one identified by this BudgetPath, or one of its
+// descendants.
+func (p BudgetPath) Contains(other BudgetPath) bool {
+	return len(other) >= len(p) && p.Equal(other[:len(p)])
+}
+
+// ErrBudgetNotFound indicates that there is no Budget at the path it holds.
+type ErrBudgetNotFound string
+
+func (err ErrBudgetNotFound) Error() string {
+	return fmt.Sprintf("no budget found at %s", string(err))
+}
+
+// ErrBudgetExists indicates that a Budget couldn't be put at the path it holds, because one is already there.
+type ErrBudgetExists string
+
+func (err ErrBudgetExists) Error() string {
+	return fmt.Sprintf("a budget already exists at %s", string(err))
+}
+
+// ErrSkipChildren allows a BudgetWalkFunc to communicate that the children of the Budget it was given shouldn't be
+// visited.
+type ErrSkipChildren struct{}
+
+func (err ErrSkipChildren) Error() string {
+	return "Don't visit the children of this Budget."
+}
+
+// BudgetWalkFunc will be called by Budget.Walk as it encounters each Budget.
+type BudgetWalkFunc func(path BudgetPath, budget *Budget) error
+
+// Get finds the Budget at a path relative to this one. The Budget returned is part of this tree, so modifying it
+// modifies this Budget too.
+func (b *Budget) Get(path BudgetPath) (*Budget, bool) {
+	current := b
+	for _, name := range path {
+		if current == nil {
+			return nil, false
+		}
+		current = current.Children[name]
+	}
+	return current, current != nil
+}
+
+// Create adds an empty Budget at a path relative to this one, including any of its ancestors that are missing. If there
+// is already a Budget at that path, ErrBudgetExists is returned.
+func (b *Budget) Create(path BudgetPath) (*Budget, error) {
+	if _, ok := b.Get(path); ok {
+		return nil, ErrBudgetExists(path.String())
+	}
+
+	created := &Budget{}
+	return created, b.attach(path, created)
+}
+
+// Remove detaches the Budget at a path relative to this one, and returns it. The root can't be removed.
+func (b *Budget) Remove(path BudgetPath) (*Budget, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the root of a budget can't be removed")
+	}
+
+	parent, ok := b.Get(path.Parent())
+	if !ok {
+		return nil, ErrBudgetNotFound(path.String())
+	}
+
+	name := path[len(path)-1]
+	removed, ok := parent.Children[name]
+	if !ok {
+		return nil, ErrBudgetNotFound(path.String())
+	}
+	delete(parent.Children, name)
+	return removed, nil
+}
+
+// Move detaches the Budget at one path relative to this one, along with its children, and attaches it at another. Any
+// ancestors of the destination that are missing are created. If there is already a Budget at the destination,
+// ErrBudgetExists is returned.
+func (b *Budget) Move(from, to BudgetPath) error {
+	if len(from) == 0 {
+		return errors.New("the root of a budget can't be moved")
+	}
+
+	if _, ok := b.Get(from); !ok {
+		return ErrBudgetNotFound(from.String())
+	}
+
+	if from.Contains(to) {
+		return fmt.Errorf("%s can't be moved inside of itself", from)
+	}
+
+	if _, ok := b.Get(to); ok {
+		return ErrBudgetExists(to.String())
+	}
+
+	moved, err := b.Remove(from)
+	if err != nil {
+		return err
+	}
+	return b.attach(to, moved)
+}
+
+// attach puts a Budget at a path relative to this one, creating any of its ancestors that are missing.
+func (b *Budget) attach(path BudgetPath, subject *Budget) error {
+	if len(path) == 0 {
+		return ErrBudgetExists(path.String())
+	}
+
+	current := b
+	for _, name := range path[:len(path)-1] {
+		next, ok := current.Children[name]
+		if !ok {
+			next = &Budget{}
+			if current.Children == nil {
+				current.Children = make(map[string]*Budget)
+			}
+			current.Children[name] = next
+		}
+		current = next
+	}
+
+	if current.Children == nil {
+		current.Children = make(map[string]*Budget)
+	}
+	current.Children[path[len(path)-1]] = subject
+	return nil
+}
+
+// Walk calls action for this Budget, and then each of its descendants, visiting children in alphabetical order. Each
+// Budget is passed along with its path relative to this one. If action returns ErrSkipChildren, the children of that
+// Budget are not visited. Any other error stops the walk, and is returned.
+func (b *Budget) Walk(action BudgetWalkFunc) error {
+	if b == nil {
+		return nil
+	}
+	return b.walk(BudgetPath{}, action)
+}
+
+func (b *Budget) walk(path BudgetPath, action BudgetWalkFunc) error {
+	err := action(path, b)
+	if err != nil {
+		if _, ok := err.(ErrSkipChildren); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, name := range b.ChildNames() {
+		err = b.Children[name].walk(path.Child(name), action)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
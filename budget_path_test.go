@@ -0,0 +1,257 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func ExampleBudget_Walk() {
+	subject := envelopes.Budget{
+		Balance: envelopes.Balance{"USD": big.NewRat(431, 100)},
+		Children: map[string]*envelopes.Budget{
+			"savings": {
+				Balance: envelopes.Balance{"USD": big.NewRat(1296, 100)},
+				Children: map[string]*envelopes.Budget{
+					"cars/trucks": {Balance: envelopes.Balance{"USD": big.NewRat(2, 100)}},
+				},
+			},
+			"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(500, 100)}},
+		},
+	}
+
+	_ = subject.Walk(func(path envelopes.BudgetPath, budget *envelopes.Budget) error {
+		fmt.Println(path, budget.Balance)
+		return nil
+	})
+	// Output:
+	// / USD 4.31
+	// /groceries USD 5.00
+	// /savings USD 12.96
+	// /savings/cars\/trucks USD 0.02
+}
+
+func TestParseBudgetPath(t *testing.T) {
+	testCases := []struct {
+		text      string
+		want      envelopes.BudgetPath
+		canonical string
+	}{
+		{"", envelopes.BudgetPath{}, "/"},
+		{"/", envelopes.BudgetPath{}, "/"},
+		{"savings", envelopes.BudgetPath{"savings"}, "/savings"},
+		{"/savings/emergency", envelopes.BudgetPath{"savings", "emergency"}, "/savings/emergency"},
+		{`/cars\/trucks`, envelopes.BudgetPath{"cars/trucks"}, `/cars\/trucks`},
+		{`/back\\slash/x`, envelopes.BudgetPath{`back\slash`, "x"}, `/back\\slash/x`},
+		{"/with space/ünïcode", envelopes.BudgetPath{"with space", "ünïcode"}, "/with space/ünïcode"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			got, err := envelopes.ParseBudgetPath(tc.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("got: %#v want: %#v", got, tc.want)
+			}
+			if formatted := got.String(); formatted != tc.canonical {
+				t.Errorf("got text: %q want: %q", formatted, tc.canonical)
+			}
+		})
+	}
+}
+
+func TestParseBudgetPath_invalid(t *testing.T) {
+	for _, text := range []string{"//", "/a//b", "/a/", `/a\b`, `/a\`} {
+		t.Run(text, func(t *testing.T) {
+			if got, err := envelopes.ParseBudgetPath(text); err == nil {
+				t.Errorf("expected an error, got: %#v", got)
+			}
+		})
+	}
+}
+
+func TestBudget_Get(t *testing.T) {
+	subject := &envelopes.Budget{
+		Children: map[string]*envelopes.Budget{
+			"savings": {
+				Children: map[string]*envelopes.Budget{
+					"emergency": {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+				},
+			},
+		},
+	}
+
+	if got, ok := subject.Get(envelopes.BudgetPath{}); !ok || got != subject {
+		t.Errorf("the empty path should find the root")
+	}
+
+	got, ok := subject.Get(envelopes.BudgetPath{"savings", "emergency"})
+	if !ok || got != subject.Children["savings"].Children["emergency"] {
+		t.Errorf("did not find /savings/emergency")
+	}
+
+	for _, missing := range []envelopes.BudgetPath{{"checking"}, {"savings", "vacation"}, {"savings", "emergency", "deeper"}} {
+		if _, ok := subject.Get(missing); ok {
+			t.Errorf("unexpectedly found %s", missing)
+		}
+	}
+
+	var nilBudget *envelopes.Budget
+	if _, ok := nilBudget.Get(envelopes.BudgetPath{"anything"}); ok {
+		t.Errorf("a nil budget should not have any children")
+	}
+}
+
+func TestBudget_Create(t *testing.T) {
+	subject := &envelopes.Budget{}
+
+	created, err := subject.Create(envelopes.BudgetPath{"savings", "emergency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := subject.Get(envelopes.BudgetPath{"savings", "emergency"}); !ok || got != created {
+		t.Errorf("created budget was not found where it was created")
+	}
+	if _, ok := subject.Get(envelopes.BudgetPath{"savings"}); !ok {
+		t.Errorf("missing ancestor was not created")
+	}
+
+	var exists envelopes.ErrBudgetExists
+	if _, err = subject.Create(envelopes.BudgetPath{"savings"}); !errors.As(err, &exists) {
+		t.Errorf("got: %v want: ErrBudgetExists", err)
+	}
+	if _, err = subject.Create(envelopes.BudgetPath{}); !errors.As(err, &exists) {
+		t.Errorf("got: %v want: ErrBudgetExists", err)
+	}
+}
+
+func TestBudget_Remove(t *testing.T) {
+	emergency := &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}}
+	subject := &envelopes.Budget{
+		Children: map[string]*envelopes.Budget{
+			"savings": {Children: map[string]*envelopes.Budget{"emergency": emergency}},
+		},
+	}
+
+	removed, err := subject.Remove(envelopes.BudgetPath{"savings", "emergency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != emergency {
+		t.Errorf("Remove did not return the removed budget")
+	}
+	if _, ok := subject.Get(envelopes.BudgetPath{"savings", "emergency"}); ok {
+		t.Errorf("budget was still present after being removed")
+	}
+
+	var notFound envelopes.ErrBudgetNotFound
+	for _, missing := range []envelopes.BudgetPath{{"savings", "emergency"}, {"checking", "anything"}} {
+		if _, err = subject.Remove(missing); !errors.As(err, &notFound) {
+			t.Errorf("removing %s got: %v want: ErrBudgetNotFound", missing, err)
+		}
+	}
+
+	if _, err = subject.Remove(envelopes.BudgetPath{}); err == nil {
+		t.Errorf("expected an error when removing the root")
+	}
+}
+
+func TestBudget_Move(t *testing.T) {
+	newSubject := func() *envelopes.Budget {
+		return &envelopes.Budget{
+			Children: map[string]*envelopes.Budget{
+				"savings": {
+					Balance: envelopes.Balance{"USD": big.NewRat(3, 1)},
+					Children: map[string]*envelopes.Budget{
+						"emergency": {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+					},
+				},
+				"groceries": {},
+			},
+		}
+	}
+
+	subject := newSubject()
+	if err := subject.Move(envelopes.BudgetPath{"savings"}, envelopes.BudgetPath{"goals", "long term"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := subject.Get(envelopes.BudgetPath{"savings"}); ok {
+		t.Errorf("budget was still present at its old path")
+	}
+	moved, ok := subject.Get(envelopes.BudgetPath{"goals", "long term", "emergency"})
+	if !ok || moved.Balance["USD"].Cmp(big.NewRat(1, 1)) != 0 {
+		t.Errorf("children were not moved along with their parent")
+	}
+
+	failures := []struct {
+		name     string
+		from, to envelopes.BudgetPath
+	}{
+		{"missing source", envelopes.BudgetPath{"checking"}, envelopes.BudgetPath{"elsewhere"}},
+		{"existing destination", envelopes.BudgetPath{"savings"}, envelopes.BudgetPath{"groceries"}},
+		{"into itself", envelopes.BudgetPath{"savings"}, envelopes.BudgetPath{"savings", "emergency", "again"}},
+		{"root", envelopes.BudgetPath{}, envelopes.BudgetPath{"elsewhere"}},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			subject := newSubject()
+			original := subject.DeepCopy()
+			if err := subject.Move(tc.from, tc.to); err == nil {
+				t.Errorf("expected an error")
+			}
+			if !subject.Equal(original) {
+				t.Errorf("a failed move should leave the budget untouched")
+			}
+		})
+	}
+}
+
+func TestBudget_Walk_skipChildren(t *testing.T) {
+	subject := &envelopes.Budget{
+		Children: map[string]*envelopes.Budget{
+			"a": {Children: map[string]*envelopes.Budget{"hidden": {}}},
+			"b": {},
+		},
+	}
+
+	var visited []string
+	err := subject.Walk(func(path envelopes.BudgetPath, _ *envelopes.Budget) error {
+		visited = append(visited, path.String())
+		if path.Equal(envelopes.BudgetPath{"a"}) {
+			return envelopes.ErrSkipChildren{}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/a", "/b"}
+	if fmt.Sprint(visited) != fmt.Sprint(want) {
+		t.Errorf("got: %v want: %v", visited, want)
+	}
+
+	stop := errors.New("stop")
+	if got := subject.Walk(func(envelopes.BudgetPath, *envelopes.Budget) error { return stop }); got != stop {
+		t.Errorf("got: %v want: %v", got, stop)
+	}
+}
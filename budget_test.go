@@ -32,7 +32,7 @@ func ExampleBudget_RecursiveBalance() {
 	}
 
 	fmt.Println(subject.RecursiveBalance())
-	// Output: USD 17.290
+	// Output: USD 17.29
 }
 
 func TestBudget_Equal(t *testing.T) {
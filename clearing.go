@@ -0,0 +1,268 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ClearingStatus describes how far a Transaction has been matched against the records of the bank. It says nothing
+// about whether the bank has finished processing the Transaction, only whether somebody has checked it.
+type ClearingStatus uint8
+
+// These are the values that a ClearingStatus can have, from least to most checked.
+const (
+	// Uncleared Transactions haven't been matched against anything yet. It is the zero value.
+	Uncleared ClearingStatus = iota
+
+	// Cleared Transactions have been seen in the records of the bank, but haven't been through a Reconciliation yet.
+	Cleared
+
+	// Reconciled Transactions were counted in a Reconciliation, and shouldn't be changed without revisiting it.
+	Reconciled
+)
+
+var clearingStatusNames = [...]string{
+	Uncleared:  "uncleared",
+	Cleared:    "cleared",
+	Reconciled: "reconciled",
+}
+
+// ErrUnknownClearingStatus indicates that text didn't name any ClearingStatus.
+type ErrUnknownClearingStatus string
+
+func (err ErrUnknownClearingStatus) Error() string {
+	return fmt.Sprintf("%q is not a clearing status", string(err))
+}
+
+func (s ClearingStatus) String() string {
+	if int(s) < len(clearingStatusNames) {
+		return clearingStatusNames[s]
+	}
+	return fmt.Sprintf("ClearingStatus(%d)", uint8(s))
+}
+
+// MarshalText writes the name of a ClearingStatus, like "cleared".
+func (s ClearingStatus) MarshalText() ([]byte, error) {
+	if int(s) >= len(clearingStatusNames) {
+		return nil, fmt.Errorf("%d is not a clearing status", uint8(s))
+	}
+	return []byte(clearingStatusNames[s]), nil
+}
+
+// UnmarshalText reads a ClearingStatus written by MarshalText.
+func (s *ClearingStatus) UnmarshalText(text []byte) error {
+	for i, name := range clearingStatusNames {
+		if name == string(text) {
+			*s = ClearingStatus(i)
+			return nil
+		}
+	}
+	return ErrUnknownClearingStatus(text)
+}
+
+// Reconciliation is a checkpoint, recording that the cleared balance of an Account matched a statement from the bank.
+type Reconciliation struct {
+	// Account is the name of the Account that was reconciled.
+	Account string
+
+	// Statement is the closing date of the statement it was reconciled against.
+	Statement Date
+
+	// Balance is the closing balance of the statement, which is what the cleared balance of Account added up to.
+	Balance Balance
+
+	// Transaction is the ID of the Transaction whose history was reconciled.
+	Transaction ID
+}
+
+// Equal determines whether two Reconciliations record the same checkpoint.
+func (r Reconciliation) Equal(other Reconciliation) bool {
+	return r.Account == other.Account &&
+		r.Statement == other.Statement &&
+		r.Balance.Equal(other.Balance) &&
+		r.Transaction.Equal(other.Transaction)
+}
+
+// DeepCopy creates a duplicate Reconciliation that can be modified without fear of modifying the original.
+func (r Reconciliation) DeepCopy() Reconciliation {
+	retval := r
+	if r.Balance != nil {
+		retval.Balance = r.Balance.DeepCopy()
+	}
+	return retval
+}
+
+// Clearing tracks the ClearingStatus of Transactions, and the Reconciliations of Accounts. It is kept apart from the
+// Transactions themselves, so that it can be updated without changing any IDs.
+//
+// The zero value of Clearing is ready to use, and treats every Transaction as Uncleared.
+type Clearing struct {
+	// Statuses holds the ClearingStatus of each Transaction that isn't Uncleared.
+	Statuses map[ID]ClearingStatus
+
+	// Reconciliations are ordered by Account, then by Statement.
+	Reconciliations []Reconciliation
+}
+
+// Status finds the ClearingStatus of a Transaction.
+func (c Clearing) Status(id ID) ClearingStatus {
+	return c.Statuses[id]
+}
+
+// SetStatus updates the ClearingStatus of a Transaction.
+func (c *Clearing) SetStatus(id ID, status ClearingStatus) {
+	if status == Uncleared {
+		delete(c.Statuses, id)
+		return
+	}
+
+	if c.Statuses == nil {
+		c.Statuses = make(map[ID]ClearingStatus)
+	}
+	c.Statuses[id] = status
+}
+
+// AddReconciliation records a checkpoint. If there is already one for the same Account and Statement, it is replaced.
+func (c *Clearing) AddReconciliation(checkpoint Reconciliation) {
+	i := sort.Search(len(c.Reconciliations), func(i int) bool {
+		current := c.Reconciliations[i]
+		if current.Account != checkpoint.Account {
+			return current.Account > checkpoint.Account
+		}
+		return !current.Statement.Before(checkpoint.Statement)
+	})
+
+	if i < len(c.Reconciliations) && c.Reconciliations[i].Account == checkpoint.Account && c.Reconciliations[i].Statement == checkpoint.Statement {
+		c.Reconciliations[i] = checkpoint
+		return
+	}
+
+	c.Reconciliations = append(c.Reconciliations, Reconciliation{})
+	copy(c.Reconciliations[i+1:], c.Reconciliations[i:])
+	c.Reconciliations[i] = checkpoint
+}
+
+// LastReconciliation finds the checkpoint with the latest Statement for an Account. If the Account has never been
+// reconciled, false is returned.
+func (c Clearing) LastReconciliation(account string) (Reconciliation, bool) {
+	var retval Reconciliation
+	found := false
+	for _, current := range c.Reconciliations {
+		if current.Account == account {
+			retval = current
+			found = true
+		}
+	}
+	return retval, found
+}
+
+// Remap creates a copy of a Clearing that follows Transactions which were given new IDs, for instance by having their
+// history rewritten. Each Transaction in replacements passes its ClearingStatus on to its replacement, and
+// Reconciliations of its history are moved over to its replacement's history. Statuses of the original Transactions are
+// kept, because they still exist until nothing refers to them.
+func (c Clearing) Remap(replacements map[ID]ID) Clearing {
+	retval := c.DeepCopy()
+
+	for original, replacement := range replacements {
+		if status := c.Status(original); status != Uncleared {
+			retval.SetStatus(replacement, status)
+		}
+	}
+
+	for i := range retval.Reconciliations {
+		if replacement, ok := replacements[retval.Reconciliations[i].Transaction]; ok {
+			retval.Reconciliations[i].Transaction = replacement
+		}
+	}
+
+	return retval
+}
+
+// Merge creates a copy of a Clearing that also holds what is recorded in other, for instance when combining the Clearing
+// of two copies of the same repository. Each Transaction keeps whichever of its two statuses is further along, so
+// checking a Transaction in either copy is never undone. Reconciliations from other are added, unless c already has one
+// for the same Account and Statement, in which case c's is kept.
+func (c Clearing) Merge(other Clearing) Clearing {
+	retval := c.DeepCopy()
+
+	for id, status := range other.Statuses {
+		if status > retval.Status(id) {
+			retval.SetStatus(id, status)
+		}
+	}
+
+	for _, checkpoint := range other.Reconciliations {
+		if !retval.hasReconciliation(checkpoint.Account, checkpoint.Statement) {
+			retval.AddReconciliation(checkpoint.DeepCopy())
+		}
+	}
+
+	return retval
+}
+
+func (c Clearing) hasReconciliation(account string, statement Date) bool {
+	for _, current := range c.Reconciliations {
+		if current.Account == account && current.Statement == statement {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal determines whether two instances of Clearing hold the same statuses and checkpoints.
+func (c Clearing) Equal(other Clearing) bool {
+	if len(c.Statuses) != len(other.Statuses) {
+		return false
+	}
+	for id, status := range c.Statuses {
+		if found, ok := other.Statuses[id]; !ok || found != status {
+			return false
+		}
+	}
+
+	if len(c.Reconciliations) != len(other.Reconciliations) {
+		return false
+	}
+	for i := range c.Reconciliations {
+		if !c.Reconciliations[i].Equal(other.Reconciliations[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DeepCopy creates a duplicate Clearing that can be modified without fear of modifying the original.
+func (c Clearing) DeepCopy() Clearing {
+	var retval Clearing
+
+	if c.Statuses != nil {
+		retval.Statuses = make(map[ID]ClearingStatus, len(c.Statuses))
+		for id, status := range c.Statuses {
+			retval.Statuses[id] = status
+		}
+	}
+
+	if c.Reconciliations != nil {
+		retval.Reconciliations = make([]Reconciliation, len(c.Reconciliations))
+		for i := range c.Reconciliations {
+			retval.Reconciliations[i] = c.Reconciliations[i].DeepCopy()
+		}
+	}
+
+	return retval
+}
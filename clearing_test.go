@@ -0,0 +1,189 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestClearingStatus_text(t *testing.T) {
+	for _, want := range []envelopes.ClearingStatus{envelopes.Uncleared, envelopes.Cleared, envelopes.Reconciled} {
+		marshaled, err := want.MarshalText()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		var got envelopes.ClearingStatus
+		if err = got.UnmarshalText(marshaled); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	}
+
+	var status envelopes.ClearingStatus
+	if err := status.UnmarshalText([]byte("pending")); err == nil {
+		t.Errorf("expected an error for a name that isn't a clearing status")
+	}
+}
+
+func TestClearing_SetStatus(t *testing.T) {
+	var subject envelopes.Clearing
+	id := envelopes.Transaction{Merchant: "Grocer"}.ID()
+
+	if got := subject.Status(id); got != envelopes.Uncleared {
+		t.Errorf("got %s want %s", got, envelopes.Uncleared)
+	}
+
+	subject.SetStatus(id, envelopes.Cleared)
+	if got := subject.Status(id); got != envelopes.Cleared {
+		t.Errorf("got %s want %s", got, envelopes.Cleared)
+	}
+
+	copied := subject.DeepCopy()
+	copied.SetStatus(id, envelopes.Reconciled)
+	if got := subject.Status(id); got != envelopes.Cleared {
+		t.Errorf("DeepCopy should not share statuses with the original, got %s", got)
+	}
+
+	subject.SetStatus(id, envelopes.Uncleared)
+	if len(subject.Statuses) != 0 {
+		t.Errorf("Uncleared Transactions should not be stored, got: %v", subject.Statuses)
+	}
+}
+
+func TestClearing_AddReconciliation(t *testing.T) {
+	var subject envelopes.Clearing
+	march := envelopes.Date{Year: 2026, Month: time.March, Day: 31}
+	april := envelopes.Date{Year: 2026, Month: time.April, Day: 30}
+
+	subject.AddReconciliation(envelopes.Reconciliation{Account: "savings", Statement: march})
+	subject.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: april})
+	subject.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: march})
+	subject.AddReconciliation(envelopes.Reconciliation{
+		Account:   "checking",
+		Statement: april,
+		Balance:   envelopes.Balance{"USD": big.NewRat(120, 1)},
+	})
+
+	if got := len(subject.Reconciliations); got != 3 {
+		t.Fatalf("a Reconciliation for the same Account and Statement should be replaced, got %d", got)
+	}
+	if first := subject.Reconciliations[0]; first.Account != "checking" || first.Statement != march {
+		t.Errorf("Reconciliations should be ordered by Account, then by Statement, got: %v", subject.Reconciliations)
+	}
+
+	last, ok := subject.LastReconciliation("checking")
+	if !ok {
+		t.Fatal("expected to find a Reconciliation")
+	}
+	if last.Statement != april || !last.Balance.Equal(envelopes.Balance{"USD": big.NewRat(120, 1)}) {
+		t.Errorf("unexpected Reconciliation: %v", last)
+	}
+
+	if _, ok = subject.LastReconciliation("credit card"); ok {
+		t.Errorf("an Account that was never reconciled should not have a Reconciliation")
+	}
+}
+
+func TestClearing_Remap(t *testing.T) {
+	original := envelopes.ID{1}
+	replacement := envelopes.ID{2}
+	untouched := envelopes.ID{3}
+	march := envelopes.Date{Year: 2026, Month: time.March, Day: 31}
+
+	var subject envelopes.Clearing
+	subject.SetStatus(original, envelopes.Reconciled)
+	subject.SetStatus(untouched, envelopes.Cleared)
+	subject.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: march, Transaction: original})
+
+	got := subject.Remap(map[envelopes.ID]envelopes.ID{original: replacement, untouched: untouched})
+
+	if status := got.Status(replacement); status != envelopes.Reconciled {
+		t.Errorf("the replacement should inherit the original's status, got %s", status)
+	}
+	if status := got.Status(original); status != envelopes.Reconciled {
+		t.Errorf("the original should keep its status, got %s", status)
+	}
+	if status := got.Status(untouched); status != envelopes.Cleared {
+		t.Errorf("a Transaction that kept its ID should keep its status, got %s", status)
+	}
+
+	last, ok := got.LastReconciliation("checking")
+	if !ok || !last.Transaction.Equal(replacement) {
+		t.Errorf("the Reconciliation should refer to the replacement, got: %v", last)
+	}
+
+	if subject.Status(replacement) != envelopes.Uncleared || !subject.Reconciliations[0].Transaction.Equal(original) {
+		t.Errorf("Remap should not modify the original Clearing")
+	}
+}
+
+func TestClearing_Merge(t *testing.T) {
+	demoted := envelopes.ID{1}
+	promoted := envelopes.ID{2}
+	theirs := envelopes.ID{3}
+	march := envelopes.Date{Year: 2026, Month: time.March, Day: 31}
+	april := envelopes.Date{Year: 2026, Month: time.April, Day: 30}
+
+	var subject envelopes.Clearing
+	subject.SetStatus(demoted, envelopes.Reconciled)
+	subject.SetStatus(promoted, envelopes.Cleared)
+	subject.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: march, Transaction: demoted})
+
+	var other envelopes.Clearing
+	other.SetStatus(demoted, envelopes.Cleared)
+	other.SetStatus(promoted, envelopes.Reconciled)
+	other.SetStatus(theirs, envelopes.Cleared)
+	other.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: march, Transaction: theirs})
+	other.AddReconciliation(envelopes.Reconciliation{Account: "checking", Statement: april, Transaction: promoted})
+
+	got := subject.Merge(other)
+
+	want := map[envelopes.ID]envelopes.ClearingStatus{
+		demoted:  envelopes.Reconciled,
+		promoted: envelopes.Reconciled,
+		theirs:   envelopes.Cleared,
+	}
+	for id, status := range want {
+		if got.Status(id) != status {
+			t.Errorf("%s: got %s want %s", id, got.Status(id), status)
+		}
+	}
+
+	if len(got.Reconciliations) != 2 {
+		t.Fatalf("got %d Reconciliations want 2", len(got.Reconciliations))
+	}
+	if !got.Reconciliations[0].Transaction.Equal(demoted) {
+		t.Errorf("a Reconciliation that was already present should be kept, got: %v", got.Reconciliations[0])
+	}
+	if !got.Reconciliations[1].Transaction.Equal(promoted) || got.Reconciliations[1].Statement != april {
+		t.Errorf("a new Reconciliation should be added, got: %v", got.Reconciliations[1])
+	}
+
+	if subject.Status(promoted) != envelopes.Cleared || len(subject.Reconciliations) != 1 {
+		t.Errorf("Merge should not modify the original Clearing")
+	}
+	if !got.Merge(got).Equal(got) {
+		t.Errorf("merging a Clearing with itself should change nothing")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateFormat is the layout used to read and write Dates. It is the one from RFC 3339, without a time of day.
+const dateFormat = "2006-01-02"
+
+// Date is a day on the calendar, without a time of day or a time zone. Banks report when a Transaction posted as a Date,
+// so recording it as one means it reads the same, and is identified the same, no matter which time zone it was
+// imported in.
+//
+// The zero value of Date means that no Date was recorded.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf finds the Date that t falls on, in t's own location.
+func DateOf(t time.Time) Date {
+	var retval Date
+	retval.Year, retval.Month, retval.Day = t.Date()
+	return retval
+}
+
+// ParseDate reads a Date written like "2006-01-02", the way String writes it.
+func ParseDate(text string) (Date, error) {
+	parsed, err := time.Parse(dateFormat, text)
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(parsed), nil
+}
+
+// String writes d like "2006-01-02".
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// IsZero determines whether d is the zero value, meaning that no Date was recorded.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// IsValid determines whether d refers to a day that exists, as opposed to something like February 30th.
+func (d Date) IsValid() bool {
+	return DateOf(d.In(time.UTC)) == d
+}
+
+// In finds the first instant of d in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// Before determines whether d comes earlier on the calendar than other.
+func (d Date) Before(other Date) bool {
+	if d.Year != other.Year {
+		return d.Year < other.Year
+	}
+	if d.Month != other.Month {
+		return d.Month < other.Month
+	}
+	return d.Day < other.Day
+}
+
+// After determines whether d comes later on the calendar than other.
+func (d Date) After(other Date) bool {
+	return other.Before(d)
+}
+
+// MarshalText writes d like "2006-01-02".
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads a Date written by MarshalText.
+func (d *Date) UnmarshalText(text []byte) error {
+	parsed, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
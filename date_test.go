@@ -0,0 +1,85 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestDateOf(t *testing.T) {
+	// 11:30 PM in Seattle on June 1st is already June 2nd in UTC.
+	late := time.Date(2026, time.June, 1, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+
+	if got, want := envelopes.DateOf(late), (envelopes.Date{Year: 2026, Month: time.June, Day: 1}); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+	if got, want := envelopes.DateOf(late.UTC()), (envelopes.Date{Year: 2026, Month: time.June, Day: 2}); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	testCases := map[string]bool{
+		"2026-03-02":           true,
+		"2024-02-29":           true,
+		"2026-02-29":           false,
+		"2026-3-2":             false,
+		"2026-03-02T00:00:00Z": false,
+		"":                     false,
+	}
+
+	for text, valid := range testCases {
+		got, err := envelopes.ParseDate(text)
+		if valid {
+			if err != nil {
+				t.Errorf("%q: %v", text, err)
+			} else if got.String() != text {
+				t.Errorf("%q: round tripped as %q", text, got)
+			}
+		} else if err == nil {
+			t.Errorf("%q: expected an error, got %s", text, got)
+		}
+	}
+}
+
+func TestDate_compare(t *testing.T) {
+	earlier := envelopes.Date{Year: 2025, Month: time.December, Day: 31}
+	later := envelopes.Date{Year: 2026, Month: time.January, Day: 1}
+
+	if !earlier.Before(later) || earlier.After(later) {
+		t.Errorf("expected %s to come before %s", earlier, later)
+	}
+	if !later.After(earlier) || later.Before(earlier) {
+		t.Errorf("expected %s to come after %s", later, earlier)
+	}
+	if later.Before(later) || later.After(later) {
+		t.Errorf("a Date should not come before or after itself")
+	}
+}
+
+func TestDate_IsValid(t *testing.T) {
+	if !(envelopes.Date{Year: 2024, Month: time.February, Day: 29}).IsValid() {
+		t.Errorf("February 29th, 2024 should be valid")
+	}
+	if (envelopes.Date{Year: 2026, Month: time.February, Day: 30}).IsValid() {
+		t.Errorf("February 30th should not be valid")
+	}
+	if (envelopes.Date{}).IsValid() {
+		t.Errorf("the zero value should not be valid")
+	}
+}
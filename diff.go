@@ -0,0 +1,295 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type (
+	// BudgetChange describes what happened to the Budget at a particular path between two States. Before is nil when
+	// the Budget was added, and After is nil when it was removed.
+	BudgetChange struct {
+		Path   BudgetPath
+		Before Balance
+		After  Balance
+	}
+
+	// BudgetRename pairs a Budget that was removed with one that was added holding exactly the same Balance. It is only
+	// a guess: States don't record renames, so it is just as possible that one Budget was emptied while another was
+	// filled.
+	BudgetRename struct {
+		From    BudgetPath
+		To      BudgetPath
+		Balance Balance
+	}
+
+	// AccountChange describes what happened to a named Account between two States. Before is nil when the Account was
+	// added, and After is nil when it was removed.
+	AccountChange struct {
+		Name   string
+		Before Balance
+		After  Balance
+	}
+
+	// AccountRename pairs an Account that was removed with one that was added holding exactly the same Balance. Like
+	// BudgetRename, it is only a guess.
+	AccountRename struct {
+		From    string
+		To      string
+		Balance Balance
+	}
+
+	// StateDiff lists everything that differs between two States. Unlike the Impact returned by State.Subtract, it
+	// tells a Budget or Account that was removed apart from one whose balance went to zero.
+	//
+	// Budgets and Accounts that are paired up as rename candidates are not repeated in the Added or Removed lists.
+	// Budgets are listed in the order Budget.Walk visits them, and Accounts are sorted by name.
+	StateDiff struct {
+		AddedBudgets    []BudgetChange
+		RemovedBudgets  []BudgetChange
+		ModifiedBudgets []BudgetChange
+		RenamedBudgets  []BudgetRename
+
+		AddedAccounts    []AccountChange
+		RemovedAccounts  []AccountChange
+		ModifiedAccounts []AccountChange
+		RenamedAccounts  []AccountRename
+	}
+)
+
+// DiffStates finds everything that changed between an original State and an updated one.
+//
+// A Budget or Account is only considered as a rename candidate when its Balance isn't zero, because empty Budgets
+// and Accounts would otherwise pair up with each other arbitrarily.
+func DiffStates(original, updated State) StateDiff {
+	var retval StateDiff
+
+	originalBudgets, originalPaths := flattenBudget(original.Budget)
+	updatedBudgets, updatedPaths := flattenBudget(updated.Budget)
+
+	var removedBudgets []BudgetChange
+	for _, key := range originalPaths {
+		before := originalBudgets[key]
+		if after, ok := updatedBudgets[key]; !ok {
+			removedBudgets = append(removedBudgets, BudgetChange{Path: before.Path, Before: before.Balance})
+		} else if !before.Balance.Equal(after.Balance) {
+			retval.ModifiedBudgets = append(retval.ModifiedBudgets, BudgetChange{
+				Path:   before.Path,
+				Before: before.Balance,
+				After:  after.Balance,
+			})
+		}
+	}
+
+	var addedBudgets []BudgetChange
+	for _, key := range updatedPaths {
+		after := updatedBudgets[key]
+		if _, ok := originalBudgets[key]; !ok {
+			addedBudgets = append(addedBudgets, BudgetChange{Path: after.Path, After: after.Balance})
+		}
+	}
+
+	removedBudgetBalances := make([]Balance, len(removedBudgets))
+	for i := range removedBudgets {
+		removedBudgetBalances[i] = removedBudgets[i].Before
+	}
+	addedBudgetBalances := make([]Balance, len(addedBudgets))
+	for i := range addedBudgets {
+		addedBudgetBalances[i] = addedBudgets[i].After
+	}
+	pairs, removedLeft, addedLeft := pairRenames(removedBudgetBalances, addedBudgetBalances)
+	for _, pair := range pairs {
+		retval.RenamedBudgets = append(retval.RenamedBudgets, BudgetRename{
+			From:    removedBudgets[pair[0]].Path,
+			To:      addedBudgets[pair[1]].Path,
+			Balance: addedBudgets[pair[1]].After,
+		})
+	}
+	for _, i := range removedLeft {
+		retval.RemovedBudgets = append(retval.RemovedBudgets, removedBudgets[i])
+	}
+	for _, i := range addedLeft {
+		retval.AddedBudgets = append(retval.AddedBudgets, addedBudgets[i])
+	}
+
+	var removedAccounts []AccountChange
+	for _, name := range original.Accounts.Names() {
+		before := original.Accounts[name]
+		if after, ok := updated.Accounts[name]; !ok {
+			removedAccounts = append(removedAccounts, AccountChange{Name: name, Before: before})
+		} else if !before.Equal(after) {
+			retval.ModifiedAccounts = append(retval.ModifiedAccounts, AccountChange{
+				Name:   name,
+				Before: before,
+				After:  after,
+			})
+		}
+	}
+
+	var addedAccounts []AccountChange
+	for _, name := range updated.Accounts.Names() {
+		if !original.Accounts.HasAccount(name) {
+			addedAccounts = append(addedAccounts, AccountChange{Name: name, After: updated.Accounts[name]})
+		}
+	}
+
+	removedAccountBalances := make([]Balance, len(removedAccounts))
+	for i := range removedAccounts {
+		removedAccountBalances[i] = removedAccounts[i].Before
+	}
+	addedAccountBalances := make([]Balance, len(addedAccounts))
+	for i := range addedAccounts {
+		addedAccountBalances[i] = addedAccounts[i].After
+	}
+	pairs, removedLeft, addedLeft = pairRenames(removedAccountBalances, addedAccountBalances)
+	for _, pair := range pairs {
+		retval.RenamedAccounts = append(retval.RenamedAccounts, AccountRename{
+			From:    removedAccounts[pair[0]].Name,
+			To:      addedAccounts[pair[1]].Name,
+			Balance: addedAccounts[pair[1]].After,
+		})
+	}
+	for _, i := range removedLeft {
+		retval.RemovedAccounts = append(retval.RemovedAccounts, removedAccounts[i])
+	}
+	for _, i := range addedLeft {
+		retval.AddedAccounts = append(retval.AddedAccounts, addedAccounts[i])
+	}
+
+	return retval
+}
+
+// Empty determines whether a StateDiff found no changes at all.
+func (d StateDiff) Empty() bool {
+	return len(d.AddedBudgets) == 0 &&
+		len(d.RemovedBudgets) == 0 &&
+		len(d.ModifiedBudgets) == 0 &&
+		len(d.RenamedBudgets) == 0 &&
+		len(d.AddedAccounts) == 0 &&
+		len(d.RemovedAccounts) == 0 &&
+		len(d.ModifiedAccounts) == 0 &&
+		len(d.RenamedAccounts) == 0
+}
+
+// WriteTo renders a StateDiff as text, one change per line. Budgets are listed before Accounts, and within each,
+// additions come first, followed by removals, renames, and modifications. For example:
+//
+//	added budget /groceries: USD 5.00
+//	renamed budget /car -> /savings/car: USD 100.00
+//	modified account checking: USD 1914.77 -> USD 1909.77
+func (d StateDiff) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var err error
+	write := func(format string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		var n int
+		n, err = fmt.Fprintf(w, format, args...)
+		written += int64(n)
+	}
+
+	for _, change := range d.AddedBudgets {
+		write("added budget %s: %s\n", change.Path, change.After)
+	}
+	for _, change := range d.RemovedBudgets {
+		write("removed budget %s: %s\n", change.Path, change.Before)
+	}
+	for _, rename := range d.RenamedBudgets {
+		write("renamed budget %s -> %s: %s\n", rename.From, rename.To, rename.Balance)
+	}
+	for _, change := range d.ModifiedBudgets {
+		write("modified budget %s: %s -> %s\n", change.Path, change.Before, change.After)
+	}
+
+	for _, change := range d.AddedAccounts {
+		write("added account %s: %s\n", change.Name, change.After)
+	}
+	for _, change := range d.RemovedAccounts {
+		write("removed account %s: %s\n", change.Name, change.Before)
+	}
+	for _, rename := range d.RenamedAccounts {
+		write("renamed account %s -> %s: %s\n", rename.From, rename.To, rename.Balance)
+	}
+	for _, change := range d.ModifiedAccounts {
+		write("modified account %s: %s -> %s\n", change.Name, change.Before, change.After)
+	}
+
+	return written, err
+}
+
+func (d StateDiff) String() string {
+	var buf bytes.Buffer
+	_, _ = d.WriteTo(&buf)
+	return buf.String()
+}
+
+type flattenedBudget struct {
+	Path    BudgetPath
+	Balance Balance
+}
+
+// flattenBudget lists every Budget in a tree keyed by the text of its path, along with those paths in the order they
+// were visited. A missing Budget is treated as an empty root, so that it doesn't show up as added or removed.
+func flattenBudget(root *Budget) (map[string]flattenedBudget, []string) {
+	if root == nil {
+		root = &Budget{}
+	}
+
+	discovered := make(map[string]flattenedBudget)
+	var order []string
+	_ = root.Walk(func(path BudgetPath, current *Budget) error {
+		key := path.String()
+		discovered[key] = flattenedBudget{Path: path, Balance: current.Balance}
+		order = append(order, key)
+		return nil
+	})
+	return discovered, order
+}
+
+// pairRenames matches each removed Balance with the first unmatched added Balance that is equal to it. It returns the
+// index pairs that were matched, followed by the indexes of the removed and added Balances that weren't.
+func pairRenames(removed, added []Balance) (pairs [][2]int, removedLeft, addedLeft []int) {
+	matched := make([]bool, len(added))
+	for i := range removed {
+		found := false
+		if !removed[i].Equal(Balance{}) {
+			for j := range added {
+				if !matched[j] && removed[i].Equal(added[j]) {
+					matched[j] = true
+					pairs = append(pairs, [2]int{i, j})
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			removedLeft = append(removedLeft, i)
+		}
+	}
+
+	for j := range added {
+		if !matched[j] {
+			addedLeft = append(addedLeft, j)
+		}
+	}
+
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a][1] < pairs[b][1] })
+	return
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func ExampleDiffStates() {
+	original := envelopes.State{
+		Budget: &envelopes.Budget{
+			Children: map[string]*envelopes.Budget{
+				"car":       {Balance: envelopes.Balance{"USD": big.NewRat(100, 1)}},
+				"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(20, 1)}},
+				"vacation":  {Balance: envelopes.Balance{"USD": big.NewRat(0, 1)}},
+			},
+		},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(120, 1)}},
+	}
+	updated := envelopes.State{
+		Budget: &envelopes.Budget{
+			Children: map[string]*envelopes.Budget{
+				"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(0, 1)}},
+				"savings": {
+					Children: map[string]*envelopes.Budget{
+						"car": {Balance: envelopes.Balance{"USD": big.NewRat(100, 1)}},
+					},
+				},
+			},
+		},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(100, 1)}},
+	}
+
+	fmt.Print(envelopes.DiffStates(original, updated))
+	// Output:
+	// added budget /savings: USD 0.00
+	// removed budget /vacation: USD 0.00
+	// renamed budget /car -> /savings/car: USD 100.00
+	// modified budget /groceries: USD 20.00 -> USD 0.00
+	// modified account checking: USD 120.00 -> USD 100.00
+}
+
+func ExampleStateDiff_WriteTo() {
+	original := envelopes.State{
+		Budget: &envelopes.Budget{
+			Children: map[string]*envelopes.Budget{
+				"car":     {Balance: envelopes.Balance{"USD": big.NewRat(100, 1)}},
+				"savings": {},
+			},
+		},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(191477, 100)}},
+	}
+	updated := envelopes.State{
+		Budget: &envelopes.Budget{
+			Children: map[string]*envelopes.Budget{
+				"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(5, 1)}},
+				"savings": {
+					Children: map[string]*envelopes.Budget{
+						"car": {Balance: envelopes.Balance{"USD": big.NewRat(100, 1)}},
+					},
+				},
+			},
+		},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(190977, 100)}},
+	}
+
+	_, _ = envelopes.DiffStates(original, updated).WriteTo(os.Stdout)
+	// Output:
+	// added budget /groceries: USD 5.00
+	// renamed budget /car -> /savings/car: USD 100.00
+	// modified account checking: USD 1914.77 -> USD 1909.77
+}
+
+func TestDiffStates(t *testing.T) {
+	usd := func(magnitude int64) envelopes.Balance {
+		return envelopes.Balance{"USD": big.NewRat(magnitude, 1)}
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		subject := envelopes.State{
+			Budget:   &envelopes.Budget{Balance: usd(5), Children: map[string]*envelopes.Budget{"a": {Balance: usd(1)}}},
+			Accounts: envelopes.Accounts{"checking": usd(6)},
+		}
+		if got := envelopes.DiffStates(subject, subject.DeepCopy()); !got.Empty() {
+			t.Errorf("expected no changes, got:\n%s", got)
+		}
+	})
+
+	t.Run("nil and empty are the same", func(t *testing.T) {
+		if got := envelopes.DiffStates(envelopes.State{}, envelopes.State{Budget: &envelopes.Budget{}, Accounts: envelopes.Accounts{}}); !got.Empty() {
+			t.Errorf("expected no changes, got:\n%s", got)
+		}
+	})
+
+	t.Run("removed versus zeroed", func(t *testing.T) {
+		original := envelopes.State{Accounts: envelopes.Accounts{"savings": usd(10), "checking": usd(10)}}
+		updated := envelopes.State{Accounts: envelopes.Accounts{"checking": usd(0)}}
+		got := envelopes.DiffStates(original, updated)
+
+		if len(got.RemovedAccounts) != 1 || got.RemovedAccounts[0].Name != "savings" || got.RemovedAccounts[0].After != nil {
+			t.Errorf("unexpected removed accounts: %#v", got.RemovedAccounts)
+		}
+		if len(got.ModifiedAccounts) != 1 || got.ModifiedAccounts[0].Name != "checking" || !got.ModifiedAccounts[0].After.Equal(usd(0)) {
+			t.Errorf("unexpected modified accounts: %#v", got.ModifiedAccounts)
+		}
+		if len(got.RenamedAccounts) != 0 {
+			t.Errorf("unexpected renamed accounts: %#v", got.RenamedAccounts)
+		}
+	})
+
+	t.Run("account rename candidates", func(t *testing.T) {
+		original := envelopes.State{Accounts: envelopes.Accounts{"old": usd(10), "other": usd(3)}}
+		updated := envelopes.State{Accounts: envelopes.Accounts{"new": usd(10), "another": usd(4)}}
+		got := envelopes.DiffStates(original, updated)
+
+		want := []envelopes.AccountRename{{From: "old", To: "new", Balance: usd(10)}}
+		if len(got.RenamedAccounts) != len(want) || got.RenamedAccounts[0].From != want[0].From || got.RenamedAccounts[0].To != want[0].To {
+			t.Errorf("got: %#v want: %#v", got.RenamedAccounts, want)
+		}
+		if len(got.AddedAccounts) != 1 || got.AddedAccounts[0].Name != "another" {
+			t.Errorf("unexpected added accounts: %#v", got.AddedAccounts)
+		}
+		if len(got.RemovedAccounts) != 1 || got.RemovedAccounts[0].Name != "other" {
+			t.Errorf("unexpected removed accounts: %#v", got.RemovedAccounts)
+		}
+	})
+
+	t.Run("empty budgets are not renames", func(t *testing.T) {
+		original := envelopes.State{Budget: &envelopes.Budget{Children: map[string]*envelopes.Budget{"a": {}}}}
+		updated := envelopes.State{Budget: &envelopes.Budget{Children: map[string]*envelopes.Budget{"b": {}}}}
+		got := envelopes.DiffStates(original, updated)
+
+		if len(got.RenamedBudgets) != 0 || len(got.AddedBudgets) != 1 || len(got.RemovedBudgets) != 1 {
+			t.Errorf("unexpected changes:\n%s", got)
+		}
+	})
+}
@@ -39,8 +39,8 @@ func ExampleBringToRule() {
 	fmt.Println("Spending:", spending.RecursiveBalance())
 
 	// Output:
-	// Grocery: USD 100.000
-	// Spending: USD 170.510
+	// Grocery: USD 100.00
+	// Spending: USD 170.51
 }
 
 func Example_nestedRules() {
@@ -99,13 +99,13 @@ func Example_nestedRules() {
 	fmt.Println("Spending:", spending.Balance)
 
 	// Output:
-	// Rent: USD 850.000
-	// Grocery: USD 500.000
-	// College Savings: USD 21256.990
-	// Car Savings: USD 10115.000
-	// Netflix: USD 19.990
-	// Travel Savings: USD 547.852
-	// Spending: USD 599.808
+	// Rent: USD 850.00
+	// Grocery: USD 500.00
+	// College Savings: USD 21256.99
+	// Car Savings: USD 10115.00
+	// Netflix: USD 19.99
+	// Travel Savings: USD 547.85
+	// Spending: USD 599.81
 }
 
 func ExampleBudgetRule() {
@@ -128,7 +128,7 @@ func ExampleBudgetRule() {
 	fmt.Println(recipient.Balance)
 
 	// Output:
-	// USD 15.000
+	// USD 15.00
 }
 
 func ExamplePercentageRule_credit() {
@@ -160,8 +160,8 @@ func ExamplePercentageRule_credit() {
 	fmt.Println("Starved:", starved.Balance)
 
 	// Output:
-	// Fed: USD 103.000
-	// Starved: USD 12.000
+	// Fed: USD 103.00
+	// Starved: USD 12.00
 }
 
 func ExamplePercentageRule_debit() {
@@ -193,8 +193,40 @@ func ExamplePercentageRule_debit() {
 	fmt.Println("Starved:", starved.Balance)
 
 	// Output:
-	// Fed: USD 97.000
-	// Starved: USD 8.000
+	// Fed: USD 97.00
+	// Starved: USD 8.00
+}
+
+func ExamplePercentageRule_indivisible() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 30)
+	defer cancel()
+
+	left := envelopes.Budget{}
+	right := envelopes.Budget{}
+	leftovers := envelopes.Budget{}
+
+	subject := distribute.NewPercentageRule(2, (*distribute.BudgetRule)(&leftovers))
+	subject.AddRule(.5, (*distribute.BudgetRule)(&left))
+	subject.AddRule(.5, (*distribute.BudgetRule)(&right))
+
+	amountToCredit := envelopes.Balance{
+		"USD": big.NewRat(1, 100),
+	}
+
+	// Half a cent can't be handed to either side, so the whole cent is left over.
+	if err := subject.Distribute(ctx, amountToCredit); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "couldn't distribute %s: %v\n", amountToCredit, err)
+		return
+	}
+
+	fmt.Println("Left:", left.Balance)
+	fmt.Println("Right:", right.Balance)
+	fmt.Println("Leftovers:", leftovers.Balance)
+
+	// Output:
+	// Left: USD 0.00
+	// Right: USD 0.00
+	// Leftovers: USD 0.01
 }
 
 func ExamplePriorityRule_credit() {
@@ -225,8 +257,8 @@ func ExamplePriorityRule_credit() {
 	fmt.Println("Starved:", starved.Balance)
 
 	// Output:
-	// Fed: USD 105.000
-	// Starved: USD 12.000
+	// Fed: USD 105.00
+	// Starved: USD 12.00
 }
 
 func ExamplePriorityRule_debit() {
@@ -257,8 +289,8 @@ func ExamplePriorityRule_debit() {
 	fmt.Println("Starved:", starved.Balance)
 
 	// Output:
-	// Fed: USD 95.000
-	// Starved: USD 8.000
+	// Fed: USD 95.00
+	// Starved: USD 8.00
 }
 
 func ExamplePriorityRule_insufficientFunds() {
@@ -289,7 +321,7 @@ func ExamplePriorityRule_insufficientFunds() {
 	fmt.Println("Starved:", starved.Balance)
 
 	// Output:
-	// Fed: USD 110.000
-	// Starved: USD 6.000
+	// Fed: USD 110.00
+	// Starved: USD 6.00
 }
 
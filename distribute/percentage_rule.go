@@ -2,6 +2,8 @@ package distribute
 
 import (
 	"context"
+	"math/big"
+	"strconv"
 	"github.com/marstr/envelopes"
 )
 
@@ -29,12 +31,14 @@ func (pr PercentageRule) AddRule(equity float64, distributor Distributor) {
 }
 
 // Distribute takes funds from balance and splits it up equitably among the rules that were previously added using
-// AddRule.
+// AddRule. Each portion is rounded toward zero to the minor units that envelopes.Assets has registered for its asset
+// type, so that nobody is handed a fraction of a cent and the portions never add up to more than balance; whatever is
+// left over goes to Err.
 func (pr PercentageRule) Distribute(ctx context.Context, balance envelopes.Balance) error {
 	remaining := balance
 
 	for target, scale := range pr.Targets {
-		current := balance.Scale(scale)
+		current := envelopes.Assets.Truncate(portion(balance, scale))
 
 		if err := target.Distribute(ctx, current); err != nil {
 			return err
@@ -45,3 +49,19 @@ func (pr PercentageRule) Distribute(ctx context.Context, balance envelopes.Balan
 
 	return pr.Err.Distribute(ctx, remaining);
 }
+
+// portion scales balance by the decimal that was written to produce scale, rather than by the binary fraction that
+// stores it. Otherwise, a scale of .6 would be slightly less than three fifths, and rounding toward zero would lose a
+// whole cent.
+func portion(balance envelopes.Balance, scale float64) envelopes.Balance {
+	exact, ok := new(big.Rat).SetString(strconv.FormatFloat(scale, 'g', -1, 64))
+	if !ok {
+		return balance.Scale(scale)
+	}
+
+	retval := make(envelopes.Balance, len(balance))
+	for asset, magnitude := range balance {
+		retval[asset] = new(big.Rat).Mul(magnitude, exact)
+	}
+	return retval
+}
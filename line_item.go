@@ -0,0 +1,88 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+)
+
+// LineItem records one part of a Transaction, for instance when a single receipt covers groceries, household supplies,
+// and a trip to the pharmacy, each of which is paid for out of a different Budget.
+type LineItem struct {
+	Amount Balance
+
+	// Budget identifies the Budget this part of the Transaction was paid for out of.
+	Budget BudgetPath
+
+	Memo string
+
+	// Account is the name of the Account this part of the Transaction was paid for out of. It may be left empty when
+	// it's the same as for the rest of the Transaction, or isn't known.
+	Account string
+}
+
+// Equal determines whether two LineItems share identical values.
+func (li LineItem) Equal(other LineItem) bool {
+	return li.Amount.Equal(other.Amount) &&
+		li.Budget.Equal(other.Budget) &&
+		li.Memo == other.Memo &&
+		li.Account == other.Account
+}
+
+// DeepCopy creates a duplicate LineItem that can be modified without fear of modifying the original.
+func (li LineItem) DeepCopy() LineItem {
+	retval := li
+	if li.Amount != nil {
+		retval.Amount = li.Amount.DeepCopy()
+	}
+	if li.Budget != nil {
+		retval.Budget = make(BudgetPath, len(li.Budget))
+		copy(retval.Budget, li.Budget)
+	}
+	return retval
+}
+
+// MarshalText creates a deterministic string that uniquely represents this LineItem.
+func (li LineItem) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("amount %s budget %q account %q memo %q", li.Amount.identity(), li.Budget, li.Account, li.Memo)), nil
+}
+
+// ErrLineItemsUnbalanced indicates that the LineItems of a Transaction don't add up to its Amount.
+type ErrLineItemsUnbalanced struct {
+	Amount Balance
+	Total  Balance
+}
+
+func (err ErrLineItemsUnbalanced) Error() string {
+	return fmt.Sprintf("line items add up to %s, but the transaction's amount is %s", err.Total, err.Amount)
+}
+
+// ValidateLineItems checks that the LineItems of a Transaction add up to its Amount. A Transaction without any
+// LineItems is always valid.
+func (t Transaction) ValidateLineItems() error {
+	if len(t.LineItems) == 0 {
+		return nil
+	}
+
+	total := make(Balance)
+	for _, item := range t.LineItems {
+		total = total.Add(item.Amount)
+	}
+
+	if !total.Equal(t.Amount) {
+		return ErrLineItemsUnbalanced{Amount: t.Amount, Total: total}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func sampleSplitTransaction() envelopes.Transaction {
+	return envelopes.Transaction{
+		Amount:   envelopes.Balance{"USD": big.NewRat(-6150, 100)},
+		Merchant: "Grocery Store",
+		LineItems: []envelopes.LineItem{
+			{Amount: envelopes.Balance{"USD": big.NewRat(-4500, 100)}, Budget: envelopes.BudgetPath{"groceries"}},
+			{
+				Amount:  envelopes.Balance{"USD": big.NewRat(-1650, 100)},
+				Budget:  envelopes.BudgetPath{"household"},
+				Memo:    "Detergent",
+				Account: "credit",
+			},
+		},
+	}
+}
+
+func TestTransaction_ValidateLineItems(t *testing.T) {
+	subject := sampleSplitTransaction()
+	if err := subject.ValidateLineItems(); err != nil {
+		t.Error(err)
+	}
+
+	if err := (envelopes.Transaction{Amount: envelopes.Balance{"USD": big.NewRat(1, 1)}}).ValidateLineItems(); err != nil {
+		t.Errorf("a Transaction without line items should always be valid: %v", err)
+	}
+
+	subject.LineItems[1].Amount = envelopes.Balance{"USD": big.NewRat(-1600, 100)}
+	err := subject.ValidateLineItems()
+	var unbalanced envelopes.ErrLineItemsUnbalanced
+	if !errors.As(err, &unbalanced) {
+		t.Fatalf("got: %v want: ErrLineItemsUnbalanced", err)
+	}
+	if want := "USD -61.00"; unbalanced.Total.String() != want {
+		t.Errorf("got total %s want %s", unbalanced.Total, want)
+	}
+}
+
+func TestTransaction_lineItemsIdentity(t *testing.T) {
+	subject := sampleSplitTransaction()
+	plain := subject
+	plain.LineItems = nil
+
+	if subject.ID().Equal(plain.ID()) {
+		t.Errorf("line items should be part of a Transaction's ID")
+	}
+	empty := plain
+	empty.LineItems = []envelopes.LineItem{}
+	if !empty.ID().Equal(plain.ID()) {
+		t.Errorf("an empty list of line items should not change a Transaction's ID")
+	}
+
+	modified := subject.DeepCopy()
+	modified.LineItems[1].Memo = "Soap"
+	if subject.Equal(modified) || subject.ID().Equal(modified.ID()) {
+		t.Errorf("changing a memo should change the Transaction")
+	}
+	if subject.LineItems[1].Memo != "Detergent" {
+		t.Errorf("DeepCopy should not share line items with the original")
+	}
+
+	moved := subject.DeepCopy()
+	moved.LineItems[0].Budget = envelopes.BudgetPath{"groceries", "produce"}
+	if subject.Equal(moved) || subject.ID().Equal(moved.ID()) {
+		t.Errorf("changing a budget should change the Transaction")
+	}
+}
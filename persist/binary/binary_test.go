@@ -0,0 +1,424 @@
+package binary_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
+	persistJson "github.com/marstr/envelopes/persist/json"
+	"github.com/marstr/envelopes/persist/persisttest"
+)
+
+// mapStore holds objects in memory, keyed by their ID.
+type mapStore map[envelopes.ID][]byte
+
+func (ms mapStore) Stash(_ context.Context, id envelopes.ID, payload []byte) error {
+	ms[id] = payload
+	return nil
+}
+
+func (ms mapStore) Fetch(_ context.Context, id envelopes.ID) ([]byte, error) {
+	if payload, ok := ms[id]; ok {
+		return payload, nil
+	}
+	return nil, persist.ErrObjectNotFound(id)
+}
+
+type loaderWriter struct {
+	persist.Loader
+	persist.Writer
+}
+
+func newLoaderWriter(t *testing.T) persisttest.LoaderWriter {
+	store := make(mapStore)
+	loader, err := persistBinary.NewLoaderV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := persistBinary.NewWriterV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaderWriter{Loader: loader, Writer: writer}
+}
+
+func newLoaderWriterV2(t *testing.T) persisttest.LoaderWriter {
+	store := make(mapStore)
+	loader, err := persistBinary.NewLoaderV2(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := persistBinary.NewWriterV2(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaderWriter{Loader: loader, Writer: writer}
+}
+
+func TestLoaderWriterV1_conformance(t *testing.T) {
+	persisttest.TestLoaderWriter(t, newLoaderWriter)
+}
+
+func TestLoaderWriterV2_conformance(t *testing.T) {
+	persisttest.TestLoaderWriter(t, newLoaderWriterV2)
+}
+
+func TestLoaderV2_readsV1(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := exampleTransaction()
+	store := make(mapStore)
+	writer, err := persistBinary.NewWriterV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := persistBinary.NewLoaderV2(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded envelopes.Transaction
+	err = loader.LoadTransaction(ctx, subject.ID(), &loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(subject) || loaded.ID() != subject.ID() {
+		t.Errorf("got: %s want: %s", loaded, subject)
+	}
+}
+
+func TestLoaderV1_rejectsV2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := exampleTransaction()
+	subject.Tags = envelopes.NewTagSet("vacation")
+	subject.State.Metadata = envelopes.AccountMetadata{"checking": {Institution: "Credit Union"}}
+
+	store := make(mapStore)
+	writer, err := persistBinary.NewWriterV2(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := persistBinary.NewLoaderV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Quietly dropping the fields that version 1 doesn't know about would change the IDs of what was loaded.
+	var loaded envelopes.Transaction
+	err = loader.LoadTransaction(ctx, subject.ID(), &loaded)
+	if !errors.Is(err, persist.ErrCorrupt) {
+		t.Errorf("got: %v want: an error matching persist.ErrCorrupt", err)
+	}
+
+	var state envelopes.State
+	err = loader.LoadState(ctx, subject.State.ID(), &state)
+	if !errors.Is(err, persist.ErrCorrupt) {
+		t.Errorf("got: %v want: an error matching persist.ErrCorrupt", err)
+	}
+
+	// Budgets and Accounts didn't change in version 2, so they can still be read.
+	var budget envelopes.Budget
+	err = loader.LoadBudget(ctx, subject.State.Budget.ID(), &budget)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// exampleTransaction only uses magnitudes with three or fewer decimal places, so that it can be written in version 3 of
+// the JSON object format without losing precision.
+func exampleTransaction() envelopes.Transaction {
+	pacific := time.FixedZone("PDT", -7*60*60)
+	return envelopes.Transaction{
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Balance: envelopes.Balance{"USD": big.NewRat(-1234, 100)},
+				Children: map[string]*envelopes.Budget{
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(9999, 100)}},
+					"savings": {
+						Balance: envelopes.Balance{"USD": big.NewRat(1, 1000), "MSFT": big.NewRat(144012, 1000)},
+						Children: map[string]*envelopes.Budget{
+							"emergency": {Balance: envelopes.Balance{"USD": big.NewRat(500000, 1)}},
+						},
+					},
+				},
+			},
+			Accounts: envelopes.Accounts{
+				"checking": envelopes.Balance{"USD": big.NewRat(12313, 100)},
+				"brokerage": envelopes.Balance{
+					"MSFT": big.NewRat(144012, 1000),
+					"USD":  big.NewRat(-5, 1),
+				},
+			},
+		},
+		PostedTime:  time.Date(2021, time.March, 4, 12, 30, 0, 0, pacific),
+		ActualTime:  time.Date(2021, time.March, 3, 9, 15, 0, 0, time.UTC),
+		EnteredTime: time.Date(2021, time.March, 5, 18, 45, 30, 0, pacific),
+		Amount:      envelopes.Balance{"USD": big.NewRat(-4213, 100)},
+		Merchant:    "Corner Store",
+		Comment:     "Snacks, for a long drive.",
+		Committer: envelopes.User{
+			FullName: "Martin Strobel",
+			Email:    "marstr@example.com",
+		},
+		RecordID: "2021030400001",
+		Parents: []envelopes.ID{
+			{0x01, 0x02, 0x03},
+			{0xfe, 0xed},
+		},
+		Reverts: []envelopes.ID{{0xba, 0xd0}},
+	}
+}
+
+func TestWriterV1_matchesJSONIDs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := exampleTransaction()
+
+	jsonStore := make(mapStore)
+	jsonWriter, err := persistJson.NewWriterV3(jsonStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jsonWriter.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryStore := make(mapStore)
+	binaryWriter, err := persistBinary.NewWriterV1(binaryStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = binaryWriter.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := sortedIDs(binaryStore), sortedIDs(jsonStore); !equalIDs(got, want) {
+		t.Fatalf("objects were stashed with different IDs\ngot:  %v\nwant: %v", got, want)
+	}
+
+	jsonSize, binarySize := 0, 0
+	for id := range jsonStore {
+		jsonSize += len(jsonStore[id])
+		binarySize += len(binaryStore[id])
+	}
+	if binarySize >= jsonSize {
+		t.Errorf("binary objects (%d bytes) were not smaller than JSON objects (%d bytes)", binarySize, jsonSize)
+	}
+
+	jsonLoader, err := persistJson.NewLoaderV3(jsonStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON envelopes.Transaction
+	err = jsonLoader.LoadTransaction(ctx, subject.ID(), &fromJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryLoader, err := persistBinary.NewLoaderV1(binaryStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromBinary envelopes.Transaction
+	err = binaryLoader.LoadTransaction(ctx, subject.ID(), &fromBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fromBinary.ID(), subject.ID(); got != want {
+		t.Errorf("loaded Transaction had the wrong ID\ngot:  %s\nwant: %s", got, want)
+	}
+	if got, want := fromBinary.ID(), fromJSON.ID(); got != want {
+		t.Errorf("Transactions loaded from each format had different IDs\nbinary: %s\njson:   %s", got, want)
+	}
+	if !fromBinary.Equal(fromJSON) {
+		t.Errorf("Transactions loaded from each format were not equal\nbinary: %s\njson:   %s", fromBinary, fromJSON)
+	}
+}
+
+func TestWriterV1_exactMagnitudes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	huge, ok := new(big.Rat).SetString("-123456789012345678901234567890/7")
+	if !ok {
+		t.Fatal("unable to parse magnitude")
+	}
+	subject := envelopes.Accounts{
+		"thirds": envelopes.Balance{"USD": big.NewRat(1, 3)},
+		"huge":   envelopes.Balance{"BTC": huge},
+		"zero":   envelopes.Balance{"USD": big.NewRat(0, 1)},
+		"empty":  envelopes.Balance{},
+	}
+
+	store := make(mapStore)
+	writer, err := persistBinary.NewWriterV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteAccounts(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := persistBinary.NewLoaderV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got envelopes.Accounts
+	err = loader.LoadAccounts(ctx, subject.ID(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs only consider the first few decimal places of each magnitude, so they can't be relied on here.
+	if len(got) != len(subject) {
+		t.Fatalf("got %d accounts, want %d", len(got), len(subject))
+	}
+	for name, balance := range subject {
+		if len(got[name]) != len(balance) {
+			t.Errorf("%s: got %d assets, want %d", name, len(got[name]), len(balance))
+			continue
+		}
+		for asset, magnitude := range balance {
+			if loaded, ok := got[name][asset]; !ok || loaded.Cmp(magnitude) != 0 {
+				t.Errorf("%s: got %s %v want %s %v", name, asset, loaded, asset, magnitude)
+			}
+		}
+	}
+}
+
+func TestLoaderV1_corrupt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := exampleTransaction()
+	store := make(mapStore)
+	writer, err := persistBinary.NewWriterV1(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := store[subject.ID()]
+
+	testCases := map[string][]byte{
+		"empty":           {},
+		"unknown version": append([]byte{0x7f}, original[1:]...),
+		"wrong kind":      append([]byte{original[0], 's'}, original[2:]...),
+		"truncated":       original[:len(original)-1],
+		"trailing bytes":  append(append([]byte{}, original...), 0x00),
+		"huge length":     append(append([]byte{}, original[:2+len(envelopes.ID{})]...), 0xff, 0xff, 0xff, 0xff, 0x0f),
+	}
+
+	for name, payload := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store[subject.ID()] = payload
+
+			loader, err := persistBinary.NewLoaderV1(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var loaded envelopes.Transaction
+			err = loader.LoadTransaction(ctx, subject.ID(), &loaded)
+			if !errors.Is(err, persist.ErrCorrupt) {
+				t.Errorf("got: %v want: an error matching persist.ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestLoaderV2_corrupt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := exampleTransaction()
+	subject.ActualDate = envelopes.Date{Year: 2021, Month: time.March, Day: 3}
+	subject.TimeHashing = envelopes.UTCTimeHashing
+	store := make(mapStore)
+	writer, err := persistBinary.NewWriterV2(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteTransaction(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := store[subject.ID()]
+
+	// Transactions end with the month and day of their ActualDate, followed by a byte saying how their times are hashed.
+	withByte := func(fromEnd int, value byte) []byte {
+		retval := append([]byte{}, original...)
+		retval[len(retval)-fromEnd] = value
+		return retval
+	}
+	testCases := map[string][]byte{
+		"unknown version":      append([]byte{0x7f}, original[1:]...),
+		"nonexistent date":     withByte(3, 13),
+		"unknown time hashing": withByte(1, 0x7f),
+	}
+
+	for name, payload := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store[subject.ID()] = payload
+
+			loader, err := persistBinary.NewLoaderV2(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var loaded envelopes.Transaction
+			err = loader.LoadTransaction(ctx, subject.ID(), &loaded)
+			if !errors.Is(err, persist.ErrCorrupt) {
+				t.Errorf("got: %v want: an error matching persist.ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func sortedIDs(store mapStore) []envelopes.ID {
+	retval := make([]envelopes.ID, 0, len(store))
+	for id := range store {
+		retval = append(retval, id)
+	}
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].String() < retval[j].String()
+	})
+	return retval
+}
+
+func equalIDs(left, right []envelopes.ID) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
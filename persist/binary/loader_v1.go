@@ -0,0 +1,175 @@
+package binary
+
+import (
+	"context"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func NewLoaderV1(fetcher persist.Fetcher) (*LoaderV1, error) {
+	retval := &LoaderV1{
+		Fetcher: fetcher,
+	}
+	retval.loopback = retval
+	return retval, nil
+}
+
+func NewLoaderV1WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV1, error) {
+	retval := &LoaderV1{
+		Fetcher:  fetcher,
+		loopback: loopback,
+	}
+	return retval, nil
+}
+
+// LoaderV1 wraps a Fetcher and does just the decoding portion.
+type LoaderV1 struct {
+	persist.Fetcher
+
+	// Loopback will be called when retrieving sub-object. i.e. It will be invoked when a Transaction needs a State.
+	// If it is not set, LoaderV1 will use itself.
+	loopback persist.Loader
+}
+
+func (dl LoaderV1) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	dec, err := dl.fetch(ctx, id, transactionKind, 1)
+	if err != nil {
+		return err
+	}
+
+	var loaded envelopes.Transaction
+	stateID := decodeTransactionV1(dec, &loaded)
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var state envelopes.State
+	err = dl.loopback.LoadState(ctx, stateID, &state)
+	if err != nil {
+		return err
+	}
+
+	loaded.State = &state
+	*toLoad = loaded
+	return nil
+}
+
+// decodeTransactionV1 reads the fields that every version of a Transaction has into toLoad, and returns the ID of its
+// State.
+func decodeTransactionV1(dec *decoder, toLoad *envelopes.Transaction) envelopes.ID {
+	stateID := dec.readID()
+	toLoad.PostedTime = dec.readTime()
+	toLoad.ActualTime = dec.readTime()
+	toLoad.EnteredTime = dec.readTime()
+	toLoad.Amount = dec.readBalance()
+	toLoad.Merchant = dec.readString()
+	toLoad.Comment = dec.readString()
+	toLoad.Committer.FullName = dec.readString()
+	toLoad.Committer.Email = dec.readString()
+	toLoad.RecordID = envelopes.BankRecordID(dec.readString())
+	toLoad.Parents = dec.readIDs()
+	toLoad.Reverts = dec.readIDs()
+	return stateID
+}
+
+func (dl LoaderV1) LoadState(ctx context.Context, id envelopes.ID, toLoad *envelopes.State) error {
+	dec, err := dl.fetch(ctx, id, stateKind, 1)
+	if err != nil {
+		return err
+	}
+
+	budgetID := dec.readID()
+	accountsID := dec.readID()
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var budget envelopes.Budget
+	err = dl.loopback.LoadBudget(ctx, budgetID, &budget)
+	if err != nil {
+		return err
+	}
+
+	var accounts envelopes.Accounts
+	err = dl.loopback.LoadAccounts(ctx, accountsID, &accounts)
+	if err != nil {
+		return err
+	}
+
+	toLoad.Budget = &budget
+	toLoad.Accounts = accounts
+	return nil
+}
+
+func (dl LoaderV1) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *envelopes.Budget) error {
+	dec, err := dl.fetch(ctx, id, budgetKind, 1)
+	if err != nil {
+		return err
+	}
+
+	balance := dec.readBalance()
+	// Each child holds at least a one byte name length, and an ID.
+	count := dec.readCount(1 + uint64(len(envelopes.ID{})))
+	childIDs := make(map[string]envelopes.ID, count)
+	for i := 0; i < count; i++ {
+		name := dec.readString()
+		childIDs[name] = dec.readID()
+	}
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	toLoad.Balance = balance
+	toLoad.Children = make(map[string]*envelopes.Budget, len(childIDs))
+	for name, childID := range childIDs {
+		var child envelopes.Budget
+		err = dl.loopback.LoadBudget(ctx, childID, &child)
+		if err != nil {
+			return err
+		}
+		toLoad.Children[name] = &child
+	}
+
+	return nil
+}
+
+func (dl LoaderV1) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *envelopes.Accounts) error {
+	dec, err := dl.fetch(ctx, id, accountsKind, 1)
+	if err != nil {
+		return err
+	}
+
+	// Each account holds at least a one byte name length, and a one byte count of assets.
+	count := dec.readCount(2)
+	accounts := make(envelopes.Accounts, count)
+	for i := 0; i < count; i++ {
+		name := dec.readString()
+		accounts[name] = dec.readBalance()
+	}
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	*toLoad = accounts
+	return nil
+}
+
+// fetch reads an object, and checks that it is the kind of object the caller was expecting, written in a version no
+// newer than newest.
+func (dl LoaderV1) fetch(ctx context.Context, id envelopes.ID, kind objectKind, newest uint) (*decoder, error) {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newDecoder(marshaled, kind, newest)
+	if err != nil {
+		return nil, persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return dec, nil
+}
@@ -0,0 +1,167 @@
+package binary
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type Loader = LoaderV2
+
+func NewLoaderV2(fetcher persist.Fetcher) (*LoaderV2, error) {
+	retval := &LoaderV2{}
+	retval.LoaderV1 = LoaderV1{
+		Fetcher:  fetcher,
+		loopback: retval,
+	}
+	return retval, nil
+}
+
+func NewLoaderV2WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV2, error) {
+	retval := &LoaderV2{
+		LoaderV1: LoaderV1{
+			Fetcher:  fetcher,
+			loopback: loopback,
+		},
+	}
+	return retval, nil
+}
+
+// LoaderV2 wraps a Fetcher and does just the decoding portion. Only Transactions and States are read differently than
+// they are by LoaderV1, so everything else is handed to it. Transactions and States written as version 1 are read too.
+type LoaderV2 struct {
+	LoaderV1
+}
+
+func (dl LoaderV2) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	dec, err := dl.fetch(ctx, id, transactionKind, 2)
+	if err != nil {
+		return err
+	}
+
+	var loaded envelopes.Transaction
+	stateID := decodeTransactionV1(dec, &loaded)
+	if dec.version >= 2 {
+		decodeTransactionV2(dec, &loaded)
+	}
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var state envelopes.State
+	err = dl.loopback.LoadState(ctx, stateID, &state)
+	if err != nil {
+		return err
+	}
+
+	loaded.State = &state
+	*toLoad = loaded
+	return nil
+}
+
+// decodeTransactionV2 reads the fields that were added to Transactions in version 2 into toLoad. Collections which are
+// empty are left nil.
+func decodeTransactionV2(dec *decoder, toLoad *envelopes.Transaction) {
+	// Each line item holds at least a one byte count of assets, a one byte count of budgets, and two one byte lengths.
+	count := dec.readCount(4)
+	for i := 0; i < count; i++ {
+		var item envelopes.LineItem
+		item.Amount = dec.readBalance()
+		item.Budget = dec.readStrings()
+		item.Memo = dec.readString()
+		item.Account = dec.readString()
+		toLoad.LineItems = append(toLoad.LineItems, item)
+	}
+
+	if tags := dec.readStrings(); len(tags) > 0 {
+		toLoad.Tags = envelopes.NewTagSet(tags...)
+	}
+
+	// Each entry holds at least a one byte key length, and a one byte value length.
+	count = dec.readCount(2)
+	for i := 0; i < count; i++ {
+		if toLoad.Metadata == nil {
+			toLoad.Metadata = make(envelopes.TransactionMetadata, count)
+		}
+		key := dec.readString()
+		toLoad.Metadata[key] = dec.readString()
+	}
+
+	// Each attachment holds at least an ID, and two one byte lengths.
+	count = dec.readCount(2 + uint64(len(envelopes.ID{})))
+	for i := 0; i < count; i++ {
+		var attachment envelopes.Attachment
+		attachment.Blob = dec.readID()
+		attachment.Filename = dec.readString()
+		attachment.MediaType = dec.readString()
+		toLoad.Attachments = append(toLoad.Attachments, attachment)
+	}
+
+	toLoad.PostedDate = dec.readDate()
+	toLoad.ActualDate = dec.readDate()
+	toLoad.TimeHashing = envelopes.TimeHashing(dec.readByte())
+	if dec.err == nil && toLoad.TimeHashing > envelopes.UTCTimeHashing {
+		dec.err = fmt.Errorf("unrecognized time hashing %d", toLoad.TimeHashing)
+	}
+}
+
+func (dl LoaderV2) LoadState(ctx context.Context, id envelopes.ID, toLoad *envelopes.State) error {
+	dec, err := dl.fetch(ctx, id, stateKind, 2)
+	if err != nil {
+		return err
+	}
+
+	budgetID := dec.readID()
+	accountsID := dec.readID()
+
+	var metadata envelopes.AccountMetadata
+	if dec.version >= 2 {
+		// Each entry holds at least five one byte lengths, and a flag.
+		count := dec.readCount(6)
+		for i := 0; i < count; i++ {
+			if metadata == nil {
+				metadata = make(envelopes.AccountMetadata, count)
+			}
+			name := dec.readString()
+			var details envelopes.AccountDetails
+			details.Class = envelopes.AccountClass(dec.readString())
+			details.Subtype = envelopes.AccountSubtype(dec.readString())
+			details.Institution = dec.readString()
+			details.Currency = envelopes.AssetType(dec.readString())
+			switch closed := dec.readByte(); closed {
+			case 0:
+			case 1:
+				details.Closed = true
+			default:
+				if dec.err == nil {
+					dec.err = fmt.Errorf("unrecognized flag %d", closed)
+				}
+			}
+			metadata[name] = details
+		}
+	}
+	err = dec.finish()
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var budget envelopes.Budget
+	err = dl.loopback.LoadBudget(ctx, budgetID, &budget)
+	if err != nil {
+		return err
+	}
+
+	var accounts envelopes.Accounts
+	err = dl.loopback.LoadAccounts(ctx, accountsID, &accounts)
+	if err != nil {
+		return err
+	}
+
+	toLoad.Budget = &budget
+	toLoad.Accounts = accounts
+	toLoad.Metadata = metadata
+	return nil
+}
@@ -0,0 +1,167 @@
+package binary
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// WriterV1 knows how to navigate the envelopes object model and stash each individual component of an object.
+type WriterV1 struct {
+	// Writes the serialized form of an object to persistent memory. Must not be nil.
+	persist.Stasher
+
+	// Allow recursive calls to Write to invoke the top-level WriterV1. If this is nil, WriterV1 uses itself.
+	loopback persist.Writer
+}
+
+func NewWriterV1(stasher persist.Stasher) (*WriterV1, error) {
+	retval := &WriterV1{
+		Stasher: stasher,
+	}
+	retval.loopback = retval
+	return retval, nil
+}
+
+func NewWriterV1WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV1, error) {
+	retval := &WriterV1{
+		Stasher:  stasher,
+		loopback: loopback,
+	}
+	return retval, nil
+}
+
+func (dw WriterV1) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if len(subject.LineItems) > 0 {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store line items", persist.ErrUnsupported)
+	}
+
+	if len(subject.Tags) > 0 || len(subject.Metadata) > 0 {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store transaction tags or metadata", persist.ErrUnsupported)
+	}
+
+	if len(subject.Attachments) > 0 {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store attachments", persist.ErrUnsupported)
+	}
+
+	if !subject.PostedDate.IsZero() || !subject.ActualDate.IsZero() {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store transaction dates", persist.ErrUnsupported)
+	}
+
+	if subject.TimeHashing != envelopes.LocalTimeHashing {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store times hashed in UTC", persist.ErrUnsupported)
+	}
+
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	err := dw.loopback.WriteState(ctx, *subject.State)
+	if err != nil {
+		return err
+	}
+
+	enc := newEncoder(1, transactionKind)
+	err = encodeTransactionV1(enc, subject)
+	if err != nil {
+		return err
+	}
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
+
+// encodeTransactionV1 writes the fields that every version of a Transaction has.
+func encodeTransactionV1(enc *encoder, subject envelopes.Transaction) error {
+	enc.writeID(subject.State.ID())
+	err := enc.writeTime(subject.PostedTime)
+	if err != nil {
+		return err
+	}
+	err = enc.writeTime(subject.ActualTime)
+	if err != nil {
+		return err
+	}
+	err = enc.writeTime(subject.EnteredTime)
+	if err != nil {
+		return err
+	}
+	enc.writeBalance(subject.Amount)
+	enc.writeString(subject.Merchant)
+	enc.writeString(subject.Comment)
+	enc.writeString(subject.Committer.FullName)
+	enc.writeString(subject.Committer.Email)
+	enc.writeString(string(subject.RecordID))
+	enc.writeIDs(subject.Parents)
+	enc.writeIDs(subject.Reverts)
+
+	return nil
+}
+
+func (dw WriterV1) WriteState(ctx context.Context, subject envelopes.State) error {
+	if !subject.Metadata.Empty() {
+		return fmt.Errorf("%w: version 1 of the binary object format can not store account metadata", persist.ErrUnsupported)
+	}
+
+	if subject.Accounts == nil {
+		subject.Accounts = make(envelopes.Accounts, 0)
+	}
+	err := dw.loopback.WriteAccounts(ctx, subject.Accounts)
+	if err != nil {
+		return err
+	}
+
+	if subject.Budget == nil {
+		subject.Budget = &envelopes.Budget{}
+	}
+	err = dw.loopback.WriteBudget(ctx, *subject.Budget)
+	if err != nil {
+		return err
+	}
+
+	enc := newEncoder(1, stateKind)
+	enc.writeID(subject.Budget.ID())
+	enc.writeID(subject.Accounts.ID())
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
+
+func (dw WriterV1) WriteBudget(ctx context.Context, subject envelopes.Budget) error {
+	for _, child := range subject.Children {
+		err := dw.loopback.WriteBudget(ctx, *child)
+		if err != nil {
+			return err
+		}
+	}
+
+	enc := newEncoder(1, budgetKind)
+	enc.writeBalance(subject.Balance)
+
+	childNames := subject.ChildNames()
+	enc.writeUvarint(uint64(len(childNames)))
+	for _, name := range childNames {
+		enc.writeString(name)
+		enc.writeID(subject.Children[name].ID())
+	}
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
+
+func (dw WriterV1) WriteAccounts(ctx context.Context, subject envelopes.Accounts) error {
+	accountNames := make([]string, 0, len(subject))
+	for name := range subject {
+		accountNames = append(accountNames, name)
+	}
+	sort.Strings(accountNames)
+
+	enc := newEncoder(1, accountsKind)
+	enc.writeUvarint(uint64(len(accountNames)))
+	for _, name := range accountNames {
+		enc.writeString(name)
+		enc.writeBalance(subject[name])
+	}
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
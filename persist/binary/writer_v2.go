@@ -0,0 +1,123 @@
+package binary
+
+import (
+	"context"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type Writer = WriterV2
+
+// WriterV2 knows how to navigate the envelopes object model and stash each individual component of an object. Only
+// Transactions and States are written differently than they are by WriterV1, so everything else is handed to it.
+type WriterV2 struct {
+	WriterV1
+}
+
+func NewWriterV2(stasher persist.Stasher) (*WriterV2, error) {
+	retval := &WriterV2{}
+	retval.WriterV1 = WriterV1{
+		Stasher:  stasher,
+		loopback: retval,
+	}
+	return retval, nil
+}
+
+func NewWriterV2WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV2, error) {
+	retval := &WriterV2{
+		WriterV1: WriterV1{
+			Stasher:  stasher,
+			loopback: loopback,
+		},
+	}
+	return retval, nil
+}
+
+func (dw WriterV2) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	err := dw.loopback.WriteState(ctx, *subject.State)
+	if err != nil {
+		return err
+	}
+
+	enc := newEncoder(2, transactionKind)
+	err = encodeTransactionV1(enc, subject)
+	if err != nil {
+		return err
+	}
+
+	enc.writeUvarint(uint64(len(subject.LineItems)))
+	for _, item := range subject.LineItems {
+		enc.writeBalance(item.Amount)
+		enc.writeStrings(item.Budget)
+		enc.writeString(item.Memo)
+		enc.writeString(item.Account)
+	}
+
+	enc.writeStrings(subject.Tags.Sorted())
+
+	keys := subject.Metadata.Keys()
+	enc.writeUvarint(uint64(len(keys)))
+	for _, key := range keys {
+		enc.writeString(key)
+		enc.writeString(subject.Metadata[key])
+	}
+
+	enc.writeUvarint(uint64(len(subject.Attachments)))
+	for _, attachment := range subject.Attachments {
+		enc.writeID(attachment.Blob)
+		enc.writeString(attachment.Filename)
+		enc.writeString(attachment.MediaType)
+	}
+
+	enc.writeDate(subject.PostedDate)
+	enc.writeDate(subject.ActualDate)
+	enc.WriteByte(byte(subject.TimeHashing))
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
+
+func (dw WriterV2) WriteState(ctx context.Context, subject envelopes.State) error {
+	if subject.Accounts == nil {
+		subject.Accounts = make(envelopes.Accounts, 0)
+	}
+	err := dw.loopback.WriteAccounts(ctx, subject.Accounts)
+	if err != nil {
+		return err
+	}
+
+	if subject.Budget == nil {
+		subject.Budget = &envelopes.Budget{}
+	}
+	err = dw.loopback.WriteBudget(ctx, *subject.Budget)
+	if err != nil {
+		return err
+	}
+
+	enc := newEncoder(2, stateKind)
+	enc.writeID(subject.Budget.ID())
+	enc.writeID(subject.Accounts.ID())
+
+	// Accounts whose AccountDetails are all zero are left out, the same as they are when computing the State's ID.
+	names := subject.Metadata.Names()
+	enc.writeUvarint(uint64(len(names)))
+	for _, name := range names {
+		details := subject.Metadata[name]
+		enc.writeString(name)
+		enc.writeString(string(details.Class))
+		enc.writeString(string(details.Subtype))
+		enc.writeString(details.Institution)
+		enc.writeString(string(details.Currency))
+		if details.Closed {
+			enc.WriteByte(1)
+		} else {
+			enc.WriteByte(0)
+		}
+	}
+
+	return dw.Stash(ctx, subject.ID(), enc.Bytes())
+}
@@ -0,0 +1,107 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/marstr/envelopes"
+)
+
+// StashBlob writes a Blob, like a scanned receipt, under its ID. Blobs are stored exactly as they are given, no matter
+// which object format is used for everything else.
+func StashBlob(ctx context.Context, stasher Stasher, blob envelopes.Blob) (envelopes.ID, error) {
+	id := blob.ID()
+	return id, stasher.Stash(ctx, id, blob)
+}
+
+// FetchBlob reads a Blob that was written by StashBlob. If what is found doesn't match id, an ErrCorruptObject is
+// returned.
+func FetchBlob(ctx context.Context, fetcher Fetcher, id envelopes.ID) (envelopes.Blob, error) {
+	payload, err := fetcher.Fetch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := envelopes.Blob(payload)
+	if found := retval.ID(); !found.Equal(id) {
+		return nil, ErrCorruptObject{ID: id, Err: fmt.Errorf("contents have ID %s", found)}
+	}
+	return retval, nil
+}
+
+// CopyAttachments duplicates each Blob attached to transaction from src to dest. If dest is also a Fetcher, Blobs that it
+// already has are skipped.
+func CopyAttachments(ctx context.Context, src Fetcher, dest Stasher, transaction envelopes.Transaction) error {
+	existing, _ := dest.(Fetcher)
+
+	for _, attachment := range transaction.Attachments {
+		if existing != nil {
+			if _, err := FetchBlob(ctx, existing, attachment.Blob); err == nil {
+				continue
+			}
+		}
+
+		blob, err := FetchBlob(ctx, src, attachment.Blob)
+		if err != nil {
+			return err
+		}
+		if _, err = StashBlob(ctx, dest, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyAttachments behaves like CopyAttachments for repositories that may not hold Blobs at all. That is only an error
+// when transaction has Attachments.
+func copyAttachments(ctx context.Context, src, dest interface{}, transaction envelopes.Transaction) error {
+	if len(transaction.Attachments) == 0 {
+		return nil
+	}
+
+	fetcher, ok := src.(Fetcher)
+	if !ok {
+		return fmt.Errorf("%w: the source can not read attachments", ErrUnsupported)
+	}
+	stasher, ok := dest.(Stasher)
+	if !ok {
+		return fmt.Errorf("%w: the destination can not store attachments", ErrUnsupported)
+	}
+	return CopyAttachments(ctx, fetcher, stasher, transaction)
+}
+
+// FindBrokenAttachments searches the history of heads for attachments whose Blobs are either missing from fetcher, or
+// don't match their IDs. The IDs of those Blobs are returned in sorted order. If every attachment can be read, an empty
+// slice is returned without an error.
+func FindBrokenAttachments(ctx context.Context, loader Loader, fetcher Fetcher, heads ...envelopes.ID) ([]envelopes.ID, error) {
+	checked := make(map[envelopes.ID]struct{})
+	retval := make([]envelopes.ID, 0)
+
+	walker := Walker{Loader: loader}
+	err := walker.Walk(ctx, func(ctx context.Context, _ envelopes.ID, transaction envelopes.Transaction) error {
+		for _, attachment := range transaction.Attachments {
+			if _, ok := checked[attachment.Blob]; ok {
+				continue
+			}
+			checked[attachment.Blob] = struct{}{}
+
+			_, err := FetchBlob(ctx, fetcher, attachment.Blob)
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrCorrupt) {
+				retval = append(retval, attachment.Blob)
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, heads...)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].String() < retval[j].String()
+	})
+	return retval, nil
+}
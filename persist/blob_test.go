@@ -0,0 +1,144 @@
+package persist_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func TestFetchBlob_corrupt(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	id := envelopes.Blob("receipt").ID()
+	if err := repo.Stash(ctx, id, []byte("not the receipt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := persist.FetchBlob(ctx, repo, id); !errors.Is(err, persist.ErrCorrupt) {
+		t.Errorf("expected an error matching persist.ErrCorrupt, got: %v", err)
+	}
+}
+
+func TestBareClone_attachments(t *testing.T) {
+	ctx := context.Background()
+	src := persist.NewMemoryRepository()
+
+	receipt := envelopes.Blob("Total: $12.50")
+	if _, err := persist.StashBlob(ctx, src, receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := envelopes.Transaction{
+		Comment:     "Lunch",
+		Attachments: []envelopes.Attachment{envelopes.NewAttachment(receipt, "lunch.txt", "text/plain")},
+	}
+	if err := src.WriteTransaction(ctx, transaction); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.WriteBranch(ctx, persist.DefaultBranch, transaction.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := persist.NewMemoryRepository()
+	if err := persist.BareClone(ctx, src, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := persist.FetchBlob(ctx, dest, receipt.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(receipt) {
+		t.Errorf("got %q want %q", got, receipt)
+	}
+}
+
+func TestFindBrokenAttachments(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	present := envelopes.Blob("present")
+	if _, err := persist.StashBlob(ctx, repo, present); err != nil {
+		t.Fatal(err)
+	}
+	missing := envelopes.Blob("missing")
+	corrupt := envelopes.Blob("corrupt")
+	if err := repo.Stash(ctx, corrupt.ID(), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+
+	first := envelopes.Transaction{
+		Comment:     "First",
+		Attachments: []envelopes.Attachment{envelopes.NewAttachment(present, "", ""), envelopes.NewAttachment(missing, "", "")},
+	}
+	second := envelopes.Transaction{
+		Comment:     "Second",
+		Parents:     []envelopes.ID{first.ID()},
+		Attachments: []envelopes.Attachment{envelopes.NewAttachment(corrupt, "", ""), envelopes.NewAttachment(missing, "", "")},
+	}
+	for _, transaction := range []envelopes.Transaction{first, second} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := persist.FindBrokenAttachments(ctx, repo, repo, second.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []envelopes.ID{missing.ID(), corrupt.ID()}
+	if want[1].String() < want[0].String() {
+		want[0], want[1] = want[1], want[0]
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestFetch_attachments(t *testing.T) {
+	ctx := context.Background()
+	src := persist.NewMemoryRepository()
+
+	receipt := envelopes.Blob("Total: $12.50")
+	if _, err := persist.StashBlob(ctx, src, receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := envelopes.Transaction{
+		Comment:     "Lunch",
+		Attachments: []envelopes.Attachment{envelopes.NewAttachment(receipt, "lunch.txt", "text/plain")},
+	}
+	if err := src.WriteTransaction(ctx, transaction); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.WriteBranch(ctx, persist.DefaultBranch, transaction.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := persist.NewMemoryRepository()
+	if err := persist.Fetch(ctx, "origin", src, fetched); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := persist.NewMemoryRepository()
+	if err := persist.Push(ctx, persist.DefaultBranch, src, pushed); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, dest := range map[string]*persist.MemoryRepository{"fetch": fetched, "push": pushed} {
+		got, err := persist.FetchBlob(ctx, dest, receipt.ID())
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != string(receipt) {
+			t.Errorf("%s: got %q want %q", name, got, receipt)
+		}
+	}
+}
@@ -0,0 +1,587 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package bundle packs a selection of branches, and every object reachable from them, into a single tar archive that
+// can be handed to somebody else and imported into their repository.
+//
+// A bundle always starts with a manifest describing the branches it contains, the Transactions it assumes the
+// recipient already has, and a SHA-256 checksum of every object in it. Objects follow the manifest, marshaled with the
+// newest JSON object format, regardless of the format used by the repository they were read from. The Blobs attached to
+// Transactions are included exactly as they are.
+//
+// If the repository a bundle is written from keeps an envelopes.Clearing, the manifest also carries the part of it that
+// concerns the bundled history, which is merged into the Clearing of the repository the bundle is imported into.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+const (
+	// ManifestName is the name of the archive entry which holds the Manifest. It is always the first entry.
+	ManifestName = "manifest.json"
+
+	// ObjectsDir is the name of the directory in the archive that holds marshaled objects.
+	ObjectsDir = "objects"
+
+	// CurrentVersion is the version of the bundle format written by this package.
+	CurrentVersion uint = 1
+)
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	// Version is the version of the bundle format.
+	Version uint `json:"version"`
+
+	// Objects identifies how the objects in the bundle were marshaled.
+	Objects ObjectFormat `json:"objects"`
+
+	// Refs are the branches contained in the bundle, and the Transactions they point at.
+	Refs map[string]envelopes.ID `json:"refs"`
+
+	// Prerequisites are Transactions that the bundle does not contain, but which are parents of Transactions that it
+	// does. A repository must already have them before the bundle can be meaningfully imported.
+	Prerequisites []envelopes.ID `json:"prerequisites,omitempty"`
+
+	// Transactions lists every Transaction in the bundle, ordered so that parents always come before their children.
+	Transactions []envelopes.ID `json:"transactions"`
+
+	// Checksums maps each object in the bundle to the hex encoded SHA-256 hash of its marshaled form.
+	Checksums map[envelopes.ID]string `json:"checksums"`
+
+	// Clearing holds the statuses and Reconciliations of the Transactions in the bundle, and of those reachable from
+	// its basis, as written by persistJson.MarshalClearing. It is left out when there are none.
+	Clearing json.RawMessage `json:"clearing,omitempty"`
+}
+
+// ObjectFormat describes how objects were marshaled.
+type ObjectFormat struct {
+	Format  string `json:"format"`
+	Version uint   `json:"version"`
+}
+
+// ErrChecksumMismatch indicates that an object in a bundle has been corrupted.
+type ErrChecksumMismatch envelopes.ID
+
+func (err ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("object %s does not match its checksum", envelopes.ID(err))
+}
+
+// Is allows ErrChecksumMismatch to match persist.ErrCorrupt.
+func (err ErrChecksumMismatch) Is(target error) bool {
+	return target == persist.ErrCorrupt
+}
+
+// ErrMissingPrerequisite indicates that a bundle could not be imported, because the repository does not have a
+// Transaction that the bundle builds upon.
+type ErrMissingPrerequisite envelopes.ID
+
+func (err ErrMissingPrerequisite) Error() string {
+	return fmt.Sprintf("repository is missing prerequisite transaction %s", envelopes.ID(err))
+}
+
+// Is allows ErrMissingPrerequisite to match persist.ErrNotFound.
+func (err ErrMissingPrerequisite) Is(target error) bool {
+	return target == persist.ErrNotFound
+}
+
+// ErrUnsupportedBundle indicates that a bundle was produced in a way this version of the package doesn't understand.
+type ErrUnsupportedBundle Manifest
+
+func (err ErrUnsupportedBundle) Error() string {
+	return fmt.Sprintf("unsupported bundle version %d with %s objects version %d", err.Version, err.Objects.Format, err.Objects.Version)
+}
+
+// Is allows ErrUnsupportedBundle to match persist.ErrUnsupported.
+func (err ErrUnsupportedBundle) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
+
+var errMissingManifest = errors.New("bundle does not start with a manifest")
+
+type writeOptions struct {
+	Basis []persist.RefSpec
+}
+
+// WriteOption modifies the behavior of Write.
+type WriteOption func(options *writeOptions) error
+
+// WriteBasis makes Write produce an incremental bundle, which omits every Transaction reachable from the given
+// RefSpecs. The recipient is expected to already have them.
+func WriteBasis(refs ...persist.RefSpec) WriteOption {
+	return func(options *writeOptions) error {
+		options.Basis = append(options.Basis, refs...)
+		return nil
+	}
+}
+
+// Write produces a bundle containing the named branches of `src` and every Transaction reachable from them.
+//
+// Each Transaction is accompanied by all the objects needed to load it, even if the recipient may already have some
+// of them, so that a bundle can be imported into any persist.BareRepositoryWriter. That includes the Blobs attached to
+// it, which requires `src` to be a persist.Fetcher whenever there are any. If `src` is also a persist.ClearingReader,
+// the part of its envelopes.Clearing that concerns those Transactions, or the ones reachable from the basis, is
+// included in the Manifest.
+func Write(ctx context.Context, output io.Writer, src persist.BareRepositoryReader, branches []string, options ...WriteOption) error {
+	var aggregatedOptions writeOptions
+	for _, option := range options {
+		if err := option(&aggregatedOptions); err != nil {
+			return err
+		}
+	}
+
+	manifest := Manifest{
+		Version: CurrentVersion,
+		Objects: ObjectFormat{
+			Format:  "json",
+			Version: persistJson.NewestVersion,
+		},
+		Refs:         make(map[string]envelopes.ID, len(branches)),
+		Transactions: make([]envelopes.ID, 0),
+		Checksums:    make(map[envelopes.ID]string),
+	}
+
+	heads := make([]envelopes.ID, 0, len(branches))
+	for _, branch := range branches {
+		head, err := src.ReadBranch(ctx, branch)
+		if err != nil {
+			return err
+		}
+		manifest.Refs[branch] = head
+
+		// An empty branch is still recorded, but there is no history behind it to include.
+		if head.Equal(envelopes.ID{}) {
+			continue
+		}
+		heads = append(heads, head)
+	}
+
+	known, err := findKnown(ctx, src, aggregatedOptions.Basis)
+	if err != nil {
+		return err
+	}
+
+	included := make(map[envelopes.ID]envelopes.Transaction)
+	prerequisites := make(map[envelopes.ID]struct{})
+	walker := persist.Walker{Loader: src}
+	err = walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		if _, ok := known[id]; ok {
+			prerequisites[id] = struct{}{}
+			return persist.ErrSkipAncestors{}
+		}
+		included[id] = transaction
+		return nil
+	}, heads...)
+	if err != nil {
+		return err
+	}
+
+	for id := range prerequisites {
+		manifest.Prerequisites = append(manifest.Prerequisites, id)
+	}
+	sortIDs(manifest.Prerequisites)
+
+	objects := make(objectSet)
+	writer, err := persistJson.NewWriterV9(objects)
+	if err != nil {
+		return err
+	}
+
+	manifest.Transactions = parentsFirst(included, heads)
+	for _, id := range manifest.Transactions {
+		transaction := included[id]
+		if len(transaction.Attachments) > 0 {
+			fetcher, ok := src.(persist.Fetcher)
+			if !ok {
+				return fmt.Errorf("%w: the source can not read attachments", persist.ErrUnsupported)
+			}
+			err = persist.CopyAttachments(ctx, fetcher, objects, transaction)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = writer.WriteTransaction(ctx, transaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	for id, payload := range objects {
+		checksum := sha256.Sum256(payload)
+		manifest.Checksums[id] = hex.EncodeToString(checksum[:])
+	}
+
+	if reader, ok := src.(persist.ClearingReader); ok {
+		manifest.Clearing, err = bundledClearing(ctx, reader, included, known)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeArchive(output, manifest, objects)
+}
+
+// bundledClearing marshals the part of a repository's Clearing that concerns Transactions which are either included in
+// a bundle, or already known to its recipient. If there is nothing to say about any of them, nil is returned.
+func bundledClearing(ctx context.Context, reader persist.ClearingReader, included map[envelopes.ID]envelopes.Transaction, known map[envelopes.ID]struct{}) (json.RawMessage, error) {
+	clearing, err := reader.ReadClearing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	relevant := func(id envelopes.ID) bool {
+		if _, ok := included[id]; ok {
+			return true
+		}
+		_, ok := known[id]
+		return ok
+	}
+
+	var bundled envelopes.Clearing
+	for id, status := range clearing.Statuses {
+		if relevant(id) {
+			bundled.SetStatus(id, status)
+		}
+	}
+	for _, checkpoint := range clearing.Reconciliations {
+		if relevant(checkpoint.Transaction) {
+			bundled.AddReconciliation(checkpoint.DeepCopy())
+		}
+	}
+
+	if len(bundled.Statuses) == 0 && len(bundled.Reconciliations) == 0 {
+		return nil, nil
+	}
+	return persistJson.MarshalClearing(bundled)
+}
+
+// Read imports a bundle into `dest`, writing each Transaction it contains and then updating each branch it contains.
+// Every object is checked against its checksum before anything is written. If any Transaction has attachments, `dest`
+// must also be a persist.Stasher, so that their Blobs can be written before the Transaction is.
+//
+// If `dest` is also a persist.Loader, it is checked for the bundle's prerequisites before anything is written, and
+// ErrMissingPrerequisite is returned if any are absent. If `dest` is a persist.ClearingReaderWriter, the Clearing carried
+// by the bundle is merged into its own using persist.MergeClearing.
+func Read(ctx context.Context, input io.Reader, dest persist.BareRepositoryWriter) (*Manifest, error) {
+	manifest, objects, err := readArchive(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var incoming envelopes.Clearing
+	if len(manifest.Clearing) > 0 {
+		err = persistJson.UnmarshalClearing(manifest.Clearing, &incoming)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to read the clearing in the manifest: %v", persist.ErrCorrupt, err)
+		}
+	}
+
+	if loader, ok := dest.(persist.Loader); ok {
+		for _, prerequisite := range manifest.Prerequisites {
+			var existing envelopes.Transaction
+			if err = loader.LoadTransaction(ctx, prerequisite, &existing); err != nil {
+				return nil, ErrMissingPrerequisite(prerequisite)
+			}
+		}
+	}
+
+	reader, err := persistJson.NewLoaderV9(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range manifest.Transactions {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// Intentionally Left Blank
+		}
+
+		var transaction envelopes.Transaction
+		err = reader.LoadTransaction(ctx, id, &transaction)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(transaction.Attachments) > 0 {
+			stasher, ok := dest.(persist.Stasher)
+			if !ok {
+				return nil, fmt.Errorf("%w: the destination can not store attachments", persist.ErrUnsupported)
+			}
+			err = persist.CopyAttachments(ctx, objects, stasher, transaction)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = dest.WriteTransaction(ctx, transaction)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if readerWriter, ok := dest.(persist.ClearingReaderWriter); ok && len(manifest.Clearing) > 0 {
+		err = persist.MergeClearing(ctx, readerWriter, incoming)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for branch, head := range manifest.Refs {
+		err = dest.WriteBranch(ctx, branch, head)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// ReadManifest reads only the Manifest from the start of a bundle, without validating or importing its contents.
+func ReadManifest(input io.Reader) (*Manifest, error) {
+	return readManifest(tar.NewReader(input))
+}
+
+func writeArchive(output io.Writer, manifest Manifest, objects objectSet) error {
+	archive := tar.NewWriter(output)
+
+	marshaledManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Use a fixed timestamp, so that the same contents always produce the same bundle.
+	modified := time.Unix(0, 0).UTC()
+
+	err = writeEntry(archive, ManifestName, marshaledManifest, modified)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]envelopes.ID, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	for _, id := range ids {
+		err = writeEntry(archive, objectName(id), objects[id], modified)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeEntry(archive *tar.Writer, name string, contents []byte, modified time.Time) error {
+	err := archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(contents)),
+		Mode:     0644,
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = archive.Write(contents)
+	return err
+}
+
+func readArchive(input io.Reader) (*Manifest, objectSet, error) {
+	archive := tar.NewReader(input)
+
+	manifest, err := readManifest(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objects := make(objectSet, len(manifest.Checksums))
+	for {
+		var header *tar.Header
+		header, err = archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg || path.Dir(header.Name) != ObjectsDir {
+			continue
+		}
+
+		var id envelopes.ID
+		rawID := strings.TrimSuffix(path.Base(header.Name), ".json")
+		if len(rawID) != 2*len(id) {
+			return nil, nil, fmt.Errorf("%q is not named like an object", header.Name)
+		}
+		err = id.UnmarshalText([]byte(rawID))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		want, ok := manifest.Checksums[id]
+		if !ok {
+			return nil, nil, fmt.Errorf("object %s is not listed in the manifest", id)
+		}
+
+		var payload []byte
+		payload, err = io.ReadAll(archive)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		got := sha256.Sum256(payload)
+		if hex.EncodeToString(got[:]) != want {
+			return nil, nil, ErrChecksumMismatch(id)
+		}
+
+		objects[id] = payload
+	}
+
+	for id := range manifest.Checksums {
+		if _, ok := objects[id]; !ok {
+			return nil, nil, persist.ErrObjectNotFound(id)
+		}
+	}
+
+	return manifest, objects, nil
+}
+
+func readManifest(archive *tar.Reader) (*Manifest, error) {
+	header, err := archive.Next()
+	if err == io.EOF {
+		return nil, errMissingManifest
+	} else if err != nil {
+		return nil, err
+	}
+
+	if header.Name != ManifestName {
+		return nil, errMissingManifest
+	}
+
+	var manifest Manifest
+	err = json.NewDecoder(archive).Decode(&manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Version 9 of the JSON object format can read every object written since version 3.
+	if manifest.Version != CurrentVersion || manifest.Objects.Format != "json" || manifest.Objects.Version < 3 || manifest.Objects.Version > persistJson.NewestVersion {
+		return nil, ErrUnsupportedBundle(manifest)
+	}
+
+	return &manifest, nil
+}
+
+// findKnown gathers the IDs of every Transaction reachable from the given RefSpecs.
+func findKnown(ctx context.Context, src persist.BareRepositoryReader, basis []persist.RefSpec) (map[envelopes.ID]struct{}, error) {
+	known := make(map[envelopes.ID]struct{})
+	if len(basis) == 0 {
+		return known, nil
+	}
+
+	heads := make([]envelopes.ID, 0, len(basis))
+	for _, ref := range basis {
+		id, err := persist.BareResolve(ctx, src, ref)
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, id)
+	}
+
+	walker := persist.Walker{Loader: src}
+	err := walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, _ envelopes.Transaction) error {
+		known[id] = struct{}{}
+		return nil
+	}, heads...)
+	if err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
+// parentsFirst orders a set of Transactions so that each appears after all of its parents which are in the set.
+func parentsFirst(transactions map[envelopes.ID]envelopes.Transaction, heads []envelopes.ID) []envelopes.ID {
+	ordered := make([]envelopes.ID, 0, len(transactions))
+	visited := make(map[envelopes.ID]struct{}, len(transactions))
+
+	var visit func(envelopes.ID)
+	visit = func(id envelopes.ID) {
+		transaction, ok := transactions[id]
+		if !ok {
+			return
+		}
+		if _, ok = visited[id]; ok {
+			return
+		}
+		visited[id] = struct{}{}
+
+		for _, parent := range transaction.Parents {
+			visit(parent)
+		}
+		ordered = append(ordered, id)
+	}
+
+	for _, head := range heads {
+		visit(head)
+	}
+	return ordered
+}
+
+func objectName(id envelopes.ID) string {
+	return path.Join(ObjectsDir, id.String()+".json")
+}
+
+func sortIDs(ids []envelopes.ID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+}
+
+// objectSet holds marshaled objects in memory while a bundle is being assembled or taken apart.
+type objectSet map[envelopes.ID][]byte
+
+func (objs objectSet) Stash(_ context.Context, id envelopes.ID, payload []byte) error {
+	objs[id] = payload
+	return nil
+}
+
+func (objs objectSet) Fetch(_ context.Context, id envelopes.ID) ([]byte, error) {
+	if payload, ok := objs[id]; ok {
+		return payload, nil
+	}
+	return nil, persist.ErrObjectNotFound(id)
+}
@@ -0,0 +1,357 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/bundle"
+	"github.com/marstr/envelopes/persist/filesystem"
+)
+
+func newHistory(ctx context.Context, t *testing.T) (*filesystem.Repository, []envelopes.Transaction) {
+	repo, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := make([]envelopes.Transaction, 0, 3)
+	var parents []envelopes.ID
+	for i, merchant := range []string{"Paycheck", "Landlord", "Grocer"} {
+		current := envelopes.Transaction{
+			Merchant: merchant,
+			Parents:  parents,
+			State: &envelopes.State{
+				Budget: &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(int64(100*(i+1)), 1)}},
+				Accounts: envelopes.Accounts{
+					"checking": envelopes.Balance{"USD": big.NewRat(int64(100*(i+1)), 1)},
+				},
+			},
+		}
+		if err = repo.WriteTransaction(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, current)
+		parents = []envelopes.ID{current.ID()}
+	}
+
+	if err = repo.WriteBranch(ctx, persist.DefaultBranch, parents[0]); err != nil {
+		t.Fatal(err)
+	}
+	return repo, history
+}
+
+func TestWriteRead_full(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, history := newHistory(ctx, t)
+
+	buf := &bytes.Buffer{}
+	if err := bundle.Write(ctx, buf, src, []string{persist.DefaultBranch}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dest, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	manifest, err := bundle.Read(ctx, buf, dest)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if got, want := len(manifest.Transactions), len(history); got != want {
+		t.Errorf("got %d transactions want %d", got, want)
+	}
+
+	for _, want := range history {
+		var got envelopes.Transaction
+		if err = dest.LoadTransaction(ctx, want.ID(), &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("imported transaction %q did not match the original", want.Merchant)
+		}
+	}
+
+	head, err := dest.ReadBranch(ctx, persist.DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := history[len(history)-1].ID(); !head.Equal(want) {
+		t.Errorf("got branch %s want %s", head, want)
+	}
+}
+
+func TestWriteRead_emptyBranch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, history := newHistory(ctx, t)
+	if err := src.WriteBranch(ctx, "empty", envelopes.ID{}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := bundle.Write(ctx, buf, src, []string{persist.DefaultBranch, "empty"}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dest, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	manifest, err := bundle.Read(ctx, buf, dest)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if got, want := len(manifest.Transactions), len(history); got != want {
+		t.Errorf("got %d transactions want %d", got, want)
+	}
+
+	head, ok := manifest.Refs["empty"]
+	if !ok {
+		t.Errorf("the empty branch should be recorded in the manifest")
+	} else if !head.Equal(envelopes.ID{}) {
+		t.Errorf("got branch %s want the zero ID", head)
+	}
+
+	head, err = dest.ReadBranch(ctx, "empty")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !head.Equal(envelopes.ID{}) {
+		t.Errorf("got branch %s want the zero ID", head)
+	}
+}
+
+func TestWriteRead_incremental(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, history := newHistory(ctx, t)
+
+	buf := &bytes.Buffer{}
+	err := bundle.Write(ctx, buf, src, []string{persist.DefaultBranch}, bundle.WriteBasis(persist.RefSpec(history[0].ID().String())))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	manifest, err := bundle.ReadManifest(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := len(manifest.Transactions); got != 2 {
+		t.Errorf("got %d transactions want 2", got)
+	}
+	if len(manifest.Prerequisites) != 1 || !manifest.Prerequisites[0].Equal(history[0].ID()) {
+		t.Errorf("unexpected prerequisites: %v", manifest.Prerequisites)
+	}
+
+	// A repository without the prerequisite should refuse the bundle.
+	empty, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = bundle.Read(ctx, bytes.NewReader(buf.Bytes()), empty)
+	if _, ok := err.(bundle.ErrMissingPrerequisite); !ok {
+		t.Errorf("expected ErrMissingPrerequisite, got: %v", err)
+	}
+
+	// One that has it should accept it.
+	if err = empty.WriteTransaction(ctx, history[0]); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = bundle.Read(ctx, bytes.NewReader(buf.Bytes()), empty); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteRead_clearing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, history := newHistory(ctx, t)
+	unrelated := envelopes.Transaction{Merchant: "Elsewhere"}
+	if err := src.WriteTransaction(ctx, unrelated); err != nil {
+		t.Fatal(err)
+	}
+
+	var clearing envelopes.Clearing
+	clearing.SetStatus(history[0].ID(), envelopes.Reconciled)
+	clearing.SetStatus(history[1].ID(), envelopes.Cleared)
+	clearing.SetStatus(unrelated.ID(), envelopes.Cleared)
+	if err := src.WriteClearing(ctx, clearing); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err := bundle.Write(ctx, buf, src, []string{persist.DefaultBranch}, bundle.WriteBasis(persist.RefSpec(history[0].ID().String())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The recipient already reconciled the Transaction that was Cleared in src, and must not lose that.
+	dest, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dest.WriteTransaction(ctx, history[0]); err != nil {
+		t.Fatal(err)
+	}
+	var existing envelopes.Clearing
+	existing.SetStatus(history[1].ID(), envelopes.Reconciled)
+	if err = dest.WriteClearing(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = bundle.Read(ctx, bytes.NewReader(buf.Bytes()), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	var want envelopes.Clearing
+	want.SetStatus(history[0].ID(), envelopes.Reconciled)
+	want.SetStatus(history[1].ID(), envelopes.Reconciled)
+	got, err := dest.ReadClearing(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("unexpected Clearing after import\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestRead_corrupted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, _ := newHistory(ctx, t)
+
+	original := &bytes.Buffer{}
+	if err := bundle.Write(ctx, original, src, []string{persist.DefaultBranch}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Re-pack the archive, flipping the contents of the last object.
+	corrupted := &bytes.Buffer{}
+	in := tar.NewReader(original)
+	out := tar.NewWriter(corrupted)
+	var lastName string
+	entries := make(map[string][]byte)
+	order := make([]*tar.Header, 0)
+	for {
+		header, err := in.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Error(err)
+			return
+		}
+		contents, err := io.ReadAll(in)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		entries[header.Name] = contents
+		order = append(order, header)
+		lastName = header.Name
+	}
+	entries[lastName] = append([]byte(" "), entries[lastName]...)
+	for _, header := range order {
+		header.Size = int64(len(entries[header.Name]))
+		if err := out.WriteHeader(header); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := out.Write(entries[header.Name]); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dest, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = bundle.Read(ctx, corrupted, dest)
+	if _, ok := err.(bundle.ErrChecksumMismatch); !ok {
+		t.Errorf("expected ErrChecksumMismatch, got: %v", err)
+	}
+}
+
+func TestWriteRead_attachments(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := envelopes.Blob("%PDF-1.4 Hardware store")
+	if _, err = persist.StashBlob(ctx, src, receipt); err != nil {
+		t.Fatal(err)
+	}
+	transaction := envelopes.Transaction{
+		Merchant:    "Hardware store",
+		Attachments: []envelopes.Attachment{envelopes.NewAttachment(receipt, "receipt.pdf", "application/pdf")},
+	}
+	if err = src.WriteTransaction(ctx, transaction); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.WriteBranch(ctx, persist.DefaultBranch, transaction.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = bundle.Write(ctx, buf, src, []string{persist.DefaultBranch}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bundle.Read(ctx, buf, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := persist.FetchBlob(ctx, dest, receipt.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(receipt) {
+		t.Errorf("got %q want %q", got, receipt)
+	}
+}
@@ -2,12 +2,12 @@ package persist
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/marstr/envelopes"
-
-	"github.com/marstr/collection/v2"
 )
 
 // ErrTypeMismatch is when an
@@ -28,23 +28,70 @@ func (err ErrTypeMismatch) Error() string {
 }
 
 // Cache provides a place to stash objects between calls to an actual Loader/Writer which are presumably more expensive.
-// It can be used without setting a backing Loader/Writer.
+// It can be used without setting a backing Loader/Writer. It is safe for concurrent use, so long as the backing
+// Loader/Writer are as well.
+//
+// When it is full, the least recently used objects are evicted to make room for new ones.
+//
+// Objects are copied as they enter the Cache and again as they are loaded from it, so modifying an object that has been
+// written or loaded never changes what later loads return.
 type Cache struct {
-	lruCache *collection.LRUCache[envelopes.ID, envelopes.IDer]
+	store *lruStore
 	Loader
 	Writer
 }
 
-// NewCache creates a new empty cache of IDers.
-func NewCache(capacity uint) *Cache {
+// CacheOption modifies the behavior of a Cache as it is created.
+type CacheOption func(*lruStore)
+
+// CacheNegativeTTL causes a Cache to remember, for the given duration, that its Loader reported an object as not
+// existing. Until that time has passed, requests for the same object are answered with ErrObjectNotFound without
+// consulting the Loader again. Writing the object clears the remembered result.
+func CacheNegativeTTL(ttl time.Duration) CacheOption {
+	return func(lru *lruStore) {
+		lru.negativeTTL = ttl
+	}
+}
+
+// NewCache creates a new empty cache of IDers, which holds at most capacity objects.
+func NewCache(capacity uint, options ...CacheOption) *Cache {
+	store := newLRUStore()
+	store.countLimited = true
+	store.maxCount = capacity
+	for _, option := range options {
+		option(store)
+	}
+
 	return &Cache{
-		lruCache: collection.NewLRUCache[envelopes.ID, envelopes.IDer](capacity),
+		store: store,
 	}
 }
 
+// NewCacheWithByteCapacity creates a new empty cache of IDers, which holds as many objects as it can without their
+// approximate size in memory exceeding capacity. This is a better fit than NewCache when the size of objects varies a
+// lot, for instance when some Budgets are deeply nested and others aren't.
+func NewCacheWithByteCapacity(capacity uint64, options ...CacheOption) *Cache {
+	store := newLRUStore()
+	store.bytesLimited = true
+	store.maxBytes = capacity
+	for _, option := range options {
+		option(store)
+	}
+
+	return &Cache{
+		store: store,
+	}
+}
+
+// Stats reports how effective this Cache has been since it was created.
+func (c Cache) Stats() CacheStats {
+	return c.store.snapshot()
+}
+
 // WriteTransaction adds a Transaction to this cache. If Writer isn't nil, it is immediately invoked.
 func (c Cache) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
-	c.lruCache.Put(subject.ID(), &subject)
+	cacheCopy := subject.DeepCopy()
+	c.store.put(subject.ID(), &cacheCopy)
 	if c.Writer == nil {
 		return nil
 	}
@@ -53,7 +100,8 @@ func (c Cache) WriteTransaction(ctx context.Context, subject envelopes.Transacti
 
 // WriteState adds a State to this cache. If Writer isn't nil, it is immediately invoked.
 func (c Cache) WriteState(ctx context.Context, subject envelopes.State) error {
-	c.lruCache.Put(subject.ID(), &subject)
+	cacheCopy := subject.DeepCopy()
+	c.store.put(subject.ID(), &cacheCopy)
 	if c.Writer == nil {
 		return nil
 	}
@@ -62,7 +110,8 @@ func (c Cache) WriteState(ctx context.Context, subject envelopes.State) error {
 
 // WriteBudget adds a Budget to this cache. If Writer isn't nil, it is immediately invoked.
 func (c Cache) WriteBudget(ctx context.Context, subject envelopes.Budget) error {
-	c.lruCache.Put(subject.ID(), &subject)
+	cacheCopy := subject.DeepCopy()
+	c.store.put(subject.ID(), &cacheCopy)
 	if c.Writer == nil {
 		return nil
 	}
@@ -71,7 +120,8 @@ func (c Cache) WriteBudget(ctx context.Context, subject envelopes.Budget) error
 
 // WriteAccounts adds an instance of Accounts to this cache. If Writer isn't nil, it is immediately invoked.
 func (c Cache) WriteAccounts(ctx context.Context, subject envelopes.Accounts) error {
-	c.lruCache.Put(subject.ID(), &subject)
+	cacheCopy := subject.DeepCopy()
+	c.store.put(subject.ID(), &cacheCopy)
 	if c.Writer == nil {
 		return nil
 	}
@@ -82,7 +132,7 @@ func (c Cache) WriteAccounts(ctx context.Context, subject envelopes.Accounts) er
 // cache, it doesn't invoke Loader. If it is not present, and Loader is not nil, it invokes Loader and adds the result
 // to the cache.
 func (c Cache) LoadTransaction(ctx context.Context, subject envelopes.ID, destination *envelopes.Transaction) error {
-	cached, ok := c.lruCache.Get(subject)
+	cached, ok := c.store.get(subject)
 	if !ok {
 		return c.missTransaction(ctx, subject, destination)
 	}
@@ -90,16 +140,18 @@ func (c Cache) LoadTransaction(ctx context.Context, subject envelopes.ID, destin
 }
 
 func (c Cache) missTransaction(ctx context.Context, subject envelopes.ID, destination *envelopes.Transaction) error {
-	if c.Loader == nil {
+	if c.Loader == nil || c.store.knownMissing(subject) {
 		return ErrObjectNotFound(subject)
 	}
 
 	var cacheCopy envelopes.Transaction
 	err := c.Loader.LoadTransaction(ctx, subject, &cacheCopy)
-	if err == nil {
-		c.lruCache.Put(subject, &cacheCopy)
+	if errors.Is(err, ErrNotFound) {
+		c.store.markMissing(subject)
+	} else if err == nil {
+		c.store.put(subject, &cacheCopy)
 	}
-	(*destination) = cacheCopy
+	(*destination) = cacheCopy.DeepCopy()
 	return err
 }
 
@@ -107,7 +159,7 @@ func (c Cache) missTransaction(ctx context.Context, subject envelopes.ID, destin
 // cache, it doesn't invoke Loader. If it is not present, and Loader is not nil, it invokes Loader and adds the result
 // to the cache.
 func (c Cache) LoadState(ctx context.Context, subject envelopes.ID, destination *envelopes.State) error {
-	cached, ok := c.lruCache.Get(subject)
+	cached, ok := c.store.get(subject)
 	if !ok {
 		return c.missState(ctx, subject, destination)
 	}
@@ -115,15 +167,17 @@ func (c Cache) LoadState(ctx context.Context, subject envelopes.ID, destination
 }
 
 func (c Cache) missState(ctx context.Context, subject envelopes.ID, destination *envelopes.State) error {
-	if c.Loader == nil {
+	if c.Loader == nil || c.store.knownMissing(subject) {
 		return ErrObjectNotFound(subject)
 	}
 
 	var cacheCopy envelopes.State
 	err := c.Loader.LoadState(ctx, subject, &cacheCopy)
-	if err == nil {
-		c.lruCache.Put(subject, &cacheCopy)
-		(*destination) = cacheCopy
+	if errors.Is(err, ErrNotFound) {
+		c.store.markMissing(subject)
+	} else if err == nil {
+		c.store.put(subject, &cacheCopy)
+		(*destination) = cacheCopy.DeepCopy()
 	}
 	return err
 }
@@ -132,7 +186,7 @@ func (c Cache) missState(ctx context.Context, subject envelopes.ID, destination
 // cache, it doesn't invoke Loader. If it is not present, and Loader is not nil, it invokes Loader and adds the result
 // to the cache.
 func (c Cache) LoadBudget(ctx context.Context, subject envelopes.ID, destination *envelopes.Budget) error {
-	cached, ok := c.lruCache.Get(subject)
+	cached, ok := c.store.get(subject)
 	if !ok {
 		return c.missBudget(ctx, subject, destination)
 	}
@@ -140,15 +194,17 @@ func (c Cache) LoadBudget(ctx context.Context, subject envelopes.ID, destination
 }
 
 func (c Cache) missBudget(ctx context.Context, subject envelopes.ID, destination *envelopes.Budget) error {
-	if c.Loader == nil {
+	if c.Loader == nil || c.store.knownMissing(subject) {
 		return ErrObjectNotFound(subject)
 	}
 
 	var cacheCopy envelopes.Budget
 	err := c.Loader.LoadBudget(ctx, subject, &cacheCopy)
-	if err == nil {
-		c.lruCache.Put(subject, &cacheCopy)
-		(*destination) = cacheCopy
+	if errors.Is(err, ErrNotFound) {
+		c.store.markMissing(subject)
+	} else if err == nil {
+		c.store.put(subject, &cacheCopy)
+		(*destination) = cacheCopy.DeepCopy()
 	}
 	return err
 }
@@ -157,7 +213,7 @@ func (c Cache) missBudget(ctx context.Context, subject envelopes.ID, destination
 // cache, it doesn't invoke Loader. If it is not present, and Loader is not nil, it invokes Loader and adds the result
 // to the cache.
 func (c Cache) LoadAccounts(ctx context.Context, subject envelopes.ID, destination *envelopes.Accounts) error {
-	cached, ok := c.lruCache.Get(subject)
+	cached, ok := c.store.get(subject)
 	if !ok {
 		return c.missAccounts(ctx, subject, destination)
 	}
@@ -165,14 +221,16 @@ func (c Cache) LoadAccounts(ctx context.Context, subject envelopes.ID, destinati
 }
 
 func (c Cache) missAccounts(ctx context.Context, subject envelopes.ID, destination *envelopes.Accounts) error {
-	if c.Loader == nil {
+	if c.Loader == nil || c.store.knownMissing(subject) {
 		return ErrObjectNotFound(subject)
 	}
 
 	var cacheCopy envelopes.Accounts
 	err := c.Loader.LoadAccounts(ctx, subject, &cacheCopy)
-	if err == nil {
-		c.lruCache.Put(subject, &cacheCopy)
+	if errors.Is(err, ErrNotFound) {
+		c.store.markMissing(subject)
+	} else if err == nil {
+		c.store.put(subject, &cacheCopy)
 		(*destination) = cacheCopy.DeepCopy()
 	}
 	return err
@@ -185,25 +243,25 @@ func (c Cache) hit(_ context.Context, cached interface{}, destination envelopes.
 		if !ok {
 			return NewErrTypeMismatch(cached, destination)
 		}
-		*(destination).(*envelopes.Transaction) = *cast
+		*(destination).(*envelopes.Transaction) = cast.DeepCopy()
 	case *envelopes.Budget:
 		cast, ok := cached.(*envelopes.Budget)
 		if !ok {
 			return NewErrTypeMismatch(cached, destination)
 		}
-		*(destination).(*envelopes.Budget) = *cast
+		*(destination).(*envelopes.Budget) = cast.DeepCopy()
 	case *envelopes.State:
 		cast, ok := cached.(*envelopes.State)
 		if !ok {
 			return NewErrTypeMismatch(cached, destination)
 		}
-		*(destination).(*envelopes.State) = *cast
+		*(destination).(*envelopes.State) = cast.DeepCopy()
 	case *envelopes.Accounts:
 		cast, ok := cached.(*envelopes.Accounts)
 		if !ok {
 			return NewErrTypeMismatch(cached, destination)
 		}
-		*(destination).(*envelopes.Accounts) = *cast
+		*(destination).(*envelopes.Accounts) = cast.DeepCopy()
 	default:
 		return NewErrUnloadableType(destination)
 	}
@@ -0,0 +1,304 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package persist
+
+import (
+	"container/list"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+// CacheStats is a point-in-time summary of how effective a Cache has been.
+type CacheStats struct {
+	// Hits is the number of loads which were satisfied by an object in the cache.
+	Hits uint64
+
+	// Misses is the number of loads which could not be satisfied by an object in the cache.
+	Misses uint64
+
+	// Evictions is the number of objects which were dropped to make room for others.
+	Evictions uint64
+
+	// NegativeHits is the number of Misses which were answered with ErrObjectNotFound because the backing Loader
+	// recently reported the same object missing. See CacheNegativeTTL.
+	NegativeHits uint64
+
+	// Objects is the number of objects currently held.
+	Objects uint
+
+	// Bytes is the approximate amount of memory used by the objects currently held.
+	Bytes uint64
+}
+
+type lruEntry struct {
+	id    envelopes.ID
+	value envelopes.IDer
+	size  uint64
+}
+
+// lruStore is the mutable portion of a Cache. It is kept behind a pointer, so that copies of a Cache all share it.
+type lruStore struct {
+	lock sync.Mutex
+
+	entries map[envelopes.ID]*list.Element
+	order   *list.List // Most recently used at the front.
+
+	countLimited bool
+	maxCount     uint
+	bytesLimited bool
+	maxBytes     uint64
+
+	negativeTTL time.Duration
+	negative    map[envelopes.ID]time.Time
+	now         func() time.Time
+
+	stats CacheStats
+}
+
+// negativeSweepThreshold is how many not-found results must be remembered before expired ones are cleaned up.
+const negativeSweepThreshold = 256
+
+func newLRUStore() *lruStore {
+	return &lruStore{
+		entries:  make(map[envelopes.ID]*list.Element),
+		order:    list.New(),
+		negative: make(map[envelopes.ID]time.Time),
+		now:      time.Now,
+	}
+}
+
+func (lru *lruStore) get(id envelopes.ID) (envelopes.IDer, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	found, ok := lru.entries[id]
+	if !ok {
+		lru.stats.Misses++
+		return nil, false
+	}
+
+	lru.stats.Hits++
+	lru.order.MoveToFront(found)
+	return found.Value.(*lruEntry).value, true
+}
+
+func (lru *lruStore) put(id envelopes.ID, value envelopes.IDer) {
+	size := approximateSize(value)
+
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	delete(lru.negative, id)
+
+	if found, ok := lru.entries[id]; ok {
+		lru.remove(found)
+	}
+
+	if lru.bytesLimited && size > lru.maxBytes {
+		// Holding this object would mean evicting everything else, and it still wouldn't fit.
+		return
+	}
+
+	lru.entries[id] = lru.order.PushFront(&lruEntry{
+		id:    id,
+		value: value,
+		size:  size,
+	})
+	lru.stats.Objects++
+	lru.stats.Bytes += size
+
+	for lru.overCapacity() {
+		lru.remove(lru.order.Back())
+		lru.stats.Evictions++
+	}
+}
+
+func (lru *lruStore) overCapacity() bool {
+	if lru.countLimited && lru.stats.Objects > lru.maxCount {
+		return true
+	}
+	return lru.bytesLimited && lru.stats.Bytes > lru.maxBytes
+}
+
+// remove expects the lock to be held.
+func (lru *lruStore) remove(element *list.Element) {
+	entry := lru.order.Remove(element).(*lruEntry)
+	delete(lru.entries, entry.id)
+	lru.stats.Objects--
+	lru.stats.Bytes -= entry.size
+}
+
+// knownMissing determines whether id was recently found not to exist. It only returns true if a negative TTL was
+// configured.
+func (lru *lruStore) knownMissing(id envelopes.ID) bool {
+	if lru.negativeTTL <= 0 {
+		return false
+	}
+
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	expiry, ok := lru.negative[id]
+	if !ok {
+		return false
+	}
+
+	if lru.now().After(expiry) {
+		delete(lru.negative, id)
+		return false
+	}
+
+	lru.stats.NegativeHits++
+	return true
+}
+
+// markMissing remembers that id was found not to exist, if a negative TTL was configured.
+func (lru *lruStore) markMissing(id envelopes.ID) {
+	if lru.negativeTTL <= 0 {
+		return
+	}
+
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	now := lru.now()
+	if len(lru.negative) >= negativeSweepThreshold {
+		for k, expiry := range lru.negative {
+			if now.After(expiry) {
+				delete(lru.negative, k)
+			}
+		}
+	}
+
+	lru.negative[id] = now.Add(lru.negativeTTL)
+}
+
+func (lru *lruStore) snapshot() CacheStats {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	return lru.stats
+}
+
+// Rough costs of the bookkeeping around values held in a Cache. These don't need to be exact, they just need to keep
+// large Budget trees from being treated the same as small Transactions.
+const (
+	sizeOfEntry   = 128 // The list element, map entry, and lruEntry.
+	sizeOfPointer = 8
+	sizeOfString  = 16
+	sizeOfRat     = 64
+	sizeOfMapItem = 48
+	sizeOfTime    = 24
+	sizeOfDate    = 24
+)
+
+// approximateSize estimates how much memory is retained by holding onto an object in a Cache.
+func approximateSize(subject envelopes.IDer) uint64 {
+	var retval uint64 = sizeOfEntry
+	switch cast := subject.(type) {
+	case *envelopes.Transaction:
+		retval += sizeOfTransaction(*cast)
+	case *envelopes.State:
+		retval += sizeOfState(*cast)
+	case *envelopes.Budget:
+		retval += sizeOfBudget(*cast)
+	case *envelopes.Accounts:
+		retval += sizeOfAccounts(*cast)
+	}
+	return retval
+}
+
+func sizeOfTransaction(subject envelopes.Transaction) uint64 {
+	retval := uint64(sizeOfPointer + 3*sizeOfTime + 2*sizeOfDate)
+	retval += sizeOfString + uint64(len(subject.Merchant))
+	retval += sizeOfString + uint64(len(subject.Comment))
+	retval += sizeOfString + uint64(len(subject.RecordID))
+	retval += 2*sizeOfString + uint64(len(subject.Committer.FullName)+len(subject.Committer.Email))
+	retval += uint64(len(subject.Parents)+len(subject.Reverts)) * uint64(len(envelopes.ID{}))
+	retval += sizeOfBalance(subject.Amount)
+	for _, item := range subject.LineItems {
+		retval += sizeOfBalance(item.Amount) + 2*sizeOfString + uint64(len(item.Memo)+len(item.Account))
+		for _, segment := range item.Budget {
+			retval += sizeOfString + uint64(len(segment))
+		}
+	}
+	for tag := range subject.Tags {
+		retval += sizeOfMapItem + uint64(len(tag))
+	}
+	for key, value := range subject.Metadata {
+		retval += sizeOfMapItem + uint64(len(key)) + sizeOfString + uint64(len(value))
+	}
+	for _, attachment := range subject.Attachments {
+		retval += uint64(len(attachment.Blob)) + 2*sizeOfString + uint64(len(attachment.Filename)+len(attachment.MediaType))
+	}
+	if subject.State != nil {
+		retval += sizeOfState(*subject.State)
+	}
+	return retval
+}
+
+func sizeOfState(subject envelopes.State) uint64 {
+	retval := uint64(3 * sizeOfPointer)
+	if subject.Budget != nil {
+		retval += sizeOfBudget(*subject.Budget)
+	}
+	return retval + sizeOfAccounts(subject.Accounts) + sizeOfMetadata(subject.Metadata)
+}
+
+func sizeOfBudget(subject envelopes.Budget) uint64 {
+	retval := sizeOfBalance(subject.Balance)
+	for name, child := range subject.Children {
+		retval += sizeOfMapItem + uint64(len(name)) + sizeOfPointer
+		if child != nil {
+			retval += sizeOfBudget(*child)
+		}
+	}
+	return retval
+}
+
+func sizeOfAccounts(subject envelopes.Accounts) uint64 {
+	var retval uint64
+	for name, balance := range subject {
+		retval += sizeOfMapItem + uint64(len(name)) + sizeOfBalance(balance)
+	}
+	return retval
+}
+
+func sizeOfMetadata(subject envelopes.AccountMetadata) uint64 {
+	var retval uint64
+	for name, details := range subject {
+		retval += sizeOfMapItem + uint64(len(name)) + 4*sizeOfString + 8
+		retval += uint64(len(details.Class) + len(details.Subtype) + len(details.Institution) + len(details.Currency))
+	}
+	return retval
+}
+
+func sizeOfBalance(subject envelopes.Balance) uint64 {
+	var retval uint64
+	for asset, magnitude := range subject {
+		retval += sizeOfMapItem + uint64(len(asset)) + sizeOfRat
+		if magnitude != nil {
+			retval += sizeOfInt(magnitude.Num()) + sizeOfInt(magnitude.Denom())
+		}
+	}
+	return retval
+}
+
+func sizeOfInt(subject *big.Int) uint64 {
+	return uint64(len(subject.Bits())) * sizeOfPointer
+}
@@ -2,8 +2,12 @@ package persist
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/marstr/envelopes"
 )
@@ -293,3 +297,312 @@ func testModifiedBudgetOnMiss(ctx context.Context) func(t *testing.T) {
 		}
 	}
 }
+
+func TestCache_Stats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := NewCache(2)
+
+	transactions := []envelopes.Transaction{
+		{Comment: "first"},
+		{Comment: "second"},
+		{Comment: "third"},
+	}
+	for _, transaction := range transactions {
+		if err := subject.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	var loaded envelopes.Transaction
+	if err := subject.LoadTransaction(ctx, transactions[2].ID(), &loaded); err != nil {
+		t.Error(err)
+	}
+	if err := subject.LoadTransaction(ctx, transactions[0].ID(), &loaded); err == nil {
+		t.Error("expected the first transaction to have been evicted")
+	}
+
+	want := CacheStats{
+		Hits:      1,
+		Misses:    1,
+		Evictions: 1,
+		Objects:   2,
+	}
+	got := subject.Stats()
+	got.Bytes = 0
+	if got != want {
+		t.Errorf("\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestCache_ByteCapacity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	small := envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}}
+	large := envelopes.Budget{Children: map[string]*envelopes.Budget{}}
+	for i := 0; i < 100; i++ {
+		large.Children[fmt.Sprint("child", i)] = &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(int64(i), 1)}}
+	}
+
+	capacity := 3 * approximateSize(&small)
+	if approximateSize(&large) <= capacity {
+		t.Fatal("test is misconfigured, the large budget should not fit in the cache")
+	}
+
+	subject := NewCacheWithByteCapacity(capacity)
+	if err := subject.WriteBudget(ctx, small); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := subject.WriteBudget(ctx, large); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var loaded envelopes.Budget
+	if err := subject.LoadBudget(ctx, small.ID(), &loaded); err != nil {
+		t.Errorf("a Budget too large to be cached should not have evicted anything: %v", err)
+	}
+	if err := subject.LoadBudget(ctx, large.ID(), &loaded); err == nil {
+		t.Error("a Budget larger than the capacity should not have been cached")
+	}
+
+	for i := int64(2); i < 10; i++ {
+		if err := subject.WriteBudget(ctx, envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(i, 1)}}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	stats := subject.Stats()
+	if stats.Bytes > capacity {
+		t.Errorf("cache holds %d bytes, which exceeds its capacity of %d", stats.Bytes, capacity)
+	}
+	if stats.Evictions == 0 {
+		t.Error("expected objects to have been evicted")
+	}
+}
+
+func TestCache_NegativeTTL(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	backing := &countingLoader{Loader: NewMemoryRepository()}
+	subject := NewCache(10, CacheNegativeTTL(time.Minute))
+	subject.Loader = backing
+
+	now := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	subject.store.now = func() time.Time { return now }
+
+	missing := envelopes.Transaction{Comment: "missing"}
+	var loaded envelopes.Transaction
+	for i := 0; i < 3; i++ {
+		if err := subject.LoadTransaction(ctx, missing.ID(), &loaded); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+	}
+	if backing.calls != 1 {
+		t.Errorf("backing Loader was called %d times, want 1", backing.calls)
+	}
+	if got := subject.Stats().NegativeHits; got != 2 {
+		t.Errorf("got %d negative hits want 2", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_ = subject.LoadTransaction(ctx, missing.ID(), &loaded)
+	if backing.calls != 2 {
+		t.Errorf("backing Loader should have been consulted after the TTL expired")
+	}
+
+	if err := subject.WriteTransaction(ctx, missing); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := subject.LoadTransaction(ctx, missing.ID(), &loaded); err != nil {
+		t.Errorf("writing an object should clear its negative entry: %v", err)
+	}
+}
+
+func TestCache_concurrent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const workers = 8
+	subject := NewCache(workers / 2)
+	subject.Loader = NewMemoryRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				transaction := envelopes.Transaction{Comment: fmt.Sprint(i, j%10)}
+				if err := subject.WriteTransaction(ctx, transaction); err != nil {
+					t.Error(err)
+					return
+				}
+				var loaded envelopes.Transaction
+				_ = subject.LoadTransaction(ctx, transaction.ID(), &loaded)
+				_ = subject.Stats()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := subject.Stats().Objects; got > workers/2 {
+		t.Errorf("cache holds %d objects, which exceeds its capacity of %d", got, workers/2)
+	}
+}
+
+type countingLoader struct {
+	Loader
+	calls int
+}
+
+func (cl *countingLoader) LoadTransaction(ctx context.Context, id envelopes.ID, destination *envelopes.Transaction) error {
+	cl.calls++
+	return cl.Loader.LoadTransaction(ctx, id, destination)
+}
+
+func TestCache_copyOnRead(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	newBudget := func() envelopes.Budget {
+		return envelopes.Budget{
+			Balance: envelopes.Balance{"USD": big.NewRat(100, 1)},
+			Children: map[string]*envelopes.Budget{
+				"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(25, 1)}},
+			},
+		}
+	}
+	newAccounts := func() envelopes.Accounts {
+		return envelopes.Accounts{"checking": {"USD": big.NewRat(125, 1)}}
+	}
+	newState := func() envelopes.State {
+		budget := newBudget()
+		return envelopes.State{Budget: &budget, Accounts: newAccounts()}
+	}
+	newTransaction := func() envelopes.Transaction {
+		state := newState()
+		return envelopes.Transaction{
+			State:   &state,
+			Amount:  envelopes.Balance{"USD": big.NewRat(-5, 1)},
+			Parents: []envelopes.ID{{1}},
+		}
+	}
+
+	mutateBudget := func(b *envelopes.Budget) {
+		b.Balance["USD"].SetInt64(1)
+		b.Children["groceries"].Balance["USD"].SetInt64(1)
+		b.Children["extra"] = &envelopes.Budget{}
+	}
+	mutateAccounts := func(a envelopes.Accounts) {
+		a["checking"]["USD"].SetInt64(1)
+		a["savings"] = envelopes.Balance{"USD": big.NewRat(1, 1)}
+	}
+
+	// Each scenario is run both with objects that are written straight into the Cache, and ones that the Cache has to
+	// fetch from its Loader.
+	scenarios := map[string]func() (*Cache, Writer){
+		"written": func() (*Cache, Writer) {
+			subject := NewCache(10)
+			return subject, subject
+		},
+		"loaded": func() (*Cache, Writer) {
+			backing := NewMemoryRepository()
+			subject := NewCache(10)
+			subject.Loader = backing
+			return subject, backing
+		},
+	}
+
+	for name, scenario := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			subject, writer := scenario()
+
+			budget := newBudget()
+			accounts := newAccounts()
+			state := newState()
+			transaction := newTransaction()
+			for _, o := range []envelopes.IDer{budget, accounts, state, transaction} {
+				if err := writeAny(ctx, writer, o); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			// Mutating the originals after they've been written shouldn't have any effect.
+			mutateBudget(&budget)
+			mutateAccounts(accounts)
+			mutateBudget(state.Budget)
+			mutateAccounts(transaction.State.Accounts)
+			transaction.Amount["USD"].SetInt64(1)
+			transaction.Parents[0] = envelopes.ID{2}
+
+			for i := 0; i < 2; i++ {
+				var loadedBudget envelopes.Budget
+				if err := subject.LoadBudget(ctx, newBudget().ID(), &loadedBudget); err != nil {
+					t.Error(err)
+					return
+				}
+				if !loadedBudget.Equal(newBudget()) {
+					t.Errorf("pass %d: Budget was modified", i)
+				}
+				mutateBudget(&loadedBudget)
+
+				var loadedAccounts envelopes.Accounts
+				if err := subject.LoadAccounts(ctx, newAccounts().ID(), &loadedAccounts); err != nil {
+					t.Error(err)
+					return
+				}
+				if loadedAccounts.ID() != newAccounts().ID() {
+					t.Errorf("pass %d: Accounts were modified", i)
+				}
+				mutateAccounts(loadedAccounts)
+
+				var loadedState envelopes.State
+				if err := subject.LoadState(ctx, newState().ID(), &loadedState); err != nil {
+					t.Error(err)
+					return
+				}
+				if !loadedState.Equal(newState()) {
+					t.Errorf("pass %d: State was modified", i)
+				}
+				mutateBudget(loadedState.Budget)
+				mutateAccounts(loadedState.Accounts)
+
+				var loadedTransaction envelopes.Transaction
+				if err := subject.LoadTransaction(ctx, newTransaction().ID(), &loadedTransaction); err != nil {
+					t.Error(err)
+					return
+				}
+				if !loadedTransaction.Equal(newTransaction()) {
+					t.Errorf("pass %d: Transaction was modified", i)
+				}
+				mutateBudget(loadedTransaction.State.Budget)
+				loadedTransaction.Amount["USD"].SetInt64(1)
+				loadedTransaction.Parents[0] = envelopes.ID{2}
+			}
+		})
+	}
+}
+
+func writeAny(ctx context.Context, writer Writer, subject envelopes.IDer) error {
+	switch cast := subject.(type) {
+	case envelopes.Transaction:
+		return writer.WriteTransaction(ctx, cast)
+	case envelopes.State:
+		return writer.WriteState(ctx, cast)
+	case envelopes.Budget:
+		return writer.WriteBudget(ctx, cast)
+	case envelopes.Accounts:
+		return writer.WriteAccounts(ctx, cast)
+	default:
+		return NewErrUnloadableType(subject)
+	}
+}
@@ -0,0 +1,186 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/marstr/envelopes"
+)
+
+// ClearingReaderWriter exposes a contract that requires both ClearingReader and ClearingWriter functionality to be
+// implemented.
+type ClearingReaderWriter interface {
+	ClearingReader
+	ClearingWriter
+}
+
+// ClearingReader allows the caller to view the envelopes.Clearing kept alongside a repository's history. When both
+// repositories involved in BareClone, Fetch, or Push keep a Clearing, the source's is merged into the destination's
+// using MergeClearing, so that a Transaction marked as Cleared or Reconciled on one machine stays that way on the
+// others. Bundles carry the part of a Clearing that concerns the history they contain, and merge it the same way.
+type ClearingReader interface {
+	// ReadClearing fetches the most recently written Clearing. If none has been written yet, an empty one is returned.
+	ReadClearing(ctx context.Context) (envelopes.Clearing, error)
+}
+
+// ClearingWriter allows the caller to update the envelopes.Clearing kept alongside a repository's history.
+type ClearingWriter interface {
+	// WriteClearing replaces the Clearing. Because it isn't part of any Transaction, this doesn't change any IDs.
+	WriteClearing(ctx context.Context, subject envelopes.Clearing) error
+}
+
+// MergeClearing merges incoming into the Clearing kept by dest, as described by envelopes.Clearing.Merge, and writes the
+// result if it changed anything. If dest reports ErrUnsupported when its Clearing is read, there is nowhere to put
+// incoming, so nothing is done.
+func MergeClearing(ctx context.Context, dest ClearingReaderWriter, incoming envelopes.Clearing) error {
+	existing, err := dest.ReadClearing(ctx)
+	if errors.Is(err, ErrUnsupported) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	merged := existing.Merge(incoming)
+	if merged.Equal(existing) {
+		return nil
+	}
+	return dest.WriteClearing(ctx, merged)
+}
+
+// transferClearing merges the Clearing of src into that of dest. Repositories that don't keep a Clearing, or that
+// report ErrUnsupported when asked for it, are skipped, since there is nothing to transfer or nowhere to put it.
+func transferClearing(ctx context.Context, src, dest interface{}) error {
+	reader, ok := src.(ClearingReader)
+	if !ok {
+		return nil
+	}
+	readerWriter, ok := dest.(ClearingReaderWriter)
+	if !ok {
+		return nil
+	}
+
+	incoming, err := reader.ReadClearing(ctx)
+	if errors.Is(err, ErrUnsupported) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return MergeClearing(ctx, readerWriter, incoming)
+}
+
+// ErrReconciliationMismatch indicates that the cleared balance of an Account didn't match the statement it was being
+// reconciled against.
+type ErrReconciliationMismatch struct {
+	Reconciliation envelopes.Reconciliation
+	Cleared        envelopes.Balance
+}
+
+func (err ErrReconciliationMismatch) Error() string {
+	return fmt.Sprintf(
+		"the cleared balance of account %q is %s, but the statement from %s says %s",
+		err.Reconciliation.Account,
+		err.Cleared,
+		err.Reconciliation.Statement,
+		err.Reconciliation.Balance)
+}
+
+// ClearedBalances adds up, for each Account, how much the Transactions in the history of head that aren't
+// envelopes.Uncleared changed it by.
+//
+// A Transaction's impact on Accounts is found by comparing its State to that of its parent. Transactions with more than
+// one parent only combine changes that were already made by their ancestors, so they are never counted.
+func ClearedBalances(ctx context.Context, loader Loader, clearing envelopes.Clearing, head envelopes.ID) (envelopes.Accounts, error) {
+	impacts, err := clearedImpacts(ctx, loader, clearing, head)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make(envelopes.Accounts)
+	for _, impact := range impacts {
+		for name, balance := range impact {
+			retval[name] = retval[name].Add(balance)
+		}
+	}
+	return retval, nil
+}
+
+// Reconcile checks that the cleared balance of checkpoint.Account, as of checkpoint.Transaction, matches
+// checkpoint.Balance. If it does, every Transaction that was counted is marked as envelopes.Reconciled, and checkpoint is
+// recorded in clearing. Otherwise, ErrReconciliationMismatch is returned and clearing is left untouched. A ClearingStatus
+// belongs to a whole Transaction, so reconciling one side of a transfer reconciles the other side too.
+//
+// Nothing is written to the repository; once clearing has been updated, it is up to the caller to write it.
+func Reconcile(ctx context.Context, loader Loader, clearing *envelopes.Clearing, checkpoint envelopes.Reconciliation) error {
+	impacts, err := clearedImpacts(ctx, loader, *clearing, checkpoint.Transaction)
+	if err != nil {
+		return err
+	}
+
+	var cleared envelopes.Balance
+	counted := make([]envelopes.ID, 0, len(impacts))
+	for id, impact := range impacts {
+		if balance, ok := impact[checkpoint.Account]; ok {
+			cleared = cleared.Add(balance)
+			counted = append(counted, id)
+		}
+	}
+
+	if !cleared.Equal(checkpoint.Balance) {
+		return ErrReconciliationMismatch{
+			Reconciliation: checkpoint,
+			Cleared:        cleared,
+		}
+	}
+
+	for _, id := range counted {
+		clearing.SetStatus(id, envelopes.Reconciled)
+	}
+	clearing.AddReconciliation(checkpoint.DeepCopy())
+	return nil
+}
+
+// clearedImpacts finds how each Transaction in the history of head that isn't envelopes.Uncleared changed the
+// balances of Accounts. Accounts that weren't changed are left out.
+func clearedImpacts(ctx context.Context, loader Loader, clearing envelopes.Clearing, head envelopes.ID) (map[envelopes.ID]envelopes.Accounts, error) {
+	retval := make(map[envelopes.ID]envelopes.Accounts)
+	if head.Equal(envelopes.ID{}) {
+		return retval, nil
+	}
+
+	walker := Walker{Loader: loader}
+	err := walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		if clearing.Status(id) == envelopes.Uncleared || len(transaction.Parents) > 1 {
+			return nil
+		}
+
+		var before envelopes.Accounts
+		if len(transaction.Parents) == 1 && !transaction.Parents[0].Equal(envelopes.ID{}) {
+			var parent envelopes.Transaction
+			if err := loader.LoadTransaction(ctx, transaction.Parents[0], &parent); err != nil {
+				return err
+			}
+			if parent.State != nil {
+				before = parent.State.Accounts
+			}
+		}
+
+		var after envelopes.Accounts
+		if transaction.State != nil {
+			after = transaction.State.Accounts
+		}
+
+		impact := after.Sub(before)
+		for name, balance := range impact {
+			if balance.Equal(envelopes.Balance{}) {
+				delete(impact, name)
+			}
+		}
+		retval[id] = impact
+		return nil
+	}, head)
+	if err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
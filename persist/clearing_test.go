@@ -0,0 +1,185 @@
+package persist_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// newClearingHistory writes a linear history to repo, and returns its Transactions from oldest to newest.
+func newClearingHistory(ctx context.Context, t *testing.T, repo persist.Writer) []envelopes.Transaction {
+	balances := []struct {
+		merchant string
+		checking int64
+		savings  int64
+	}{
+		{"Paycheck", 1000, 0},
+		{"Landlord", 200, 0},
+		{"Transfer", 100, 100},
+		{"Grocer", 50, 100},
+	}
+
+	history := make([]envelopes.Transaction, 0, len(balances))
+	var parents []envelopes.ID
+	for _, entry := range balances {
+		accounts := envelopes.Accounts{"checking": {"USD": big.NewRat(entry.checking, 1)}}
+		if entry.savings != 0 {
+			accounts["savings"] = envelopes.Balance{"USD": big.NewRat(entry.savings, 1)}
+		}
+
+		current := envelopes.Transaction{
+			Merchant: entry.merchant,
+			Parents:  parents,
+			State:    &envelopes.State{Accounts: accounts},
+		}
+		if err := repo.WriteTransaction(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, current)
+		parents = []envelopes.ID{current.ID()}
+	}
+	return history
+}
+
+func TestClearedBalances(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+	history := newClearingHistory(ctx, t, repo)
+	head := history[len(history)-1].ID()
+
+	var clearing envelopes.Clearing
+	for _, transaction := range history[:3] {
+		clearing.SetStatus(transaction.ID(), envelopes.Cleared)
+	}
+
+	got, err := persist.ClearedBalances(ctx, repo, clearing, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := envelopes.Accounts{
+		"checking": {"USD": big.NewRat(100, 1)},
+		"savings":  {"USD": big.NewRat(100, 1)},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	for name, balance := range want {
+		if !got[name].Equal(balance) {
+			t.Errorf("%s: got %s want %s", name, got[name], balance)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+	history := newClearingHistory(ctx, t, repo)
+	head := history[len(history)-1].ID()
+
+	var clearing envelopes.Clearing
+	for _, transaction := range history[:3] {
+		clearing.SetStatus(transaction.ID(), envelopes.Cleared)
+	}
+
+	checkpoint := envelopes.Reconciliation{
+		Account:     "checking",
+		Statement:   envelopes.Date{Year: 2026, Month: time.March, Day: 31},
+		Balance:     envelopes.Balance{"USD": big.NewRat(150, 1)},
+		Transaction: head,
+	}
+
+	before := clearing.DeepCopy()
+	err := persist.Reconcile(ctx, repo, &clearing, checkpoint)
+	var mismatch persist.ErrReconciliationMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected an ErrReconciliationMismatch, got: %v", err)
+	}
+	if want := (envelopes.Balance{"USD": big.NewRat(100, 1)}); !mismatch.Cleared.Equal(want) {
+		t.Errorf("got cleared balance %s want %s", mismatch.Cleared, want)
+	}
+	if !clearing.Equal(before) {
+		t.Errorf("a failed Reconciliation should leave the Clearing untouched")
+	}
+
+	checkpoint.Balance = envelopes.Balance{"USD": big.NewRat(100, 1)}
+	if err = persist.Reconcile(ctx, repo, &clearing, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []envelopes.ClearingStatus{envelopes.Reconciled, envelopes.Reconciled, envelopes.Reconciled, envelopes.Uncleared} {
+		if got := clearing.Status(history[i].ID()); got != want {
+			t.Errorf("%s: got %s want %s", history[i].Merchant, got, want)
+		}
+	}
+
+	if last, ok := clearing.LastReconciliation("checking"); !ok || !last.Equal(checkpoint) {
+		t.Errorf("expected the checkpoint to be recorded, got: %v", clearing.Reconciliations)
+	}
+
+	if err = repo.WriteClearing(ctx, clearing); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.ReadClearing(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Equal(clearing) {
+		t.Errorf("the Clearing read back did not match the one written")
+	}
+}
+
+func TestRewrite_remapClearing(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+	history := newClearingHistory(ctx, t, repo)
+	head := history[len(history)-1].ID()
+
+	var clearing envelopes.Clearing
+	for _, transaction := range history[:3] {
+		clearing.SetStatus(transaction.ID(), envelopes.Cleared)
+	}
+	err := persist.Reconcile(ctx, repo, &clearing, envelopes.Reconciliation{
+		Account:     "savings",
+		Statement:   envelopes.Date{Year: 2026, Month: time.March, Day: 31},
+		Balance:     envelopes.Balance{"USD": big.NewRat(100, 1)},
+		Transaction: head,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := persist.ClearedBalances(ctx, repo, clearing, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heads, replacements, err := persist.Rewrite(ctx, repo, repo, persist.NormalizeTimes(), head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heads[0].Equal(head) {
+		t.Fatal("the rewrite was expected to change IDs")
+	}
+
+	remapped := clearing.Remap(replacements)
+	got, err := persist.ClearedBalances(ctx, repo, remapped, heads[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, balance := range want {
+		if !got[name].Equal(balance) {
+			t.Errorf("%s: got %s want %s", name, got[name], balance)
+		}
+	}
+
+	last, ok := remapped.LastReconciliation("savings")
+	if !ok || !last.Transaction.Equal(heads[0]) {
+		t.Errorf("the Reconciliation should refer to the rewritten head, got: %v", last)
+	}
+}
@@ -0,0 +1,36 @@
+package persist_test
+
+import (
+	"testing"
+
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/persisttest"
+)
+
+// A Cache without a Writer only holds the objects it is handed directly, so it is only expected to conform when there
+// is something behind it.
+func TestCache_conformance(t *testing.T) {
+	persisttest.TestLoaderWriter(t, func(t *testing.T) persisttest.LoaderWriter {
+		backing := persist.NewMemoryRepository()
+		subject := persist.NewCache(3)
+		subject.Loader = backing
+		subject.Writer = backing
+		return subject
+	})
+}
+
+func TestMemoryRepository_conformance(t *testing.T) {
+	persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+		return persist.NewMemoryRepository()
+	})
+}
+
+func TestCache_conformanceWithByteCapacity(t *testing.T) {
+	persisttest.TestLoaderWriter(t, func(t *testing.T) persisttest.LoaderWriter {
+		backing := persist.NewMemoryRepository()
+		subject := persist.NewCacheWithByteCapacity(4096)
+		subject.Loader = backing
+		subject.Writer = backing
+		return subject
+	})
+}
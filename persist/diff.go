@@ -0,0 +1,45 @@
+package persist
+
+import (
+	"context"
+
+	"github.com/marstr/envelopes"
+)
+
+// DiffRefSpecs finds everything that changed between the States of the Transactions two RefSpecs point to. A branch
+// that nothing has been committed to yet is treated as having an empty State.
+func DiffRefSpecs(ctx context.Context, repo RepositoryReader, original, updated RefSpec) (envelopes.StateDiff, error) {
+	originalState, err := loadRefSpecState(ctx, repo, original)
+	if err != nil {
+		return envelopes.StateDiff{}, err
+	}
+
+	updatedState, err := loadRefSpecState(ctx, repo, updated)
+	if err != nil {
+		return envelopes.StateDiff{}, err
+	}
+
+	return envelopes.DiffStates(originalState, updatedState), nil
+}
+
+func loadRefSpecState(ctx context.Context, repo RepositoryReader, subject RefSpec) (envelopes.State, error) {
+	id, err := Resolve(ctx, repo, subject)
+	if err != nil {
+		return envelopes.State{}, err
+	}
+
+	if id.Equal(envelopes.ID{}) {
+		return envelopes.State{}, nil
+	}
+
+	var transaction envelopes.Transaction
+	err = repo.LoadTransaction(ctx, id, &transaction)
+	if err != nil {
+		return envelopes.State{}, err
+	}
+
+	if transaction.State == nil {
+		return envelopes.State{}, nil
+	}
+	return *transaction.State, nil
+}
@@ -0,0 +1,62 @@
+package persist_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func TestDiffRefSpecs(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	initial := envelopes.Transaction{
+		State: &envelopes.State{
+			Accounts: envelopes.Accounts{"checking": envelopes.Balance{"USD": big.NewRat(100, 1)}},
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(100, 1)}},
+		},
+	}
+	coffee := envelopes.Transaction{
+		State: &envelopes.State{
+			Accounts: envelopes.Accounts{"checking": envelopes.Balance{"USD": big.NewRat(97, 1)}},
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(97, 1)}},
+		},
+		Parents: []envelopes.ID{initial.ID()},
+	}
+	for _, transaction := range []envelopes.Transaction{initial, coffee} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.WriteBranch(ctx, persist.DefaultBranch, coffee.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.WriteBranch(ctx, "unborn", envelopes.ID{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := persist.DiffRefSpecs(ctx, repo, persist.DefaultBranch+"^", persist.DefaultBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "modified budget /: USD 100.00 -> USD 97.00\nmodified account checking: USD 100.00 -> USD 97.00\n"
+	if got.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got, err = persist.DiffRefSpecs(ctx, repo, "unborn", persist.RefSpec(initial.ID().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "modified budget /: USD 0.00 -> USD 100.00\nadded account checking: USD 100.00\n"
+	if got.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err = persist.DiffRefSpecs(ctx, repo, "missing", persist.DefaultBranch); err == nil {
+		t.Errorf("expected an error for a RefSpec that can't be resolved")
+	}
+}
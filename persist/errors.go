@@ -0,0 +1,106 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package persist
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marstr/envelopes"
+)
+
+// Every Fetcher, Loader, and BranchReader in this module reports failures using the errors below, so that callers can
+// tell why an operation failed without knowing which backend they are talking to. Each typed error carries the ID or
+// branch name that caused it, and matches one of the broad sentinels using errors.Is:
+//
+//   - ErrNotFound is matched by ErrObjectNotFound and ErrBranchNotFound.
+//   - ErrCorrupt is matched by ErrCorruptObject and ErrCorruptBranch, which also Unwrap to the underlying parse error.
+//   - ErrUnsupported is matched by errors describing an object format, version, or layout that is not understood.
+//
+// Any other error, for instance a permissions problem or a cancelled context, is passed along as-is.
+var (
+	// ErrNotFound indicates that the requested object or branch does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrCorrupt indicates that the requested object or branch exists, but could not be interpreted.
+	ErrCorrupt = errors.New("corrupt")
+
+	// ErrUnsupported indicates that something was stored in a way that is not understood by this version of the module.
+	ErrUnsupported = errors.New("unsupported")
+)
+
+// ErrObjectNotFound indicates that a non-existent object was requested.
+type ErrObjectNotFound envelopes.ID
+
+func (err ErrObjectNotFound) Error() string {
+	return fmt.Sprintf("not able to find object %s", envelopes.ID(err).String())
+}
+
+// Is allows ErrObjectNotFound to match ErrNotFound.
+func (err ErrObjectNotFound) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ErrBranchNotFound indicates that a non-existent branch was requested.
+type ErrBranchNotFound string
+
+func (err ErrBranchNotFound) Error() string {
+	return fmt.Sprintf("not able to find branch %q", string(err))
+}
+
+// Is allows ErrBranchNotFound to match ErrNotFound.
+func (err ErrBranchNotFound) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ErrCorruptObject indicates that an object was found, but its contents could not be interpreted.
+type ErrCorruptObject struct {
+	ID  envelopes.ID
+	Err error
+}
+
+func (err ErrCorruptObject) Error() string {
+	return fmt.Sprintf("object %s is corrupt: %v", err.ID, err.Err)
+}
+
+// Is allows ErrCorruptObject to match ErrCorrupt.
+func (err ErrCorruptObject) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// Unwrap fetches the error that was encountered while interpreting the object.
+func (err ErrCorruptObject) Unwrap() error {
+	return err.Err
+}
+
+// ErrCorruptBranch indicates that a branch was found, but it does not point at anything that could be an ID.
+type ErrCorruptBranch struct {
+	Name string
+	Err  error
+}
+
+func (err ErrCorruptBranch) Error() string {
+	return fmt.Sprintf("branch %q is corrupt: %v", err.Name, err.Err)
+}
+
+// Is allows ErrCorruptBranch to match ErrCorrupt.
+func (err ErrCorruptBranch) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// Unwrap fetches the error that was encountered while interpreting the branch.
+func (err ErrCorruptBranch) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,53 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestErrors_Is(t *testing.T) {
+	cause := errors.New("unexpected end of JSON input")
+
+	testCases := []struct {
+		err      error
+		sentinel error
+		cause    error
+	}{
+		{ErrObjectNotFound(envelopes.ID{1}), ErrNotFound, nil},
+		{ErrBranchNotFound("master"), ErrNotFound, nil},
+		{ErrCorruptObject{ID: envelopes.ID{1}, Err: cause}, ErrCorrupt, cause},
+		{ErrCorruptBranch{Name: "master", Err: cause}, ErrCorrupt, cause},
+	}
+
+	sentinels := []error{ErrNotFound, ErrCorrupt, ErrUnsupported}
+
+	for _, tc := range testCases {
+		wrapped := fmt.Errorf("while doing something: %w", tc.err)
+		for _, sentinel := range sentinels {
+			if want, got := sentinel == tc.sentinel, errors.Is(wrapped, sentinel); got != want {
+				t.Errorf("%v matching %v: got %v want %v", tc.err, sentinel, got, want)
+			}
+		}
+
+		if tc.cause != nil && !errors.Is(wrapped, tc.cause) {
+			t.Errorf("%v should unwrap to %v", tc.err, tc.cause)
+		}
+	}
+}
+
+func TestErrors_As(t *testing.T) {
+	want := envelopes.ID{1, 2, 3}
+	wrapped := fmt.Errorf("while loading: %w", ErrCorruptObject{ID: want, Err: errors.New("bad")})
+
+	var corrupt ErrCorruptObject
+	if !errors.As(wrapped, &corrupt) {
+		t.Error("expected to find ErrCorruptObject")
+		return
+	}
+	if corrupt.ID != want {
+		t.Errorf("got ID %s want %s", corrupt.ID, want)
+	}
+}
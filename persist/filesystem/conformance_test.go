@@ -0,0 +1,44 @@
+package filesystem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
+	"github.com/marstr/envelopes/persist/filesystem"
+	"github.com/marstr/envelopes/persist/persisttest"
+)
+
+func TestRepository_conformance(t *testing.T) {
+	persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+		repo, err := filesystem.OpenRepository(context.Background(), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestRepository_conformanceWithCache(t *testing.T) {
+	persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+		repo, err := filesystem.OpenRepositoryWithCache(context.Background(), t.TempDir(), 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestRepository_conformanceBinary(t *testing.T) {
+	persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+		repo, err := filesystem.OpenRepository(
+			context.Background(),
+			t.TempDir(),
+			filesystem.RepositoryObjectFormat(filesystem.FormatBinary, persistBinary.NewestVersion))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
@@ -19,13 +19,17 @@ package filesystem
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/marstr/envelopes"
 	"github.com/marstr/envelopes/persist"
+	persistJson "github.com/marstr/envelopes/persist/json"
 
 	"github.com/marstr/collection/v2"
 	"github.com/mitchellh/go-homedir"
@@ -34,6 +38,9 @@ import (
 // ObjectsDir is the name of the directory that holds marshaled IDer objects.
 const ObjectsDir = "objects"
 
+// clearingFilename is the name of the file that holds the envelopes.Clearing, next to ObjectsDir.
+const clearingFilename = "clearing.json"
+
 // FileSystem allows an easy mechanism for reading and writing raw Budget related objects to and from a hard drive.
 type FileSystem struct {
 	Root              string
@@ -75,6 +82,44 @@ func (fs FileSystem) SetCurrent(_ context.Context, current persist.RefSpec) erro
 	return os.WriteFile(p, []byte(current), fs.getCreatePermissions())
 }
 
+// ReadClearing fetches the envelopes.Clearing that was most recently written by WriteClearing. If none has been written
+// yet, an empty one is returned.
+func (fs FileSystem) ReadClearing(_ context.Context) (envelopes.Clearing, error) {
+	p, err := fs.clearingPath()
+	if err != nil {
+		return envelopes.Clearing{}, err
+	}
+
+	raw, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return envelopes.Clearing{}, nil
+	} else if err != nil {
+		return envelopes.Clearing{}, err
+	}
+
+	var retval envelopes.Clearing
+	err = persistJson.UnmarshalClearing(raw, &retval)
+	if err != nil {
+		return envelopes.Clearing{}, fmt.Errorf("%w: unable to read %s: %v", persist.ErrCorrupt, p, err)
+	}
+	return retval, nil
+}
+
+// WriteClearing replaces the envelopes.Clearing. Anybody reading it at the same time sees either the old one or the new
+// one, but never a mix of both.
+func (fs FileSystem) WriteClearing(_ context.Context, subject envelopes.Clearing) error {
+	p, err := fs.clearingPath()
+	if err != nil {
+		return err
+	}
+
+	marshaled, err := persistJson.MarshalClearing(subject)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(p, marshaled, fs.getCreatePermissions())
+}
+
 // Fetch is able to read into memory the marshaled form of a Budget related object.
 //
 // See Also:
@@ -84,7 +129,12 @@ func (fs FileSystem) Fetch(_ context.Context, id envelopes.ID) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return os.ReadFile(p)
+
+	retval, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, persist.ErrObjectNotFound(id)
+	}
+	return retval, err
 }
 
 // Stash commits the provided payload to disk at a place that it can retreive again if asked for the ID specified here.
@@ -114,20 +164,40 @@ func (fs FileSystem) currentPath() (result string, err error) {
 	return filepath.Join(exp, "current.txt"), nil
 }
 
+// clearingPath fetches the name of the file containing the envelopes.Clearing.
+func (fs FileSystem) clearingPath() (string, error) {
+	exp, err := homedir.Expand(fs.Root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(exp, clearingFilename), nil
+}
+
 func (fs FileSystem) path(id envelopes.ID) (string, error) {
 	exp, err := homedir.Expand(fs.Root)
 	if err != nil {
 		return "", err
 	}
 
-	switch fs.ObjectLayout {
+	rel, err := objectPath(fs.ObjectLayout, id)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(exp, filepath.FromSlash(rel)), nil
+}
+
+// objectPath finds the slash-separated location of an object, relative to the root of a repository, for the given
+// object layout.
+func objectPath(layout uint, id envelopes.ID) (string, error) {
+	switch layout {
 	case 0:
-		return filepath.Join(exp, ObjectsDir, id.String()+".json"), nil
+		return path.Join(ObjectsDir, id.String()+".json"), nil
 	case 1:
 		full := id.String()
-		return filepath.Join(exp, ObjectsDir, full[:2], full[2:]+".json"), nil
+		return path.Join(ObjectsDir, full[:2], full[2:]+".json"), nil
 	default:
-		return "", fmt.Errorf("unrecognized object layout %v", fs.ObjectLayout)
+		return "", fmt.Errorf("unrecognized object layout %v", layout)
 	}
 }
 
@@ -135,32 +205,40 @@ func (fs FileSystem) branchPath(name string) string {
 	return filepath.Join(fs.Root, "refs", "heads", name)
 }
 
-// ReadBranch fetches the ID that a branch is pointing at.
+// ReadBranch fetches the ID that a branch is pointing at. If the branch doesn't exist, persist.ErrBranchNotFound is
+// returned. If it exists but doesn't contain an ID, persist.ErrCorruptBranch is returned.
 func (fs FileSystem) ReadBranch(_ context.Context, name string) (retval envelopes.ID, err error) {
 	branchLoc := fs.branchPath(name)
 	handle, err := os.Open(branchLoc)
-	if err != nil {
+	if errors.Is(err, os.ErrNotExist) {
+		err = persist.ErrBranchNotFound(name)
+		return
+	} else if err != nil {
 		return
 	}
 	defer handle.Close()
 
 	var contents [2 * cap(retval)]byte
 	var n int
-	n, err = handle.Read(contents[:])
-	if err != nil {
+	n, err = io.ReadFull(handle, contents[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = persist.ErrCorruptBranch{
+			Name: name,
+			Err: fmt.Errorf(
+				"%s was not long enough to be a candidate for pointing to a Transaction ID (want: %v got: %v)",
+				branchLoc,
+				cap(contents),
+				n),
+		}
 		return
-	}
-
-	if expected := cap(contents); n != expected {
-		err = fmt.Errorf(
-			"%s was not long enough to be a candidate for pointing to a Transaction ID (want: %v got: %v)",
-			branchLoc,
-			expected,
-			n)
+	} else if err != nil {
 		return
 	}
 
 	err = retval.UnmarshalText(contents[:])
+	if err != nil {
+		err = persist.ErrCorruptBranch{Name: name, Err: err}
+	}
 	return
 }
 
@@ -16,6 +16,7 @@ package filesystem_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
@@ -47,7 +48,15 @@ func TestFileSystem_Current(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run("", func(t *testing.T) {
-			repo, err := filesystem.OpenRepository(ctx, tc)
+			// These repositories have no objects, so opening them rewrites their configuration as if they were new.
+			// Work on a copy, so that the checked-in one isn't modified.
+			loc := t.TempDir()
+			if err := copyDirectory(tc, loc); err != nil {
+				t.Error(err)
+				return
+			}
+
+			repo, err := filesystem.OpenRepository(ctx, loc)
 			if err != nil {
 				t.Error(err)
 				return
@@ -179,6 +188,54 @@ func TestFileSystem_WriteBranch(t *testing.T) {
 	}
 }
 
+func TestFileSystem_RoundTrip_Clearing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := filesystem.FileSystem{
+		Root: t.TempDir(),
+	}
+
+	got, err := subject.ReadClearing(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(envelopes.Clearing{}) {
+		t.Errorf("a repository that never had a Clearing written should have an empty one, got: %v", got)
+	}
+
+	var want envelopes.Clearing
+	want.SetStatus(envelopes.Transaction{Merchant: "Grocer"}.ID(), envelopes.Cleared)
+	want.SetStatus(envelopes.Transaction{Merchant: "Landlord"}.ID(), envelopes.Reconciled)
+	want.AddReconciliation(envelopes.Reconciliation{
+		Account:     "checking",
+		Statement:   envelopes.Date{Year: 2026, Month: time.March, Day: 31},
+		Balance:     envelopes.Balance{"USD": big.NewRat(-120050, 100)},
+		Transaction: envelopes.Transaction{Merchant: "Landlord"}.ID(),
+	})
+
+	if err = subject.WriteClearing(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = subject.ReadClearing(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("round trip failed.\n\tgot:  %v\n\twant: %v", got, want)
+	}
+
+	readOnly := filesystem.ReadOnlyFileSystem{Source: os.DirFS(subject.Root)}
+	got, err = readOnly.ReadClearing(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("read-only round trip failed.\n\tgot:  %v\n\twant: %v", got, want)
+	}
+}
+
 func TestFileSystem_TransactionRoundTrip(t *testing.T) {
 	var ctx context.Context
 	deadline, ok := t.Deadline()
@@ -361,3 +418,48 @@ func BenchmarkFileSystem_RoundTrip(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestFileSystem_errors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := filesystem.FileSystem{
+		Root:         t.TempDir(),
+		ObjectLayout: 1,
+	}
+
+	missing := envelopes.Transaction{Comment: "never stashed"}.ID()
+	_, err := subject.Fetch(ctx, missing)
+	var notFound persist.ErrObjectNotFound
+	if !errors.As(err, &notFound) || envelopes.ID(notFound) != missing {
+		t.Errorf("expected ErrObjectNotFound for %s, got: %v", missing, err)
+	}
+
+	_, err = subject.ReadBranch(ctx, "never-written")
+	if !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound, got: %v", err)
+	}
+
+	testCases := map[string]string{
+		"short":   "abc123",
+		"not-hex": "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz",
+	}
+
+	for branch, contents := range testCases {
+		loc := filepath.Join(subject.Root, "refs", "heads", branch)
+		if err = os.MkdirAll(filepath.Dir(loc), 0770); err != nil {
+			t.Error(err)
+			return
+		}
+		if err = os.WriteFile(loc, []byte(contents), 0660); err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = subject.ReadBranch(ctx, branch)
+		var corrupt persist.ErrCorruptBranch
+		if !errors.As(err, &corrupt) || corrupt.Name != branch {
+			t.Errorf("%s: expected ErrCorruptBranch, got: %v", branch, err)
+		}
+	}
+}
@@ -140,6 +140,8 @@ func TestCache_Load_reuseHits(t *testing.T) {
 		return
 	}
 
+	before := subject.Stats()
+
 	var got envelopes.State
 	err = subject.LoadState(ctx, targetId, &got)
 	if err != nil {
@@ -147,8 +149,18 @@ func TestCache_Load_reuseHits(t *testing.T) {
 		return
 	}
 
-	if got.Budget != want.Budget {
-		t.Logf("When encountering a cache hit, the SAME Budget object should be reused")
+	if after := subject.Stats(); after.Hits != before.Hits+1 || after.Misses != before.Misses {
+		t.Logf("When loading a State a second time, it should be found in the cache")
+		t.Fail()
+	}
+
+	if !got.Equal(want) {
+		t.Logf("When encountering a cache hit, an equivalent State should be loaded")
+		t.Fail()
+	}
+
+	if got.Budget == want.Budget {
+		t.Logf("When encountering a cache hit, the Budget should be a copy so that modifying it can't corrupt the cache")
 		t.Fail()
 	}
 }
@@ -0,0 +1,203 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+// ReadOnlyFileSystem reads raw Budget related objects, branches, and the current pointer from an fs.FS. This allows a
+// repository to be read out of a zip archive, an embed.FS, or a testing/fstest.MapFS.
+//
+// Paths are interpreted relative to the root of Source, so it should be the equivalent of FileSystem.Root. Use
+// fs.Sub to point at a repository nested inside a larger fs.FS.
+type ReadOnlyFileSystem struct {
+	Source       fs.FS
+	ObjectLayout uint
+}
+
+// Current fetches the RefSpec that was most recently used to populate the index.
+func (rofs ReadOnlyFileSystem) Current(_ context.Context) (persist.RefSpec, error) {
+	raw, err := fs.ReadFile(rofs.Source, "current.txt")
+	if err != nil {
+		return "", err
+	}
+	return persist.RefSpec(strings.TrimSpace(string(raw))), nil
+}
+
+// ReadClearing fetches the envelopes.Clearing. If none was ever written, an empty one is returned.
+func (rofs ReadOnlyFileSystem) ReadClearing(_ context.Context) (envelopes.Clearing, error) {
+	raw, err := fs.ReadFile(rofs.Source, clearingFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return envelopes.Clearing{}, nil
+	} else if err != nil {
+		return envelopes.Clearing{}, err
+	}
+
+	var retval envelopes.Clearing
+	err = persistJson.UnmarshalClearing(raw, &retval)
+	if err != nil {
+		return envelopes.Clearing{}, fmt.Errorf("%w: unable to read %s: %v", persist.ErrCorrupt, clearingFilename, err)
+	}
+	return retval, nil
+}
+
+// Fetch is able to read into memory the marshaled form of a Budget related object.
+func (rofs ReadOnlyFileSystem) Fetch(_ context.Context, id envelopes.ID) ([]byte, error) {
+	loc, err := objectPath(rofs.ObjectLayout, id)
+	if err != nil {
+		return nil, err
+	}
+
+	retval, err := fs.ReadFile(rofs.Source, loc)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, persist.ErrObjectNotFound(id)
+	}
+	return retval, err
+}
+
+// ReadBranch fetches the ID that a branch is pointing at. If the branch doesn't exist, persist.ErrBranchNotFound is
+// returned. If it exists but doesn't contain an ID, persist.ErrCorruptBranch is returned.
+func (rofs ReadOnlyFileSystem) ReadBranch(_ context.Context, name string) (retval envelopes.ID, err error) {
+	branchLoc := path.Join("refs", "heads", name)
+	raw, err := fs.ReadFile(rofs.Source, branchLoc)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = persist.ErrBranchNotFound(name)
+		return
+	} else if err != nil {
+		return
+	}
+
+	trimmed := strings.TrimSpace(string(raw))
+	if expected := 2 * cap(retval); len(trimmed) != expected {
+		err = persist.ErrCorruptBranch{
+			Name: name,
+			Err: fmt.Errorf(
+				"%s was not long enough to be a candidate for pointing to a Transaction ID (want: %v got: %v)",
+				branchLoc,
+				expected,
+				len(trimmed)),
+		}
+		return
+	}
+
+	err = retval.UnmarshalText([]byte(trimmed))
+	if err != nil {
+		err = persist.ErrCorruptBranch{Name: name, Err: err}
+	}
+	return
+}
+
+// ListBranches fetches the distinct names of the branches that exist in a repository.
+func (rofs ReadOnlyFileSystem) ListBranches(ctx context.Context) (<-chan string, error) {
+	const branchesDir = "refs/heads"
+
+	names := make([]string, 0)
+	err := fs.WalkDir(rofs.Source, branchesDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		names = append(names, strings.TrimPrefix(p, branchesDir+"/"))
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	results := make(chan string)
+	go func() {
+		defer close(results)
+
+		for _, name := range names {
+			select {
+			case <-ctx.Done():
+				return
+			case results <- name:
+				// Intentionally Left Blank
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+// ReadOnlyRepository combines a ReadOnlyFileSystem with the persist.Loader appropriate for the objects in it.
+type ReadOnlyRepository struct {
+	ReadOnlyFileSystem
+	persist.Loader
+}
+
+// OpenReadOnlyRepository creates a handle for reading an existing repository out of an fs.FS. The object format and
+// layout are determined the same way as OpenRepository, by reading the repository's configuration file.
+func OpenReadOnlyRepository(ctx context.Context, source fs.FS) (*ReadOnlyRepository, error) {
+	return openReadOnlyRepository(ctx, source, nil)
+}
+
+// OpenReadOnlyRepositoryWithCache is like OpenReadOnlyRepository, but includes an in-memory cache that will reduce the
+// number of reads from source. The parameter cacheSize is the number of budget objects that can fit in the cache.
+func OpenReadOnlyRepositoryWithCache(ctx context.Context, source fs.FS, cacheSize uint) (*ReadOnlyRepository, error) {
+	return openReadOnlyRepository(ctx, source, persist.NewCache(cacheSize))
+}
+
+func openReadOnlyRepository(ctx context.Context, source fs.FS, cache *persist.Cache) (*ReadOnlyRepository, error) {
+	config, err := LoadConfigFS(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	rofs := ReadOnlyFileSystem{
+		Source:       source,
+		ObjectLayout: config.ObjectLocations,
+	}
+
+	loader, err := newLoader(config, rofs, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		cache.Loader = loader
+		loader = cache
+	}
+
+	return &ReadOnlyRepository{
+		ReadOnlyFileSystem: rofs,
+		Loader:             loader,
+	}, nil
+}
+
+// LoadConfigFS reads a repository configuration file out of an fs.FS.
+func LoadConfigFS(_ context.Context, source fs.FS) (*RepositoryConfig, error) {
+	configContents, err := fs.ReadFile(source, ConfigFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &missingConfiguration, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseConfig(configContents)
+}
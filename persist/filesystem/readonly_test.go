@@ -0,0 +1,190 @@
+package filesystem_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/filesystem"
+)
+
+func TestOpenReadOnlyRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	testCases := []string{
+		"./testdata/test4/.baronial", // object layout 0, no config file
+		"./testdata/test5/.baronial", // object layout 1
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			want, err := filesystem.OpenRepository(ctx, tc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			dirSubject, err := filesystem.OpenReadOnlyRepository(ctx, os.DirFS(tc))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			assertReadOnlyMatches(ctx, t, want, dirSubject)
+
+			zipped, err := zipDirectory(tc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			zipSubject, err := filesystem.OpenReadOnlyRepositoryWithCache(ctx, zipped, 20)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			assertReadOnlyMatches(ctx, t, want, zipSubject)
+		})
+	}
+}
+
+func TestOpenReadOnlyRepository_mapFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject, err := filesystem.OpenReadOnlyRepository(ctx, fstest.MapFS{
+		"config.json": {Data: []byte(`{"objects":{"format":"json","version":3},"objectLocs":1}`)},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if subject.ObjectLayout != 1 {
+		t.Errorf("got object layout %d want 1", subject.ObjectLayout)
+	}
+
+	branches, err := subject.ListBranches(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for branch := range branches {
+		t.Errorf("unexpected branch %q", branch)
+	}
+
+	var loaded envelopes.Transaction
+	if err = subject.LoadTransaction(ctx, envelopes.ID{1}, &loaded); err == nil {
+		t.Error("expected an error loading a non-existent transaction")
+	}
+}
+
+func assertReadOnlyMatches(ctx context.Context, t *testing.T, want *filesystem.Repository, got *filesystem.ReadOnlyRepository) {
+	wantCurrent, err := want.Current(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	gotCurrent, err := got.Current(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if gotCurrent != wantCurrent {
+		t.Errorf("got current %q want %q", gotCurrent, wantCurrent)
+	}
+
+	wantBranches := readBranchNames(ctx, t, want)
+	gotBranches := readBranchNames(ctx, t, got)
+	if len(wantBranches) != len(gotBranches) {
+		t.Errorf("got branches %v want %v", gotBranches, wantBranches)
+		return
+	}
+	for i := range wantBranches {
+		if wantBranches[i] != gotBranches[i] {
+			t.Errorf("got branches %v want %v", gotBranches, wantBranches)
+			return
+		}
+	}
+
+	head, err := persist.Resolve(ctx, got, gotCurrent)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	walker := persist.Walker{Loader: got}
+	err = walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		var expected envelopes.Transaction
+		if err := want.LoadTransaction(ctx, id, &expected); err != nil {
+			return err
+		}
+		if !transaction.Equal(expected) {
+			t.Errorf("transaction %s did not match", id)
+		}
+		return nil
+	}, head)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func readBranchNames(ctx context.Context, t *testing.T, lister persist.BranchLister) []string {
+	raw, err := lister.ListBranches(ctx)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	names := make([]string, 0)
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// zipDirectory packs a directory into an in-memory zip archive, and returns it as an fs.FS.
+func zipDirectory(root string) (fs.FS, error) {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		entry, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(contents)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 
 	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
 	persistJson "github.com/marstr/envelopes/persist/json"
 
 	"github.com/marstr/collection/v2"
@@ -29,6 +30,10 @@ type RepositoryConfig struct {
 
 const (
 	FormatJson = "json"
+
+	// FormatBinary stores objects using the compact encoding found in persist/binary. Object files keep the same names
+	// regardless of their format.
+	FormatBinary = "binary"
 )
 
 // missingConfiguration should be used when opening a repository old enough that config files are not present.
@@ -43,21 +48,31 @@ var missingConfiguration = RepositoryConfig{
 var defaultConfiguration = RepositoryConfig{
 	Objects: RepositoryConfigEntry{
 		Format:  FormatJson,
-		Version: 3,
+		Version: persistJson.NewestVersion,
 	},
 	ObjectLocations: 1,
 }
 
+// ErrUnsupportedConfiguration indicates that a repository was created by a version of this module that stores objects
+// in a way this version doesn't understand.
 type ErrUnsupportedConfiguration RepositoryConfig
 
 func (err ErrUnsupportedConfiguration) Error() string {
 	return "this version is not capable of loading the specified configuration"
 }
 
+// Is allows ErrUnsupportedConfiguration to match persist.ErrUnsupported.
+func (err ErrUnsupportedConfiguration) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
+
 type Repository struct {
 	FileSystem
 	persist.Loader
 	persist.Writer
+
+	writeNewestObjects bool
+	objectFormat       *RepositoryConfigEntry
 }
 
 type RepositoryOption func(repository *Repository) error
@@ -82,6 +97,31 @@ func RepositoryObjectLoc(layout uint) RepositoryOption {
 	}
 }
 
+// RepositoryWriteNewestObjects creates a RepositoryOption that causes objects to be written in the newest version of
+// the repository's object format, regardless of the version recorded in the repository's configuration. Objects that are
+// already present aren't modified, and can still be read.
+//
+// Versions of this module from before objects were inspected as they were loaded will not be able to read the objects
+// written this way.
+func RepositoryWriteNewestObjects() RepositoryOption {
+	return func(repository *Repository) error {
+		repository.writeNewestObjects = true
+		return nil
+	}
+}
+
+// RepositoryObjectFormat creates a RepositoryOption that sets the format objects will be stored in when a new
+// repository is created. Opening an existing repository that stores objects in a different format fails.
+func RepositoryObjectFormat(format string, version uint) RepositoryOption {
+	return func(repository *Repository) error {
+		repository.objectFormat = &RepositoryConfigEntry{
+			Format:  format,
+			Version: version,
+		}
+		return nil
+	}
+}
+
 // OpenRepository creates a handle for interacting with an existing filesystem-based repository.
 func OpenRepository(ctx context.Context, loc string, options ...RepositoryOption) (*Repository, error) {
 	return openRepository(ctx, loc, nil, options...)
@@ -125,87 +165,52 @@ func openRepository(ctx context.Context, loc string, cache *persist.Cache, optio
 		Writer:     nil,
 	}
 
-	if config.Objects.Format == FormatJson {
-		switch config.Objects.Version {
-		case 1:
-			if cache == nil {
-				retval.Loader, err = persistJson.NewLoaderV1(&fs)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV1(&fs)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				retval.Loader, err = persistJson.NewLoaderV1WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV1WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-			}
-		case 2:
-			if cache == nil {
-				retval.Loader, err = persistJson.NewLoaderV2(&fs)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV2(&fs)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				retval.Loader, err = persistJson.NewLoaderV2WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV2WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-			}
-		case 3:
-			if cache == nil {
-				retval.Loader, err = persistJson.NewLoaderV3(&fs)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV3(&fs)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				retval.Loader, err = persistJson.NewLoaderV3WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-				retval.Writer, err = persistJson.NewWriterV3WithLoopback(&fs, cache)
-				if err != nil {
-					return nil, err
-				}
-			}
-		default:
-			return nil, ErrUnsupportedConfiguration{}
+	err = retval.useObjectFormat(config, &fs, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range options {
+		err = options[i](&retval)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, ErrUnsupportedConfiguration{}
 	}
 
-	if cache != nil {
-		cache.Loader = retval.Loader
-		cache.Writer = retval.Writer
-		retval.Loader = cache
-		retval.Writer = cache
+	if retval.objectFormat != nil && *retval.objectFormat != config.Objects {
+		if !creatingRepo {
+			return nil, fmt.Errorf("repository objects are already stored as %s version %d", config.Objects.Format, config.Objects.Version)
+		}
+
+		requested := *config
+		requested.Objects = *retval.objectFormat
+		config = &requested
+
+		err = retval.useObjectFormat(config, &fs, cache)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	for i := range options {
-		err = options[i](&retval)
+	newest := *config
+	switch config.Objects.Format {
+	case FormatJson:
+		newest.Objects.Version = persistJson.NewestVersion
+	case FormatBinary:
+		newest.Objects.Version = persistBinary.NewestVersion
+	}
+	if retval.writeNewestObjects && newest != *config {
+		var writer persist.Writer
+		writer, err = newWriter(&newest, &fs, cache)
 		if err != nil {
 			return nil, err
 		}
+
+		if cache == nil {
+			retval.Writer = writer
+		} else {
+			cache.Writer = writer
+		}
 	}
 
 	if creatingRepo {
@@ -218,6 +223,150 @@ func openRepository(ctx context.Context, loc string, cache *persist.Cache, optio
 	return &retval, nil
 }
 
+// useObjectFormat sets up the Loader and Writer of a Repository to read and write objects in the format described by
+// config. If cache isn't nil, objects are read and written through it.
+func (repo *Repository) useObjectFormat(config *RepositoryConfig, fs *FileSystem, cache *persist.Cache) error {
+	loader, err := newLoader(config, fs, cache)
+	if err != nil {
+		return err
+	}
+
+	writer, err := newWriter(config, fs, cache)
+	if err != nil {
+		return err
+	}
+
+	if cache == nil {
+		repo.Loader = loader
+		repo.Writer = writer
+		return nil
+	}
+
+	cache.Loader = loader
+	cache.Writer = writer
+	repo.Loader = cache
+	repo.Writer = cache
+	return nil
+}
+
+// NewObjectLoader creates a persist.Loader that can read objects stored in the format described by config, even when
+// they aren't being read from a FileSystem. For instance, a repository being served over HTTP.
+func NewObjectLoader(config *RepositoryConfig, fetcher persist.Fetcher) (persist.Loader, error) {
+	return newLoader(config, fetcher, nil)
+}
+
+// NewObjectWriter creates a persist.Writer that will write objects in the format described by config, even when they
+// aren't being written to a FileSystem. For instance, a repository being served over HTTP.
+func NewObjectWriter(config *RepositoryConfig, stasher persist.Stasher) (persist.Writer, error) {
+	return newWriter(config, stasher, nil)
+}
+
+// newLoader creates a persist.Loader that can read objects in the format described by config. If cache isn't nil,
+// nested objects are loaded through it.
+//
+// Objects in repositories using any version of either format are inspected as they are loaded, so that objects written
+// in older versions can still be read.
+func newLoader(config *RepositoryConfig, fetcher persist.Fetcher, cache *persist.Cache) (persist.Loader, error) {
+	if config.Objects.Format == FormatBinary {
+		if config.Objects.Version < 1 || config.Objects.Version > persistBinary.NewestVersion {
+			return nil, ErrUnsupportedConfiguration(*config)
+		}
+
+		if cache == nil {
+			return persistBinary.NewLoaderV2(fetcher)
+		}
+		return persistBinary.NewLoaderV2WithLoopback(fetcher, cache)
+	}
+
+	if config.Objects.Format != FormatJson {
+		return nil, ErrUnsupportedConfiguration(*config)
+	}
+
+	if config.Objects.Version < 1 || config.Objects.Version > persistJson.NewestVersion {
+		return nil, ErrUnsupportedConfiguration(*config)
+	}
+
+	if cache == nil {
+		return persistJson.NewDetectingLoader(fetcher)
+	}
+	return persistJson.NewDetectingLoaderWithLoopback(fetcher, cache)
+}
+
+// newWriter creates a persist.Writer that will write objects in the format described by config. If cache isn't nil,
+// nested objects are written through it.
+func newWriter(config *RepositoryConfig, stasher persist.Stasher, cache *persist.Cache) (persist.Writer, error) {
+	if config.Objects.Format == FormatBinary {
+		switch config.Objects.Version {
+		case 1:
+			if cache == nil {
+				return persistBinary.NewWriterV1(stasher)
+			}
+			return persistBinary.NewWriterV1WithLoopback(stasher, cache)
+		case 2:
+			if cache == nil {
+				return persistBinary.NewWriterV2(stasher)
+			}
+			return persistBinary.NewWriterV2WithLoopback(stasher, cache)
+		default:
+			return nil, ErrUnsupportedConfiguration(*config)
+		}
+	}
+
+	if config.Objects.Format != FormatJson {
+		return nil, ErrUnsupportedConfiguration(*config)
+	}
+
+	switch config.Objects.Version {
+	case 1:
+		if cache == nil {
+			return persistJson.NewWriterV1(stasher)
+		}
+		return persistJson.NewWriterV1WithLoopback(stasher, cache)
+	case 2:
+		if cache == nil {
+			return persistJson.NewWriterV2(stasher)
+		}
+		return persistJson.NewWriterV2WithLoopback(stasher, cache)
+	case 3:
+		if cache == nil {
+			return persistJson.NewWriterV3(stasher)
+		}
+		return persistJson.NewWriterV3WithLoopback(stasher, cache)
+	case 4:
+		if cache == nil {
+			return persistJson.NewWriterV4(stasher)
+		}
+		return persistJson.NewWriterV4WithLoopback(stasher, cache)
+	case 5:
+		if cache == nil {
+			return persistJson.NewWriterV5(stasher)
+		}
+		return persistJson.NewWriterV5WithLoopback(stasher, cache)
+	case 6:
+		if cache == nil {
+			return persistJson.NewWriterV6(stasher)
+		}
+		return persistJson.NewWriterV6WithLoopback(stasher, cache)
+	case 7:
+		if cache == nil {
+			return persistJson.NewWriterV7(stasher)
+		}
+		return persistJson.NewWriterV7WithLoopback(stasher, cache)
+	case 8:
+		if cache == nil {
+			return persistJson.NewWriterV8(stasher)
+		}
+		return persistJson.NewWriterV8WithLoopback(stasher, cache)
+	case 9:
+		if cache == nil {
+			return persistJson.NewWriterV9(stasher)
+		}
+		return persistJson.NewWriterV9WithLoopback(stasher, cache)
+	default:
+		return nil, ErrUnsupportedConfiguration(*config)
+	}
+}
+
 // LoadConfig reads a repository configuration file from disk.
 func LoadConfig(_ context.Context, loc string) (*RepositoryConfig, error) {
 	var err error
@@ -229,8 +378,12 @@ func LoadConfig(_ context.Context, loc string) (*RepositoryConfig, error) {
 		return nil, err
 	}
 
+	return parseConfig(configContents)
+}
+
+func parseConfig(configContents []byte) (*RepositoryConfig, error) {
 	var config RepositoryConfig
-	err = json.Unmarshal(configContents, &config)
+	err := json.Unmarshal(configContents, &config)
 	if err != nil {
 		return nil, err
 	}
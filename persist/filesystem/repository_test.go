@@ -2,6 +2,7 @@ package filesystem_test
 
 import (
 	"context"
+	"io/fs"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/marstr/envelopes"
 	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
 	"github.com/marstr/envelopes/persist/filesystem"
+	persistJson "github.com/marstr/envelopes/persist/json"
 )
 
 func TestOpenRepositoryLayout1(t *testing.T) {
@@ -104,3 +107,248 @@ func TestCreateRepositoryLayout1(t *testing.T) {
 	}
 	defer handle.Close()
 }
+
+func TestOpenRepository_mixedObjectVersions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// test4 holds objects written in version 1 of the JSON format, and has no configuration file.
+	loc := t.TempDir()
+	if err := copyDirectory(filepath.Join("testdata", "test4", ".baronial"), loc); err != nil {
+		t.Error(err)
+		return
+	}
+
+	upgraded, err := filesystem.OpenRepository(ctx, loc, filesystem.RepositoryWriteNewestObjects())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	head, err := persist.Resolve(ctx, upgraded, persist.DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var old envelopes.Transaction
+	if err = upgraded.LoadTransaction(ctx, head, &old); err != nil {
+		t.Error(err)
+		return
+	}
+
+	newer := envelopes.Transaction{
+		Comment: "written in the newest format",
+		Parents: []envelopes.ID{head},
+		State: &envelopes.State{
+			Budget:   old.State.Budget,
+			Accounts: envelopes.Accounts{"new account": {"USD": big.NewRat(1234, 100)}},
+		},
+	}
+	if err = upgraded.WriteTransaction(ctx, newer); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The newer version of Accounts stores magnitudes as decimals, where version 1 used fractions.
+	raw, err := upgraded.Fetch(ctx, newer.State.Accounts.ID())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if version, err := persistJson.AccountsVersion(raw); err != nil || version != persistJson.NewestVersion {
+		t.Errorf("got accounts version %d (err: %v) want %d", version, err, persistJson.NewestVersion)
+	}
+
+	reopened, err := filesystem.OpenRepositoryWithCache(ctx, loc, 20)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The objects in test4 predate the current way IDs are calculated, so rather than checking their IDs, they're
+	// compared to what a loader that only understands version 1 produces.
+	legacy, err := persistJson.NewLoaderV1(reopened.FileSystem)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	walker := persist.Walker{Loader: reopened}
+	seen := 0
+	err = walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		seen++
+		if id == newer.ID() {
+			if !transaction.Equal(newer) {
+				t.Errorf("transaction %s did not match what was written", id)
+			}
+			return nil
+		}
+
+		var want envelopes.Transaction
+		if err := legacy.LoadTransaction(ctx, id, &want); err != nil {
+			return err
+		}
+		if !transaction.Equal(want) || transaction.ID() != want.ID() {
+			t.Errorf("transaction %s did not match what a version 1 loader produces", id)
+		}
+		return nil
+	}, newer.ID())
+	if err != nil {
+		t.Error(err)
+	}
+	if seen < 2 {
+		t.Errorf("expected to walk both the new transaction and its ancestors, saw %d", seen)
+	}
+}
+
+func TestOpenRepository_binaryWriteNewestObjects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc := t.TempDir()
+	created, err := filesystem.OpenRepository(ctx, loc, filesystem.RepositoryObjectFormat(filesystem.FormatBinary, 1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	old := envelopes.Transaction{
+		Comment: "written in version 1",
+		State: &envelopes.State{
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(314, 100)}},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(314, 100)}},
+		},
+	}
+	if err = created.WriteTransaction(ctx, old); err != nil {
+		t.Error(err)
+		return
+	}
+
+	newer := envelopes.Transaction{
+		Comment: "written in the newest version",
+		Parents: []envelopes.ID{old.ID()},
+		State: &envelopes.State{
+			Budget:   old.State.Budget,
+			Accounts: old.State.Accounts,
+			Metadata: envelopes.AccountMetadata{"checking": {Class: envelopes.AssetAccount, Institution: "Credit Union"}},
+		},
+		LineItems: []envelopes.LineItem{
+			{Amount: envelopes.Balance{"USD": big.NewRat(-100, 100)}, Budget: envelopes.BudgetPath{"groceries"}, Memo: "milk"},
+		},
+		Tags:        envelopes.NewTagSet("reimbursable"),
+		Metadata:    envelopes.TransactionMetadata{"check": "1042"},
+		Attachments: []envelopes.Attachment{{Blob: envelopes.ID{0x01}, Filename: "receipt.pdf", MediaType: "application/pdf"}},
+	}
+	if err = created.WriteTransaction(ctx, newer); err == nil {
+		t.Error("expected version 1 of the binary format to refuse newer fields")
+	}
+
+	upgraded, err := filesystem.OpenRepository(ctx, loc, filesystem.RepositoryWriteNewestObjects())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = upgraded.WriteTransaction(ctx, newer); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reopened, err := filesystem.OpenRepositoryWithCache(ctx, loc, 20)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, want := range []envelopes.Transaction{old, newer} {
+		var loaded envelopes.Transaction
+		if err = reopened.LoadTransaction(ctx, want.ID(), &loaded); err != nil {
+			t.Error(err)
+			continue
+		}
+		if !loaded.Equal(want) || loaded.ID() != want.ID() {
+			t.Errorf("got: %s want: %s", loaded, want)
+		}
+	}
+}
+
+func TestCreateRepository_binaryFormat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc := t.TempDir()
+	created, err := filesystem.OpenRepositoryWithCache(
+		ctx,
+		loc,
+		10,
+		filesystem.RepositoryObjectFormat(filesystem.FormatBinary, persistBinary.NewestVersion))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	written := envelopes.Transaction{
+		Comment: "stored compactly",
+		State: &envelopes.State{
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(314, 100)}},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(314, 100)}},
+		},
+	}
+	if err = created.WriteTransaction(ctx, written); err != nil {
+		t.Error(err)
+		return
+	}
+
+	config, err := filesystem.LoadConfig(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if config.Objects.Format != filesystem.FormatBinary || config.Objects.Version != persistBinary.NewestVersion {
+		t.Errorf("got objects config %+v want format %q version %d", config.Objects, filesystem.FormatBinary, persistBinary.NewestVersion)
+	}
+
+	// Reopening the repository must pick up the format from its configuration.
+	reopened, err := filesystem.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var loaded envelopes.Transaction
+	if err = reopened.LoadTransaction(ctx, written.ID(), &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if loaded.ID() != written.ID() {
+		t.Errorf("got ID %s want ID %s", loaded.ID(), written.ID())
+	}
+
+	_, err = filesystem.OpenRepository(ctx, loc, filesystem.RepositoryObjectFormat(filesystem.FormatJson, persistJson.NewestVersion))
+	if err == nil {
+		t.Error("expected an error when opening a repository with a format other than the one it was created with")
+	}
+}
+
+// copyDirectory recursively copies the contents of one directory into another.
+func copyDirectory(src, dest string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0770)
+		}
+
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, contents, 0660)
+	})
+}
@@ -0,0 +1,411 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+// UpgradeSummary describes the work that was done by Upgrade.
+type UpgradeSummary struct {
+	// Rewritten is the number of objects that were converted to a newer format, or moved to a new location.
+	Rewritten uint
+
+	// Unchanged is the number of reachable objects that were already stored as requested.
+	Unchanged uint
+
+	// Removed is the number of files that were left behind by moving objects to a new location, and then deleted.
+	Removed uint
+}
+
+type objectKind int
+
+const (
+	transactionKind objectKind = iota
+	stateKind
+	budgetKind
+	accountsKind
+	blobKind
+)
+
+type pendingObject struct {
+	id   envelopes.ID
+	kind objectKind
+}
+
+var layoutZeroName = regexp.MustCompile(`^[0-9a-f]{40}\.json$`)
+
+// Upgrade rewrites a repository so that it uses the newest object format and object layout. See UpgradeTo.
+func Upgrade(ctx context.Context, loc string) (*UpgradeSummary, error) {
+	return UpgradeTo(ctx, loc, defaultConfiguration)
+}
+
+// UpgradeTo rewrites a repository so that it uses the object format and object layout described by target.
+//
+// Every object that can be reached from a branch, or from the current pointer, is rewritten. The Blobs attached to
+// those Transactions count as reachable, so they are moved along with everything else. Objects are rewritten in
+// place and keep their original IDs, so branches and references between objects don't need to be updated. Unreachable
+// objects are left as they are. Once every object has been rewritten, config.json is replaced atomically. Finally, if
+// objects were moved to a new location, the files they were moved from are deleted.
+//
+// Each object is rewritten atomically, and objects that are already stored as requested are skipped, so an upgrade
+// that is interrupted can be finished by calling UpgradeTo again. Throughout, the repository remains readable by
+// versions of this module which inspect the format of each object as it is loaded.
+//
+// Repositories using the binary object format can only be upgraded to its newest version, without moving objects.
+// Every version of the binary format can be read by the newest one, so only config.json is replaced.
+func UpgradeTo(ctx context.Context, loc string, target RepositoryConfig) (*UpgradeSummary, error) {
+	current, err := LoadConfig(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Objects.Format == FormatBinary {
+		return upgradeBinary(ctx, loc, current, target)
+	}
+
+	if current.Objects.Format != FormatJson || current.Objects.Version < 1 || current.Objects.Version > persistJson.NewestVersion || current.ObjectLocations > 1 {
+		return nil, ErrUnsupportedConfiguration(*current)
+	}
+
+	if target.Objects.Format != FormatJson || target.Objects.Version != persistJson.NewestVersion || target.ObjectLocations > 1 || target.ObjectLocations < current.ObjectLocations {
+		return nil, ErrUnsupportedConfiguration(target)
+	}
+
+	if target.Branches == (RepositoryConfigEntry{}) {
+		target.Branches = current.Branches
+	}
+
+	src := FileSystem{Root: loc, ObjectLayout: current.ObjectLocations}
+	dest := FileSystem{Root: loc, ObjectLayout: target.ObjectLocations}
+	summary := &UpgradeSummary{}
+
+	roots, err := upgradeRoots(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	err = upgradeObjects(ctx, src, dest, roots, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	if *current != target {
+		err = writeConfigAtomically(loc, &target, dest.getCreatePermissions())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if target.ObjectLocations == 1 {
+		err = removeLayoutZeroObjects(ctx, dest, summary)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
+}
+
+// upgradeBinary moves a repository using the binary object format to the newest version of it.
+func upgradeBinary(ctx context.Context, loc string, current *RepositoryConfig, target RepositoryConfig) (*UpgradeSummary, error) {
+	if current.Objects.Version < 1 || current.Objects.Version > persistBinary.NewestVersion {
+		return nil, ErrUnsupportedConfiguration(*current)
+	}
+
+	if target.Objects.Format != FormatBinary || target.Objects.Version != persistBinary.NewestVersion || target.ObjectLocations != current.ObjectLocations {
+		return nil, ErrUnsupportedConfiguration(target)
+	}
+
+	if target.Branches == (RepositoryConfigEntry{}) {
+		target.Branches = current.Branches
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if *current != target {
+		dest := FileSystem{Root: loc, ObjectLayout: target.ObjectLocations}
+		err := writeConfigAtomically(loc, &target, dest.getCreatePermissions())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &UpgradeSummary{}, nil
+}
+
+// upgradeRoots finds the Transactions that every reachable object can be found from.
+func upgradeRoots(ctx context.Context, repo FileSystem) ([]envelopes.ID, error) {
+	var retval []envelopes.ID
+
+	branches, err := repo.ListBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for branch := range branches {
+		var head envelopes.ID
+		head, err = repo.ReadBranch(ctx, branch)
+		if err != nil {
+			return nil, err
+		}
+		retval = append(retval, head)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	current, err := repo.Current(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return retval, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var detached envelopes.ID
+	if len(current) == 2*len(detached) && detached.UnmarshalText([]byte(current)) == nil {
+		retval = append(retval, detached)
+	}
+	return retval, nil
+}
+
+// upgradeObjects rewrites each object reachable from roots, and records what it did in summary.
+func upgradeObjects(ctx context.Context, src, dest FileSystem, roots []envelopes.ID, summary *UpgradeSummary) error {
+	visited := make(map[envelopes.ID]struct{})
+	pending := make([]pendingObject, 0, len(roots))
+	for _, root := range roots {
+		pending = append(pending, pendingObject{id: root, kind: transactionKind})
+	}
+
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// Intentionally Left Blank
+		}
+
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if current.id.Equal(envelopes.ID{}) {
+			continue
+		}
+		if _, ok := visited[current.id]; ok {
+			continue
+		}
+		visited[current.id] = struct{}{}
+
+		upgraded, changed, err := upgradeObject(ctx, src, dest, current)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			var loc string
+			loc, err = dest.path(current.id)
+			if err != nil {
+				return err
+			}
+			err = writeFileAtomically(loc, upgraded, dest.getCreatePermissions())
+			if err != nil {
+				return err
+			}
+			summary.Rewritten++
+		} else {
+			summary.Unchanged++
+		}
+
+		references, err := objectReferences(current.kind, upgraded)
+		if err != nil {
+			return persist.ErrCorruptObject{ID: current.id, Err: err}
+		}
+		pending = append(pending, references...)
+	}
+
+	return nil
+}
+
+// upgradeObject fetches an object, preferring a copy that a previous upgrade has already written to dest, and converts
+// it to the newest object format. It reports whether the returned payload needs to be written to dest.
+func upgradeObject(ctx context.Context, src, dest FileSystem, subject pendingObject) ([]byte, bool, error) {
+	fromDest := true
+	original, err := dest.Fetch(ctx, subject.id)
+	if errors.Is(err, persist.ErrNotFound) && src.ObjectLayout != dest.ObjectLayout {
+		fromDest = false
+		original, err = src.Fetch(ctx, subject.id)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var upgraded []byte
+	switch subject.kind {
+	case transactionKind:
+		upgraded, err = persistJson.UpgradeTransaction(original)
+	case accountsKind:
+		upgraded, err = persistJson.UpgradeAccounts(original)
+	default:
+		// States and Budgets are written the same way in every version of the JSON object format, and Blobs are stored
+		// exactly as they were given.
+		upgraded = original
+	}
+	if err != nil {
+		return nil, false, persist.ErrCorruptObject{ID: subject.id, Err: err}
+	}
+
+	changed := !fromDest || string(upgraded) != string(original)
+	return upgraded, changed, nil
+}
+
+// objectReferences finds the objects that a marshaled object in the newest JSON object format refers to.
+func objectReferences(kind objectKind, marshaled []byte) ([]pendingObject, error) {
+	switch kind {
+	case transactionKind:
+		var transaction persistJson.TransactionV9
+		if err := json.Unmarshal(marshaled, &transaction); err != nil {
+			return nil, err
+		}
+		retval := make([]pendingObject, 0, 1+len(transaction.Parent)+len(transaction.Reverts)+len(transaction.Attachments))
+		retval = append(retval, pendingObject{id: transaction.State, kind: stateKind})
+		for _, parent := range transaction.Parent {
+			retval = append(retval, pendingObject{id: parent, kind: transactionKind})
+		}
+		for _, reverted := range transaction.Reverts {
+			retval = append(retval, pendingObject{id: reverted, kind: transactionKind})
+		}
+		for _, attachment := range transaction.Attachments {
+			retval = append(retval, pendingObject{id: attachment.Blob, kind: blobKind})
+		}
+		return retval, nil
+	case stateKind:
+		var state persistJson.StateV4
+		if err := json.Unmarshal(marshaled, &state); err != nil {
+			return nil, err
+		}
+		return []pendingObject{
+			{id: state.Budget, kind: budgetKind},
+			{id: state.Accounts, kind: accountsKind},
+		}, nil
+	case budgetKind:
+		var budget persistJson.BudgetV3
+		if err := json.Unmarshal(marshaled, &budget); err != nil {
+			return nil, err
+		}
+		retval := make([]pendingObject, 0, len(budget.Children))
+		for _, child := range budget.Children {
+			retval = append(retval, pendingObject{id: child, kind: budgetKind})
+		}
+		return retval, nil
+	default:
+		return nil, nil
+	}
+}
+
+// removeLayoutZeroObjects deletes objects stored using object layout 0, if a copy is also stored using object layout 1.
+func removeLayoutZeroObjects(ctx context.Context, repo FileSystem, summary *UpgradeSummary) error {
+	objectsDir := filepath.Join(repo.Root, ObjectsDir)
+	entries, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !layoutZeroName.MatchString(entry.Name()) {
+			continue
+		}
+
+		var id envelopes.ID
+		err = id.UnmarshalText([]byte(strings.TrimSuffix(entry.Name(), ".json")))
+		if err != nil {
+			continue
+		}
+
+		var moved string
+		moved, err = repo.path(id)
+		if err != nil {
+			return err
+		}
+		if _, err = os.Stat(moved); err != nil {
+			// This object wasn't reachable, so it was never moved. Leave it be.
+			continue
+		}
+
+		err = os.Remove(filepath.Join(objectsDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		summary.Removed++
+	}
+	return nil
+}
+
+func writeConfigAtomically(loc string, config *RepositoryConfig, mode os.FileMode) error {
+	marshaled, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(loc, ConfigFilename), marshaled, mode)
+}
+
+// writeFileAtomically writes to a temporary file, then renames it into place. That way, anybody reading name sees
+// either its old contents or its new contents, but never a partially written file.
+func writeFileAtomically(name string, contents []byte, mode os.FileMode) error {
+	dir := filepath.Dir(name)
+	err := os.MkdirAll(dir, mode|0110|os.ModeDir)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(contents)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+
+	err = os.Chmod(temp.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), name)
+}
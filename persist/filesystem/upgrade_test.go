@@ -0,0 +1,276 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	persistBinary "github.com/marstr/envelopes/persist/binary"
+	"github.com/marstr/envelopes/persist/filesystem"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	testCases := []string{
+		filepath.Join("testdata", "test4", ".baronial"), // object layout 0, no config file
+		filepath.Join("testdata", "test5", ".baronial"), // object layout 1, JSON version 1
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			loc := t.TempDir()
+			if err := copyDirectory(tc, loc); err != nil {
+				t.Error(err)
+				return
+			}
+
+			want := readHistory(ctx, t, loc)
+
+			summary, err := filesystem.Upgrade(ctx, loc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if summary.Rewritten == 0 {
+				t.Error("expected objects to be rewritten")
+			}
+
+			assertUpgraded(ctx, t, loc, want)
+
+			summary, err = filesystem.Upgrade(ctx, loc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if summary.Rewritten != 0 || summary.Removed != 0 {
+				t.Errorf("upgrading an up-to-date repository should do nothing, but got: %+v", summary)
+			}
+		})
+	}
+}
+
+func TestUpgrade_resume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	original := filepath.Join("testdata", "test4", ".baronial")
+	loc := t.TempDir()
+	if err := copyDirectory(original, loc); err != nil {
+		t.Error(err)
+		return
+	}
+	want := readHistory(ctx, t, loc)
+
+	if _, err := filesystem.Upgrade(ctx, loc); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Put the repository back in the state it would be in if the upgrade had been interrupted part-way through
+	// rewriting objects: the configuration file hasn't been written, none of the original objects have been removed,
+	// and only some of the objects have been rewritten.
+	if err := os.Remove(filepath.Join(loc, filesystem.ConfigFilename)); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := copyDirectory(original, loc); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var undone uint
+	for id := range want {
+		if undone%2 == 0 {
+			moved, err := filepath.Glob(filepath.Join(loc, filesystem.ObjectsDir, id.String()[:2], id.String()[2:]+".json"))
+			if err != nil || len(moved) != 1 {
+				t.Errorf("expected to find the upgraded copy of %s", id)
+				return
+			}
+			if err = os.Remove(moved[0]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		undone++
+	}
+
+	summary, err := filesystem.Upgrade(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if wantRewritten := (undone + 1) / 2; summary.Rewritten != wantRewritten {
+		t.Errorf("got %d objects rewritten want %d", summary.Rewritten, wantRewritten)
+	}
+
+	assertUpgraded(ctx, t, loc, want)
+}
+
+func TestUpgradeTo_binary(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc := t.TempDir()
+	created, err := filesystem.OpenRepository(ctx, loc, filesystem.RepositoryObjectFormat(filesystem.FormatBinary, 1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	written := envelopes.Transaction{
+		Comment:    "written in version 1",
+		PostedTime: time.Date(2021, time.March, 4, 12, 30, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		State: &envelopes.State{
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(314, 100)}},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(314, 100)}},
+		},
+	}
+	if err = created.WriteTransaction(ctx, written); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = created.WriteBranch(ctx, persist.DefaultBranch, written.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Version 1 of the binary format can't record which way times are hashed, so history can't be normalized yet.
+	_, _, err = persist.Rewrite(ctx, created, created, persist.NormalizeTimes(), written.ID())
+	if !errors.Is(err, persist.ErrUnsupported) {
+		t.Errorf("got: %v want: an error matching persist.ErrUnsupported", err)
+	}
+
+	config, err := filesystem.LoadConfig(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Binary repositories can't be moved to another format.
+	var unsupported filesystem.ErrUnsupportedConfiguration
+	if _, err = filesystem.Upgrade(ctx, loc); !errors.As(err, &unsupported) {
+		t.Errorf("got: %v want: an ErrUnsupportedConfiguration", err)
+	}
+
+	target := *config
+	target.Objects.Version = persistBinary.NewestVersion
+	if _, err = filesystem.UpgradeTo(ctx, loc, target); err != nil {
+		t.Error(err)
+		return
+	}
+
+	upgraded, err := filesystem.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var loaded envelopes.Transaction
+	if err = upgraded.LoadTransaction(ctx, written.ID(), &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if !loaded.Equal(written) || loaded.ID() != written.ID() {
+		t.Errorf("got: %s want: %s", loaded, written)
+	}
+
+	heads, _, err := persist.Rewrite(ctx, upgraded, upgraded, persist.NormalizeTimes(), written.ID())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = upgraded.LoadTransaction(ctx, heads[0], &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if loaded.TimeHashing != envelopes.UTCTimeHashing || !loaded.PostedTime.Equal(written.PostedTime) {
+		t.Errorf("got time hashing %d posted %v want time hashing %d posted %v", loaded.TimeHashing, loaded.PostedTime, envelopes.UTCTimeHashing, written.PostedTime)
+	}
+}
+
+// readHistory loads every Transaction reachable from the branches in a repository.
+func readHistory(ctx context.Context, t *testing.T, loc string) map[envelopes.ID]envelopes.Transaction {
+	repo, err := filesystem.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var heads []envelopes.ID
+	for _, branch := range readBranchNames(ctx, t, repo) {
+		head, err := repo.ReadBranch(ctx, branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heads = append(heads, head)
+	}
+
+	retval := make(map[envelopes.ID]envelopes.Transaction)
+	walker := persist.Walker{Loader: repo}
+	err = walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		retval[id] = transaction
+		return nil
+	}, heads...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return retval
+}
+
+func assertUpgraded(ctx context.Context, t *testing.T, loc string, want map[envelopes.ID]envelopes.Transaction) {
+	config, err := filesystem.LoadConfig(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if config.Objects.Format != filesystem.FormatJson || config.Objects.Version != persistJson.NewestVersion || config.ObjectLocations != 1 {
+		t.Errorf("unexpected configuration after upgrade: %+v", *config)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(loc, filesystem.ObjectsDir, "*.json"))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("objects were left behind in the old layout: %v", leftovers)
+	}
+
+	got := readHistory(ctx, t, loc)
+	if len(got) != len(want) {
+		t.Errorf("got %d transactions want %d", len(got), len(want))
+	}
+
+	repo, err := filesystem.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, expected := range want {
+		actual, ok := got[id]
+		if !ok {
+			t.Errorf("transaction %s is no longer reachable", id)
+			continue
+		}
+		if !actual.Equal(expected) {
+			t.Errorf("transaction %s changed during the upgrade", id)
+		}
+
+		raw, err := repo.Fetch(ctx, id)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if version, err := persistJson.TransactionVersion(raw); err != nil || version != persistJson.NewestVersion {
+			t.Errorf("transaction %s is version %d (err: %v) want %d", id, version, err, persistJson.NewestVersion)
+		}
+	}
+}
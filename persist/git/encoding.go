@@ -0,0 +1,556 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+// Names of the trailers that are added to the end of each commit message, so that a Transaction can be read back
+// exactly as it was written.
+const (
+	idTrailer             = "Envelopes-Id"
+	postedTimeTrailer     = "Envelopes-Posted-Time"
+	actualTimeTrailer     = "Envelopes-Actual-Time"
+	enteredTimeTrailer    = "Envelopes-Entered-Time"
+	postedDateTrailer     = "Envelopes-Posted-Date"
+	actualDateTrailer     = "Envelopes-Actual-Date"
+	timeHashingTrailer    = "Envelopes-Time-Hashing"
+	amountTrailer         = "Envelopes-Amount"
+	merchantTrailer       = "Envelopes-Merchant"
+	committerNameTrailer  = "Envelopes-Committer-Name"
+	committerEmailTrailer = "Envelopes-Committer-Email"
+	recordIDTrailer       = "Envelopes-Record-Id"
+	parentTrailer         = "Envelopes-Parent"
+	revertsTrailer        = "Envelopes-Reverts"
+	lineItemTrailer       = "Envelopes-Line-Item"
+	tagsTrailer           = "Envelopes-Tags"
+	metadataTrailer       = "Envelopes-Metadata"
+	attachmentTrailer     = "Envelopes-Attachment"
+)
+
+// balanceName is the name of the blob holding a Budget's own balance, inside the tree that represents that Budget. Child
+// names that start with a period are always escaped, so it can't collide with a child Budget.
+const balanceName = ".balance"
+
+// formatMagnitude writes a magnitude as a decimal, with at least three places, when that can be done exactly. Otherwise,
+// it is written as a fraction.
+func formatMagnitude(magnitude *big.Rat) string {
+	places, ok := envelopes.DecimalPlaces(magnitude)
+	if !ok {
+		return magnitude.RatString()
+	}
+
+	if places < 3 {
+		places = 3
+	}
+	return magnitude.FloatString(places)
+}
+
+// encodeBalance writes a Balance as a JSON object, with one property per asset, sorted by asset.
+func encodeBalance(balance envelopes.Balance) ([]byte, error) {
+	formatted := make(map[string]string, len(balance))
+	for asset, magnitude := range balance {
+		if magnitude == nil {
+			magnitude = &big.Rat{}
+		}
+		formatted[string(asset)] = formatMagnitude(magnitude)
+	}
+
+	marshaled, err := json.Marshal(formatted)
+	if err != nil {
+		return nil, err
+	}
+	return append(marshaled, '\n'), nil
+}
+
+func decodeBalance(marshaled []byte) (envelopes.Balance, error) {
+	var formatted map[string]string
+	err := json.Unmarshal(marshaled, &formatted)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make(envelopes.Balance, len(formatted))
+	for asset, text := range formatted {
+		magnitude, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a valid magnitude", text)
+		}
+		retval[envelopes.AssetType(asset)] = magnitude
+	}
+	return retval, nil
+}
+
+// metadataEntry is how a single entry of envelopes.AccountMetadata is written. Fields that aren't set are left out.
+type metadataEntry struct {
+	Class       envelopes.AccountClass   `json:"class,omitempty"`
+	Subtype     envelopes.AccountSubtype `json:"subtype,omitempty"`
+	Institution string                   `json:"institution,omitempty"`
+	Currency    envelopes.AssetType      `json:"currency,omitempty"`
+	Closed      bool                     `json:"closed,omitempty"`
+}
+
+// encodeMetadata writes AccountMetadata as a JSON object, with one property per Account, sorted by name. Accounts whose
+// AccountDetails are all zero are left out.
+func encodeMetadata(metadata envelopes.AccountMetadata) ([]byte, error) {
+	formatted := make(map[string]metadataEntry, len(metadata))
+	for _, name := range metadata.Names() {
+		formatted[name] = metadataEntry(metadata[name])
+	}
+
+	marshaled, err := json.MarshalIndent(formatted, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(marshaled, '\n'), nil
+}
+
+func decodeMetadata(marshaled []byte) (envelopes.AccountMetadata, error) {
+	var formatted map[string]metadataEntry
+	err := json.Unmarshal(marshaled, &formatted)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make(envelopes.AccountMetadata, len(formatted))
+	for name, entry := range formatted {
+		retval[name] = envelopes.AccountDetails(entry)
+	}
+	return retval, nil
+}
+
+// lineItemEntry is how a single envelopes.LineItem is written, as the value of a trailer. The Budget is written as the
+// text of its envelopes.BudgetPath.
+type lineItemEntry struct {
+	Amount  json.RawMessage `json:"amount"`
+	Budget  string          `json:"budget"`
+	Memo    string          `json:"memo,omitempty"`
+	Account string          `json:"account,omitempty"`
+}
+
+// attachmentEntry is how a single envelopes.Attachment is written, as the value of a trailer.
+type attachmentEntry struct {
+	Blob      envelopes.ID `json:"blob"`
+	Filename  string       `json:"filename,omitempty"`
+	MediaType string       `json:"mediaType,omitempty"`
+}
+
+// encodeLineItem writes a LineItem as a single line of JSON.
+func encodeLineItem(item envelopes.LineItem) (string, error) {
+	amount, err := encodeBalance(item.Amount)
+	if err != nil {
+		return "", err
+	}
+
+	marshaled, err := json.Marshal(lineItemEntry{
+		Amount:  json.RawMessage(amount),
+		Budget:  item.Budget.String(),
+		Memo:    item.Memo,
+		Account: item.Account,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(marshaled), nil
+}
+
+func decodeLineItem(marshaled string) (retval envelopes.LineItem, err error) {
+	var entry lineItemEntry
+	err = json.Unmarshal([]byte(marshaled), &entry)
+	if err != nil {
+		return
+	}
+
+	retval.Amount, err = decodeBalance(entry.Amount)
+	if err != nil {
+		return
+	}
+	retval.Budget, err = envelopes.ParseBudgetPath(entry.Budget)
+	if err != nil {
+		return
+	}
+	retval.Memo = entry.Memo
+	retval.Account = entry.Account
+	return
+}
+
+// escapeName makes an Account or Budget name safe to use as the name of a git tree entry. Git doesn't allow names that
+// are empty, or that contain slashes or NUL characters. Names starting with a period are escaped too, so that they can't
+// be mistaken for "." or "..", ".git", or balanceName.
+func escapeName(name string) string {
+	if name == "" {
+		return "%"
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '%' || c == '/' || c == 0 || (i == 0 && c == '.') {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		} else {
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+func unescapeName(escaped string) (string, error) {
+	if escaped == "%" {
+		return "", nil
+	}
+	return url.PathUnescape(escaped)
+}
+
+// formatSignature writes the author or committer line of a git commit. Git only allows a restricted set of names and
+// email addresses, so the values are sanitized. The exact values are recorded in trailers instead.
+func formatSignature(user envelopes.User, when time.Time) string {
+	sanitize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			switch r {
+			case '<', '>', '\n', 0:
+				return -1
+			default:
+				return r
+			}
+		}, strings.TrimSpace(s))
+	}
+
+	name := sanitize(user.FullName)
+	if name == "" {
+		name = "Unknown"
+	}
+
+	// Git doesn't accept dates before the epoch, which the zero value of time.Time is.
+	if when.IsZero() {
+		when = time.Unix(0, 0).UTC()
+	}
+
+	_, offset := when.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	return fmt.Sprintf("%s <%s> %d %c%02d%02d", name, sanitize(user.Email), when.Unix(), sign, offset/3600, (offset%3600)/60)
+}
+
+// formatSubject summarizes a Transaction in a single line, so that it's readable in the output of "git log --oneline".
+func formatSubject(subject envelopes.Transaction) string {
+	merchant := strings.Join(strings.Fields(subject.Merchant), " ")
+	if merchant == "" {
+		merchant = "Transaction"
+	}
+
+	if len(subject.Amount) == 0 {
+		return merchant
+	}
+	return fmt.Sprintf("%s: %s", merchant, subject.Amount)
+}
+
+// trailer is a single "Key: value" line at the end of a commit message.
+type trailer struct {
+	key   string
+	value string
+}
+
+func quote(s string) string {
+	marshaled, _ := json.Marshal(s)
+	return string(marshaled)
+}
+
+func unquote(s string) (retval string, err error) {
+	err = json.Unmarshal([]byte(s), &retval)
+	return
+}
+
+// encodeMessage writes the message of the commit that represents a Transaction. It is made of a subject line, the
+// Transaction's comment, and a paragraph of trailers that holds every other field.
+func encodeMessage(subject envelopes.Transaction) (string, error) {
+	const timeFormat = time.RFC3339Nano
+
+	trailers := []trailer{
+		{idTrailer, subject.ID().String()},
+		{postedTimeTrailer, subject.PostedTime.Format(timeFormat)},
+	}
+
+	if !subject.ActualTime.IsZero() {
+		trailers = append(trailers, trailer{actualTimeTrailer, subject.ActualTime.Format(timeFormat)})
+	}
+
+	if !subject.EnteredTime.IsZero() {
+		trailers = append(trailers, trailer{enteredTimeTrailer, subject.EnteredTime.Format(timeFormat)})
+	}
+
+	if !subject.PostedDate.IsZero() {
+		trailers = append(trailers, trailer{postedDateTrailer, subject.PostedDate.String()})
+	}
+
+	if !subject.ActualDate.IsZero() {
+		trailers = append(trailers, trailer{actualDateTrailer, subject.ActualDate.String()})
+	}
+
+	if subject.TimeHashing != envelopes.LocalTimeHashing {
+		timeHashing, err := subject.TimeHashing.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{timeHashingTrailer, string(timeHashing)})
+	}
+
+	if len(subject.Amount) > 0 {
+		amount, err := encodeBalance(subject.Amount)
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{amountTrailer, strings.TrimSpace(string(amount))})
+	}
+
+	optional := []trailer{
+		{merchantTrailer, subject.Merchant},
+		{committerNameTrailer, subject.Committer.FullName},
+		{committerEmailTrailer, subject.Committer.Email},
+		{recordIDTrailer, string(subject.RecordID)},
+	}
+	for _, entry := range optional {
+		if entry.value != "" {
+			trailers = append(trailers, trailer{entry.key, quote(entry.value)})
+		}
+	}
+
+	for _, parent := range subject.Parents {
+		trailers = append(trailers, trailer{parentTrailer, parent.String()})
+	}
+
+	for _, reverted := range subject.Reverts {
+		trailers = append(trailers, trailer{revertsTrailer, reverted.String()})
+	}
+
+	for _, item := range subject.LineItems {
+		encoded, err := encodeLineItem(item)
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{lineItemTrailer, encoded})
+	}
+
+	if len(subject.Tags) > 0 {
+		tags, err := json.Marshal(subject.Tags.Sorted())
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{tagsTrailer, string(tags)})
+	}
+
+	if len(subject.Metadata) > 0 {
+		metadata, err := json.Marshal(subject.Metadata)
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{metadataTrailer, string(metadata)})
+	}
+
+	for _, attachment := range subject.Attachments {
+		encoded, err := json.Marshal(attachmentEntry(attachment))
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, trailer{attachmentTrailer, string(encoded)})
+	}
+
+	var builder strings.Builder
+	builder.WriteString(formatSubject(subject))
+	builder.WriteString("\n\n")
+	builder.WriteString(subject.Comment)
+	builder.WriteString("\n\n")
+	for _, entry := range trailers {
+		fmt.Fprintf(&builder, "%s: %s\n", entry.key, entry.value)
+	}
+	return builder.String(), nil
+}
+
+// decodeMessage reads the fields of a Transaction back out of a commit message written by encodeMessage. The State isn't
+// set, because it is found in the commit's tree. It returns the ID recorded in the message.
+func decodeMessage(message string, toLoad *envelopes.Transaction) (envelopes.ID, error) {
+	var id envelopes.ID
+
+	// The subject never contains a blank line, and neither do the trailers. The comment, which could, is everything in
+	// between.
+	message = strings.TrimSuffix(message, "\n")
+	subjectEnd := strings.Index(message, "\n\n")
+	trailersStart := strings.LastIndex(message, "\n\n")
+	if subjectEnd < 0 || trailersStart < subjectEnd {
+		return id, errors.New("commit message was not written by this package")
+	}
+
+	comment := ""
+	if trailersStart > subjectEnd {
+		comment = message[subjectEnd+2 : trailersStart]
+	}
+
+	var loaded envelopes.Transaction
+	loaded.Comment = comment
+	loaded.Amount = envelopes.Balance{}
+	loaded.Parents = []envelopes.ID{}
+	loaded.Reverts = []envelopes.ID{}
+
+	parseID := func(text string) (retval envelopes.ID, err error) {
+		if len(text) != 2*len(retval) {
+			err = fmt.Errorf("%q is not an ID", text)
+			return
+		}
+		err = retval.UnmarshalText([]byte(text))
+		return
+	}
+
+	foundID := false
+	for _, line := range strings.Split(message[trailersStart+2:], "\n") {
+		separator := strings.Index(line, ": ")
+		if separator < 0 {
+			return id, fmt.Errorf("malformed trailer %q", line)
+		}
+		key, value := line[:separator], line[separator+2:]
+
+		var err error
+		switch key {
+		case idTrailer:
+			id, err = parseID(value)
+			foundID = true
+		case postedTimeTrailer:
+			loaded.PostedTime, err = time.Parse(time.RFC3339Nano, value)
+		case actualTimeTrailer:
+			loaded.ActualTime, err = time.Parse(time.RFC3339Nano, value)
+		case enteredTimeTrailer:
+			loaded.EnteredTime, err = time.Parse(time.RFC3339Nano, value)
+		case postedDateTrailer:
+			loaded.PostedDate, err = envelopes.ParseDate(value)
+		case actualDateTrailer:
+			loaded.ActualDate, err = envelopes.ParseDate(value)
+		case timeHashingTrailer:
+			err = loaded.TimeHashing.UnmarshalText([]byte(value))
+		case amountTrailer:
+			loaded.Amount, err = decodeBalance([]byte(value))
+		case merchantTrailer:
+			loaded.Merchant, err = unquote(value)
+		case committerNameTrailer:
+			loaded.Committer.FullName, err = unquote(value)
+		case committerEmailTrailer:
+			loaded.Committer.Email, err = unquote(value)
+		case recordIDTrailer:
+			var recordID string
+			recordID, err = unquote(value)
+			loaded.RecordID = envelopes.BankRecordID(recordID)
+		case parentTrailer:
+			var parent envelopes.ID
+			parent, err = parseID(value)
+			loaded.Parents = append(loaded.Parents, parent)
+		case revertsTrailer:
+			var reverted envelopes.ID
+			reverted, err = parseID(value)
+			loaded.Reverts = append(loaded.Reverts, reverted)
+		case lineItemTrailer:
+			var item envelopes.LineItem
+			item, err = decodeLineItem(value)
+			loaded.LineItems = append(loaded.LineItems, item)
+		case tagsTrailer:
+			var tags []string
+			err = json.Unmarshal([]byte(value), &tags)
+			loaded.Tags = envelopes.NewTagSet(tags...)
+		case metadataTrailer:
+			err = json.Unmarshal([]byte(value), &loaded.Metadata)
+		case attachmentTrailer:
+			var entry attachmentEntry
+			err = json.Unmarshal([]byte(value), &entry)
+			loaded.Attachments = append(loaded.Attachments, envelopes.Attachment(entry))
+		default:
+			// Trailers added by other tools, like "Signed-off-by", are ignored.
+		}
+		if err != nil {
+			return id, fmt.Errorf("malformed trailer %q: %w", key, err)
+		}
+	}
+
+	if !foundID {
+		return id, fmt.Errorf("commit message is missing the %s trailer", idTrailer)
+	}
+
+	*toLoad = loaded
+	return id, nil
+}
+
+// commit holds the parts of a git commit that are needed to represent a Transaction.
+type commit struct {
+	tree    objectID
+	parents []objectID
+	message string
+}
+
+func encodeCommit(subject envelopes.Transaction, tree objectID, parents []objectID) ([]byte, error) {
+	message, err := encodeMessage(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	when := subject.EnteredTime
+	if when.IsZero() {
+		when = postedTime(subject)
+	}
+	signature := formatSignature(subject.Committer, when)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "tree %s\n", tree)
+	for _, parent := range parents {
+		fmt.Fprintf(&builder, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&builder, "author %s\n", signature)
+	fmt.Fprintf(&builder, "committer %s\n", signature)
+	builder.WriteString("\n")
+	builder.WriteString(message)
+	return []byte(builder.String()), nil
+}
+
+// postedTime finds when a Transaction posted, falling back to the start of its PostedDate in UTC if it only has one.
+func postedTime(subject envelopes.Transaction) time.Time {
+	if subject.PostedTime.IsZero() && !subject.PostedDate.IsZero() {
+		return subject.PostedDate.In(time.UTC)
+	}
+	return subject.PostedTime
+}
+
+func decodeCommit(contents []byte) (retval commit, err error) {
+	text := string(contents)
+	headerEnd := strings.Index(text, "\n\n")
+	if headerEnd < 0 {
+		err = errors.New("commit has no message")
+		return
+	}
+	retval.message = text[headerEnd+2:]
+
+	foundTree := false
+	for _, line := range strings.Split(text[:headerEnd], "\n") {
+		switch {
+		case strings.HasPrefix(line, "tree "):
+			retval.tree, err = parseObjectID(strings.TrimPrefix(line, "tree "))
+			foundTree = true
+		case strings.HasPrefix(line, "parent "):
+			var parent objectID
+			parent, err = parseObjectID(strings.TrimPrefix(line, "parent "))
+			retval.parents = append(retval.parents, parent)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if !foundTree {
+		err = errors.New("commit has no tree")
+	}
+	return
+}
@@ -0,0 +1,217 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// ExportFastImport writes the history of a branch as a stream that "git fast-import" understands. It is a lighter
+// alternative to storing a repository with this package: the exported history can be browsed with git, but can't be
+// read back.
+//
+// Each Transaction becomes a commit on the branch of the same name. Its committer comes from the Transaction's
+// Committer, its date from PostedTime or PostedDate, and its message from Merchant and Comment. Its tree renders the Transaction's
+// State as text: there is a file for each Account in the "accounts" directory, and a directory for each Budget in the
+// "budget" directory holding a ".balance" file. That way, "git diff" shows how balances changed.
+func ExportFastImport(ctx context.Context, w io.Writer, repo persist.BareRepositoryReader, branch string) error {
+	head, err := repo.ReadBranch(ctx, branch)
+	if err != nil {
+		return err
+	}
+	if head.Equal(envelopes.ID{}) {
+		// Nothing has been committed to this branch yet.
+		return nil
+	}
+
+	parents := make(map[envelopes.ID][]envelopes.ID)
+	walker := persist.Walker{Loader: repo}
+	err = walker.Walk(ctx, func(_ context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		parents[id] = transaction.Parents
+		return nil
+	}, head)
+	if err != nil {
+		return err
+	}
+
+	// The Walker visits children before their parents, but fast-import needs a commit's parents to come first. Only
+	// parents are remembered while walking, and each Transaction is loaded again as it is exported, so that memory use
+	// doesn't grow with the size of each State.
+	buffered := bufio.NewWriter(w)
+	marks := make(map[envelopes.ID]int, len(parents))
+	for _, id := range parentsFirst(head, parents) {
+		var transaction envelopes.Transaction
+		err = repo.LoadTransaction(ctx, id, &transaction)
+		if err != nil {
+			return err
+		}
+
+		marks[id] = len(marks) + 1
+		err = writeFastImportCommit(buffered, branch, marks, transaction)
+		if err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// parentsFirst orders the Transactions reachable from head, so that each one comes after all of its parents.
+func parentsFirst(head envelopes.ID, parents map[envelopes.ID][]envelopes.ID) []envelopes.ID {
+	type frame struct {
+		id       envelopes.ID
+		expanded bool
+	}
+
+	retval := make([]envelopes.ID, 0, len(parents))
+	visited := make(map[envelopes.ID]struct{}, len(parents))
+	stack := []frame{{id: head}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if current.expanded {
+			retval = append(retval, current.id)
+			continue
+		}
+
+		if _, ok := visited[current.id]; ok {
+			continue
+		}
+		if _, ok := parents[current.id]; !ok {
+			continue
+		}
+		visited[current.id] = struct{}{}
+
+		stack = append(stack, frame{id: current.id, expanded: true})
+		ancestors := parents[current.id]
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			stack = append(stack, frame{id: ancestors[i]})
+		}
+	}
+	return retval
+}
+
+func writeFastImportCommit(w io.Writer, branch string, marks map[envelopes.ID]int, transaction envelopes.Transaction) error {
+	id := transaction.ID()
+
+	message := strings.TrimSpace(transaction.Merchant)
+	if comment := strings.TrimSpace(transaction.Comment); comment != "" {
+		if message == "" {
+			message = comment
+		} else {
+			message += "\n\n" + comment
+		}
+	}
+	if message == "" {
+		message = "Transaction " + id.String()
+	}
+
+	var err error
+	write := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	write("commit refs/heads/%s\n", branch)
+	write("mark :%d\n", marks[id])
+	write("committer %s\n", formatSignature(transaction.Committer, postedTime(transaction)))
+	write("data %d\n%s\n", len(message), message)
+
+	first := true
+	for _, parent := range transaction.Parents {
+		mark, ok := marks[parent]
+		if !ok {
+			continue
+		}
+		if first {
+			write("from :%d\n", mark)
+			first = false
+		} else {
+			write("merge :%d\n", mark)
+		}
+	}
+
+	// Rather than working out which files changed since the first parent, every commit replaces its whole tree.
+	// fast-import finds the differences itself.
+	write("deleteall\n")
+
+	files := renderState(transaction.State)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write("M 644 inline %s\n", quoteFastImportPath(name))
+		write("data %d\n%s\n", len(files[name]), files[name])
+	}
+	write("\n")
+
+	return err
+}
+
+// renderState creates the files that show a State, keyed by their slash-separated paths.
+func renderState(state *envelopes.State) map[string]string {
+	retval := make(map[string]string)
+	if state == nil {
+		return retval
+	}
+
+	for name, balance := range state.Accounts {
+		retval[path.Join(accountsName, escapeName(name))] = renderBalance(balance)
+	}
+
+	var renderBudget func(dir string, budget *envelopes.Budget)
+	renderBudget = func(dir string, budget *envelopes.Budget) {
+		retval[path.Join(dir, balanceName)] = renderBalance(budget.Balance)
+		for name, child := range budget.Children {
+			renderBudget(path.Join(dir, escapeName(name)), child)
+		}
+	}
+	if state.Budget != nil {
+		renderBudget(budgetName, state.Budget)
+	}
+
+	return retval
+}
+
+// renderBalance writes each asset in a Balance on its own line, sorted by asset.
+func renderBalance(balance envelopes.Balance) string {
+	assets := make([]string, 0, len(balance))
+	for asset := range balance {
+		assets = append(assets, string(asset))
+	}
+	sort.Strings(assets)
+
+	var builder strings.Builder
+	for _, asset := range assets {
+		display := asset
+		if display == "" || strings.IndexFunc(display, func(r rune) bool { return r <= ' ' || r == '"' }) >= 0 {
+			display = strconv.Quote(display)
+		}
+		magnitude := balance[envelopes.AssetType(asset)]
+		if magnitude == nil {
+			magnitude = &big.Rat{}
+		}
+		fmt.Fprintf(&builder, "%s %s\n", display, formatMagnitude(magnitude))
+	}
+	return builder.String()
+}
+
+// quoteFastImportPath quotes a path if fast-import would otherwise misread it.
+func quoteFastImportPath(p string) string {
+	if strings.HasPrefix(p, "\"") || strings.ContainsAny(p, " \n\\") {
+		return strconv.Quote(p)
+	}
+	return p
+}
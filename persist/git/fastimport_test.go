@@ -0,0 +1,163 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/git"
+)
+
+// exampleHistory commits a short history, including a merge, to the default branch of a new MemoryRepository.
+func exampleHistory(ctx context.Context, t *testing.T) *persist.MemoryRepository {
+	repo := persist.NewMemoryRepository()
+	posted := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.FixedZone("PDT", -7*60*60))
+	jane := envelopes.User{FullName: "Jane Doe", Email: "jane@example.com"}
+
+	payday := envelopes.Transaction{
+		Merchant:   "Employer",
+		Comment:    "Payday",
+		PostedTime: posted,
+		Committer:  jane,
+		State: &envelopes.State{
+			Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(200000, 100)}},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(200000, 100)}},
+		},
+		Parents: []envelopes.ID{},
+	}
+	groceries := envelopes.Transaction{
+		Merchant:   "Grocery Store",
+		PostedTime: posted.Add(24 * time.Hour),
+		Committer:  jane,
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Balance: envelopes.Balance{"USD": big.NewRat(191477, 100)},
+				Children: map[string]*envelopes.Budget{
+					"food": {Balance: envelopes.Balance{"USD": big.NewRat(-8523, 100)}},
+				},
+			},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(191477, 100)}},
+		},
+		Parents: []envelopes.ID{payday.ID()},
+	}
+	correction := envelopes.Transaction{
+		Comment:    "Imported from the bank",
+		PostedTime: posted.Add(48 * time.Hour),
+		State:      payday.State,
+		Parents:    []envelopes.ID{payday.ID()},
+	}
+	merged := envelopes.Transaction{
+		Comment:    "Merge",
+		PostedTime: posted.Add(72 * time.Hour),
+		Committer:  jane,
+		State:      groceries.State,
+		Parents:    []envelopes.ID{groceries.ID(), correction.ID()},
+	}
+
+	for _, transaction := range []envelopes.Transaction{payday, groceries, correction, merged} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.WriteBranch(ctx, persist.DefaultBranch, merged.ID()); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestExportFastImport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stream bytes.Buffer
+	if err := git.ExportFastImport(ctx, &stream, exampleHistory(ctx, t), persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	exported := stream.String()
+
+	if got := strings.Count(exported, "commit refs/heads/master\n"); got != 4 {
+		t.Errorf("got %d commits want 4", got)
+	}
+
+	// Parents have to be written before their children, so the first commit can't have any.
+	firstCommit := exported[:strings.Index(exported, "\n\ncommit ")]
+	if strings.Contains(firstCommit, "from :") {
+		t.Errorf("first commit should not have a parent:\n%s", firstCommit)
+	}
+
+	for _, want := range []string{
+		"committer Jane Doe <jane@example.com> 1615759766 -0700\n",
+		"M 644 inline budget/food/.balance\ndata 12\nUSD -85.230\n",
+		"M 644 inline accounts/checking\ndata 13\nUSD 2000.000\n",
+		"merge :",
+	} {
+		if !strings.Contains(exported, want) {
+			t.Errorf("stream does not contain %q:\n%s", want, exported)
+		}
+	}
+}
+
+func TestExportFastImport_unbornBranch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	repo := persist.NewMemoryRepository()
+	if err := repo.WriteBranch(ctx, persist.DefaultBranch, envelopes.ID{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stream bytes.Buffer
+	if err := git.ExportFastImport(ctx, &stream, repo, persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Len() != 0 {
+		t.Errorf("expected an empty stream, got:\n%s", stream.String())
+	}
+}
+
+// TestExportFastImport_gitCompatible feeds an exported stream to "git fast-import", when git is installed.
+func TestExportFastImport_gitCompatible(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stream bytes.Buffer
+	if err := git.ExportFastImport(ctx, &stream, exampleHistory(ctx, t), persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	loc := t.TempDir()
+	runGit := func(stdin *bytes.Buffer, args ...string) string {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = loc
+		if stdin != nil {
+			cmd.Stdin = stdin
+		}
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+
+	runGit(nil, "init", "--quiet")
+	runGit(&stream, "fast-import", "--quiet")
+
+	if got, want := runGit(nil, "rev-list", "--count", persist.DefaultBranch), "4\n"; got != want {
+		t.Errorf("got %q commits want %q", got, want)
+	}
+
+	diff := runGit(nil, "diff", persist.DefaultBranch+"^2", persist.DefaultBranch, "--", "accounts/checking")
+	if !strings.Contains(diff, "-USD 2000.000\n+USD 1914.770\n") {
+		t.Errorf("diff did not show the change in balance:\n%s", diff)
+	}
+}
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// attachmentsName is the subtree of a commit's tree that holds the Blobs attached to its Transaction. It isn't part of
+// the State, but it makes the Blobs reachable, so that git copies them along with the commit.
+const attachmentsName = "attachments"
+
+// indexPath finds the file that records which git object represents the envelopes object with the given ID.
+func (repo *Repository) indexPath(id envelopes.ID) string {
+	full := id.String()
+	return filepath.Join(repo.dir, "envelopes", "objects", full[:2], full[2:])
+}
+
+func (repo *Repository) writeIndex(id envelopes.ID, object objectID) error {
+	return writeFileAtomically(repo.indexPath(id), []byte(object.String()+"\n"), 0644)
+}
+
+// readIndex finds the git object that represents an envelopes object. The first time an object can't be found, the
+// index is brought up to date with the commits git knows about, in case they were copied in by git rather than written
+// by this package.
+func (repo *Repository) readIndex(id envelopes.ID) (objectID, error) {
+	retval, err := repo.readIndexFile(id)
+	if !errors.Is(err, persist.ErrNotFound) {
+		return retval, err
+	}
+
+	repo.indexLock.Lock()
+	defer repo.indexLock.Unlock()
+	if repo.reindexed {
+		return objectID{}, err
+	}
+	if err = repo.reindex(); err != nil {
+		return objectID{}, err
+	}
+	repo.reindexed = true
+	return repo.readIndexFile(id)
+}
+
+func (repo *Repository) readIndexFile(id envelopes.ID) (objectID, error) {
+	contents, err := os.ReadFile(repo.indexPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return objectID{}, persist.ErrObjectNotFound(id)
+	} else if err != nil {
+		return objectID{}, err
+	}
+
+	retval, err := parseObjectID(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return objectID{}, persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return retval, nil
+}
+
+// reindex adds every Transaction reachable from a ref to the index, along with the States, Budgets, Accounts, and Blobs
+// that are loaded with it. The index is kept where git doesn't look, so "git clone" and "git push" don't copy it;
+// rebuilding it from the commits themselves is what allows a copy made by git to be read by this package.
+//
+// Writing a Transaction indexes everything needed to load it, so a commit whose Transaction is already indexed is
+// skipped along with its ancestors. Commits that weren't written by this package have no Transaction to index, but
+// their ancestors are still searched.
+func (repo *Repository) reindex() error {
+	pending, err := repo.refTargets()
+	if err != nil {
+		return err
+	}
+
+	visitedCommits := make(map[objectID]struct{})
+	visitedTrees := make(map[objectID]struct{})
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if _, ok := visitedCommits[current]; ok {
+			continue
+		}
+		visitedCommits[current] = struct{}{}
+
+		kind, contents, err := repo.objects.read(current)
+		if err != nil {
+			return err
+		}
+		if kind != commitType {
+			// Refs may also point at annotated tags, which don't represent Transactions.
+			continue
+		}
+
+		decoded, err := decodeCommit(contents)
+		if err != nil {
+			return err
+		}
+
+		var transaction envelopes.Transaction
+		id, err := decodeMessage(decoded.message, &transaction)
+		if err != nil {
+			pending = append(pending, decoded.parents...)
+			continue
+		}
+
+		if existing, err := repo.readIndexFile(id); err == nil && existing == current {
+			continue
+		}
+
+		if err = repo.indexState(decoded.tree, visitedTrees); err != nil {
+			return err
+		}
+
+		for _, attachment := range transaction.Attachments {
+			blob := objectID(attachment.Blob)
+			if !repo.objects.has(blob) {
+				continue
+			}
+			if err = repo.writeIndex(attachment.Blob, blob); err != nil {
+				return err
+			}
+		}
+
+		// The Transaction is indexed last, so that it is only skipped in the future once everything it needs is indexed.
+		if err = repo.writeIndex(id, current); err != nil {
+			return err
+		}
+		pending = append(pending, decoded.parents...)
+	}
+	return nil
+}
+
+// indexState adds the State held in a tree to the index, along with its Budgets and Accounts.
+func (repo *Repository) indexState(object objectID, visited map[objectID]struct{}) error {
+	if _, ok := visited[object]; ok {
+		return nil
+	}
+	visited[object] = struct{}{}
+
+	var state envelopes.State
+	if err := repo.loadState(object, &state); err != nil {
+		return err
+	}
+	if err := repo.writeIndex(state.ID(), object); err != nil {
+		return err
+	}
+
+	entries, err := repo.readTree(object)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch entry.name {
+		case budgetName:
+			err = repo.indexBudget(entry.id, *state.Budget, visited)
+		case accountsName:
+			err = repo.writeIndex(state.Accounts.ID(), entry.id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBudget adds a Budget that has already been loaded from a tree to the index, along with each of its children.
+func (repo *Repository) indexBudget(object objectID, budget envelopes.Budget, visited map[objectID]struct{}) error {
+	if _, ok := visited[object]; ok {
+		return nil
+	}
+	visited[object] = struct{}{}
+
+	if err := repo.writeIndex(budget.ID(), object); err != nil {
+		return err
+	}
+
+	entries, err := repo.readTree(object)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.name == balanceName {
+			continue
+		}
+
+		name, err := unescapeName(entry.name)
+		if err != nil {
+			return err
+		}
+		child, ok := budget.Children[name]
+		if !ok {
+			continue
+		}
+		if err = repo.indexBudget(entry.id, *child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refTargets finds the object that every ref points at, whether it has its own file or has been packed. That includes
+// remote-tracking branches and tags, as well as local branches.
+func (repo *Repository) refTargets() ([]objectID, error) {
+	packed, err := repo.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make([]objectID, 0, len(packed))
+	for _, object := range packed {
+		retval = append(retval, object)
+	}
+
+	root := filepath.Join(repo.dir, "refs")
+	err = filepath.WalkDir(root, func(current string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+
+		contents, err := os.ReadFile(current)
+		if err != nil {
+			return err
+		}
+
+		// Symbolic refs, like refs/remotes/origin/HEAD, name another ref rather than an object.
+		trimmed := strings.TrimSpace(string(contents))
+		if strings.HasPrefix(trimmed, "ref: ") {
+			return nil
+		}
+
+		object, err := parseObjectID(trimmed)
+		if err != nil {
+			return err
+		}
+		retval = append(retval, object)
+		return nil
+	})
+	return retval, err
+}
+
+// attachBlobs creates the tree that a Transaction's commit points at: the tree holding its State, plus a subtree holding
+// each of its attachments. Blobs that haven't been stashed yet are left out, since git requires every object a tree
+// refers to to be present.
+func (repo *Repository) attachBlobs(state objectID, attachments []envelopes.Attachment) (objectID, error) {
+	blobs := make([]treeEntry, 0, len(attachments))
+	seen := make(map[objectID]struct{}, len(attachments))
+	for _, attachment := range attachments {
+		blob := objectID(attachment.Blob)
+		if _, ok := seen[blob]; ok || !repo.objects.has(blob) {
+			continue
+		}
+		seen[blob] = struct{}{}
+		blobs = append(blobs, treeEntry{name: blob.String(), mode: blobMode, id: blob})
+	}
+	if len(blobs) == 0 {
+		return state, nil
+	}
+
+	attached, err := repo.objects.write(treeType, encodeTree(blobs))
+	if err != nil {
+		return objectID{}, err
+	}
+
+	entries, err := repo.readTree(state)
+	if err != nil {
+		return objectID{}, err
+	}
+	entries = append(entries, treeEntry{name: attachmentsName, mode: treeMode, id: attached})
+	return repo.objects.write(treeType, encodeTree(entries))
+}
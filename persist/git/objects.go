@@ -0,0 +1,244 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// objectID is the name git gives an object: the SHA1 hash of its header and contents.
+type objectID [sha1.Size]byte
+
+func (id objectID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func parseObjectID(text string) (retval objectID, err error) {
+	if len(text) != 2*len(retval) {
+		err = fmt.Errorf("%q is not a git object ID", text)
+		return
+	}
+	_, err = hex.Decode(retval[:], []byte(text))
+	return
+}
+
+const (
+	blobType   = "blob"
+	treeType   = "tree"
+	commitType = "commit"
+)
+
+// Modes git uses for tree entries.
+const (
+	blobMode = "100644"
+	treeMode = "40000"
+)
+
+var errObjectNotFound = errors.New("git object not found")
+
+// objectStore reads and writes git objects. Objects are written as loose objects, which are stored one per file, named
+// after their objectID and compressed with zlib. They can be read either from loose objects or from pack files.
+type objectStore struct {
+	// dir is the location of the .git directory.
+	dir string
+
+	packs *packSet
+}
+
+func newObjectStore(dir string) objectStore {
+	return objectStore{
+		dir:   dir,
+		packs: &packSet{dir: dir},
+	}
+}
+
+func (store objectStore) path(id objectID) string {
+	full := id.String()
+	return filepath.Join(store.dir, "objects", full[:2], full[2:])
+}
+
+// write stores an object if it isn't already present, and returns its objectID.
+func (store objectStore) write(kind string, contents []byte) (objectID, error) {
+	header := kind + " " + strconv.Itoa(len(contents)) + "\x00"
+
+	hasher := sha1.New()
+	hasher.Write([]byte(header))
+	hasher.Write(contents)
+	var id objectID
+	hasher.Sum(id[:0])
+
+	loc := store.path(id)
+	if _, err := os.Stat(loc); err == nil {
+		// Objects are immutable, so there's nothing left to do.
+		return id, nil
+	}
+
+	var compressed bytes.Buffer
+	compressor := zlib.NewWriter(&compressed)
+	compressor.Write([]byte(header))
+	compressor.Write(contents)
+	if err := compressor.Close(); err != nil {
+		return objectID{}, err
+	}
+
+	// Git marks loose objects as read-only, to discourage modifying them.
+	return id, writeFileAtomically(loc, compressed.Bytes(), 0444)
+}
+
+// has determines whether an object is present, either as a loose object or in a pack file.
+func (store objectStore) has(id objectID) bool {
+	if _, err := os.Stat(store.path(id)); err == nil {
+		return true
+	}
+	_, ok, err := store.packs.lookup(id)
+	return err == nil && ok
+}
+
+// read fetches an object, and returns its kind and contents. Loose objects are preferred, then pack files are searched.
+func (store objectStore) read(id objectID) (string, []byte, error) {
+	handle, err := os.Open(store.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return store.packs.read(id, store.read)
+	} else if err != nil {
+		return "", nil, err
+	}
+	defer handle.Close()
+
+	decompressor, err := zlib.NewReader(handle)
+	if err != nil {
+		return "", nil, err
+	}
+	defer decompressor.Close()
+
+	raw, err := io.ReadAll(decompressor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nul := bytes.IndexByte(raw, 0)
+	if nul < 0 {
+		return "", nil, fmt.Errorf("git object %s has no header", id)
+	}
+
+	var kind string
+	var length int
+	if _, err = fmt.Sscanf(string(raw[:nul]), "%s %d", &kind, &length); err != nil {
+		return "", nil, fmt.Errorf("git object %s has a malformed header: %w", id, err)
+	}
+
+	contents := raw[nul+1:]
+	if len(contents) != length {
+		return "", nil, fmt.Errorf("git object %s should be %d bytes, but is %d", id, length, len(contents))
+	}
+	return kind, contents, nil
+}
+
+// readKind fetches an object, and checks that it is of the expected kind.
+func (store objectStore) readKind(id objectID, kind string) ([]byte, error) {
+	got, contents, err := store.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if got != kind {
+		return nil, fmt.Errorf("git object %s is a %s, not a %s", id, got, kind)
+	}
+	return contents, nil
+}
+
+// treeEntry is a single named item in a git tree.
+type treeEntry struct {
+	name string
+	mode string
+	id   objectID
+}
+
+// sortKey is the name git sorts an entry by. Subtrees are sorted as though they end with a slash.
+func (entry treeEntry) sortKey() string {
+	if entry.mode == treeMode {
+		return entry.name + "/"
+	}
+	return entry.name
+}
+
+func encodeTree(entries []treeEntry) []byte {
+	sorted := make([]treeEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].sortKey() < sorted[j].sortKey()
+	})
+
+	var buf bytes.Buffer
+	for _, entry := range sorted {
+		buf.WriteString(entry.mode)
+		buf.WriteByte(' ')
+		buf.WriteString(entry.name)
+		buf.WriteByte(0)
+		buf.Write(entry.id[:])
+	}
+	return buf.Bytes()
+}
+
+func decodeTree(contents []byte) ([]treeEntry, error) {
+	var retval []treeEntry
+	for len(contents) > 0 {
+		space := bytes.IndexByte(contents, ' ')
+		if space < 0 {
+			return nil, errors.New("tree entry is missing its mode")
+		}
+		mode := string(contents[:space])
+		contents = contents[space+1:]
+
+		nul := bytes.IndexByte(contents, 0)
+		if nul < 0 || len(contents) < nul+1+sha1.Size {
+			return nil, errors.New("tree entry ended unexpectedly")
+		}
+		entry := treeEntry{
+			name: string(contents[:nul]),
+			mode: mode,
+		}
+		copy(entry.id[:], contents[nul+1:])
+		contents = contents[nul+1+sha1.Size:]
+
+		retval = append(retval, entry)
+	}
+	return retval, nil
+}
+
+// writeFileAtomically writes to a temporary file, then renames it into place. That way, anybody reading name sees
+// either its old contents or its new contents, but never a partially written file.
+func writeFileAtomically(name string, contents []byte, mode os.FileMode) error {
+	dir := filepath.Dir(name)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(contents)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+
+	err = os.Chmod(temp.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), name)
+}
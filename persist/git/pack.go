@@ -0,0 +1,321 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Types of the entries in a pack file.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxDeltaDepth bounds how many deltas may be chained together, so that a corrupt pack can't send reading into an
+// endless loop. Git itself won't create chains deeper than 4095.
+const maxDeltaDepth = 4095
+
+var packTypeNames = map[byte]string{
+	packCommit: commitType,
+	packTree:   treeType,
+	packBlob:   blobType,
+	packTag:    "tag",
+}
+
+// packLocation is where an object can be found inside of a pack file.
+type packLocation struct {
+	pack   string
+	offset int64
+}
+
+// packSet reads objects out of the pack files that git creates when cloning, fetching, or running "git gc". Only
+// version 2 pack indexes are understood, which is all that git has written since 2008.
+type packSet struct {
+	// dir is the location of the .git directory.
+	dir string
+
+	lock      sync.Mutex
+	loaded    map[string]struct{}
+	locations map[objectID]packLocation
+}
+
+// lookup finds the pack that holds an object. Packs that appeared since the last lookup are read first, so that objects
+// git fetched in the meantime can be found.
+func (packs *packSet) lookup(id objectID) (packLocation, bool, error) {
+	packs.lock.Lock()
+	defer packs.lock.Unlock()
+
+	if location, ok := packs.locations[id]; ok {
+		return location, true, nil
+	}
+
+	if err := packs.refresh(); err != nil {
+		return packLocation{}, false, err
+	}
+	location, ok := packs.locations[id]
+	return location, ok, nil
+}
+
+// refresh reads the index of every pack that hasn't been read yet. The caller must hold packs.lock.
+func (packs *packSet) refresh() error {
+	indexes, err := filepath.Glob(filepath.Join(packs.dir, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		return err
+	}
+
+	if packs.loaded == nil {
+		packs.loaded = make(map[string]struct{})
+		packs.locations = make(map[objectID]packLocation)
+	}
+
+	for _, index := range indexes {
+		if _, ok := packs.loaded[index]; ok {
+			continue
+		}
+
+		pack := strings.TrimSuffix(index, ".idx") + ".pack"
+		err = readPackIndex(index, func(id objectID, offset int64) {
+			packs.locations[id] = packLocation{pack: pack, offset: offset}
+		})
+		if err != nil {
+			return fmt.Errorf("unable to read pack index %s: %w", index, err)
+		}
+		packs.loaded[index] = struct{}{}
+	}
+	return nil
+}
+
+// read fetches an object out of whichever pack holds it, and returns its kind and contents. If no pack holds it,
+// errObjectNotFound is returned. Deltas against objects outside of the pack are resolved using base.
+func (packs *packSet) read(id objectID, base func(objectID) (string, []byte, error)) (string, []byte, error) {
+	location, ok, err := packs.lookup(id)
+	if err != nil {
+		return "", nil, err
+	} else if !ok {
+		return "", nil, errObjectNotFound
+	}
+
+	handle, err := os.Open(location.pack)
+	if err != nil {
+		return "", nil, err
+	}
+	defer handle.Close()
+
+	kind, contents, err := readPackEntry(handle, location.offset, base, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read git object %s from %s: %w", id, location.pack, err)
+	}
+	return kind, contents, nil
+}
+
+// readPackIndex calls found with the name and offset of every object listed in a version 2 pack index.
+func readPackIndex(name string, found func(id objectID, offset int64)) error {
+	contents, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	const headerLen = 8
+	const fanoutLen = 256 * 4
+	if len(contents) < headerLen+fanoutLen || !bytes.Equal(contents[:headerLen], []byte("\xfftOc\x00\x00\x00\x02")) {
+		return errors.New("only version 2 pack indexes are supported")
+	}
+
+	count := int(binary.BigEndian.Uint32(contents[headerLen+fanoutLen-4:]))
+	namesStart := headerLen + fanoutLen
+	offsetsStart := namesStart + count*sha1.Size + count*4
+	largeStart := offsetsStart + count*4
+	if len(contents) < largeStart {
+		return errors.New("pack index ended unexpectedly")
+	}
+
+	for i := 0; i < count; i++ {
+		var id objectID
+		copy(id[:], contents[namesStart+i*sha1.Size:])
+
+		offset := int64(binary.BigEndian.Uint32(contents[offsetsStart+i*4:]))
+		if offset&0x80000000 != 0 {
+			// Offsets that don't fit in 31 bits are stored in a separate table, after the small ones.
+			large := largeStart + int(offset&0x7fffffff)*8
+			if len(contents) < large+8 {
+				return errors.New("pack index ended unexpectedly")
+			}
+			offset = int64(binary.BigEndian.Uint64(contents[large:]))
+		}
+		found(id, offset)
+	}
+	return nil
+}
+
+// readPackEntry reads the object stored at offset in a pack, applying any deltas it is stored as.
+func readPackEntry(pack io.ReaderAt, offset int64, base func(objectID) (string, []byte, error), depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, errors.New("chain of deltas is too deep")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(pack, offset, 1<<62))
+
+	// The header holds the type of the entry in bits 4-6 of the first byte, followed by its size as a variable length
+	// integer. The size is recomputed from the contents, so it isn't kept.
+	first, err := reader.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	entryType := (first >> 4) & 0x7
+	for current := first; current&0x80 != 0; {
+		if current, err = reader.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseKind string
+	var baseContents []byte
+	switch entryType {
+	case packCommit, packTree, packBlob, packTag:
+		contents, err := inflate(reader)
+		return packTypeNames[entryType], contents, err
+	case packOfsDelta:
+		// The distance back to the base is written big-endian, with one added to every byte after the first so that
+		// each distance has exactly one encoding.
+		current, err := reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		distance := int64(current & 0x7f)
+		for current&0x80 != 0 {
+			if current, err = reader.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(current&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return "", nil, fmt.Errorf("delta at %d refers outside of the pack", offset)
+		}
+		baseKind, baseContents, err = readPackEntry(pack, offset-distance, base, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		var baseID objectID
+		if _, err = io.ReadFull(reader, baseID[:]); err != nil {
+			return "", nil, err
+		}
+		baseKind, baseContents, err = base(baseID)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown pack entry type %d", entryType)
+	}
+
+	delta, err := inflate(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	contents, err := applyDelta(baseContents, delta)
+	return baseKind, contents, err
+}
+
+func inflate(compressed io.Reader) ([]byte, error) {
+	decompressor, err := zlib.NewReader(compressed)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+	return io.ReadAll(decompressor)
+}
+
+// applyDelta rebuilds an object from the object it was compressed against, and the instructions for turning one into
+// the other.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errTruncated := errors.New("delta ended unexpectedly")
+
+	readSize := func() (int, error) {
+		size, shift := 0, 0
+		for {
+			if len(delta) == 0 {
+				return 0, errTruncated
+			}
+			current := delta[0]
+			delta = delta[1:]
+			size |= int(current&0x7f) << shift
+			shift += 7
+			if current&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta expects a base of %d bytes, but it is %d", baseSize, len(base))
+	}
+
+	targetSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make([]byte, 0, targetSize)
+	for len(delta) > 0 {
+		instruction := delta[0]
+		delta = delta[1:]
+
+		if instruction&0x80 == 0 {
+			// Insert the next few bytes of the delta as they are.
+			length := int(instruction)
+			if length == 0 || len(delta) < length {
+				return nil, errors.New("malformed insert instruction in delta")
+			}
+			retval = append(retval, delta[:length]...)
+			delta = delta[length:]
+			continue
+		}
+
+		// Copy a range of the base. The low seven bits say which bytes of the offset and length are present.
+		var offset, length int
+		for i := 0; i < 7; i++ {
+			if instruction&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errTruncated
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				length |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if length == 0 {
+			length = 0x10000
+		}
+		if offset+length > len(base) {
+			return nil, errors.New("delta copies past the end of its base")
+		}
+		retval = append(retval, base[offset:offset+length]...)
+	}
+
+	if len(retval) != targetSize {
+		return nil, fmt.Errorf("delta should produce %d bytes, but produced %d", targetSize, len(retval))
+	}
+	return retval, nil
+}
@@ -0,0 +1,272 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// branchRefPrefix is the prefix of the full names of branches, as they appear in packed-refs.
+const branchRefPrefix = "refs/heads/"
+
+func (repo *Repository) branchPath(name string) string {
+	return filepath.Join(repo.dir, "refs", "heads", filepath.FromSlash(name))
+}
+
+// unbornPath finds the file marking that a branch exists, but doesn't point at any Transaction yet. Git has no way to
+// represent that, so those branches are recorded alongside the index instead.
+func (repo *Repository) unbornPath(name string) string {
+	return filepath.Join(repo.dir, "envelopes", "unborn", filepath.FromSlash(name))
+}
+
+func (repo *Repository) currentPath() string {
+	return filepath.Join(repo.dir, "envelopes", "current")
+}
+
+// ReadBranch fetches the ID of the Transaction that a branch is pointing at. If the branch doesn't exist,
+// persist.ErrBranchNotFound is returned.
+func (repo *Repository) ReadBranch(ctx context.Context, name string) (envelopes.ID, error) {
+	if err := ctx.Err(); err != nil {
+		return envelopes.ID{}, err
+	}
+
+	var object objectID
+	contents, err := os.ReadFile(repo.branchPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err = os.Stat(repo.unbornPath(name)); err == nil {
+			return envelopes.ID{}, nil
+		}
+
+		var packed map[string]objectID
+		packed, err = repo.readPackedRefs()
+		if err != nil {
+			return envelopes.ID{}, err
+		}
+		var ok bool
+		if object, ok = packed[branchRefPrefix+name]; !ok {
+			return envelopes.ID{}, persist.ErrBranchNotFound(name)
+		}
+	} else if err != nil {
+		return envelopes.ID{}, err
+	} else {
+		object, err = parseObjectID(strings.TrimSpace(string(contents)))
+		if err != nil {
+			return envelopes.ID{}, persist.ErrCorruptBranch{Name: name, Err: err}
+		}
+	}
+
+	id, err := repo.transactionID(object)
+	if err != nil {
+		return envelopes.ID{}, persist.ErrCorruptBranch{Name: name, Err: err}
+	}
+	return id, nil
+}
+
+// transactionID finds the ID of the Transaction represented by a commit, by reading the trailer that records it.
+func (repo *Repository) transactionID(object objectID) (envelopes.ID, error) {
+	contents, err := repo.objects.readKind(object, commitType)
+	if err != nil {
+		return envelopes.ID{}, err
+	}
+
+	decoded, err := decodeCommit(contents)
+	if err != nil {
+		return envelopes.ID{}, err
+	}
+
+	var ignored envelopes.Transaction
+	return decodeMessage(decoded.message, &ignored)
+}
+
+// WriteBranch sets a branch to point at a Transaction, which must already have been written.
+func (repo *Repository) WriteBranch(ctx context.Context, name string, id envelopes.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if id.Equal(envelopes.ID{}) {
+		err := os.Remove(repo.branchPath(name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return writeFileAtomically(repo.unbornPath(name), nil, 0644)
+	}
+
+	object, err := repo.readIndex(id)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomically(repo.branchPath(name), []byte(object.String()+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(repo.unbornPath(name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ListBranches finds the name of every branch in the repository, including those that don't point at a Transaction
+// yet.
+func (repo *Repository) ListBranches(ctx context.Context) (<-chan string, error) {
+	names := make(map[string]struct{})
+	for _, root := range []string{repo.branchPath(""), repo.unbornPath("")} {
+		err := filepath.WalkDir(root, func(current string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, current)
+			if err != nil {
+				return err
+			}
+			names[filepath.ToSlash(rel)] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	packed, err := repo.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for ref := range packed {
+		if strings.HasPrefix(ref, branchRefPrefix) {
+			names[strings.TrimPrefix(ref, branchRefPrefix)] = struct{}{}
+		}
+	}
+
+	results := make(chan string, len(names))
+	for name := range names {
+		results <- name
+	}
+	close(results)
+	return results, nil
+}
+
+// readPackedRefs reads the refs that git has moved out of their own files and into the packed-refs file, as "git clone"
+// and "git gc" do. It maps the full name of each ref, like "refs/heads/master", to the object it points at. A ref that
+// also has its own file has been updated since it was packed, so the file should be preferred.
+func (repo *Repository) readPackedRefs() (map[string]objectID, error) {
+	contents, err := os.ReadFile(filepath.Join(repo.dir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	retval := make(map[string]objectID)
+	for _, line := range strings.Split(string(contents), "\n") {
+		// Comments describe the file, and lines starting with a caret give the commit that the tag above them points at.
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line in packed-refs: %q", line)
+		}
+		object, err := parseObjectID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		retval[fields[1]] = object
+	}
+	return retval, nil
+}
+
+// Current fetches the RefSpec that was most recently used to populate the index. If SetCurrent was never called, the
+// branch named by git's HEAD is used.
+func (repo *Repository) Current(ctx context.Context) (persist.RefSpec, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	contents, err := os.ReadFile(repo.currentPath())
+	if err == nil {
+		return persist.RefSpec(strings.TrimSpace(string(contents))), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	head, err := os.ReadFile(filepath.Join(repo.dir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+
+	const symbolicPrefix = "ref: refs/heads/"
+	trimmed := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(trimmed, symbolicPrefix) {
+		return "", fmt.Errorf("unable to interpret HEAD %q", trimmed)
+	}
+	return persist.RefSpec(strings.TrimPrefix(trimmed, symbolicPrefix)), nil
+}
+
+// SetCurrent replaces the current pointer. When it names a branch, or a Transaction that has been written, git's HEAD
+// is updated to match, so that git tooling agrees about what is checked out.
+func (repo *Repository) SetCurrent(ctx context.Context, current persist.RefSpec) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := writeFileAtomically(repo.currentPath(), []byte(current), 0644)
+	if err != nil {
+		return err
+	}
+
+	var head string
+	var id envelopes.ID
+	if len(current) == 2*len(id) && id.UnmarshalText([]byte(current)) == nil {
+		object, err := repo.readIndex(id)
+		if errors.Is(err, persist.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		head = object.String()
+	} else if isBranchName(string(current)) {
+		head = "ref: refs/heads/" + string(current)
+	} else {
+		// Other RefSpecs, like "master~2", have no equivalent in git. HEAD is left alone.
+		return nil
+	}
+
+	return writeFileAtomically(filepath.Join(repo.dir, "HEAD"), []byte(head+"\n"), 0644)
+}
+
+// isBranchName determines whether git would accept a name as a branch. It is deliberately stricter than git.
+func isBranchName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".lock") {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "//") || strings.Contains(name, "@{") {
+		return false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return !strings.ContainsAny(name, " ~^:?*[\\\x7f") && strings.IndexFunc(name, func(r rune) bool { return r < ' ' }) < 0
+}
@@ -0,0 +1,516 @@
+// Package git stores envelopes objects in a git repository, so that budget history can be inspected and backed up using
+// ordinary git tooling. It is written in pure Go, and doesn't need git to be installed.
+//
+// Each Transaction is stored as a commit, so "git log" shows the ledger. A commit's tree represents the Transaction's
+// State: it holds an "accounts" tree with a blob for each Account, and a "budget" tree. Each Budget is stored as a tree
+// holding a ".balance" blob, and a subtree for each of its children. If any Accounts have AccountDetails, they are kept
+// in a "metadata" blob next to those trees. Balances are written as JSON objects, so that
+// "git diff" shows how they changed. The fields of a Transaction that git doesn't have a place for are recorded as
+// trailers at the end of its commit message, with a trailer for each of its LineItems and Attachments. Tags and Metadata
+// are each written as a single trailer holding JSON. Dates are written like "2006-01-02", and a Transaction that only
+// has a PostedDate is committed at the start of that day in UTC. The Blobs that are attached to Transactions are stored
+// as git blobs, and listed in an "attachments" subtree of the commit's tree so that git copies them along with it.
+//
+// Git names objects differently than this module does, so an index from envelopes IDs to git objects is kept in the
+// "envelopes" directory inside of the .git directory. Branches are stored as ordinary git branches. Git doesn't copy the
+// index, so when a repository is restored from a backup using "git clone", the index is rebuilt from the commits
+// reachable from its refs the first time an object can't be found. Only the default branch is checked out by a clone;
+// other branches can be restored with "git branch <name> origin/<name>". Branches that don't point at a Transaction yet
+// and the current pointer are kept alongside the index, so they aren't backed up either.
+//
+// Objects are written as loose objects, but can be read either from loose objects or from the pack files that "git gc",
+// "git clone", and "git fetch" create. Likewise, branches can be read after "git gc" has packed them.
+//
+// For a one-way copy of history that git tooling can browse, see ExportFastImport.
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// DotGit is the name of the directory, inside the root of a repository, that holds everything git knows about it.
+const DotGit = ".git"
+
+const (
+	accountsName = "accounts"
+	budgetName   = "budget"
+	metadataName = "metadata"
+)
+
+const initialConfig = `[core]
+	repositoryformatversion = 0
+	filemode = true
+	bare = false
+`
+
+// Repository reads and writes envelopes objects, branches, and the current pointer in a git repository. It satisfies
+// persist.RepositoryReaderWriter.
+type Repository struct {
+	// dir is the location of the .git directory.
+	dir     string
+	objects objectStore
+
+	indexLock sync.Mutex
+	reindexed bool
+}
+
+// OpenRepository creates a handle for interacting with the git repository rooted at loc. If loc doesn't contain a .git
+// directory yet, one is created.
+func OpenRepository(_ context.Context, loc string) (*Repository, error) {
+	dir := filepath.Join(loc, DotGit)
+	retval := &Repository{
+		dir:     dir,
+		objects: newObjectStore(dir),
+	}
+
+	_, err := os.Stat(filepath.Join(dir, "HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		err = retval.initialize()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
+
+// initialize creates the minimal set of files that git expects to find in a repository.
+func (repo *Repository) initialize() error {
+	for _, subdir := range []string{"objects", filepath.Join("refs", "heads"), filepath.Join("refs", "tags")} {
+		if err := os.MkdirAll(filepath.Join(repo.dir, subdir), 0755); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(repo.dir, "config"), []byte(initialConfig), 0644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(repo.dir, "HEAD"), []byte("ref: refs/heads/"+persist.DefaultBranch+"\n"), 0644)
+}
+
+// readObject finds the git object that represents an envelopes object, and reads it.
+func (repo *Repository) readObject(ctx context.Context, id envelopes.ID, kind string) (objectID, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return objectID{}, nil, err
+	}
+
+	object, err := repo.readIndex(id)
+	if err != nil {
+		return objectID{}, nil, err
+	}
+
+	contents, err := repo.objects.readKind(object, kind)
+	if errors.Is(err, errObjectNotFound) {
+		return objectID{}, nil, persist.ErrObjectNotFound(id)
+	} else if err != nil {
+		return objectID{}, nil, persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return object, contents, nil
+}
+
+// WriteTransaction stores a Transaction as a commit, and its State as the commit's tree. Parents that have already been
+// written become parents of the commit. Parents that haven't been written are still recorded, but git won't know about
+// them.
+func (repo *Repository) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	tree, err := repo.writeState(*subject.State)
+	if err != nil {
+		return err
+	}
+
+	attached, err := repo.attachBlobs(tree, subject.Attachments)
+	if err != nil {
+		return err
+	}
+	if attached != tree {
+		// The State can be loaded from the commit's tree too, and unlike the tree written for it alone, that one won't
+		// be thrown away by "git gc".
+		tree = attached
+		if err = repo.writeIndex(subject.State.ID(), tree); err != nil {
+			return err
+		}
+	}
+
+	parents := make([]objectID, 0, len(subject.Parents))
+	for _, parent := range subject.Parents {
+		var object objectID
+		object, err = repo.readIndex(parent)
+		if errors.Is(err, persist.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		parents = append(parents, object)
+	}
+
+	encoded, err := encodeCommit(subject, tree, parents)
+	if err != nil {
+		return err
+	}
+
+	written, err := repo.objects.write(commitType, encoded)
+	if err != nil {
+		return err
+	}
+	return repo.writeIndex(subject.ID(), written)
+}
+
+// WriteState stores a State as a tree, holding its Accounts and Budget.
+func (repo *Repository) WriteState(ctx context.Context, subject envelopes.State) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := repo.writeState(subject)
+	return err
+}
+
+// WriteBudget stores a Budget as a tree, holding its balance and each of its children.
+func (repo *Repository) WriteBudget(ctx context.Context, subject envelopes.Budget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := repo.writeBudget(subject)
+	return err
+}
+
+// WriteAccounts stores Accounts as a tree, holding a blob with the balance of each account.
+func (repo *Repository) WriteAccounts(ctx context.Context, subject envelopes.Accounts) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := repo.writeAccounts(subject)
+	return err
+}
+
+func (repo *Repository) writeState(subject envelopes.State) (objectID, error) {
+	if subject.Budget == nil {
+		subject.Budget = &envelopes.Budget{}
+	}
+	if subject.Accounts == nil {
+		subject.Accounts = make(envelopes.Accounts, 0)
+	}
+
+	budget, err := repo.writeBudget(*subject.Budget)
+	if err != nil {
+		return objectID{}, err
+	}
+
+	accounts, err := repo.writeAccounts(subject.Accounts)
+	if err != nil {
+		return objectID{}, err
+	}
+
+	entries := []treeEntry{
+		{name: accountsName, mode: treeMode, id: accounts},
+		{name: budgetName, mode: treeMode, id: budget},
+	}
+
+	// Leaving out empty AccountMetadata keeps the trees of States from before it existed the same.
+	if !subject.Metadata.Empty() {
+		encoded, err := encodeMetadata(subject.Metadata)
+		if err != nil {
+			return objectID{}, err
+		}
+
+		metadata, err := repo.objects.write(blobType, encoded)
+		if err != nil {
+			return objectID{}, err
+		}
+		entries = append(entries, treeEntry{name: metadataName, mode: blobMode, id: metadata})
+	}
+
+	written, err := repo.objects.write(treeType, encodeTree(entries))
+	if err != nil {
+		return objectID{}, err
+	}
+	return written, repo.writeIndex(subject.ID(), written)
+}
+
+func (repo *Repository) writeBudget(subject envelopes.Budget) (objectID, error) {
+	balance, err := encodeBalance(subject.Balance)
+	if err != nil {
+		return objectID{}, err
+	}
+
+	balanceBlob, err := repo.objects.write(blobType, balance)
+	if err != nil {
+		return objectID{}, err
+	}
+
+	entries := make([]treeEntry, 0, 1+len(subject.Children))
+	entries = append(entries, treeEntry{name: balanceName, mode: blobMode, id: balanceBlob})
+	for name, child := range subject.Children {
+		var written objectID
+		written, err = repo.writeBudget(*child)
+		if err != nil {
+			return objectID{}, err
+		}
+		entries = append(entries, treeEntry{name: escapeName(name), mode: treeMode, id: written})
+	}
+
+	written, err := repo.objects.write(treeType, encodeTree(entries))
+	if err != nil {
+		return objectID{}, err
+	}
+	return written, repo.writeIndex(subject.ID(), written)
+}
+
+func (repo *Repository) writeAccounts(subject envelopes.Accounts) (objectID, error) {
+	entries := make([]treeEntry, 0, len(subject))
+	for name, balance := range subject {
+		encoded, err := encodeBalance(balance)
+		if err != nil {
+			return objectID{}, err
+		}
+
+		written, err := repo.objects.write(blobType, encoded)
+		if err != nil {
+			return objectID{}, err
+		}
+		entries = append(entries, treeEntry{name: escapeName(name), mode: blobMode, id: written})
+	}
+
+	written, err := repo.objects.write(treeType, encodeTree(entries))
+	if err != nil {
+		return objectID{}, err
+	}
+	return written, repo.writeIndex(subject.ID(), written)
+}
+
+// Stash stores a raw payload, like a Blob written by persist.StashBlob, as a git blob. Because envelopes.Blob IDs are
+// computed the same way as git's, a Blob's ID is also the name of the git blob holding it.
+func (repo *Repository) Stash(ctx context.Context, id envelopes.ID, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	written, err := repo.objects.write(blobType, payload)
+	if err != nil {
+		return err
+	}
+	return repo.writeIndex(id, written)
+}
+
+// Fetch reads a raw payload that was previously stored by Stash.
+func (repo *Repository) Fetch(ctx context.Context, id envelopes.ID) ([]byte, error) {
+	_, contents, err := repo.readObject(ctx, id, blobType)
+	return contents, err
+}
+
+// LoadTransaction reads the commit that represents a Transaction, and the State held in its tree.
+func (repo *Repository) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	_, contents, err := repo.readObject(ctx, id, commitType)
+	if err != nil {
+		return err
+	}
+
+	loaded, _, err := repo.decodeTransaction(contents)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	*toLoad = loaded
+	return nil
+}
+
+// decodeTransaction reads a Transaction out of a commit, and returns it along with the ID recorded in its message.
+func (repo *Repository) decodeTransaction(contents []byte) (envelopes.Transaction, envelopes.ID, error) {
+	var retval envelopes.Transaction
+
+	decoded, err := decodeCommit(contents)
+	if err != nil {
+		return retval, envelopes.ID{}, err
+	}
+
+	id, err := decodeMessage(decoded.message, &retval)
+	if err != nil {
+		return retval, envelopes.ID{}, err
+	}
+
+	var state envelopes.State
+	err = repo.loadState(decoded.tree, &state)
+	if err != nil {
+		return retval, envelopes.ID{}, err
+	}
+	retval.State = &state
+	return retval, id, nil
+}
+
+// LoadState reads the tree that represents a State.
+func (repo *Repository) LoadState(ctx context.Context, id envelopes.ID, toLoad *envelopes.State) error {
+	object, _, err := repo.readObject(ctx, id, treeType)
+	if err != nil {
+		return err
+	}
+
+	err = repo.loadState(object, toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
+}
+
+// LoadBudget reads the tree that represents a Budget, and each of its children.
+func (repo *Repository) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *envelopes.Budget) error {
+	object, _, err := repo.readObject(ctx, id, treeType)
+	if err != nil {
+		return err
+	}
+
+	err = repo.loadBudget(object, toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
+}
+
+// LoadAccounts reads the tree that represents Accounts.
+func (repo *Repository) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *envelopes.Accounts) error {
+	object, _, err := repo.readObject(ctx, id, treeType)
+	if err != nil {
+		return err
+	}
+
+	err = repo.loadAccounts(object, toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
+}
+
+func (repo *Repository) readTree(object objectID) ([]treeEntry, error) {
+	contents, err := repo.objects.readKind(object, treeType)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTree(contents)
+}
+
+func (repo *Repository) loadState(object objectID, toLoad *envelopes.State) error {
+	entries, err := repo.readTree(object)
+	if err != nil {
+		return err
+	}
+
+	var budget envelopes.Budget
+	var accounts envelopes.Accounts
+	var metadata envelopes.AccountMetadata
+	foundBudget, foundAccounts := false, false
+	for _, entry := range entries {
+		switch entry.name {
+		case budgetName:
+			err = repo.loadBudget(entry.id, &budget)
+			foundBudget = true
+		case accountsName:
+			err = repo.loadAccounts(entry.id, &accounts)
+			foundAccounts = true
+		case metadataName:
+			var contents []byte
+			contents, err = repo.objects.readKind(entry.id, blobType)
+			if err == nil {
+				metadata, err = decodeMetadata(contents)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !foundBudget || !foundAccounts {
+		return fmt.Errorf("tree %s does not hold both %q and %q", object, budgetName, accountsName)
+	}
+
+	toLoad.Budget = &budget
+	toLoad.Accounts = accounts
+	toLoad.Metadata = metadata
+	return nil
+}
+
+func (repo *Repository) loadBudget(object objectID, toLoad *envelopes.Budget) error {
+	entries, err := repo.readTree(object)
+	if err != nil {
+		return err
+	}
+
+	var loaded envelopes.Budget
+	loaded.Children = make(map[string]*envelopes.Budget, len(entries))
+	for _, entry := range entries {
+		if entry.name == balanceName {
+			var contents []byte
+			contents, err = repo.objects.readKind(entry.id, blobType)
+			if err != nil {
+				return err
+			}
+			loaded.Balance, err = decodeBalance(contents)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var name string
+		name, err = unescapeName(entry.name)
+		if err != nil {
+			return err
+		}
+
+		var child envelopes.Budget
+		err = repo.loadBudget(entry.id, &child)
+		if err != nil {
+			return err
+		}
+		loaded.Children[name] = &child
+	}
+
+	if loaded.Balance == nil {
+		return fmt.Errorf("tree %s does not hold %q", object, balanceName)
+	}
+
+	*toLoad = loaded
+	return nil
+}
+
+func (repo *Repository) loadAccounts(object objectID, toLoad *envelopes.Accounts) error {
+	entries, err := repo.readTree(object)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(envelopes.Accounts, len(entries))
+	for _, entry := range entries {
+		var name string
+		name, err = unescapeName(entry.name)
+		if err != nil {
+			return err
+		}
+
+		var contents []byte
+		contents, err = repo.objects.readKind(entry.id, blobType)
+		if err != nil {
+			return err
+		}
+
+		loaded[name], err = decodeBalance(contents)
+		if err != nil {
+			return err
+		}
+	}
+
+	*toLoad = loaded
+	return nil
+}
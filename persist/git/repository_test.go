@@ -0,0 +1,374 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/git"
+	"github.com/marstr/envelopes/persist/persisttest"
+)
+
+func TestRepository_conformance(t *testing.T) {
+	persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+		repo, err := git.OpenRepository(context.Background(), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestRepository_awkwardNames(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := envelopes.State{
+		Budget: &envelopes.Budget{
+			Balance: envelopes.Balance{"USD": big.NewRat(1, 3)},
+			Children: map[string]*envelopes.Budget{
+				"":          {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+				".":         {Balance: envelopes.Balance{"USD": big.NewRat(2, 1)}},
+				"..":        {Balance: envelopes.Balance{"USD": big.NewRat(3, 1)}},
+				".balance":  {Balance: envelopes.Balance{"USD": big.NewRat(4, 1)}},
+				".git":      {Balance: envelopes.Balance{"USD": big.NewRat(5, 1)}},
+				"a/b":       {Balance: envelopes.Balance{"USD": big.NewRat(6, 1)}},
+				"100%":      {Balance: envelopes.Balance{"USD": big.NewRat(7, 1)}},
+				"%2F":       {Balance: envelopes.Balance{"USD": big.NewRat(8, 1)}},
+				"nul\x00":   {Balance: envelopes.Balance{"USD": big.NewRat(9, 1)}},
+				"groceries": {Balance: envelopes.Balance{"\"quoted\" asset": big.NewRat(-10, 7)}},
+			},
+		},
+		Accounts: envelopes.Accounts{
+			"":          {"USD": big.NewRat(1, 1)},
+			"savings/2": {"USD": big.NewRat(123456789, 1000)},
+		},
+	}
+
+	repo, err := git.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.WriteState(ctx, subject); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded envelopes.State
+	if err = repo.LoadState(ctx, subject.ID(), &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range subject.Budget.Children {
+		got, ok := loaded.Budget.Children[name]
+		if !ok {
+			t.Errorf("child %q was not loaded", name)
+			continue
+		}
+		for asset, magnitude := range want.Balance {
+			if got.Balance[asset] == nil || got.Balance[asset].Cmp(magnitude) != 0 {
+				t.Errorf("child %q: got %v want %v", name, got.Balance, want.Balance)
+			}
+		}
+	}
+	if len(loaded.Budget.Children) != len(subject.Budget.Children) {
+		t.Errorf("got %d children want %d", len(loaded.Budget.Children), len(subject.Budget.Children))
+	}
+	if got := loaded.Budget.Balance["USD"]; got == nil || got.Cmp(big.NewRat(1, 3)) != 0 {
+		t.Errorf("got balance %v want USD 1/3", loaded.Budget.Balance)
+	}
+
+	for name, want := range subject.Accounts {
+		if got, ok := loaded.Accounts[name]; !ok || !got.Equal(want) {
+			t.Errorf("account %q: got %v want %v", name, got, want)
+		}
+	}
+}
+
+// TestRepository_gitCompatible uses the git command line tool, when it is installed, to make sure that repositories
+// written by this package are readable by git.
+func TestRepository_gitCompatible(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc := t.TempDir()
+	repo, err := git.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.WriteBranch(ctx, persist.DefaultBranch, envelopes.ID{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.SetCurrent(ctx, persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	posted := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.FixedZone("PDT", -7*60*60))
+	transactions := []envelopes.Transaction{
+		{
+			Merchant:   "Employer",
+			Comment:    "Payday",
+			PostedTime: posted,
+			Amount:     envelopes.Balance{"USD": big.NewRat(200000, 100)},
+			Committer:  envelopes.User{FullName: "Jane Doe", Email: "jane@example.com"},
+			State: &envelopes.State{
+				Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(200000, 100)}},
+				Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(200000, 100)}},
+			},
+		},
+		{
+			Merchant:   "Grocery Store",
+			Comment:    "Weekly shopping\n\nIncluding: things that look like trailers",
+			PostedTime: posted.Add(24 * time.Hour),
+			Amount:     envelopes.Balance{"USD": big.NewRat(-8523, 100)},
+			State: &envelopes.State{
+				Budget: &envelopes.Budget{
+					Balance: envelopes.Balance{"USD": big.NewRat(191477, 100)},
+					Children: map[string]*envelopes.Budget{
+						"food": {Balance: envelopes.Balance{"USD": big.NewRat(-8523, 100)}},
+					},
+				},
+				Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(191477, 100)}},
+			},
+		},
+	}
+
+	for _, transaction := range transactions {
+		if err = persist.Commit(ctx, repo, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runGit := func(args ...string) string {
+		return runGit(ctx, t, loc, args...)
+	}
+
+	runGit("fsck", "--strict", "--no-dangling")
+
+	log := runGit("log", "--format=%s", persist.DefaultBranch)
+	wantLog := "Grocery Store: USD -85.23\nEmployer: USD 2000.00\n"
+	if log != wantLog {
+		t.Errorf("git log\ngot:\n%s\nwant:\n%s", log, wantLog)
+	}
+
+	author := runGit("log", "-1", "--format=%an <%ae>", persist.DefaultBranch+"~1")
+	if want := "Jane Doe <jane@example.com>\n"; author != want {
+		t.Errorf("got author %q want %q", author, want)
+	}
+
+	balance := runGit("show", persist.DefaultBranch+":budget/food/.balance")
+	if want := "{\"USD\":\"-85.230\"}\n"; balance != want {
+		t.Errorf("got balance %q want %q", balance, want)
+	}
+
+	head, err := repo.ReadBranch(ctx, persist.DefaultBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, head, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Comment != transactions[1].Comment {
+		t.Errorf("got comment %q want %q", loaded.Comment, transactions[1].Comment)
+	}
+	if len(loaded.Parents) != 1 || loaded.Parents[0] != transactions[0].ID() {
+		t.Errorf("got parents %v want [%s]", loaded.Parents, transactions[0].ID())
+	}
+}
+
+// runGit invokes the git command line tool in dir, and returns its output.
+func runGit(ctx context.Context, t *testing.T, dir string, args ...string) string {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return string(output)
+}
+
+// writeBackupHistory writes a few Transactions to a new repository, on two branches, with a Blob attached to the last
+// one. It returns the location of the repository and the Transactions, from oldest to newest.
+func writeBackupHistory(ctx context.Context, t *testing.T) (string, []envelopes.Transaction, envelopes.Blob) {
+	loc := t.TempDir()
+	repo, err := git.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := envelopes.Blob("a receipt for the groceries")
+	if _, err = persist.StashBlob(ctx, repo, receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	var history []envelopes.Transaction
+	var parents []envelopes.ID
+	for i, merchant := range []string{"Employer", "Landlord", "Grocer", "Grocer", "Grocer"} {
+		current := envelopes.Transaction{
+			Merchant: merchant,
+			Parents:  parents,
+			State: &envelopes.State{
+				Budget: &envelopes.Budget{
+					Balance: envelopes.Balance{"USD": big.NewRat(int64(1000-100*i), 1)},
+					Children: map[string]*envelopes.Budget{
+						"food": {Balance: envelopes.Balance{"USD": big.NewRat(int64(10*i), 1)}},
+						"rent": {Balance: envelopes.Balance{"USD": big.NewRat(500, 1)}},
+					},
+				},
+				Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(int64(1500-90*i), 1)}},
+			},
+		}
+		if i == 4 {
+			current.Attachments = []envelopes.Attachment{{Blob: receipt.ID(), Filename: "receipt.txt", MediaType: "text/plain"}}
+		}
+		if err = repo.WriteTransaction(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, current)
+		parents = []envelopes.ID{current.ID()}
+
+		if i == 1 {
+			if err = repo.WriteBranch(ctx, "savings", current.ID()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err = repo.WriteBranch(ctx, persist.DefaultBranch, parents[0]); err != nil {
+		t.Fatal(err)
+	}
+	return loc, history, receipt
+}
+
+// checkBackupHistory makes sure that everything written by writeBackupHistory can be read from repo.
+func checkBackupHistory(ctx context.Context, t *testing.T, repo *git.Repository, history []envelopes.Transaction, receipt envelopes.Blob) {
+	for name, want := range map[string]envelopes.ID{persist.DefaultBranch: history[4].ID(), "savings": history[1].ID()} {
+		head, err := repo.ReadBranch(ctx, name)
+		if err != nil {
+			t.Errorf("unable to read branch %q: %v", name, err)
+			continue
+		}
+		if !head.Equal(want) {
+			t.Errorf("branch %q: got %s want %s", name, head, want)
+		}
+	}
+
+	for _, want := range history {
+		var got envelopes.Transaction
+		if err := repo.LoadTransaction(ctx, want.ID(), &got); err != nil {
+			t.Errorf("unable to load %s: %v", want.ID(), err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("loaded Transaction %s did not match the one that was written", want.ID())
+		}
+
+		var state envelopes.State
+		if err := repo.LoadState(ctx, want.State.ID(), &state); err != nil {
+			t.Errorf("unable to load the State of %s: %v", want.ID(), err)
+		}
+	}
+
+	fetched, err := repo.Fetch(ctx, receipt.ID())
+	if err != nil {
+		t.Errorf("unable to fetch the attachment: %v", err)
+	} else if string(fetched) != string(receipt) {
+		t.Errorf("got attachment %q want %q", fetched, receipt)
+	}
+}
+
+// TestRepository_restoreFromClone makes sure that a repository backed up by pushing it somewhere with git, then
+// restored by cloning it, can be read. Neither the index nor loose objects survive the trip.
+func TestRepository_restoreFromClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc, history, receipt := writeBackupHistory(ctx, t)
+
+	backup := t.TempDir()
+	runGit(ctx, t, backup, "init", "--bare", "--quiet")
+	runGit(ctx, t, loc, "push", "--quiet", "--all", backup)
+
+	restored := t.TempDir()
+	// A file URL makes git transfer a pack, the same way it would from another machine.
+	runGit(ctx, t, restored, "clone", "--quiet", "file://"+filepath.ToSlash(backup), ".")
+
+	if _, err := os.Stat(filepath.Join(restored, git.DotGit, "envelopes")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("the clone was not expected to have an index, got: %v", err)
+	}
+
+	repo, err := git.OpenRepository(ctx, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the branch that was checked out is local to a clone, so the other is made local the way a person would.
+	runGit(ctx, t, restored, "branch", "--quiet", "savings", "origin/savings")
+
+	checkBackupHistory(ctx, t, repo, history, receipt)
+}
+
+// TestRepository_packed makes sure that a repository can still be read after "git gc" has moved its objects and refs
+// into pack files, including objects that git stored as deltas against one another.
+func TestRepository_packed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	loc, history, receipt := writeBackupHistory(ctx, t)
+	runGit(ctx, t, loc, "gc", "--quiet", "--aggressive", "--prune=now")
+
+	if loose := runGit(ctx, t, loc, "count-objects"); !strings.HasPrefix(loose, "0 objects") {
+		t.Fatalf("expected every object to be packed, got: %s", loose)
+	}
+
+	repo, err := git.OpenRepository(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBackupHistory(ctx, t, repo, history, receipt)
+
+	branches, err := repo.ListBranches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]struct{})
+	for branch := range branches {
+		listed[branch] = struct{}{}
+	}
+	for _, want := range []string{persist.DefaultBranch, "savings"} {
+		if _, ok := listed[want]; !ok {
+			t.Errorf("packed branch %q was not listed", want)
+		}
+	}
+
+	// Writing on top of packed history should work just as well.
+	next := envelopes.Transaction{Merchant: "Employer", Parents: []envelopes.ID{history[4].ID()}}
+	if err = persist.Commit(ctx, repo, next); err != nil {
+		t.Fatal(err)
+	}
+	runGit(ctx, t, loc, "fsck", "--strict", "--no-dangling")
+}
@@ -0,0 +1,373 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/filesystem"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+// ErrUnexpectedStatus indicates that a Server responded to a request in a way that the Client did not anticipate.
+type ErrUnexpectedStatus struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (err ErrUnexpectedStatus) Error() string {
+	return fmt.Sprintf("unexpected response from server %q: %s", err.Status, strings.TrimSpace(err.Body))
+}
+
+// Client reads and writes the raw objects and branches exposed by a Server.
+type Client struct {
+	// BaseURL is the location that Server is being hosted at. Paths will be appended to it.
+	BaseURL string
+
+	// HTTPClient is used to send requests. If it is nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Authenticate is invoked on each request before it is sent, giving the caller a chance to attach credentials.
+	Authenticate func(req *http.Request) error
+}
+
+// Fetch retrieves the marshaled form of an object from the server. If the server does not have the object,
+// persist.ErrObjectNotFound is returned.
+func (c Client) Fetch(ctx context.Context, id envelopes.ID) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, objectsPrefix+"/"+id.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, persist.ErrObjectNotFound(id)
+	default:
+		return nil, newErrUnexpectedStatus(resp)
+	}
+}
+
+// FetchMany retrieves the marshaled form of several objects in a single round-trip. Objects which the server does not
+// have are omitted from the results.
+func (c Client) FetchMany(ctx context.Context, ids ...envelopes.ID) (map[envelopes.ID][]byte, error) {
+	body, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, objectsPrefix, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newErrUnexpectedStatus(resp)
+	}
+
+	results := make(map[envelopes.ID][]byte, len(ids))
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Stash uploads the marshaled form of an object to the server.
+func (c Client) Stash(ctx context.Context, id envelopes.ID, payload []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, objectsPrefix+"/"+id.String(), payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newErrUnexpectedStatus(resp)
+	}
+	return nil
+}
+
+// ReadBranch fetches the ID of the Transaction that a branch on the server points at.
+func (c Client) ReadBranch(ctx context.Context, name string) (envelopes.ID, error) {
+	resp, err := c.do(ctx, http.MethodGet, branchesPrefix+"/"+escapeBranchName(name), nil)
+	if err != nil {
+		return envelopes.ID{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Intentionally Left Blank
+	case http.StatusNotFound:
+		return envelopes.ID{}, persist.ErrBranchNotFound(name)
+	default:
+		return envelopes.ID{}, newErrUnexpectedStatus(resp)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return envelopes.ID{}, err
+	}
+
+	var retval envelopes.ID
+	if len(raw) < 2*len(retval) {
+		return envelopes.ID{}, fmt.Errorf("%q is not long enough to be a Transaction ID", string(raw))
+	}
+	err = retval.UnmarshalText(raw)
+	return retval, err
+}
+
+// WriteBranch points a branch on the server at a particular Transaction.
+func (c Client) WriteBranch(ctx context.Context, name string, id envelopes.ID) error {
+	resp, err := c.do(ctx, http.MethodPut, branchesPrefix+"/"+escapeBranchName(name), []byte(id.String()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return newErrUnexpectedStatus(resp)
+	}
+	return nil
+}
+
+// ReadConfig fetches the description of how the server stores objects. If the server doesn't say, an error matching
+// persist.ErrNotFound is returned.
+func (c Client) ReadConfig(ctx context.Context) (*filesystem.RepositoryConfig, error) {
+	resp, err := c.do(ctx, http.MethodGet, configPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Intentionally Left Blank
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: the server did not describe how it stores objects", persist.ErrNotFound)
+	default:
+		return nil, newErrUnexpectedStatus(resp)
+	}
+
+	var retval filesystem.RepositoryConfig
+	err = json.NewDecoder(resp.Body).Decode(&retval)
+	if err != nil {
+		return nil, err
+	}
+	return &retval, nil
+}
+
+// ReadClearing fetches the envelopes.Clearing kept by the server. If the server doesn't keep one, an error matching
+// persist.ErrUnsupported is returned.
+func (c Client) ReadClearing(ctx context.Context) (envelopes.Clearing, error) {
+	resp, err := c.do(ctx, http.MethodGet, clearingPath, nil)
+	if err != nil {
+		return envelopes.Clearing{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Intentionally Left Blank
+	case http.StatusNotFound:
+		return envelopes.Clearing{}, errClearingUnsupported
+	default:
+		return envelopes.Clearing{}, newErrUnexpectedStatus(resp)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return envelopes.Clearing{}, err
+	}
+
+	var retval envelopes.Clearing
+	err = persistJson.UnmarshalClearing(raw, &retval)
+	if err != nil {
+		return envelopes.Clearing{}, err
+	}
+	return retval, nil
+}
+
+// WriteClearing replaces the envelopes.Clearing kept by the server. If the server doesn't keep one, an error matching
+// persist.ErrUnsupported is returned.
+func (c Client) WriteClearing(ctx context.Context, subject envelopes.Clearing) error {
+	marshaled, err := persistJson.MarshalClearing(subject)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, clearingPath, marshaled)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errClearingUnsupported
+	default:
+		return newErrUnexpectedStatus(resp)
+	}
+}
+
+var errClearingUnsupported = fmt.Errorf("%w: the server does not keep a clearing", persist.ErrUnsupported)
+
+// ListBranches fetches the names of all branches on the server.
+func (c Client) ListBranches(ctx context.Context) (<-chan string, error) {
+	resp, err := c.do(ctx, http.MethodGet, branchesPrefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newErrUnexpectedStatus(resp)
+	}
+
+	var names []string
+	err = json.NewDecoder(resp.Body).Decode(&names)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := make(chan string)
+	go func() {
+		defer close(retval)
+		for _, name := range names {
+			select {
+			case <-ctx.Done():
+				return
+			case retval <- name:
+				// Intentionally Left Blank
+			}
+		}
+	}()
+
+	return retval, nil
+}
+
+func (c Client) do(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Authenticate != nil {
+		err = c.Authenticate(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+func newErrUnexpectedStatus(resp *http.Response) ErrUnexpectedStatus {
+	const maxBody = 512
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	return ErrUnexpectedStatus{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+}
+
+func escapeBranchName(name string) string {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+// Repository combines a Client with the JSON Loader and Writer, so that a repository hosted by a Server can be used
+// anywhere a persist.BareRepositoryReaderWriter is expected, for instance with persist.BareClone or persist.Fetch.
+type Repository struct {
+	*Client
+	persist.Loader
+	persist.Writer
+}
+
+// NewRepository creates a Repository that reads and writes objects on a Server in the same format that the Server
+// stores them in. If the Server doesn't say which format that is, objects are read in whichever version of the JSON
+// object format they appear to be in, and written using the most recent one.
+//
+// When objects are stored as JSON, loading one also fetches everything that will be loaded along with it using
+// FetchMany, one level of nesting at a time, instead of making a round-trip for each object.
+func NewRepository(ctx context.Context, client *Client) (*Repository, error) {
+	var loader persist.Loader
+	var writer persist.Writer
+
+	config, err := client.ReadConfig(ctx)
+	if errors.Is(err, persist.ErrNotFound) {
+		loader, err = persistJson.NewDetectingLoader(newPrefetcher(client))
+		if err != nil {
+			return nil, err
+		}
+
+		writer, err = persistJson.NewWriterV9(client)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		var fetcher persist.Fetcher = client
+		if config.Objects.Format == filesystem.FormatJson {
+			fetcher = newPrefetcher(client)
+		}
+
+		loader, err = filesystem.NewObjectLoader(config, fetcher)
+		if err != nil {
+			return nil, err
+		}
+
+		writer, err = filesystem.NewObjectWriter(config, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Repository{
+		Client: client,
+		Loader: loader,
+		Writer: writer,
+	}, nil
+}
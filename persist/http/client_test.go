@@ -0,0 +1,536 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/filesystem"
+	persistHttp "github.com/marstr/envelopes/persist/http"
+)
+
+func newTestServer(t *testing.T, server persistHttp.Server) *httptest.Server {
+	server.Backend = filesystem.FileSystem{
+		Root:         t.TempDir(),
+		ObjectLayout: 1,
+	}
+	hosted := httptest.NewServer(server)
+	t.Cleanup(hosted.Close)
+	return hosted
+}
+
+func TestRepository_roundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hosted := newTestServer(t, persistHttp.Server{})
+
+	subject, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := envelopes.Transaction{
+		Merchant: "Corner Store",
+		Amount:   envelopes.Balance{"USD": big.NewRat(-1299, 100)},
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Children: map[string]*envelopes.Budget{
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(8701, 100)}},
+				},
+			},
+			Accounts: envelopes.Accounts{
+				"checking": envelopes.Balance{"USD": big.NewRat(8701, 100)},
+			},
+		},
+	}
+	wantID := want.ID()
+
+	if err = subject.WriteTransaction(ctx, want); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = subject.WriteBranch(ctx, "remotes/origin/"+persist.DefaultBranch, wantID); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var got envelopes.Transaction
+	if err = subject.LoadTransaction(ctx, wantID, &got); err != nil {
+		t.Error(err)
+		return
+	}
+	if !got.Equal(want) {
+		t.Errorf("loaded Transaction did not match the one that was written")
+	}
+
+	branchID, err := subject.ReadBranch(ctx, "remotes/origin/"+persist.DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !branchID.Equal(wantID) {
+		t.Errorf("unexpected branch value\ngot:  %s\nwant: %s", branchID, wantID)
+	}
+
+	batch, err := subject.FetchMany(ctx, wantID, want.State.ID(), envelopes.ID{1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(batch) != 2 {
+		t.Errorf("expected exactly the two present objects to be returned, got %d", len(batch))
+	}
+
+	_, err = subject.Fetch(ctx, envelopes.ID{1})
+	if _, ok := err.(persist.ErrObjectNotFound); !ok {
+		t.Errorf("expected a persist.ErrObjectNotFound, got: %v", err)
+	}
+
+	_, err = subject.ReadBranch(ctx, "no-such-branch")
+	if _, ok := err.(persist.ErrBranchNotFound); !ok {
+		t.Errorf("expected a ErrBranchNotFound, got: %v", err)
+	}
+}
+
+func TestRepository_bareClone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hosted := newTestServer(t, persistHttp.Server{})
+	remote, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	a := envelopes.Transaction{Comment: "a"}
+	b := envelopes.Transaction{Comment: "b", Parents: []envelopes.ID{a.ID()}}
+	for _, transaction := range []envelopes.Transaction{a, b} {
+		if err = remote.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err = remote.WriteBranch(ctx, persist.DefaultBranch, b.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	local, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = persist.BareClone(ctx, remote, local); err != nil {
+		t.Error(err)
+		return
+	}
+
+	head, err := local.ReadBranch(ctx, persist.DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var loaded envelopes.Transaction
+	if err = local.LoadTransaction(ctx, head, &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if loaded.Comment != b.Comment {
+		t.Errorf("got %q want %q", loaded.Comment, b.Comment)
+	}
+}
+
+func TestRepository_clearing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	local, err := filesystem.OpenRepository(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := envelopes.Transaction{Comment: "a"}
+	if err = local.WriteTransaction(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err = local.WriteBranch(ctx, persist.DefaultBranch, a.ID()); err != nil {
+		t.Fatal(err)
+	}
+	var want envelopes.Clearing
+	want.SetStatus(a.ID(), envelopes.Cleared)
+	if err = local.WriteClearing(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	hosted := newTestServer(t, persistHttp.Server{})
+	remote, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = persist.Push(ctx, persist.DefaultBranch, local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := remote.ReadClearing(ctx); err != nil || !got.Equal(want) {
+		t.Errorf("the Clearing wasn't pushed\ngot:  %v (err: %v)\nwant: %v", got, err, want)
+	}
+
+	// A server whose Backend doesn't keep a Clearing can still be pushed to.
+	hidden := httptest.NewServer(persistHttp.Server{Backend: struct{ persistHttp.Backend }{filesystem.FileSystem{
+		Root:         t.TempDir(),
+		ObjectLayout: 1,
+	}}})
+	t.Cleanup(hidden.Close)
+	withoutClearing, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hidden.URL,
+		HTTPClient: hidden.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = persist.Push(ctx, persist.DefaultBranch, local, withoutClearing); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = withoutClearing.ReadClearing(ctx); !errors.Is(err, persist.ErrUnsupported) {
+		t.Errorf("got: %v want: an error matching persist.ErrUnsupported", err)
+	}
+}
+
+func TestRepository_binaryBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	local, err := filesystem.OpenRepository(ctx, t.TempDir(), filesystem.RepositoryObjectFormat(filesystem.FormatBinary, 1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	config, err := filesystem.LoadConfig(ctx, local.Root)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hosted := httptest.NewServer(persistHttp.Server{
+		Backend: local.FileSystem,
+		Config:  config,
+	})
+	t.Cleanup(hosted.Close)
+
+	remote, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := envelopes.Transaction{
+		Comment: "written over HTTP",
+		State: &envelopes.State{
+			Accounts: envelopes.Accounts{
+				"checking": envelopes.Balance{"USD": big.NewRat(8701, 100)},
+			},
+		},
+	}
+	if err = remote.WriteTransaction(ctx, want); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Objects written by the Client should be readable by the repository being served, and vice versa.
+	var got envelopes.Transaction
+	if err = local.LoadTransaction(ctx, want.ID(), &got); err != nil {
+		t.Error(err)
+		return
+	}
+	if !got.Equal(want) {
+		t.Errorf("Transaction written over HTTP did not match the one read from disk")
+	}
+
+	got = envelopes.Transaction{}
+	if err = remote.LoadTransaction(ctx, want.ID(), &got); err != nil {
+		t.Error(err)
+		return
+	}
+	if !got.Equal(want) {
+		t.Errorf("Transaction read over HTTP did not match the one that was written")
+	}
+}
+
+func TestServer_rejectsMismatchedObjects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hosted := newTestServer(t, persistHttp.Server{})
+	subject, err := persistHttp.NewRepository(ctx, &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	original := envelopes.Transaction{Comment: "original"}
+	if err = subject.WriteTransaction(ctx, original); err != nil {
+		t.Error(err)
+		return
+	}
+	forged := envelopes.Transaction{Comment: "forged"}
+	if err = subject.WriteTransaction(ctx, forged); err != nil {
+		t.Error(err)
+		return
+	}
+
+	forgedPayload, err := subject.Fetch(ctx, forged.ID())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	testCases := map[string][]byte{
+		"different object": forgedPayload,
+		"garbage":          []byte("not an object"),
+	}
+
+	for name, payload := range testCases {
+		err = subject.Stash(ctx, original.ID(), payload)
+		if cast, ok := err.(persistHttp.ErrUnexpectedStatus); !ok || cast.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected stash to be rejected, got: %v", name, err)
+		}
+	}
+
+	var loaded envelopes.Transaction
+	if err = subject.LoadTransaction(ctx, original.ID(), &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if !loaded.Equal(original) {
+		t.Errorf("a rejected stash replaced the original object")
+	}
+
+	blob := envelopes.Blob("receipt")
+	if err = subject.Stash(ctx, blob.ID(), blob); err != nil {
+		t.Errorf("blobs stashed under their own ID should be accepted, got: %v", err)
+	}
+}
+
+// newCountingClient hosts an empty repository, and counts how many requests are made to fetch one object, and how many
+// are made to fetch a batch of them.
+func newCountingClient(t *testing.T) (client *persistHttp.Client, singleFetches, batchFetches *int32) {
+	singleFetches, batchFetches = new(int32), new(int32)
+	server := persistHttp.Server{
+		Backend: filesystem.FileSystem{
+			Root:         t.TempDir(),
+			ObjectLayout: 1,
+		},
+	}
+	hosted := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/objects/") {
+			atomic.AddInt32(singleFetches, 1)
+		} else if req.Method == http.MethodPost && req.URL.Path == "/objects" {
+			atomic.AddInt32(batchFetches, 1)
+		}
+		server.ServeHTTP(resp, req)
+	}))
+	t.Cleanup(hosted.Close)
+
+	client = &persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	}
+	return
+}
+
+func TestRepository_prefetch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, singleFetches, batchFetches := newCountingClient(t)
+
+	writer, err := persistHttp.NewRepository(ctx, client)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := envelopes.Transaction{
+		Comment: "many budgets",
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Children: map[string]*envelopes.Budget{
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+					"rent":      {Balance: envelopes.Balance{"USD": big.NewRat(2, 1)}},
+					"savings": {
+						Children: map[string]*envelopes.Budget{
+							"car": {Balance: envelopes.Balance{"USD": big.NewRat(3, 1)}},
+						},
+					},
+				},
+			},
+			Accounts: envelopes.Accounts{
+				"checking": envelopes.Balance{"USD": big.NewRat(6, 1)},
+			},
+		},
+	}
+	if err = writer.WriteTransaction(ctx, want); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reader, err := persistHttp.NewRepository(ctx, client)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var got envelopes.Transaction
+	if err = reader.LoadTransaction(ctx, want.ID(), &got); err != nil {
+		t.Error(err)
+		return
+	}
+	if !got.Equal(want) {
+		t.Errorf("loaded Transaction did not match the one that was written")
+	}
+
+	// The Transaction itself, then one batch for each level: its State, the Budget and Accounts, the children of the
+	// root Budget, and the children of "savings".
+	if got := atomic.LoadInt32(singleFetches); got != 1 {
+		t.Errorf("got %d individual fetches, want 1", got)
+	}
+	if got := atomic.LoadInt32(batchFetches); got != 4 {
+		t.Errorf("got %d batch fetches, want 4", got)
+	}
+}
+
+func TestServer_authenticate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const token = "Bearer hunter2"
+	hosted := newTestServer(t, persistHttp.Server{
+		Authenticate: func(req *http.Request) error {
+			if req.Header.Get("Authorization") != token {
+				return errors.New("bad credentials")
+			}
+			return nil
+		},
+	})
+
+	client := persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	}
+
+	_, err := client.ListBranches(ctx)
+	if cast, ok := err.(persistHttp.ErrUnexpectedStatus); !ok || cast.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected request without credentials to be rejected, got: %v", err)
+	}
+
+	client.Authenticate = func(req *http.Request) error {
+		req.Header.Set("Authorization", token)
+		return nil
+	}
+	if _, err = client.ListBranches(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServer_readOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hosted := newTestServer(t, persistHttp.Server{ReadOnly: true})
+	client := persistHttp.Client{
+		BaseURL:    hosted.URL,
+		HTTPClient: hosted.Client(),
+	}
+
+	err := client.Stash(ctx, envelopes.ID{1}, []byte("{}"))
+	if cast, ok := err.(persistHttp.ErrUnexpectedStatus); !ok || cast.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected write to be rejected, got: %v", err)
+	}
+}
+
+func TestRepository_prefetchSharedObjects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, singleFetches, batchFetches := newCountingClient(t)
+
+	writer, err := persistHttp.NewRepository(ctx, client)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// "dining" and "groceries" are identical, so they share an ID, and are each loaded from the same object.
+	want := envelopes.Transaction{
+		Comment: "identical budgets",
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Children: map[string]*envelopes.Budget{
+					"dining":    {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(1, 1)}},
+					"rent":      {Balance: envelopes.Balance{"USD": big.NewRat(2, 1)}},
+					"vacation":  {},
+				},
+			},
+		},
+	}
+	if err = writer.WriteTransaction(ctx, want); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reader, err := persistHttp.NewRepository(ctx, client)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Loading the same Transaction again should be served entirely from what has already been fetched.
+	for i := 0; i < 2; i++ {
+		var got envelopes.Transaction
+		if err = reader.LoadTransaction(ctx, want.ID(), &got); err != nil {
+			t.Error(err)
+			return
+		}
+		if !got.Equal(want) {
+			t.Errorf("loaded Transaction did not match the one that was written")
+		}
+	}
+
+	// The Transaction itself, then one batch each for its State, the root Budget, and the children of the root Budget.
+	if got := atomic.LoadInt32(singleFetches); got != 1 {
+		t.Errorf("got %d individual fetches, want 1", got)
+	}
+	if got := atomic.LoadInt32(batchFetches); got != 3 {
+		t.Errorf("got %d batch fetches, want 3", got)
+	}
+}
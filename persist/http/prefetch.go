@@ -0,0 +1,142 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/marstr/envelopes"
+)
+
+// prefetcher serves objects in the JSON object format to a Loader. Whenever an object is fetched, everything that will
+// be loaded along with it is fetched too, using one call to FetchMany for each level of nesting. That way, loading a
+// Transaction takes a handful of round-trips, rather than one for each Budget in its State.
+//
+// Objects never change once they've been written, so everything that has been fetched is kept for as long as the
+// prefetcher is. That matters because identical Budgets, like empty ones, share an ID, and so are loaded more than once.
+type prefetcher struct {
+	client *Client
+
+	lock    sync.Mutex
+	fetched map[envelopes.ID][]byte
+}
+
+func newPrefetcher(client *Client) *prefetcher {
+	return &prefetcher{
+		client:  client,
+		fetched: make(map[envelopes.ID][]byte),
+	}
+}
+
+// Fetch retrieves the marshaled form of an object, from the objects that were prefetched if possible.
+func (p *prefetcher) Fetch(ctx context.Context, id envelopes.ID) ([]byte, error) {
+	p.lock.Lock()
+	payload, ok := p.fetched[id]
+	p.lock.Unlock()
+
+	if ok {
+		return payload, nil
+	}
+
+	payload, err := p.client.Fetch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.store(map[envelopes.ID][]byte{id: payload})
+	p.prefetch(ctx, payload)
+	return payload, nil
+}
+
+// prefetch fetches the objects that payload refers to, then the ones those refer to, and so on, skipping any that have
+// already been fetched. If a batch can't be fetched, prefetching stops early, and the rest of the objects are left to
+// be fetched one at a time.
+func (p *prefetcher) prefetch(ctx context.Context, payload []byte) {
+	pending := p.missing(references(payload))
+	for len(pending) > 0 {
+		batch, err := p.client.FetchMany(ctx, pending...)
+		if err != nil {
+			return
+		}
+		p.store(batch)
+
+		var next []envelopes.ID
+		for _, found := range batch {
+			next = append(next, references(found)...)
+		}
+		pending = p.missing(next)
+	}
+}
+
+// missing finds the IDs in candidates that haven't been fetched yet, without repeating any of them.
+func (p *prefetcher) missing(candidates []envelopes.ID) []envelopes.ID {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	seen := make(map[envelopes.ID]struct{}, len(candidates))
+	retval := make([]envelopes.ID, 0, len(candidates))
+	for _, id := range candidates {
+		if _, ok := p.fetched[id]; ok {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		retval = append(retval, id)
+	}
+	return retval
+}
+
+// store adds objects to the ones that have been fetched.
+func (p *prefetcher) store(objects map[envelopes.ID][]byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, payload := range objects {
+		p.fetched[id] = payload
+	}
+}
+
+// references finds the IDs of the objects that are loaded along with a JSON object: the State of a Transaction, the
+// Budget and Accounts of a State, and the children of a Budget. Every version of the JSON object format uses the same
+// names for them. Parents, reverted Transactions, and attachments aren't loaded along with a Transaction, so they are
+// left out.
+func references(payload []byte) []envelopes.ID {
+	var found struct {
+		State    envelopes.ID            `json:"state"`
+		Budget   envelopes.ID            `json:"budget"`
+		Accounts envelopes.ID            `json:"accounts"`
+		Children map[string]envelopes.ID `json:"children"`
+	}
+
+	// Objects that don't fit, like Accounts, don't refer to anything.
+	if err := json.Unmarshal(payload, &found); err != nil {
+		return nil
+	}
+
+	retval := make([]envelopes.ID, 0, 3+len(found.Children))
+	for _, id := range []envelopes.ID{found.State, found.Budget, found.Accounts} {
+		if !id.Equal(envelopes.ID{}) {
+			retval = append(retval, id)
+		}
+	}
+	for _, id := range found.Children {
+		retval = append(retval, id)
+	}
+	return retval
+}
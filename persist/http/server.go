@@ -0,0 +1,409 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package http exposes the raw objects and branches of a repository over HTTP, and provides a client that can read and
+// write them from another machine.
+//
+// The server understands the following routes:
+//
+//	GET  /objects/{id}    fetch the marshaled form of a single object
+//	PUT  /objects/{id}    stash the marshaled form of a single object, if it matches the ID
+//	POST /objects         fetch many objects, given a JSON array of IDs
+//	GET  /branches        list the names of all branches as a JSON array
+//	GET  /branches/{name} read the Transaction ID a branch points at
+//	PUT  /branches/{name} point a branch at a Transaction ID
+//	GET  /config          describe how objects are stored, as a filesystem.RepositoryConfig
+//	GET  /clearing        fetch the envelopes.Clearing, as written by persistJson.MarshalClearing
+//	PUT  /clearing        replace the envelopes.Clearing
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/filesystem"
+	persistJson "github.com/marstr/envelopes/persist/json"
+)
+
+const (
+	objectsPrefix  = "/objects"
+	branchesPrefix = "/branches"
+	configPath     = "/config"
+	clearingPath   = "/clearing"
+)
+
+// Backend is the set of capabilities a Server needs from the repository it is exposing. A filesystem.FileSystem
+// satisfies it. If a Backend is also a persist.ClearingReader or persist.ClearingWriter, its envelopes.Clearing is
+// exposed too.
+type Backend interface {
+	persist.Fetcher
+	persist.Stasher
+	persist.BranchReaderWriter
+	persist.BranchLister
+}
+
+// Server is an http.Handler which exposes the objects and branches of a Backend.
+type Server struct {
+	// Backend is where objects and branches are read from and written to. Must not be nil.
+	Backend Backend
+
+	// Authenticate is invoked before each request is served. If it returns an error, the request is rejected with
+	// 401 Unauthorized. If it is nil, all requests are served.
+	Authenticate func(req *http.Request) error
+
+	// ReadOnly rejects all requests which would modify Backend with 405 Method Not Allowed.
+	ReadOnly bool
+
+	// Config describes the format that Backend stores objects in, so that Clients can read and write them the same way.
+	// For a filesystem.FileSystem, it can be read using filesystem.LoadConfig. If it is nil, requests for it are
+	// answered with 404 Not Found, and Clients fall back to guessing.
+	Config *filesystem.RepositoryConfig
+}
+
+// ServeHTTP routes a request to the appropriate operation on Backend.
+func (s Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if s.Authenticate != nil {
+		if err := s.Authenticate(req); err != nil {
+			http.Error(resp, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if s.ReadOnly && req.Method == http.MethodPut {
+		http.Error(resp, "repository is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case req.URL.Path == objectsPrefix:
+		s.serveObjects(resp, req)
+	case strings.HasPrefix(req.URL.Path, objectsPrefix+"/"):
+		s.serveObject(resp, req, strings.TrimPrefix(req.URL.Path, objectsPrefix+"/"))
+	case req.URL.Path == branchesPrefix:
+		s.serveBranches(resp, req)
+	case strings.HasPrefix(req.URL.Path, branchesPrefix+"/"):
+		s.serveBranch(resp, req, strings.TrimPrefix(req.URL.Path, branchesPrefix+"/"))
+	case req.URL.Path == configPath:
+		s.serveConfig(resp, req)
+	case req.URL.Path == clearingPath:
+		s.serveClearing(resp, req)
+	default:
+		http.NotFound(resp, req)
+	}
+}
+
+func (s Server) serveObject(resp http.ResponseWriter, req *http.Request, rawID string) {
+	var id envelopes.ID
+	if len(rawID) != 2*len(id) {
+		http.Error(resp, "malformed object ID", http.StatusBadRequest)
+		return
+	}
+	if err := id.UnmarshalText([]byte(rawID)); err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		payload, err := s.Backend.Fetch(req.Context(), id)
+		if err != nil {
+			http.Error(resp, err.Error(), statusFor(err))
+			return
+		}
+		resp.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = resp.Write(payload)
+	case http.MethodPut:
+		payload, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.verifyObject(req.Context(), id, payload)
+		if errors.Is(err, errObjectMismatch) {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = s.Backend.Stash(req.Context(), id, payload)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		resp.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// errObjectMismatch indicates that an object being stashed doesn't have the ID it is being stashed under.
+var errObjectMismatch = errors.New("the object does not match its ID")
+
+// verifyObject checks that payload is the marshaled form of an object with the given ID, so that a Client can't replace
+// an object with a different one. The objects that it refers to, like the State of a Transaction, must already have been
+// stashed.
+func (s Server) verifyObject(ctx context.Context, id envelopes.ID, payload []byte) error {
+	if envelopes.Blob(payload).ID().Equal(id) {
+		return nil
+	}
+
+	pending := pendingFetcher{
+		Fetcher: s.Backend,
+		id:      id,
+		payload: payload,
+	}
+
+	var loader persist.Loader
+	var err error
+	if s.Config == nil {
+		loader, err = persistJson.NewDetectingLoader(pending)
+	} else {
+		loader, err = filesystem.NewObjectLoader(s.Config, pending)
+	}
+	if err != nil {
+		return err
+	}
+
+	var transaction envelopes.Transaction
+	if err = loader.LoadTransaction(ctx, id, &transaction); err == nil && transaction.ID().Equal(id) {
+		return nil
+	}
+
+	var state envelopes.State
+	if err = loader.LoadState(ctx, id, &state); err == nil && state.ID().Equal(id) {
+		return nil
+	}
+
+	var budget envelopes.Budget
+	if err = loader.LoadBudget(ctx, id, &budget); err == nil && budget.ID().Equal(id) {
+		return nil
+	}
+
+	var accounts envelopes.Accounts
+	if err = loader.LoadAccounts(ctx, id, &accounts); err == nil && accounts.ID().Equal(id) {
+		return nil
+	}
+
+	return fmt.Errorf("%w %s", errObjectMismatch, id)
+}
+
+// pendingFetcher serves an object that hasn't been stashed yet, alongside those that have.
+type pendingFetcher struct {
+	persist.Fetcher
+	id      envelopes.ID
+	payload []byte
+}
+
+func (pf pendingFetcher) Fetch(ctx context.Context, id envelopes.ID) ([]byte, error) {
+	if id.Equal(pf.id) {
+		return pf.payload, nil
+	}
+	return pf.Fetcher.Fetch(ctx, id)
+}
+
+// serveObjects responds to a batch request for objects. Objects which could not be found are omitted from the
+// response, rather than failing the whole request.
+func (s Server) serveObjects(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", "POST")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ids []envelopes.ID
+	if err := json.NewDecoder(req.Body).Decode(&ids); err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found := make(map[envelopes.ID][]byte, len(ids))
+	for _, id := range ids {
+		payload, err := s.Backend.Fetch(req.Context(), id)
+		if errors.Is(err, persist.ErrNotFound) {
+			continue
+		} else if err != nil {
+			http.Error(resp, err.Error(), statusFor(err))
+			return
+		}
+		found[id] = payload
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(resp).Encode(found)
+}
+
+func (s Server) serveBranches(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp.Header().Set("Allow", "GET, HEAD")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	branches, err := s.Backend.ListBranches(ctx)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	names := make([]string, 0)
+	for branch := range branches {
+		names = append(names, branch)
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(resp).Encode(names)
+}
+
+func (s Server) serveBranch(resp http.ResponseWriter, req *http.Request, name string) {
+	if !validBranchName(name) {
+		http.Error(resp, "malformed branch name", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		id, err := s.Backend.ReadBranch(req.Context(), name)
+		if err != nil {
+			http.Error(resp, err.Error(), statusFor(err))
+			return
+		}
+		resp.Header().Set("Content-Type", "text/plain")
+		_, _ = resp.Write([]byte(id.String()))
+	case http.MethodPut:
+		payload, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var id envelopes.ID
+		if len(payload) < 2*len(id) {
+			http.Error(resp, "malformed Transaction ID", http.StatusBadRequest)
+			return
+		}
+		if err = id.UnmarshalText(payload); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = s.Backend.WriteBranch(req.Context(), name, id)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		resp.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s Server) serveConfig(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp.Header().Set("Allow", "GET, HEAD")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.Config == nil {
+		http.NotFound(resp, req)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(resp).Encode(s.Config)
+}
+
+func (s Server) serveClearing(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		reader, ok := s.Backend.(persist.ClearingReader)
+		if !ok {
+			http.NotFound(resp, req)
+			return
+		}
+
+		clearing, err := reader.ReadClearing(req.Context())
+		if err != nil {
+			http.Error(resp, err.Error(), statusFor(err))
+			return
+		}
+
+		marshaled, err := persistJson.MarshalClearing(clearing)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		_, _ = resp.Write(marshaled)
+	case http.MethodPut:
+		writer, ok := s.Backend.(persist.ClearingWriter)
+		if !ok {
+			http.NotFound(resp, req)
+			return
+		}
+
+		payload, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var clearing envelopes.Clearing
+		if err = persistJson.UnmarshalClearing(payload, &clearing); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = writer.WriteClearing(req.Context(), clearing)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		resp.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validBranchName rejects branch names that could be used to escape the portion of a Backend reserved for branches.
+func validBranchName(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, "\\") {
+			return false
+		}
+	}
+	return true
+}
+
+// statusFor picks the status code that best describes an error returned by a Backend.
+func statusFor(err error) int {
+	if errors.Is(err, persist.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
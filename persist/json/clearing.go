@@ -0,0 +1,67 @@
+package json
+
+import (
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+)
+
+type (
+	// ClearingV1 is a copy of envelopes.Clearing for ORM purposes. A Clearing isn't an object, and nothing refers to it
+	// by ID, so it is versioned separately from the JSON object format.
+	ClearingV1 struct {
+		Statuses        map[envelopes.ID]envelopes.ClearingStatus `json:"statuses,omitempty"`
+		Reconciliations []ReconciliationV1                        `json:"reconciliations,omitempty"`
+	}
+
+	// ReconciliationV1 is a copy of envelopes.Reconciliation for ORM purposes.
+	ReconciliationV1 struct {
+		Account     string         `json:"account"`
+		Statement   envelopes.Date `json:"statement"`
+		Balance     BalanceV3      `json:"balance"`
+		Transaction envelopes.ID   `json:"transaction"`
+	}
+)
+
+// MarshalClearing writes a Clearing as JSON.
+func MarshalClearing(subject envelopes.Clearing) ([]byte, error) {
+	var toMarshal ClearingV1
+	toMarshal.Statuses = subject.Statuses
+	if len(subject.Reconciliations) > 0 {
+		toMarshal.Reconciliations = make([]ReconciliationV1, len(subject.Reconciliations))
+		for i, current := range subject.Reconciliations {
+			toMarshal.Reconciliations[i] = ReconciliationV1{
+				Account:     current.Account,
+				Statement:   current.Statement,
+				Balance:     BalanceV3(current.Balance),
+				Transaction: current.Transaction,
+			}
+		}
+	}
+	return json.Marshal(toMarshal)
+}
+
+// UnmarshalClearing reads a Clearing written by MarshalClearing.
+func UnmarshalClearing(marshaled []byte, toLoad *envelopes.Clearing) error {
+	var unmarshaled ClearingV1
+	err := json.Unmarshal(marshaled, &unmarshaled)
+	if err != nil {
+		return err
+	}
+
+	var loaded envelopes.Clearing
+	for id, status := range unmarshaled.Statuses {
+		loaded.SetStatus(id, status)
+	}
+	for _, current := range unmarshaled.Reconciliations {
+		loaded.AddReconciliation(envelopes.Reconciliation{
+			Account:     current.Account,
+			Statement:   current.Statement,
+			Balance:     envelopes.Balance(current.Balance),
+			Transaction: current.Transaction,
+		})
+	}
+
+	*toLoad = loaded
+	return nil
+}
@@ -0,0 +1,192 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// NewestVersion is the most recent version of the JSON object format. It is the version written by Writer.
+const NewestVersion uint = 9
+
+// TransactionVersion inspects a marshaled Transaction, and determines the newest version of the JSON object format that
+// could have produced it.
+//
+// Version 1 Transactions are the only ones with a single parent. Transactions have been written the same way since
+// version 2, apart from earlier versions never having any Reverts, line items, tags, metadata, attachments, dates, or
+// times hashed in UTC, so they are reported as the NewestVersion.
+func TransactionVersion(marshaled []byte) (uint, error) {
+	var probe struct {
+		Parent json.RawMessage `json:"parent"`
+	}
+	if err := json.Unmarshal(marshaled, &probe); err != nil {
+		return 0, err
+	}
+
+	if isJSONString(probe.Parent) {
+		return 1, nil
+	}
+	return NewestVersion, nil
+}
+
+// AccountsVersion inspects a marshaled instance of Accounts, and determines the newest version of the JSON object format
+// that could have produced it.
+//
+// Versions 1 and 2 wrote each magnitude as a string holding a fraction, where versions 3 and 4 write decimal numbers.
+// Since version 5, Accounts have been written as a hierarchy, so each Account is an object rather than a number. Those
+// and empty Accounts are reported as the NewestVersion.
+func AccountsVersion(marshaled []byte) (uint, error) {
+	var probe map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(marshaled, &probe); err != nil {
+		return 0, err
+	}
+
+	for _, balance := range probe {
+		for _, magnitude := range balance {
+			if isJSONString(magnitude) {
+				return 2, nil
+			}
+			if isJSONObject(magnitude) {
+				return NewestVersion, nil
+			}
+			return 4, nil
+		}
+	}
+	return NewestVersion, nil
+}
+
+func isJSONString(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && trimmed[0] == '"'
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// DetectingLoader reads objects written in any version of the JSON object format, by inspecting each object as it is
+// loaded. This allows repositories that hold a mix of versions, for instance because they were only partially upgraded
+// or received objects from an older clone, to be read.
+//
+// Budgets are written the same way in every version, and every earlier version of a State can be read as a State in the
+// NewestVersion, so only Transactions and Accounts need to be inspected.
+type DetectingLoader struct {
+	persist.Fetcher
+
+	// loopback will be called when retrieving sub-objects. If it is not set, DetectingLoader will use itself.
+	loopback persist.Loader
+}
+
+// NewDetectingLoader creates a DetectingLoader that reads objects, and the objects they are composed of, from fetcher.
+func NewDetectingLoader(fetcher persist.Fetcher) (*DetectingLoader, error) {
+	retval := &DetectingLoader{
+		Fetcher: fetcher,
+	}
+	retval.loopback = retval
+	return retval, nil
+}
+
+// NewDetectingLoaderWithLoopback creates a DetectingLoader that reads objects from fetcher, but loads the objects they
+// are composed of using loopback. This is useful for putting a persist.Cache in front of nested loads.
+func NewDetectingLoaderWithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*DetectingLoader, error) {
+	retval := &DetectingLoader{
+		Fetcher:  fetcher,
+		loopback: loopback,
+	}
+	return retval, nil
+}
+
+// LoadTransaction fetches a Transaction, and unmarshals it using whichever version of the JSON object format it was
+// written in.
+func (dl DetectingLoader) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	version, err := TransactionVersion(marshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	prefetched := prefetchedFetcher{ID: id, Payload: marshaled, Fetcher: dl.Fetcher}
+	if version == 1 {
+		loader, err := NewLoaderV1WithLoopback(prefetched, dl.loopback)
+		if err != nil {
+			return err
+		}
+		return loader.LoadTransaction(ctx, id, toLoad)
+	}
+
+	loader, err := NewLoaderV9WithLoopback(prefetched, dl.loopback)
+	if err != nil {
+		return err
+	}
+	return loader.LoadTransaction(ctx, id, toLoad)
+}
+
+// LoadState fetches a State and the objects it is composed of.
+func (dl DetectingLoader) LoadState(ctx context.Context, id envelopes.ID, toLoad *envelopes.State) error {
+	loader, err := NewLoaderV9WithLoopback(dl.Fetcher, dl.loopback)
+	if err != nil {
+		return err
+	}
+	return loader.LoadState(ctx, id, toLoad)
+}
+
+// LoadBudget fetches a Budget and each of its children.
+func (dl DetectingLoader) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *envelopes.Budget) error {
+	loader, err := NewLoaderV3WithLoopback(dl.Fetcher, dl.loopback)
+	if err != nil {
+		return err
+	}
+	return loader.LoadBudget(ctx, id, toLoad)
+}
+
+// LoadAccounts fetches an instance of Accounts, and unmarshals it using whichever version of the JSON object format it
+// was written in.
+func (dl DetectingLoader) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *envelopes.Accounts) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	version, err := AccountsVersion(marshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	prefetched := prefetchedFetcher{ID: id, Payload: marshaled, Fetcher: dl.Fetcher}
+	if version < 3 {
+		loader, err := NewLoaderV2WithLoopback(prefetched, dl.loopback)
+		if err != nil {
+			return err
+		}
+		return loader.LoadAccounts(ctx, id, toLoad)
+	}
+
+	loader, err := NewLoaderV5WithLoopback(prefetched, dl.loopback)
+	if err != nil {
+		return err
+	}
+	return loader.LoadAccounts(ctx, id, toLoad)
+}
+
+// prefetchedFetcher hands back an object that has already been fetched, so that inspecting it doesn't cost a second
+// read. Requests for any other object are passed along to Fetcher.
+type prefetchedFetcher struct {
+	ID      envelopes.ID
+	Payload []byte
+	persist.Fetcher
+}
+
+func (pf prefetchedFetcher) Fetch(ctx context.Context, id envelopes.ID) ([]byte, error) {
+	if id == pf.ID {
+		return pf.Payload, nil
+	}
+	return pf.Fetcher.Fetch(ctx, id)
+}
@@ -0,0 +1,136 @@
+package json_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+	"github.com/marstr/envelopes/persist/json"
+)
+
+func TestDetectingLoader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	parent := envelopes.Transaction{Comment: "parent"}.ID()
+	newTransaction := func(comment string) envelopes.Transaction {
+		return envelopes.Transaction{
+			Comment: comment,
+			Amount:  envelopes.Balance{"USD": big.NewRat(-1234, 100)},
+			Parents: []envelopes.ID{parent},
+			State: &envelopes.State{
+				Budget: &envelopes.Budget{
+					Balance: envelopes.Balance{"USD": big.NewRat(5, 1)},
+					Children: map[string]*envelopes.Budget{
+						"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(1234, 100)}},
+					},
+				},
+				Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(1734, 100), envelopes.AssetType(comment): big.NewRat(1, 1)}},
+			},
+		}
+	}
+
+	mockFiles := NewMockFilesystem()
+
+	writerV1, err := json.NewWriterV1(mockFiles)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	writerV2, err := json.NewWriterV2(mockFiles)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	writerV3, err := json.NewWriterV3(mockFiles)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	withReverts := newTransaction("v3 with reverts")
+	withReverts.Reverts = []envelopes.ID{parent}
+
+	testCases := []struct {
+		writer  persist.Writer
+		subject envelopes.Transaction
+	}{
+		{writerV1, newTransaction("v1")},
+		{writerV2, newTransaction("v2")},
+		{writerV3, newTransaction("v3")},
+		{writerV3, withReverts},
+	}
+
+	for _, tc := range testCases {
+		if err = tc.writer.WriteTransaction(ctx, tc.subject); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	subject, err := json.NewDetectingLoader(mockFiles)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, tc := range testCases {
+		var loaded envelopes.Transaction
+		if err = subject.LoadTransaction(ctx, tc.subject.ID(), &loaded); err != nil {
+			t.Errorf("%s: %v", tc.subject.Comment, err)
+			continue
+		}
+
+		if got, want := loaded.ID(), tc.subject.ID(); got != want {
+			t.Errorf("%s: got ID %s want %s", tc.subject.Comment, got, want)
+		}
+	}
+}
+
+func TestTransactionVersion(t *testing.T) {
+	testCases := map[string]uint{
+		`{"state":"0000000000000000000000000000000000000000","parent":"0000000000000000000000000000000000000000"}`:   1,
+		`{"state":"0000000000000000000000000000000000000000","parent":["0000000000000000000000000000000000000000"]}`: json.NewestVersion,
+		`{"state":"0000000000000000000000000000000000000000","parent":null}`:                                         json.NewestVersion,
+		`{"state":"0000000000000000000000000000000000000000"}`:                                                       json.NewestVersion,
+	}
+
+	for marshaled, want := range testCases {
+		got, err := json.TransactionVersion([]byte(marshaled))
+		if err != nil {
+			t.Errorf("%s: %v", marshaled, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got version %d want %d", marshaled, got, want)
+		}
+	}
+
+	if _, err := json.TransactionVersion([]byte(`{"parent":`)); err == nil {
+		t.Error("expected an error for malformed JSON")
+	}
+}
+
+func TestAccountsVersion(t *testing.T) {
+	testCases := map[string]uint{
+		`{"checking":{"USD":"1587/100"}}`:         2,
+		`{"checking":{"USD":15.870}}`:             4,
+		`{"checking":{"balance":{"USD":15.870}}}`: json.NewestVersion,
+		`{"checking":{}}`:                         json.NewestVersion,
+		`{}`:                                      json.NewestVersion,
+	}
+
+	for marshaled, want := range testCases {
+		got, err := json.AccountsVersion([]byte(marshaled))
+		if err != nil {
+			t.Errorf("%s: %v", marshaled, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got version %d want %d", marshaled, got, want)
+		}
+	}
+}
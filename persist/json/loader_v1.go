@@ -42,7 +42,7 @@ func (dl LoaderV1) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad
 	var unmarshaled TransactionV1
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var state envelopes.State
@@ -80,7 +80,7 @@ func (dl LoaderV1) LoadState(ctx context.Context, id envelopes.ID, toLoad *envel
 	var unmarshaled StateV1
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var budget envelopes.Budget
@@ -107,7 +107,7 @@ func (dl LoaderV1) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *enve
 	var unmarshaled BudgetV1
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	toLoad.Balance = envelopes.Balance(unmarshaled.Balance)
@@ -130,5 +130,9 @@ func (dl LoaderV1) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *en
 		return err
 	}
 
-	return json.Unmarshal(marshaled, toLoad)
+	err = json.Unmarshal(marshaled, toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
 }
@@ -42,7 +42,7 @@ func (dl LoaderV2) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad
 	var unmarshaled TransactionV2
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var state envelopes.State
@@ -76,7 +76,7 @@ func (dl LoaderV2) LoadState(ctx context.Context, id envelopes.ID, toLoad *envel
 	var unmarshaled StateV2
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var budget envelopes.Budget
@@ -103,7 +103,7 @@ func (dl LoaderV2) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *enve
 	var unmarshaled BudgetV2
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	toLoad.Balance = envelopes.Balance(unmarshaled.Balance)
@@ -126,5 +126,9 @@ func (dl LoaderV2) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *en
 		return err
 	}
 
-	return json.Unmarshal(marshaled, toLoad)
+	err = json.Unmarshal(marshaled, toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
 }
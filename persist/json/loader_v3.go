@@ -8,8 +8,6 @@ import (
 	"github.com/marstr/envelopes/persist"
 )
 
-type Loader = LoaderV3
-
 func NewLoaderV3(fetcher persist.Fetcher) (*LoaderV3, error) {
 	retval := &LoaderV3{
 		Fetcher: fetcher,
@@ -44,7 +42,7 @@ func (dl LoaderV3) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad
 	var unmarshaled TransactionV3
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var state envelopes.State
@@ -82,7 +80,7 @@ func (dl LoaderV3) LoadState(ctx context.Context, id envelopes.ID, toLoad *envel
 	var unmarshaled StateV3
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	var budget envelopes.Budget
@@ -111,7 +109,7 @@ func (dl LoaderV3) LoadBudget(ctx context.Context, id envelopes.ID, toLoad *enve
 	var unmarshaled BudgetV3
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	toLoad.Balance = envelopes.Balance(unmarshaled.Balance)
@@ -137,7 +135,7 @@ func (dl LoaderV3) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *en
 	var unmarshaled AccountsV3
 	err = json.Unmarshal(marshaled, &unmarshaled)
 	if err != nil {
-		return err
+		return persist.ErrCorruptObject{ID: id, Err: err}
 	}
 
 	*toLoad = make(envelopes.Accounts, len(unmarshaled))
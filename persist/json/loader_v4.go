@@ -0,0 +1,71 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func NewLoaderV4(fetcher persist.Fetcher) (*LoaderV4, error) {
+	retval := &LoaderV4{}
+	retval.LoaderV3 = LoaderV3{
+		Fetcher:  fetcher,
+		loopback: retval,
+	}
+	return retval, nil
+}
+
+func NewLoaderV4WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV4, error) {
+	retval := &LoaderV4{
+		LoaderV3: LoaderV3{
+			Fetcher:  fetcher,
+			loopback: loopback,
+		},
+	}
+	return retval, nil
+}
+
+// LoaderV4 wraps a Fetcher and does just the unmarshaling portion. Only States are read differently than they are by
+// LoaderV3, so everything else is handed to it. Because version 4 States are a superset of version 3 States, LoaderV4
+// can read either.
+type LoaderV4 struct {
+	LoaderV3
+}
+
+func (dl LoaderV4) LoadState(ctx context.Context, id envelopes.ID, toLoad *envelopes.State) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var unmarshaled StateV4
+	err = json.Unmarshal(marshaled, &unmarshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var budget envelopes.Budget
+	err = dl.loopback.LoadBudget(ctx, unmarshaled.Budget, &budget)
+	if err != nil {
+		return err
+	}
+
+	var accounts envelopes.Accounts
+	err = dl.loopback.LoadAccounts(ctx, unmarshaled.Accounts, &accounts)
+	if err != nil {
+		return err
+	}
+
+	toLoad.Budget = &budget
+	toLoad.Accounts = accounts
+	toLoad.Metadata = nil
+	if len(unmarshaled.Metadata) > 0 {
+		toLoad.Metadata = make(envelopes.AccountMetadata, len(unmarshaled.Metadata))
+		for name, details := range unmarshaled.Metadata {
+			toLoad.Metadata[name] = envelopes.AccountDetails(details)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func NewLoaderV5(fetcher persist.Fetcher) (*LoaderV5, error) {
+	retval := &LoaderV5{}
+	retval.LoaderV4 = LoaderV4{
+		LoaderV3: LoaderV3{
+			Fetcher:  fetcher,
+			loopback: retval,
+		},
+	}
+	return retval, nil
+}
+
+func NewLoaderV5WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV5, error) {
+	retval := &LoaderV5{
+		LoaderV4: LoaderV4{
+			LoaderV3: LoaderV3{
+				Fetcher:  fetcher,
+				loopback: loopback,
+			},
+		},
+	}
+	return retval, nil
+}
+
+// LoaderV5 wraps a Fetcher and does just the unmarshaling portion. Only Accounts are read differently than they are by
+// LoaderV4, so everything else is handed to it. Because WriterV5 falls back to the flat form of Accounts from version 3
+// when it has to, LoaderV5 reads either form.
+type LoaderV5 struct {
+	LoaderV4
+}
+
+func (dl LoaderV5) LoadAccounts(ctx context.Context, id envelopes.ID, toLoad *envelopes.Accounts) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	version, err := AccountsVersion(marshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	if version < 5 {
+		flat, err := NewLoaderV3(prefetchedFetcher{ID: id, Payload: marshaled, Fetcher: dl.Fetcher})
+		if err != nil {
+			return err
+		}
+		return flat.LoadAccounts(ctx, id, toLoad)
+	}
+
+	var unmarshaled AccountsV5
+	err = json.Unmarshal(marshaled, &unmarshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	*toLoad = make(envelopes.Accounts)
+	err = flattenAccountsV5(unmarshaled, envelopes.AccountPath{}, *toLoad)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+	return nil
+}
+
+// flattenAccountsV5 names each Account found beneath parent by its envelopes.AccountPath, and adds it to toLoad.
+func flattenAccountsV5(nodes AccountsV5, parent envelopes.AccountPath, toLoad envelopes.Accounts) error {
+	for segment, node := range nodes {
+		if segment == "" {
+			return fmt.Errorf("account names can not have empty segments")
+		}
+
+		current := parent.Child(segment)
+		if node.Balance != nil {
+			toLoad[current.String()] = envelopes.Balance(*node.Balance)
+		} else if len(node.Children) == 0 {
+			toLoad[current.String()] = envelopes.Balance{}
+		}
+
+		err := flattenAccountsV5(node.Children, current, toLoad)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func NewLoaderV6(fetcher persist.Fetcher) (*LoaderV6, error) {
+	retval := &LoaderV6{}
+	retval.LoaderV5 = LoaderV5{
+		LoaderV4: LoaderV4{
+			LoaderV3: LoaderV3{
+				Fetcher:  fetcher,
+				loopback: retval,
+			},
+		},
+	}
+	return retval, nil
+}
+
+func NewLoaderV6WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV6, error) {
+	retval := &LoaderV6{
+		LoaderV5: LoaderV5{
+			LoaderV4: LoaderV4{
+				LoaderV3: LoaderV3{
+					Fetcher:  fetcher,
+					loopback: loopback,
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+// LoaderV6 wraps a Fetcher and does just the unmarshaling portion. Only Transactions are read differently than they
+// are by LoaderV5, so everything else is handed to it. Because version 6 Transactions are a superset of those written
+// since version 2, LoaderV6 can read any of them.
+type LoaderV6 struct {
+	LoaderV5
+}
+
+func (dl LoaderV6) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var unmarshaled TransactionV6
+	err = json.Unmarshal(marshaled, &unmarshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	lineItems, err := loadLineItemsV6(unmarshaled.LineItems)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var state envelopes.State
+	err = dl.loopback.LoadState(ctx, unmarshaled.State, &state)
+	if err != nil {
+		return err
+	}
+
+	toLoad.State = &state
+	toLoad.Comment = unmarshaled.Comment
+	toLoad.Merchant = unmarshaled.Merchant
+	toLoad.ActualTime = unmarshaled.ActualTime
+	toLoad.EnteredTime = unmarshaled.EnteredTime
+	toLoad.PostedTime = unmarshaled.PostedTime
+	toLoad.Parents = unmarshaled.Parent
+	toLoad.Amount = envelopes.Balance(unmarshaled.Amount)
+	toLoad.Committer.FullName = unmarshaled.Committer.FullName
+	toLoad.Committer.Email = unmarshaled.Committer.Email
+	toLoad.RecordID = envelopes.BankRecordID(unmarshaled.RecordId)
+	if unmarshaled.Reverts != nil {
+		toLoad.Reverts = unmarshaled.Reverts
+	} else {
+		toLoad.Reverts = []envelopes.ID{}
+	}
+	toLoad.LineItems = lineItems
+
+	return nil
+}
+
+// loadLineItemsV6 converts LineItems out of their ORM form. If there aren't any, nil is returned.
+func loadLineItemsV6(items []LineItemV6) ([]envelopes.LineItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	retval := make([]envelopes.LineItem, len(items))
+	for i, item := range items {
+		budget, err := envelopes.ParseBudgetPath(item.Budget)
+		if err != nil {
+			return nil, err
+		}
+		retval[i] = envelopes.LineItem{
+			Amount:  envelopes.Balance(item.Amount),
+			Budget:  budget,
+			Memo:    item.Memo,
+			Account: item.Account,
+		}
+	}
+	return retval, nil
+}
@@ -0,0 +1,110 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func NewLoaderV8(fetcher persist.Fetcher) (*LoaderV8, error) {
+	retval := &LoaderV8{}
+	retval.LoaderV7 = LoaderV7{
+		LoaderV6: LoaderV6{
+			LoaderV5: LoaderV5{
+				LoaderV4: LoaderV4{
+					LoaderV3: LoaderV3{
+						Fetcher:  fetcher,
+						loopback: retval,
+					},
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+func NewLoaderV8WithLoopback(fetcher persist.Fetcher, loopback persist.Loader) (*LoaderV8, error) {
+	retval := &LoaderV8{
+		LoaderV7: LoaderV7{
+			LoaderV6: LoaderV6{
+				LoaderV5: LoaderV5{
+					LoaderV4: LoaderV4{
+						LoaderV3: LoaderV3{
+							Fetcher:  fetcher,
+							loopback: loopback,
+						},
+					},
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+// LoaderV8 wraps a Fetcher and does just the unmarshaling portion. Only Transactions are read differently than they
+// are by LoaderV7, so everything else is handed to it. Because version 8 Transactions are a superset of those written
+// since version 2, LoaderV8 can read any of them.
+type LoaderV8 struct {
+	LoaderV7
+}
+
+func (dl LoaderV8) LoadTransaction(ctx context.Context, id envelopes.ID, toLoad *envelopes.Transaction) error {
+	marshaled, err := dl.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var unmarshaled TransactionV8
+	err = json.Unmarshal(marshaled, &unmarshaled)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	lineItems, err := loadLineItemsV6(unmarshaled.LineItems)
+	if err != nil {
+		return persist.ErrCorruptObject{ID: id, Err: err}
+	}
+
+	var state envelopes.State
+	err = dl.loopback.LoadState(ctx, unmarshaled.State, &state)
+	if err != nil {
+		return err
+	}
+
+	toLoad.State = &state
+	toLoad.Comment = unmarshaled.Comment
+	toLoad.Merchant = unmarshaled.Merchant
+	toLoad.ActualTime = unmarshaled.ActualTime
+	toLoad.EnteredTime = unmarshaled.EnteredTime
+	toLoad.PostedTime = unmarshaled.PostedTime
+	toLoad.Parents = unmarshaled.Parent
+	toLoad.Amount = envelopes.Balance(unmarshaled.Amount)
+	toLoad.Committer.FullName = unmarshaled.Committer.FullName
+	toLoad.Committer.Email = unmarshaled.Committer.Email
+	toLoad.RecordID = envelopes.BankRecordID(unmarshaled.RecordId)
+	if unmarshaled.Reverts != nil {
+		toLoad.Reverts = unmarshaled.Reverts
+	} else {
+		toLoad.Reverts = []envelopes.ID{}
+	}
+	toLoad.LineItems = lineItems
+	toLoad.Tags = nil
+	if len(unmarshaled.Tags) > 0 {
+		toLoad.Tags = envelopes.NewTagSet(unmarshaled.Tags...)
+	}
+	toLoad.Metadata = nil
+	if len(unmarshaled.Metadata) > 0 {
+		toLoad.Metadata = envelopes.TransactionMetadata(unmarshaled.Metadata)
+	}
+	toLoad.Attachments = nil
+	if len(unmarshaled.Attachments) > 0 {
+		toLoad.Attachments = make([]envelopes.Attachment, len(unmarshaled.Attachments))
+		for i, attachment := range unmarshaled.Attachments {
+			toLoad.Attachments[i] = envelopes.Attachment(attachment)
+		}
+	}
+
+	return nil
+}
@@ -24,7 +24,6 @@ type (
 		Children map[string]envelopes.ID `json:"children"`
 	}
 
-	Transaction = TransactionV3
 	// TransactionV3 is a copy of envelopes.Transaction for ORM purposes.
 	TransactionV3 struct {
 		State       envelopes.ID   `json:"state"`
@@ -40,7 +39,6 @@ type (
 		Parent      []envelopes.ID `json:"parent"`
 	}
 
-	State = StateV3
 	// StateV3 is a copy of envelopes.State for ORM purposes.
 	StateV3 struct {
 		Budget   envelopes.ID `json:"budget"`
@@ -58,7 +56,6 @@ type (
 	// BalanceV3 is a copy of envelopes.Balance for ORM purposes.
 	BalanceV3 map[envelopes.AssetType]*big.Rat
 
-	Accounts = AccountsV3
 	// AccountsV3 is a copy of envelopes.Accounts for ORM purposes.
 	AccountsV3 map[string]BalanceV3
 )
@@ -0,0 +1,47 @@
+package json
+
+import (
+	"fmt"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type (
+	State = StateV4
+	// StateV4 is a copy of envelopes.State for ORM purposes. It is the same as StateV3, except that it may also describe
+	// the Accounts of a State.
+	StateV4 struct {
+		Budget   envelopes.ID `json:"budget"`
+		Accounts envelopes.ID `json:"accounts"`
+
+		// Metadata is left out when it's empty, so that States without any are written exactly as they were in version
+		// 3.
+		Metadata AccountMetadataV4 `json:"metadata,omitempty"`
+	}
+
+	// AccountDetailsV4 is a copy of envelopes.AccountDetails for ORM purposes.
+	AccountDetailsV4 struct {
+		Class       envelopes.AccountClass   `json:"class,omitempty"`
+		Subtype     envelopes.AccountSubtype `json:"subtype,omitempty"`
+		Institution string                   `json:"institution,omitempty"`
+		Currency    envelopes.AssetType      `json:"currency,omitempty"`
+		Closed      bool                     `json:"closed,omitempty"`
+	}
+
+	// AccountMetadataV4 is a copy of envelopes.AccountMetadata for ORM purposes.
+	AccountMetadataV4 map[string]AccountDetailsV4
+)
+
+// ErrMetadataUnsupported indicates that a State described its Accounts, but was being written in a version of the JSON
+// object format from before that was possible. Writing it anyway would silently discard the description.
+type ErrMetadataUnsupported uint
+
+func (err ErrMetadataUnsupported) Error() string {
+	return fmt.Sprintf("version %d of the JSON object format can not store account metadata", uint(err))
+}
+
+// Is allows ErrMetadataUnsupported to match persist.ErrUnsupported.
+func (err ErrMetadataUnsupported) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
@@ -0,0 +1,16 @@
+package json
+
+type (
+	Accounts = AccountsV5
+	// AccountsV5 is a copy of envelopes.AccountTree for ORM purposes. Each key is a single segment of an
+	// envelopes.AccountPath, rather than the whole name of an Account.
+	AccountsV5 map[string]AccountNodeV5
+
+	// AccountNodeV5 is a copy of a single node of an envelopes.AccountTree for ORM purposes. Nodes that only group other
+	// Accounts are written without a balance. A node with neither a balance nor any children is an Account with an empty
+	// Balance.
+	AccountNodeV5 struct {
+		Balance  *BalanceV3 `json:"balance,omitempty"`
+		Children AccountsV5 `json:"children,omitempty"`
+	}
+)
@@ -0,0 +1,53 @@
+package json
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type (
+	// TransactionV6 is a copy of envelopes.Transaction for ORM purposes. It is the same as TransactionV3, except that
+	// it may also break its Amount down into line items.
+	TransactionV6 struct {
+		State       envelopes.ID   `json:"state"`
+		PostedTime  time.Time      `json:"postedTime"`
+		ActualTime  time.Time      `json:"actualTime,omitempty"`
+		EnteredTime time.Time      `json:"enteredTime,omitempty"`
+		Amount      BalanceV3      `json:"amount"`
+		Merchant    string         `json:"merchant"`
+		Comment     string         `json:"comment"`
+		Committer   UserV3         `json:"committer,omitempty"`
+		RecordId    BankRecordIDV3 `json:"recordId,omitempty"`
+		Reverts     []envelopes.ID `json:"reverts,omitempty"`
+		Parent      []envelopes.ID `json:"parent"`
+
+		// LineItems are left out when there aren't any, so that Transactions without them are written exactly as they
+		// were in version 3.
+		LineItems []LineItemV6 `json:"lineItems,omitempty"`
+	}
+
+	// LineItemV6 is a copy of envelopes.LineItem for ORM purposes. The Budget is written as the text of its
+	// envelopes.BudgetPath.
+	LineItemV6 struct {
+		Amount  BalanceV3 `json:"amount"`
+		Budget  string    `json:"budget"`
+		Memo    string    `json:"memo,omitempty"`
+		Account string    `json:"account,omitempty"`
+	}
+)
+
+// ErrLineItemsUnsupported indicates that a Transaction had line items, but was being written in a version of the JSON
+// object format from before that was possible. Writing it anyway would silently discard them.
+type ErrLineItemsUnsupported uint
+
+func (err ErrLineItemsUnsupported) Error() string {
+	return fmt.Sprintf("version %d of the JSON object format can not store line items", uint(err))
+}
+
+// Is allows ErrLineItemsUnsupported to match persist.ErrUnsupported.
+func (err ErrLineItemsUnsupported) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
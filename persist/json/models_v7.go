@@ -0,0 +1,46 @@
+package json
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type (
+	// TransactionV7 is a copy of envelopes.Transaction for ORM purposes. It is the same as TransactionV6, except that
+	// it may also be labeled with tags and metadata.
+	TransactionV7 struct {
+		State       envelopes.ID   `json:"state"`
+		PostedTime  time.Time      `json:"postedTime"`
+		ActualTime  time.Time      `json:"actualTime,omitempty"`
+		EnteredTime time.Time      `json:"enteredTime,omitempty"`
+		Amount      BalanceV3      `json:"amount"`
+		Merchant    string         `json:"merchant"`
+		Comment     string         `json:"comment"`
+		Committer   UserV3         `json:"committer,omitempty"`
+		RecordId    BankRecordIDV3 `json:"recordId,omitempty"`
+		Reverts     []envelopes.ID `json:"reverts,omitempty"`
+		Parent      []envelopes.ID `json:"parent"`
+		LineItems   []LineItemV6   `json:"lineItems,omitempty"`
+
+		// Tags are written in sorted order. Both Tags and Metadata are left out when they're empty, so that
+		// Transactions without them are written exactly as they were in version 6.
+		Tags     []string          `json:"tags,omitempty"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+)
+
+// ErrTagsUnsupported indicates that a Transaction had tags or metadata, but was being written in a version of the JSON
+// object format from before that was possible. Writing it anyway would silently discard them.
+type ErrTagsUnsupported uint
+
+func (err ErrTagsUnsupported) Error() string {
+	return fmt.Sprintf("version %d of the JSON object format can not store transaction tags or metadata", uint(err))
+}
+
+// Is allows ErrTagsUnsupported to match persist.ErrUnsupported.
+func (err ErrTagsUnsupported) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
@@ -0,0 +1,54 @@
+package json
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type (
+	// TransactionV8 is a copy of envelopes.Transaction for ORM purposes. It is the same as TransactionV7, except that
+	// it may also refer to attachments.
+	TransactionV8 struct {
+		State       envelopes.ID      `json:"state"`
+		PostedTime  time.Time         `json:"postedTime"`
+		ActualTime  time.Time         `json:"actualTime,omitempty"`
+		EnteredTime time.Time         `json:"enteredTime,omitempty"`
+		Amount      BalanceV3         `json:"amount"`
+		Merchant    string            `json:"merchant"`
+		Comment     string            `json:"comment"`
+		Committer   UserV3            `json:"committer,omitempty"`
+		RecordId    BankRecordIDV3    `json:"recordId,omitempty"`
+		Reverts     []envelopes.ID    `json:"reverts,omitempty"`
+		Parent      []envelopes.ID    `json:"parent"`
+		LineItems   []LineItemV6      `json:"lineItems,omitempty"`
+		Tags        []string          `json:"tags,omitempty"`
+		Metadata    map[string]string `json:"metadata,omitempty"`
+
+		// Attachments are left out when there aren't any, so that Transactions without them are written exactly as they
+		// were in version 7.
+		Attachments []AttachmentV8 `json:"attachments,omitempty"`
+	}
+
+	// AttachmentV8 is a copy of envelopes.Attachment for ORM purposes.
+	AttachmentV8 struct {
+		Blob      envelopes.ID `json:"blob"`
+		Filename  string       `json:"filename,omitempty"`
+		MediaType string       `json:"mediaType,omitempty"`
+	}
+)
+
+// ErrAttachmentsUnsupported indicates that a Transaction had attachments, but was being written in a version of the
+// JSON object format from before that was possible. Writing it anyway would silently discard them.
+type ErrAttachmentsUnsupported uint
+
+func (err ErrAttachmentsUnsupported) Error() string {
+	return fmt.Sprintf("version %d of the JSON object format can not store attachments", uint(err))
+}
+
+// Is allows ErrAttachmentsUnsupported to match persist.ErrUnsupported.
+func (err ErrAttachmentsUnsupported) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
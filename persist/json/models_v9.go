@@ -0,0 +1,94 @@
+package json
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+type (
+	Transaction = TransactionV9
+	// TransactionV9 is a copy of envelopes.Transaction for ORM purposes. It is the same as TransactionV8, except that
+	// it may also record when it posted and happened as dates, and how its times are hashed.
+	TransactionV9 struct {
+		State       envelopes.ID      `json:"state"`
+		PostedTime  time.Time         `json:"postedTime"`
+		ActualTime  time.Time         `json:"actualTime,omitempty"`
+		EnteredTime time.Time         `json:"enteredTime,omitempty"`
+		Amount      BalanceV3         `json:"amount"`
+		Merchant    string            `json:"merchant"`
+		Comment     string            `json:"comment"`
+		Committer   UserV3            `json:"committer,omitempty"`
+		RecordId    BankRecordIDV3    `json:"recordId,omitempty"`
+		Reverts     []envelopes.ID    `json:"reverts,omitempty"`
+		Parent      []envelopes.ID    `json:"parent"`
+		LineItems   []LineItemV6      `json:"lineItems,omitempty"`
+		Tags        []string          `json:"tags,omitempty"`
+		Metadata    map[string]string `json:"metadata,omitempty"`
+		Attachments []AttachmentV8    `json:"attachments,omitempty"`
+
+		// Dates are written like "2006-01-02", and left out when they aren't set, so that Transactions without them are
+		// written exactly as they were in version 8.
+		PostedDate string `json:"postedDate,omitempty"`
+		ActualDate string `json:"actualDate,omitempty"`
+
+		// TimeHashing is left out when it is envelopes.LocalTimeHashing, for the same reason.
+		TimeHashing string `json:"timeHashing,omitempty"`
+	}
+)
+
+// ErrDatesUnsupported indicates that a Transaction had a PostedDate or ActualDate, or had its times hashed in UTC, but
+// was being written in a version of the JSON object format from before that was possible. Writing it anyway would
+// silently discard them, and change its ID.
+type ErrDatesUnsupported uint
+
+func (err ErrDatesUnsupported) Error() string {
+	return fmt.Sprintf("version %d of the JSON object format can not store transaction dates or times hashed in UTC", uint(err))
+}
+
+// Is allows ErrDatesUnsupported to match persist.ErrUnsupported.
+func (err ErrDatesUnsupported) Is(target error) bool {
+	return target == persist.ErrUnsupported
+}
+
+// usesFieldsV9 determines whether a Transaction has anything that can't be written in a version of the JSON object
+// format before 9.
+func usesFieldsV9(subject envelopes.Transaction) bool {
+	return !subject.PostedDate.IsZero() || !subject.ActualDate.IsZero() || subject.TimeHashing != envelopes.LocalTimeHashing
+}
+
+// timeHashingV9 writes a TimeHashing the way TransactionV9 stores it, leaving out envelopes.LocalTimeHashing.
+func timeHashingV9(subject envelopes.TimeHashing) (string, error) {
+	if subject == envelopes.LocalTimeHashing {
+		return "", nil
+	}
+	marshaled, err := subject.MarshalText()
+	return string(marshaled), err
+}
+
+// loadTimeHashingV9 reads a TimeHashing written by timeHashingV9.
+func loadTimeHashingV9(marshaled string) (retval envelopes.TimeHashing, err error) {
+	if marshaled == "" {
+		return envelopes.LocalTimeHashing, nil
+	}
+	err = retval.UnmarshalText([]byte(marshaled))
+	return
+}
+
+// dateV9 writes a Date the way TransactionV9 stores it, leaving out Dates that aren't set.
+func dateV9(subject envelopes.Date) string {
+	if subject.IsZero() {
+		return ""
+	}
+	return subject.String()
+}
+
+// loadDateV9 reads a Date written by dateV9.
+func loadDateV9(marshaled string) (envelopes.Date, error) {
+	if marshaled == "" {
+		return envelopes.Date{}, nil
+	}
+	return envelopes.ParseDate(marshaled)
+}
@@ -0,0 +1,117 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/marstr/envelopes"
+)
+
+// ErrLossyUpgrade indicates that an object could not be rewritten in a newer version of the JSON object format without
+// changing its value. For instance, a magnitude of 1/3 can be written in version 1, but not in version 3.
+type ErrLossyUpgrade struct {
+	Account string
+	Asset   envelopes.AssetType
+}
+
+func (err ErrLossyUpgrade) Error() string {
+	return fmt.Sprintf("the balance of %q in account %q can not be represented exactly in version %d", err.Asset, err.Account, NewestVersion)
+}
+
+// UpgradeTransaction rewrites a marshaled Transaction in the NewestVersion of the JSON object format. The IDs it refers
+// to are left untouched. Transactions that are already in the NewestVersion are returned as-is.
+func UpgradeTransaction(marshaled []byte) ([]byte, error) {
+	version, err := TransactionVersion(marshaled)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == NewestVersion {
+		return marshaled, nil
+	}
+
+	var original TransactionV1
+	err = json.Unmarshal(marshaled, &original)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgraded TransactionV3
+	upgraded.State = original.State
+	upgraded.PostedTime = original.PostedTime
+	upgraded.ActualTime = original.ActualTime
+	upgraded.EnteredTime = original.EnteredTime
+	upgraded.Amount = BalanceV3(original.Amount)
+	upgraded.Merchant = original.Merchant
+	upgraded.Comment = original.Comment
+	upgraded.Committer.FullName = original.Committer.FullName
+	upgraded.Committer.Email = original.Committer.Email
+	upgraded.RecordId = BankRecordIDV3(original.RecordId)
+	if original.Parent.Equal(envelopes.ID{}) {
+		upgraded.Parent = []envelopes.ID{}
+	} else {
+		upgraded.Parent = []envelopes.ID{original.Parent}
+	}
+
+	return json.Marshal(upgraded)
+}
+
+// UpgradeAccounts rewrites a marshaled instance of Accounts in the NewestVersion of the JSON object format. Accounts
+// that are already in the NewestVersion are returned as-is. If a magnitude can't be represented exactly in the
+// NewestVersion, ErrLossyUpgrade is returned.
+func UpgradeAccounts(marshaled []byte) ([]byte, error) {
+	version, err := AccountsVersion(marshaled)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == NewestVersion {
+		return marshaled, nil
+	}
+
+	loader, err := NewDetectingLoader(prefetchedFetcher{Payload: marshaled})
+	if err != nil {
+		return nil, err
+	}
+
+	var original envelopes.Accounts
+	err = loader.LoadAccounts(context.Background(), envelopes.ID{}, &original)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, balance := range original {
+		for asset, magnitude := range balance {
+			reparsed, err := parseRatV3(formatRatV3(magnitude))
+			if err != nil {
+				return nil, err
+			}
+			if reparsed.Cmp(magnitude) != 0 {
+				return nil, ErrLossyUpgrade{Account: name, Asset: asset}
+			}
+		}
+	}
+
+	captured := &capturingStasher{}
+	writer, err := NewWriterV5(captured)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.WriteAccounts(context.Background(), original)
+	if err != nil {
+		return nil, err
+	}
+	return captured.payload, nil
+}
+
+// capturingStasher holds on to the most recent payload it was handed, instead of persisting it anywhere.
+type capturingStasher struct {
+	payload []byte
+}
+
+func (cs *capturingStasher) Stash(_ context.Context, _ envelopes.ID, payload []byte) error {
+	cs.payload = payload
+	return nil
+}
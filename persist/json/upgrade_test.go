@@ -0,0 +1,115 @@
+package json_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist/json"
+)
+
+func TestUpgradeTransaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	testCases := []envelopes.Transaction{
+		{Comment: "no parent"},
+		{
+			Comment:    "everything",
+			Merchant:   "Bakery",
+			PostedTime: time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC),
+			Amount:     envelopes.Balance{"USD": big.NewRat(-450, 100)},
+			Parents:    []envelopes.ID{{1, 2, 3}},
+			Committer:  envelopes.User{FullName: "Jane Doe", Email: "jane@example.com"},
+			RecordID:   "ABC",
+		},
+	}
+
+	for _, tc := range testCases {
+		original := NewMockFilesystem()
+		writer, err := json.NewWriterV1(original)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err = writer.WriteTransaction(ctx, tc); err != nil {
+			t.Error(err)
+			return
+		}
+
+		marshaled, err := original.Fetch(ctx, tc.ID())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		upgraded, err := json.UpgradeTransaction(marshaled)
+		if err != nil {
+			t.Errorf("%s: %v", tc.Comment, err)
+			continue
+		}
+
+		if version, err := json.TransactionVersion(upgraded); err != nil || version != json.NewestVersion {
+			t.Errorf("%s: got version %d (err: %v) want %d", tc.Comment, version, err, json.NewestVersion)
+		}
+
+		// Everything other than the Transaction itself is still where the original writer put it.
+		if err = original.Stash(ctx, tc.ID(), upgraded); err != nil {
+			t.Error(err)
+			return
+		}
+		loader, err := json.NewLoaderV3(original)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var loaded envelopes.Transaction
+		if err = loader.LoadTransaction(ctx, tc.ID(), &loaded); err != nil {
+			t.Errorf("%s: %v", tc.Comment, err)
+			continue
+		}
+		if !loaded.Equal(tc) {
+			t.Errorf("%s: upgraded Transaction did not match the original", tc.Comment)
+		}
+
+		again, err := json.UpgradeTransaction(upgraded)
+		if err != nil || string(again) != string(upgraded) {
+			t.Errorf("%s: upgrading an up-to-date Transaction should not change it", tc.Comment)
+		}
+	}
+}
+
+func TestUpgradeAccounts(t *testing.T) {
+	upgraded, err := json.UpgradeAccounts([]byte(`{"checking":{"USD":"1587/100"},"empty":{}}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const want = `{"checking":{"balance":{"USD":15.870}},"empty":{"balance":{}}}`
+	if string(upgraded) != want {
+		t.Errorf("\ngot:  %s\nwant: %s", upgraded, want)
+	}
+
+	upgraded, err = json.UpgradeAccounts([]byte(`{"Bank A/checking":{"USD":15.870}}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const wantNested = `{"Bank A":{"children":{"checking":{"balance":{"USD":15.870}}}}}`
+	if string(upgraded) != wantNested {
+		t.Errorf("\ngot:  %s\nwant: %s", upgraded, wantNested)
+	}
+
+	_, err = json.UpgradeAccounts([]byte(`{"checking":{"USD":"1/3"}}`))
+	var lossy json.ErrLossyUpgrade
+	if !errors.As(err, &lossy) {
+		t.Errorf("expected ErrLossyUpgrade, got: %v", err)
+	} else if lossy.Account != "checking" || lossy.Asset != "USD" {
+		t.Errorf("unexpected details in %v", lossy)
+	}
+}
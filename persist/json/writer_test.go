@@ -0,0 +1,335 @@
+package json
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// writersByVersion and loadersByVersion construct the Writer and Loader of each version of the JSON object format that
+// TestWriter_features covers, including the version before the first one it covers.
+var writersByVersion = map[uint]func(persist.Stasher) (persist.Writer, error){
+	3: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV3(stasher) },
+	4: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV4(stasher) },
+	5: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV5(stasher) },
+	6: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV6(stasher) },
+	7: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV7(stasher) },
+	8: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV8(stasher) },
+	9: func(stasher persist.Stasher) (persist.Writer, error) { return NewWriterV9(stasher) },
+}
+
+var loadersByVersion = map[uint]func(persist.Fetcher) (persist.Loader, error){
+	4: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV4(fetcher) },
+	5: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV5(fetcher) },
+	6: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV6(fetcher) },
+	7: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV7(fetcher) },
+	8: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV8(fetcher) },
+	9: func(fetcher persist.Fetcher) (persist.Loader, error) { return NewLoaderV9(fetcher) },
+}
+
+// writeObject writes a Transaction, State, or Accounts.
+func writeObject(ctx context.Context, writer persist.Writer, subject interface{}) error {
+	switch typed := subject.(type) {
+	case envelopes.Transaction:
+		return writer.WriteTransaction(ctx, typed)
+	case envelopes.State:
+		return writer.WriteState(ctx, typed)
+	case envelopes.Accounts:
+		return writer.WriteAccounts(ctx, typed)
+	default:
+		panic(fmt.Sprintf("unexpected type %T", subject))
+	}
+}
+
+// objectID finds the ID of a Transaction, State, or Accounts.
+func objectID(subject interface{}) envelopes.ID {
+	return subject.(interface{ ID() envelopes.ID }).ID()
+}
+
+// loadObject loads an object of the same type as subject, with the same ID, and returns the ID of what was loaded.
+func loadObject(ctx context.Context, loader persist.Loader, subject interface{}) (envelopes.ID, error) {
+	id := objectID(subject)
+	switch subject.(type) {
+	case envelopes.Transaction:
+		var loaded envelopes.Transaction
+		err := loader.LoadTransaction(ctx, id, &loaded)
+		return loaded.ID(), err
+	case envelopes.State:
+		var loaded envelopes.State
+		err := loader.LoadState(ctx, id, &loaded)
+		return loaded.ID(), err
+	case envelopes.Accounts:
+		var loaded envelopes.Accounts
+		err := loader.LoadAccounts(ctx, id, &loaded)
+		return loaded.ID(), err
+	default:
+		panic(fmt.Sprintf("unexpected type %T", subject))
+	}
+}
+
+// TestWriter_features checks each feature that was added to the JSON object format after version 3, against the version
+// before the one that added it.
+func TestWriter_features(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	plainState := envelopes.State{
+		Accounts: envelopes.Accounts{"credit": {"USD": big.NewRat(-40, 1)}},
+		Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(-40, 1)}},
+	}
+	described := plainState
+	described.Metadata = envelopes.AccountMetadata{
+		"credit":   {Class: envelopes.LiabilityAccount, Subtype: envelopes.CreditAccount, Institution: "Bank"},
+		"checking": {},
+	}
+
+	nested := envelopes.Accounts{
+		"Bank A":          {"USD": big.NewRat(1, 1)},
+		"Bank A/checking": {"USD": big.NewRat(1587, 100)},
+		"Bank A/savings":  {},
+		"cash":            {"USD": big.NewRat(20, 1)},
+	}
+
+	plain := envelopes.Transaction{
+		Amount:   envelopes.Balance{"USD": big.NewRat(-6150, 100)},
+		Merchant: "Grocery Store",
+		Parents:  []envelopes.ID{},
+	}
+	split := plain
+	split.LineItems = []envelopes.LineItem{
+		{Amount: envelopes.Balance{"USD": big.NewRat(-4500, 100)}, Budget: envelopes.BudgetPath{"groceries"}},
+		{
+			Amount:  envelopes.Balance{"USD": big.NewRat(-1650, 100)},
+			Budget:  envelopes.BudgetPath{"household", "cleaning"},
+			Memo:    "Detergent",
+			Account: "credit",
+		},
+	}
+	labeled := split
+	labeled.Tags = envelopes.NewTagSet("tax-deductible", "reimbursable")
+	labeled.Metadata = envelopes.TransactionMetadata{"check": "1042"}
+	attached := labeled
+	attached.Attachments = []envelopes.Attachment{
+		envelopes.NewAttachment(envelopes.Blob("receipt"), "receipt.pdf", "application/pdf"),
+	}
+	dated := attached
+	dated.PostedDate = envelopes.Date{Year: 2026, Month: time.March, Day: 2}
+	dated.ActualDate = envelopes.Date{Year: 2026, Month: time.February, Day: 27}
+	normalized := attached
+	normalized.PostedTime = time.Date(2026, time.March, 2, 9, 30, 15, 250000000, time.FixedZone("EST", -5*60*60))
+	normalized.TimeHashing = envelopes.UTCTimeHashing
+	datedAndNormalized := dated
+	datedAndNormalized.EnteredTime = time.Date(2026, time.March, 3, 23, 0, 0, 0, time.FixedZone("PST", -8*60*60))
+	datedAndNormalized.TimeHashing = envelopes.UTCTimeHashing
+
+	testCases := []struct {
+		version uint
+		feature string
+
+		// plain doesn't use the feature, so it should be written the same way it was by the version before.
+		plain interface{}
+
+		// featured uses the feature. It should be read back as it was written and, if want isn't empty, be written as
+		// want.
+		featured interface{}
+		want     string
+
+		// refused is whether the version before should refuse to write featured, rather than writing it some other way.
+		refused bool
+
+		// previous is written by the version before, and should be read back as it was written by this version.
+		previous interface{}
+	}{
+		{
+			version:  4,
+			feature:  "account metadata",
+			plain:    plainState,
+			featured: described,
+			want:     `{"budget":"` + plainState.Budget.ID().String() + `","accounts":"` + plainState.Accounts.ID().String() + `","metadata":{"credit":{"class":"liability","subtype":"credit","institution":"Bank"}}}`,
+			refused:  true,
+			previous: plainState,
+		},
+		{
+			version:  5,
+			feature:  "nested accounts",
+			plain:    envelopes.Accounts{},
+			featured: nested,
+			want:     `{"Bank A":{"balance":{"USD":1.000},"children":{"checking":{"balance":{"USD":15.870}},"savings":{"balance":{}}}},"cash":{"balance":{"USD":20.000}}}`,
+			previous: nested,
+		},
+		{
+			version:  5,
+			feature:  "nested accounts in a State",
+			plain:    envelopes.State{},
+			featured: envelopes.State{Accounts: nested},
+			previous: described,
+		},
+		{
+			version:  6,
+			feature:  "line items",
+			plain:    plain,
+			featured: split,
+			refused:  true,
+			previous: plain,
+		},
+		{
+			version:  7,
+			feature:  "tags and metadata",
+			plain:    split,
+			featured: labeled,
+			refused:  true,
+			previous: split,
+		},
+		{
+			version:  8,
+			feature:  "attachments",
+			plain:    labeled,
+			featured: attached,
+			refused:  true,
+			previous: labeled,
+		},
+		{
+			version:  9,
+			feature:  "dates",
+			plain:    attached,
+			featured: dated,
+			refused:  true,
+			previous: attached,
+		},
+		{
+			version:  9,
+			feature:  "time hashing",
+			plain:    attached,
+			featured: normalized,
+			refused:  true,
+			previous: attached,
+		},
+		{
+			version:  9,
+			feature:  "dates with time hashing",
+			plain:    attached,
+			featured: datedAndNormalized,
+			refused:  true,
+			previous: attached,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("v%d %s", tc.version, tc.feature), func(t *testing.T) {
+			previousStore, currentStore := make(mockDisk), make(mockDisk)
+			previous, err := writersByVersion[tc.version-1](previousStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, err := writersByVersion[tc.version](currentStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loader, err := loadersByVersion[tc.version](currentStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = writeObject(ctx, previous, tc.plain); err != nil {
+				t.Fatal(err)
+			}
+			if err = writeObject(ctx, current, tc.plain); err != nil {
+				t.Fatal(err)
+			}
+			id := objectID(tc.plain)
+			if got, want := string(currentStore[id]), string(previousStore[id]); got != want {
+				t.Errorf("objects without %s should be written as they were in version %d\ngot:  %q\nwant: %q", tc.feature, tc.version-1, got, want)
+			}
+
+			if err = writeObject(ctx, current, tc.featured); err != nil {
+				t.Fatal(err)
+			}
+			id = objectID(tc.featured)
+			if got := string(currentStore[id]); tc.want != "" && got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+			if loaded, err := loadObject(ctx, loader, tc.featured); err != nil {
+				t.Error(err)
+			} else if !loaded.Equal(id) {
+				t.Errorf("loaded object %s is not the one written, %s", loaded, id)
+			}
+
+			err = writeObject(ctx, previous, tc.featured)
+			if tc.refused && !errors.Is(err, persist.ErrUnsupported) {
+				t.Errorf("version %d should refuse to drop %s, got: %v", tc.version-1, tc.feature, err)
+			} else if !tc.refused && err != nil {
+				t.Errorf("version %d should be able to write the same object differently, got: %v", tc.version-1, err)
+			}
+
+			olderStore := make(mockDisk)
+			older, err := writersByVersion[tc.version-1](olderStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = writeObject(ctx, older, tc.previous); err != nil {
+				t.Fatal(err)
+			}
+			olderLoader, err := loadersByVersion[tc.version](olderStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id = objectID(tc.previous)
+			if loaded, err := loadObject(ctx, olderLoader, tc.previous); err != nil {
+				t.Errorf("unable to load an object written by version %d: %v", tc.version-1, err)
+			} else if !loaded.Equal(id) {
+				t.Errorf("loaded object %s written by version %d is not the one written, %s", loaded, tc.version-1, id)
+			}
+		})
+	}
+}
+
+// TestWriterV5_nonCanonicalAccounts checks that Accounts which can't be written as a hierarchy, because one of their
+// names isn't a canonical envelopes.AccountPath, are written in the flat form used before version 5, even when the rest
+// of the names could be nested.
+func TestWriterV5_nonCanonicalAccounts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range []string{"", "/leading", "trailing/", "double//slash", `odd\name`} {
+		t.Run(fmt.Sprintf("%q", name), func(t *testing.T) {
+			accounts := envelopes.Accounts{
+				"Bank A":          {"USD": big.NewRat(1, 1)},
+				"Bank A/checking": {"USD": big.NewRat(1587, 100)},
+				name:              {"USD": big.NewRat(2, 1)},
+			}
+
+			v4Store, v5Store := make(mockDisk), make(mockDisk)
+			if err := (WriterV4{WriterV3: WriterV3{Stasher: v4Store}}).WriteAccounts(ctx, accounts); err != nil {
+				t.Fatal(err)
+			}
+			v5, err := NewWriterV5(v5Store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = v5.WriteAccounts(ctx, accounts); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(v5Store[accounts.ID()]), string(v4Store[accounts.ID()]); got != want {
+				t.Errorf("Accounts with a name that isn't canonical should be written as they were in version 4\ngot:  %q\nwant: %q", got, want)
+			}
+
+			loader, err := NewLoaderV5(v5Store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded envelopes.Accounts
+			if err = loader.LoadAccounts(ctx, accounts.ID(), &loaded); err != nil {
+				t.Fatal(err)
+			}
+			if !loaded.ID().Equal(accounts.ID()) {
+				t.Errorf("got %v want %v", loaded, accounts)
+			}
+		})
+	}
+}
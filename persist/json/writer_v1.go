@@ -35,6 +35,22 @@ func NewWriterV1WithLoopback(stasher persist.Stasher, loopback persist.Writer) (
 }
 
 func (dw WriterV1) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if len(subject.LineItems) > 0 {
+		return ErrLineItemsUnsupported(1)
+	}
+
+	if len(subject.Tags) > 0 || len(subject.Metadata) > 0 {
+		return ErrTagsUnsupported(1)
+	}
+
+	if len(subject.Attachments) > 0 {
+		return ErrAttachmentsUnsupported(1)
+	}
+
+	if usesFieldsV9(subject) {
+		return ErrDatesUnsupported(1)
+	}
+
 	if subject.State == nil {
 		subject.State = &envelopes.State{}
 	}
@@ -73,6 +89,10 @@ func (dw WriterV1) WriteTransaction(ctx context.Context, subject envelopes.Trans
 }
 
 func (dw WriterV1) WriteState(ctx context.Context, subject envelopes.State) error {
+	if !subject.Metadata.Empty() {
+		return ErrMetadataUnsupported(1)
+	}
+
 	if subject.Accounts == nil {
 		subject.Accounts = make(envelopes.Accounts, 0)
 	}
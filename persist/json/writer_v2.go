@@ -34,6 +34,22 @@ func NewWriterV2WithLoopback(stasher persist.Stasher, loopback persist.Writer) (
 }
 
 func (dw WriterV2) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if len(subject.LineItems) > 0 {
+		return ErrLineItemsUnsupported(2)
+	}
+
+	if len(subject.Tags) > 0 || len(subject.Metadata) > 0 {
+		return ErrTagsUnsupported(2)
+	}
+
+	if len(subject.Attachments) > 0 {
+		return ErrAttachmentsUnsupported(2)
+	}
+
+	if usesFieldsV9(subject) {
+		return ErrDatesUnsupported(2)
+	}
+
 	if subject.State == nil {
 		subject.State = &envelopes.State{}
 	}
@@ -65,6 +81,10 @@ func (dw WriterV2) WriteTransaction(ctx context.Context, subject envelopes.Trans
 }
 
 func (dw WriterV2) WriteState(ctx context.Context, subject envelopes.State) error {
+	if !subject.Metadata.Empty() {
+		return ErrMetadataUnsupported(2)
+	}
+
 	if subject.Accounts == nil {
 		subject.Accounts = make(envelopes.Accounts, 0)
 	}
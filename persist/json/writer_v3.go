@@ -11,8 +11,6 @@ import (
 	"github.com/marstr/envelopes/persist"
 )
 
-type Writer = WriterV3
-
 // WriterV3 knows how to navigate the envelopes object model and stash each individual component of an object.
 type WriterV3 struct {
 	// Writes the serialized form of an object to persistent memory. Must not be nil.
@@ -39,6 +37,22 @@ func NewWriterV3WithLoopback(stasher persist.Stasher, loopback persist.Writer) (
 }
 
 func (dw WriterV3) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if len(subject.LineItems) > 0 {
+		return ErrLineItemsUnsupported(3)
+	}
+
+	if len(subject.Tags) > 0 || len(subject.Metadata) > 0 {
+		return ErrTagsUnsupported(3)
+	}
+
+	if len(subject.Attachments) > 0 {
+		return ErrAttachmentsUnsupported(3)
+	}
+
+	if usesFieldsV9(subject) {
+		return ErrDatesUnsupported(3)
+	}
+
 	if subject.State == nil {
 		subject.State = &envelopes.State{}
 	}
@@ -73,6 +87,10 @@ func (dw WriterV3) WriteTransaction(ctx context.Context, subject envelopes.Trans
 }
 
 func (dw WriterV3) WriteState(ctx context.Context, subject envelopes.State) error {
+	if !subject.Metadata.Empty() {
+		return ErrMetadataUnsupported(3)
+	}
+
 	if subject.Accounts == nil {
 		subject.Accounts = make(envelopes.Accounts, 0)
 	}
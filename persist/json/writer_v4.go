@@ -0,0 +1,69 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// WriterV4 knows how to navigate the envelopes object model and stash each individual component of an object. Only
+// States are written differently than they are by WriterV3, so everything else is handed to it.
+type WriterV4 struct {
+	WriterV3
+}
+
+func NewWriterV4(stasher persist.Stasher) (*WriterV4, error) {
+	retval := &WriterV4{}
+	retval.WriterV3 = WriterV3{
+		Stasher:  stasher,
+		loopback: retval,
+	}
+	return retval, nil
+}
+
+func NewWriterV4WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV4, error) {
+	retval := &WriterV4{
+		WriterV3: WriterV3{
+			Stasher:  stasher,
+			loopback: loopback,
+		},
+	}
+	return retval, nil
+}
+
+func (dw WriterV4) WriteState(ctx context.Context, subject envelopes.State) error {
+	if subject.Accounts == nil {
+		subject.Accounts = make(envelopes.Accounts, 0)
+	}
+	err := dw.loopback.WriteAccounts(ctx, subject.Accounts)
+	if err != nil {
+		return err
+	}
+
+	if subject.Budget == nil {
+		subject.Budget = &envelopes.Budget{}
+	}
+	err = dw.loopback.WriteBudget(ctx, *subject.Budget)
+	if err != nil {
+		return err
+	}
+
+	var toMarshal StateV4
+	toMarshal.Accounts = subject.Accounts.ID()
+	toMarshal.Budget = subject.Budget.ID()
+	if names := subject.Metadata.Names(); len(names) > 0 {
+		toMarshal.Metadata = make(AccountMetadataV4, len(names))
+		for _, name := range names {
+			toMarshal.Metadata[name] = AccountDetailsV4(subject.Metadata[name])
+		}
+	}
+
+	marshaled, err := json.Marshal(toMarshal)
+	if err != nil {
+		return err
+	}
+
+	return dw.Stash(ctx, subject.ID(), marshaled)
+}
@@ -0,0 +1,77 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// WriterV5 knows how to navigate the envelopes object model and stash each individual component of an object. Only
+// Accounts are written differently than they are by WriterV4, so everything else is handed to it.
+type WriterV5 struct {
+	WriterV4
+}
+
+func NewWriterV5(stasher persist.Stasher) (*WriterV5, error) {
+	retval := &WriterV5{}
+	retval.WriterV4 = WriterV4{
+		WriterV3: WriterV3{
+			Stasher:  stasher,
+			loopback: retval,
+		},
+	}
+	return retval, nil
+}
+
+func NewWriterV5WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV5, error) {
+	retval := &WriterV5{
+		WriterV4: WriterV4{
+			WriterV3: WriterV3{
+				Stasher:  stasher,
+				loopback: loopback,
+			},
+		},
+	}
+	return retval, nil
+}
+
+// WriteAccounts stashes Accounts as a hierarchy, nesting each one beneath the groups named by its envelopes.AccountPath.
+// If the name of any Account isn't a canonical envelopes.AccountPath, it couldn't be read back from a hierarchy, so all
+// of the Accounts are written in the flat form used by WriterV3 instead.
+func (dw WriterV5) WriteAccounts(ctx context.Context, subject envelopes.Accounts) error {
+	for name := range subject {
+		if _, err := envelopes.ParseAccountPath(name); err != nil {
+			return dw.WriterV4.WriteAccounts(ctx, subject)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	err := encoder.Encode(accountNodesV5(subject.Tree()))
+	if err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+
+	return dw.Stash(ctx, subject.ID(), buf.Bytes())
+}
+
+// accountNodesV5 converts the children of a node in an envelopes.AccountTree into their ORM form.
+func accountNodesV5(tree *envelopes.AccountTree) AccountsV5 {
+	retval := make(AccountsV5, len(tree.Children))
+	for name, child := range tree.Children {
+		var current AccountNodeV5
+		if child.Balance != nil {
+			balance := BalanceV3(child.Balance)
+			current.Balance = &balance
+		}
+		if len(child.Children) > 0 {
+			current.Children = accountNodesV5(child)
+		}
+		retval[name] = current
+	}
+	return retval
+}
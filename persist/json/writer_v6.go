@@ -0,0 +1,107 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// WriterV6 knows how to navigate the envelopes object model and stash each individual component of an object. Only
+// Transactions are written differently than they are by WriterV5, so everything else is handed to it.
+type WriterV6 struct {
+	WriterV5
+}
+
+func NewWriterV6(stasher persist.Stasher) (*WriterV6, error) {
+	retval := &WriterV6{}
+	retval.WriterV5 = WriterV5{
+		WriterV4: WriterV4{
+			WriterV3: WriterV3{
+				Stasher:  stasher,
+				loopback: retval,
+			},
+		},
+	}
+	return retval, nil
+}
+
+func NewWriterV6WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV6, error) {
+	retval := &WriterV6{
+		WriterV5: WriterV5{
+			WriterV4: WriterV4{
+				WriterV3: WriterV3{
+					Stasher:  stasher,
+					loopback: loopback,
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+func (dw WriterV6) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if len(subject.Tags) > 0 || len(subject.Metadata) > 0 {
+		return ErrTagsUnsupported(6)
+	}
+
+	if len(subject.Attachments) > 0 {
+		return ErrAttachmentsUnsupported(6)
+	}
+
+	if usesFieldsV9(subject) {
+		return ErrDatesUnsupported(6)
+	}
+
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	var toMarshal TransactionV6
+	toMarshal.Amount = BalanceV3(subject.Amount)
+	toMarshal.Parent = subject.Parents
+	toMarshal.State = subject.State.ID()
+	toMarshal.Comment = subject.Comment
+	toMarshal.Merchant = subject.Merchant
+	toMarshal.ActualTime = subject.ActualTime
+	toMarshal.EnteredTime = subject.EnteredTime
+	toMarshal.PostedTime = subject.PostedTime
+	toMarshal.Committer.FullName = subject.Committer.FullName
+	toMarshal.Committer.Email = subject.Committer.Email
+	toMarshal.RecordId = BankRecordIDV3(subject.RecordID)
+	if len(subject.Reverts) != 0 {
+		toMarshal.Reverts = subject.Reverts
+	}
+	toMarshal.LineItems = lineItemsV6(subject.LineItems)
+
+	err := dw.loopback.WriteState(ctx, *subject.State)
+	if err != nil {
+		return err
+	}
+
+	marshaled, err := json.Marshal(toMarshal)
+	if err != nil {
+		return err
+	}
+
+	return dw.Stash(ctx, subject.ID(), marshaled)
+}
+
+// lineItemsV6 converts LineItems into their ORM form. If there aren't any, nil is returned so that they're left out.
+func lineItemsV6(items []envelopes.LineItem) []LineItemV6 {
+	if len(items) == 0 {
+		return nil
+	}
+
+	retval := make([]LineItemV6, len(items))
+	for i, item := range items {
+		retval[i] = LineItemV6{
+			Amount:  BalanceV3(item.Amount),
+			Budget:  item.Budget.String(),
+			Memo:    item.Memo,
+			Account: item.Account,
+		}
+	}
+	return retval
+}
@@ -0,0 +1,101 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// WriterV8 knows how to navigate the envelopes object model and stash each individual component of an object. Only
+// Transactions are written differently than they are by WriterV7, so everything else is handed to it.
+type WriterV8 struct {
+	WriterV7
+}
+
+func NewWriterV8(stasher persist.Stasher) (*WriterV8, error) {
+	retval := &WriterV8{}
+	retval.WriterV7 = WriterV7{
+		WriterV6: WriterV6{
+			WriterV5: WriterV5{
+				WriterV4: WriterV4{
+					WriterV3: WriterV3{
+						Stasher:  stasher,
+						loopback: retval,
+					},
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+func NewWriterV8WithLoopback(stasher persist.Stasher, loopback persist.Writer) (*WriterV8, error) {
+	retval := &WriterV8{
+		WriterV7: WriterV7{
+			WriterV6: WriterV6{
+				WriterV5: WriterV5{
+					WriterV4: WriterV4{
+						WriterV3: WriterV3{
+							Stasher:  stasher,
+							loopback: loopback,
+						},
+					},
+				},
+			},
+		},
+	}
+	return retval, nil
+}
+
+func (dw WriterV8) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	if usesFieldsV9(subject) {
+		return ErrDatesUnsupported(8)
+	}
+
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	var toMarshal TransactionV8
+	toMarshal.Amount = BalanceV3(subject.Amount)
+	toMarshal.Parent = subject.Parents
+	toMarshal.State = subject.State.ID()
+	toMarshal.Comment = subject.Comment
+	toMarshal.Merchant = subject.Merchant
+	toMarshal.ActualTime = subject.ActualTime
+	toMarshal.EnteredTime = subject.EnteredTime
+	toMarshal.PostedTime = subject.PostedTime
+	toMarshal.Committer.FullName = subject.Committer.FullName
+	toMarshal.Committer.Email = subject.Committer.Email
+	toMarshal.RecordId = BankRecordIDV3(subject.RecordID)
+	if len(subject.Reverts) != 0 {
+		toMarshal.Reverts = subject.Reverts
+	}
+	toMarshal.LineItems = lineItemsV6(subject.LineItems)
+	if len(subject.Tags) != 0 {
+		toMarshal.Tags = subject.Tags.Sorted()
+	}
+	if len(subject.Metadata) != 0 {
+		toMarshal.Metadata = subject.Metadata
+	}
+	if len(subject.Attachments) != 0 {
+		toMarshal.Attachments = make([]AttachmentV8, len(subject.Attachments))
+		for i, attachment := range subject.Attachments {
+			toMarshal.Attachments[i] = AttachmentV8(attachment)
+		}
+	}
+
+	err := dw.loopback.WriteState(ctx, *subject.State)
+	if err != nil {
+		return err
+	}
+
+	marshaled, err := json.Marshal(toMarshal)
+	if err != nil {
+		return err
+	}
+
+	return dw.Stash(ctx, subject.ID(), marshaled)
+}
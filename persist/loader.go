@@ -26,13 +26,6 @@ import (
 	"github.com/marstr/collection/v2"
 )
 
-// ErrObjectNotFound indicates that a non-existent object was requested.
-type ErrObjectNotFound envelopes.ID
-
-func (err ErrObjectNotFound) Error() string {
-	return fmt.Sprintf("not able to find object %s", envelopes.ID(err).String())
-}
-
 // Loader can instantiate core envelopes objects given just an ID.
 type Loader interface {
 	LoadTransaction(ctx context.Context, id envelopes.ID, destination *envelopes.Transaction) error
@@ -0,0 +1,324 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package persist
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/marstr/envelopes"
+)
+
+// MemoryRepository is a RepositoryReaderWriter which holds all objects, branches, the current pointer, and the
+// envelopes.Clearing in memory.
+// It is safe for concurrent use, and is intended for tests and for simulating changes that should never reach disk.
+//
+// Objects are copied as they are written and again as they are loaded, so modifying a loaded object never changes
+// what is stored. Because of that, stored objects are never modified and can be shared between a MemoryRepository and
+// its Snapshots.
+type MemoryRepository struct {
+	lock         sync.RWMutex
+	transactions map[envelopes.ID]envelopes.Transaction
+	states       map[envelopes.ID]envelopes.State
+	budgets      map[envelopes.ID]envelopes.Budget
+	accounts     map[envelopes.ID]envelopes.Accounts
+	payloads     map[envelopes.ID][]byte
+	branches     map[string]envelopes.ID
+	current      RefSpec
+	clearing     envelopes.Clearing
+}
+
+// NewMemoryRepository creates an empty MemoryRepository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		transactions: make(map[envelopes.ID]envelopes.Transaction),
+		states:       make(map[envelopes.ID]envelopes.State),
+		budgets:      make(map[envelopes.ID]envelopes.Budget),
+		accounts:     make(map[envelopes.ID]envelopes.Accounts),
+		payloads:     make(map[envelopes.ID][]byte),
+		branches:     make(map[string]envelopes.ID),
+	}
+}
+
+// Snapshot creates an independent MemoryRepository with the same objects, branches, current pointer, and Clearing as
+// this one. Changes made to either after the Snapshot is taken are not visible in the other, which makes it cheap to
+// explore "what-if" scenarios.
+func (mr *MemoryRepository) Snapshot() *MemoryRepository {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	retval := &MemoryRepository{
+		transactions: make(map[envelopes.ID]envelopes.Transaction, len(mr.transactions)),
+		states:       make(map[envelopes.ID]envelopes.State, len(mr.states)),
+		budgets:      make(map[envelopes.ID]envelopes.Budget, len(mr.budgets)),
+		accounts:     make(map[envelopes.ID]envelopes.Accounts, len(mr.accounts)),
+		payloads:     make(map[envelopes.ID][]byte, len(mr.payloads)),
+		branches:     make(map[string]envelopes.ID, len(mr.branches)),
+		current:      mr.current,
+		clearing:     mr.clearing.DeepCopy(),
+	}
+
+	for k, v := range mr.transactions {
+		retval.transactions[k] = v
+	}
+	for k, v := range mr.states {
+		retval.states[k] = v
+	}
+	for k, v := range mr.budgets {
+		retval.budgets[k] = v
+	}
+	for k, v := range mr.accounts {
+		retval.accounts[k] = v
+	}
+	for k, v := range mr.payloads {
+		retval.payloads[k] = v
+	}
+	for k, v := range mr.branches {
+		retval.branches[k] = v
+	}
+
+	return retval
+}
+
+// LoadTransaction copies a previously written Transaction into destination.
+func (mr *MemoryRepository) LoadTransaction(_ context.Context, id envelopes.ID, destination *envelopes.Transaction) error {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.transactions[id]
+	if !ok {
+		return ErrObjectNotFound(id)
+	}
+	*destination = found.DeepCopy()
+	return nil
+}
+
+// LoadState copies a previously written State into destination.
+func (mr *MemoryRepository) LoadState(_ context.Context, id envelopes.ID, destination *envelopes.State) error {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.states[id]
+	if !ok {
+		return ErrObjectNotFound(id)
+	}
+	*destination = found.DeepCopy()
+	return nil
+}
+
+// LoadBudget copies a previously written Budget into destination.
+func (mr *MemoryRepository) LoadBudget(_ context.Context, id envelopes.ID, destination *envelopes.Budget) error {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.budgets[id]
+	if !ok {
+		return ErrObjectNotFound(id)
+	}
+	*destination = found.DeepCopy()
+	return nil
+}
+
+// LoadAccounts copies a previously written instance of Accounts into destination.
+func (mr *MemoryRepository) LoadAccounts(_ context.Context, id envelopes.ID, destination *envelopes.Accounts) error {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.accounts[id]
+	if !ok {
+		return ErrObjectNotFound(id)
+	}
+	*destination = found.DeepCopy()
+	return nil
+}
+
+// WriteTransaction stores a copy of a Transaction, and all objects composing it.
+func (mr *MemoryRepository) WriteTransaction(_ context.Context, subject envelopes.Transaction) error {
+	subject = subject.DeepCopy()
+	if subject.State == nil {
+		subject.State = &envelopes.State{}
+	}
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.writeState(*subject.State)
+	mr.transactions[subject.ID()] = subject
+	return nil
+}
+
+// WriteState stores a copy of a State, and all objects composing it.
+func (mr *MemoryRepository) WriteState(_ context.Context, subject envelopes.State) error {
+	subject = subject.DeepCopy()
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.writeState(subject)
+	return nil
+}
+
+// WriteBudget stores a copy of a Budget, and each of its children.
+func (mr *MemoryRepository) WriteBudget(_ context.Context, subject envelopes.Budget) error {
+	subject = subject.DeepCopy()
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.writeBudget(subject)
+	return nil
+}
+
+// WriteAccounts stores a copy of an instance of Accounts.
+func (mr *MemoryRepository) WriteAccounts(_ context.Context, subject envelopes.Accounts) error {
+	subject = subject.DeepCopy()
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.accounts[subject.ID()] = subject
+	return nil
+}
+
+// writeState expects to be handed a State that nobody else has a reference to, and the write lock to be held.
+func (mr *MemoryRepository) writeState(subject envelopes.State) {
+	if subject.Budget == nil {
+		subject.Budget = &envelopes.Budget{}
+	}
+	if subject.Accounts == nil {
+		subject.Accounts = make(envelopes.Accounts)
+	}
+
+	mr.writeBudget(*subject.Budget)
+	mr.accounts[subject.Accounts.ID()] = subject.Accounts
+	mr.states[subject.ID()] = subject
+}
+
+// writeBudget expects to be handed a Budget that nobody else has a reference to, and the write lock to be held.
+func (mr *MemoryRepository) writeBudget(subject envelopes.Budget) {
+	for _, child := range subject.Children {
+		mr.writeBudget(*child)
+	}
+	mr.budgets[subject.ID()] = subject
+}
+
+// Stash stores a copy of a raw payload, like a Blob written by StashBlob, alongside the objects in this
+// MemoryRepository.
+func (mr *MemoryRepository) Stash(_ context.Context, id envelopes.ID, payload []byte) error {
+	copied := append([]byte(nil), payload...)
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.payloads[id] = copied
+	return nil
+}
+
+// Fetch copies a raw payload that was previously stored by Stash.
+func (mr *MemoryRepository) Fetch(_ context.Context, id envelopes.ID) ([]byte, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.payloads[id]
+	if !ok {
+		return nil, ErrObjectNotFound(id)
+	}
+	return append([]byte(nil), found...), nil
+}
+
+// ReadBranch fetches the ID that a branch is pointing at.
+func (mr *MemoryRepository) ReadBranch(_ context.Context, name string) (envelopes.ID, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	found, ok := mr.branches[name]
+	if !ok {
+		return envelopes.ID{}, ErrBranchNotFound(name)
+	}
+	return found, nil
+}
+
+// WriteBranch sets a branch to be pointing at a particular ID.
+func (mr *MemoryRepository) WriteBranch(_ context.Context, name string, id envelopes.ID) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.branches[name] = id
+	return nil
+}
+
+// ListBranches fetches the names of all branches, in alphabetical order.
+func (mr *MemoryRepository) ListBranches(ctx context.Context) (<-chan string, error) {
+	mr.lock.RLock()
+	names := make([]string, 0, len(mr.branches))
+	for name := range mr.branches {
+		names = append(names, name)
+	}
+	mr.lock.RUnlock()
+	sort.Strings(names)
+
+	results := make(chan string)
+	go func() {
+		defer close(results)
+
+		for _, name := range names {
+			select {
+			case <-ctx.Done():
+				return
+			case results <- name:
+				// Intentionally Left Blank
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+// Current fetches the RefSpec that is currently checked out.
+func (mr *MemoryRepository) Current(_ context.Context) (RefSpec, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	return mr.current, nil
+}
+
+// SetCurrent replaces the RefSpec that is currently checked out.
+func (mr *MemoryRepository) SetCurrent(_ context.Context, current RefSpec) error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.current = current
+	return nil
+}
+
+// ReadClearing fetches a copy of the most recently written Clearing.
+func (mr *MemoryRepository) ReadClearing(_ context.Context) (envelopes.Clearing, error) {
+	mr.lock.RLock()
+	defer mr.lock.RUnlock()
+
+	return mr.clearing.DeepCopy(), nil
+}
+
+// WriteClearing replaces the Clearing with a copy of subject.
+func (mr *MemoryRepository) WriteClearing(_ context.Context, subject envelopes.Clearing) error {
+	copied := subject.DeepCopy()
+
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.clearing = copied
+	return nil
+}
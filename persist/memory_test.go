@@ -0,0 +1,222 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestMemoryRepository_roundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := NewMemoryRepository()
+
+	want := envelopes.Transaction{
+		Merchant: "Bakery",
+		Amount:   envelopes.Balance{"USD": big.NewRat(-450, 100)},
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Children: map[string]*envelopes.Budget{
+					"treats": {Balance: envelopes.Balance{"USD": big.NewRat(1550, 100)}},
+				},
+			},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(1550, 100)}},
+		},
+	}
+
+	if err := Commit(ctx, subject, want); err != nil {
+		t.Error(err)
+		return
+	}
+
+	head, err := Resolve(ctx, subject, MostRecentTransactionAlias)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var got envelopes.Transaction
+	if err = subject.LoadTransaction(ctx, head, &got); err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Merchant != want.Merchant || !got.State.Equal(*want.State) {
+		t.Error("loaded transaction did not match what was committed")
+	}
+
+	// Sub-objects should be independently loadable.
+	var budget envelopes.Budget
+	if err = subject.LoadBudget(ctx, want.State.Budget.Children["treats"].ID(), &budget); err != nil {
+		t.Error(err)
+	}
+
+	var accounts envelopes.Accounts
+	if err = subject.LoadAccounts(ctx, want.State.Accounts.ID(), &accounts); err != nil {
+		t.Error(err)
+	}
+
+	err = subject.LoadTransaction(ctx, envelopes.ID{1}, &got)
+	if _, ok := err.(ErrObjectNotFound); !ok {
+		t.Errorf("expected ErrObjectNotFound, got: %v", err)
+	}
+
+	_, err = subject.ReadBranch(ctx, "no-such-branch")
+	if _, ok := err.(ErrBranchNotFound); !ok {
+		t.Errorf("expected ErrBranchNotFound, got: %v", err)
+	}
+}
+
+func TestMemoryRepository_mutationIsolation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	subject := NewMemoryRepository()
+
+	original := envelopes.Budget{
+		Balance: envelopes.Balance{"USD": big.NewRat(10, 1)},
+		Children: map[string]*envelopes.Budget{
+			"child": {Balance: envelopes.Balance{"USD": big.NewRat(5, 1)}},
+		},
+	}
+	id := original.ID()
+
+	if err := subject.WriteBudget(ctx, original); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Mutating what was written shouldn't matter.
+	original.Balance["USD"].SetInt64(99)
+	original.Children["child"].Balance["USD"] = big.NewRat(99, 1)
+
+	var loaded envelopes.Budget
+	if err := subject.LoadBudget(ctx, id, &loaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if got := loaded.ID(); !got.Equal(id) {
+		t.Errorf("modifying a written Budget changed the stored copy")
+	}
+
+	// Neither should mutating what was loaded.
+	loaded.Balance["USD"].SetInt64(42)
+	loaded.Children["extra"] = &envelopes.Budget{}
+
+	var reloaded envelopes.Budget
+	if err := subject.LoadBudget(ctx, id, &reloaded); err != nil {
+		t.Error(err)
+		return
+	}
+	if got := reloaded.ID(); !got.Equal(id) {
+		t.Errorf("modifying a loaded Budget changed the stored copy")
+	}
+}
+
+func TestMemoryRepository_Snapshot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	original := NewMemoryRepository()
+	if err := original.SetCurrent(ctx, DefaultBranch); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := original.WriteBranch(ctx, DefaultBranch, envelopes.ID{}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	base := envelopes.Transaction{Comment: "base"}
+	if err := Commit(ctx, original, base); err != nil {
+		t.Error(err)
+		return
+	}
+
+	fork := original.Snapshot()
+
+	whatIf := envelopes.Transaction{Comment: "what if"}
+	if err := Commit(ctx, fork, whatIf); err != nil {
+		t.Error(err)
+		return
+	}
+
+	forkHead, err := fork.ReadBranch(ctx, DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	originalHead, err := original.ReadBranch(ctx, DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if forkHead.Equal(originalHead) {
+		t.Error("committing to a snapshot should not have moved the original's branch")
+	}
+
+	var loaded envelopes.Transaction
+	if err = original.LoadTransaction(ctx, forkHead, &loaded); err == nil {
+		t.Error("a transaction written to a snapshot should not be visible in the original")
+	}
+}
+
+func TestMemoryRepository_concurrent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const workers = 8
+	subject := NewMemoryRepository()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			current := envelopes.Transaction{Comment: fmt.Sprint(i)}
+			if err := subject.WriteTransaction(ctx, current); err != nil {
+				errs <- err
+				return
+			}
+			branch := fmt.Sprintf("worker-%d", i)
+			if err := subject.WriteBranch(ctx, branch, current.ID()); err != nil {
+				errs <- err
+				return
+			}
+
+			var loaded envelopes.Transaction
+			if err := subject.LoadTransaction(ctx, current.ID(), &loaded); err != nil {
+				errs <- err
+				return
+			}
+			_ = subject.Snapshot()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	branches, err := subject.ListBranches(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	count := 0
+	for range branches {
+		count++
+	}
+	if count != workers {
+		t.Errorf("got %d branches want %d", count, workers)
+	}
+}
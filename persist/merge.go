@@ -48,5 +48,21 @@ func Merge(ctx context.Context, repo RepositoryReader, heads []RefSpec) (merged
 		merged = envelopes.State(merged.Add(envelopes.State(delta)))
 	}
 
+	// Balances are combined, but AccountDetails can't be added together. Instead, any change a head made is kept.
+	merged.Metadata = nca.State.Metadata.DeepCopy()
+	for i := range hydratedHeads {
+		headMetadata := hydratedHeads[i].State.Metadata
+		for name, details := range headMetadata {
+			if details != nca.State.Metadata[name] {
+				merged.Metadata[name] = details
+			}
+		}
+		for name := range nca.State.Metadata {
+			if _, ok := headMetadata[name]; !ok {
+				delete(merged.Metadata, name)
+			}
+		}
+	}
+
 	return
 }
@@ -18,7 +18,6 @@ package persist
 
 import (
 	"context"
-	"errors"
 
 	"github.com/marstr/envelopes"
 )
@@ -40,7 +39,7 @@ func NewMockRepository(branchCapacity uint, transactionCapacity uint) *MockRepos
 func (mb MockRepository) ReadBranch(_ context.Context, name string) (envelopes.ID, error) {
 	retval, ok := mb.branches[name]
 	if !ok {
-		return envelopes.ID{}, errors.New("no such branch")
+		return envelopes.ID{}, ErrBranchNotFound(name)
 	}
 	return retval, nil
 }
@@ -0,0 +1,684 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package persisttest implements a battery of tests that check whether an implementation of the persist interfaces
+// honors the contract the rest of this module relies upon. Backends should run it from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		persisttest.TestRepository(t, func(t *testing.T) persist.RepositoryReaderWriter {
+//			return newMyRepository(t.TempDir())
+//		})
+//	}
+//
+// The contract being checked is:
+//   - Every object written can be loaded by its ID, and the loaded object has the same ID.
+//   - Writing a Transaction or State also makes each object composing it loadable by its own ID.
+//   - Modifying an object after it has been written, or after it has been loaded, never changes what later loads return.
+//   - Loaders are free to return nil or empty slices and maps where the written object had the other, as long as the
+//     loaded object's ID is unchanged. For example, a Transaction written with nil Reverts may be loaded with empty
+//     Reverts.
+//   - Loading an ID that was never written returns an error matching persist.ErrNotFound, and never a zero-valued
+//     object.
+//   - Operations given a cancelled context either complete normally, or return an error matching context.Canceled.
+//   - A branch reads back the ID it was most recently written with, may contain '/', and is listed exactly once.
+//   - Reading a branch that was never written returns an error matching persist.ErrNotFound.
+//   - Current returns the RefSpec most recently passed to SetCurrent.
+//   - Backends that are also a persist.Stasher and persist.Fetcher hand back each Blob exactly as it was stashed.
+package persisttest
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+// LoaderWriter is satisfied by backends which can both load and write objects.
+type LoaderWriter interface {
+	persist.Loader
+	persist.Writer
+}
+
+// LoaderWriterFactory creates a new, empty LoaderWriter for each test that is run.
+type LoaderWriterFactory func(t *testing.T) LoaderWriter
+
+// RepositoryFactory creates a new, empty repository for each test that is run.
+type RepositoryFactory func(t *testing.T) persist.RepositoryReaderWriter
+
+// TestLoaderWriter runs every test which applies to a persist.Loader and persist.Writer against the backends created by
+// factory.
+func TestLoaderWriter(t *testing.T, factory LoaderWriterFactory) {
+	t.Run("RoundTripTransaction", func(t *testing.T) { testRoundTripTransaction(t, factory(t)) })
+	t.Run("RoundTripState", func(t *testing.T) { testRoundTripState(t, factory(t)) })
+	t.Run("RoundTripBudget", func(t *testing.T) { testRoundTripBudget(t, factory(t)) })
+	t.Run("RoundTripAccounts", func(t *testing.T) { testRoundTripAccounts(t, factory(t)) })
+	t.Run("ComposingObjects", func(t *testing.T) { testComposingObjects(t, factory(t)) })
+	t.Run("MutationIsolation", func(t *testing.T) { testMutationIsolation(t, factory(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, factory(t)) })
+	t.Run("Cancellation", func(t *testing.T) { testCancellation(t, factory(t)) })
+	t.Run("RoundTripBlob", func(t *testing.T) { testRoundTripBlob(t, factory(t)) })
+}
+
+// TestRepository runs every test which applies to a persist.RepositoryReaderWriter, including those run by
+// TestLoaderWriter, against the backends created by factory.
+func TestRepository(t *testing.T, factory RepositoryFactory) {
+	TestLoaderWriter(t, func(t *testing.T) LoaderWriter {
+		return factory(t)
+	})
+	t.Run("Branches", func(t *testing.T) { testBranches(t, factory(t)) })
+	t.Run("BranchNotFound", func(t *testing.T) { testBranchNotFound(t, factory(t)) })
+	t.Run("Current", func(t *testing.T) { testCurrent(t, factory(t)) })
+	t.Run("Commit", func(t *testing.T) { testCommit(t, factory(t)) })
+}
+
+func newContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// sampleBudget creates a Budget with several levels of children and a mix of assets.
+func sampleBudget() envelopes.Budget {
+	return envelopes.Budget{
+		Balance: envelopes.Balance{"USD": big.NewRat(10001, 100)},
+		Children: map[string]*envelopes.Budget{
+			"savings": {
+				Balance: envelopes.Balance{
+					"USD":   big.NewRat(50000, 100),
+					"VTSAX": big.NewRat(12345, 1000),
+				},
+				Children: map[string]*envelopes.Budget{
+					"emergency": {Balance: envelopes.Balance{"USD": big.NewRat(100000, 100)}},
+				},
+			},
+			"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(-1250, 100)}},
+			"empty":     {},
+		},
+	}
+}
+
+func sampleAccounts() envelopes.Accounts {
+	return envelopes.Accounts{
+		"checking":  {"USD": big.NewRat(158751, 100)},
+		"brokerage": {"VTSAX": big.NewRat(12345, 1000)},
+		"empty":     {},
+	}
+}
+
+func sampleState() envelopes.State {
+	budget := sampleBudget()
+	return envelopes.State{
+		Budget:   &budget,
+		Accounts: sampleAccounts(),
+	}
+}
+
+// sampleTransactions creates a collection of Transactions which exercise optional fields being both set and unset.
+func sampleTransactions() map[string]envelopes.Transaction {
+	posted := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.FixedZone("PDT", -7*60*60))
+	actual := time.Date(2021, time.March, 13, 0, 0, 0, 0, time.UTC)
+	state := sampleState()
+	parent := envelopes.Transaction{Comment: "parent"}.ID()
+
+	return map[string]envelopes.Transaction{
+		"zero":         {},
+		"emptyState":   {State: &envelopes.State{}},
+		"nilReverts":   {Comment: "nil reverts", Reverts: nil, Parents: nil},
+		"emptyReverts": {Comment: "empty reverts", Reverts: []envelopes.ID{}, Parents: []envelopes.ID{}},
+		"full": {
+			State:       &state,
+			PostedTime:  posted,
+			ActualTime:  actual,
+			EnteredTime: posted.Add(time.Hour),
+			Amount:      envelopes.Balance{"USD": big.NewRat(-4299, 100)},
+			Merchant:    "Hardware Store",
+			Committer: envelopes.User{
+				FullName: "Jane Doe",
+				Email:    "jane@example.com",
+			},
+			Comment:  "Replacement faucet",
+			RecordID: "ABC-123",
+			Parents:  []envelopes.ID{parent},
+			Reverts:  []envelopes.ID{parent},
+		},
+		"lineItems": {
+			Amount:   envelopes.Balance{"USD": big.NewRat(-6150, 100)},
+			Merchant: "Grocery Store",
+			LineItems: []envelopes.LineItem{
+				{Amount: envelopes.Balance{"USD": big.NewRat(-4500, 100)}, Budget: envelopes.BudgetPath{"groceries"}},
+				{
+					Amount:  envelopes.Balance{"USD": big.NewRat(-1650, 100)},
+					Budget:  envelopes.BudgetPath{"household", "cleaning"},
+					Memo:    "Detergent",
+					Account: "credit",
+				},
+			},
+		},
+		"labeled": {
+			Comment:  "Conference hotel",
+			Tags:     envelopes.NewTagSet("reimbursable", "tax-deductible"),
+			Metadata: envelopes.TransactionMetadata{"check": "1042", "trip": "Chicago: day 2"},
+		},
+		"attached": {
+			Comment: "Receipts",
+			Attachments: []envelopes.Attachment{
+				envelopes.NewAttachment(envelopes.Blob("receipt"), "receipt.pdf", "application/pdf"),
+				envelopes.NewAttachment(envelopes.Blob("statement"), "", ""),
+			},
+		},
+		"dated": {
+			Merchant:   "Electric Company",
+			PostedDate: envelopes.Date{Year: 2026, Month: time.March, Day: 2},
+			ActualDate: envelopes.Date{Year: 2026, Month: time.February, Day: 27},
+		},
+		"normalized": {
+			Merchant:    "Coffee Shop",
+			PostedTime:  time.Date(2026, time.March, 2, 7, 45, 12, 500000000, time.FixedZone("PST", -8*60*60)),
+			TimeHashing: envelopes.UTCTimeHashing,
+		},
+	}
+}
+
+// usesOptionalFields determines whether a Transaction uses any fields that not every object format has a place for.
+func usesOptionalFields(subject envelopes.Transaction) bool {
+	return len(subject.LineItems) > 0 ||
+		len(subject.Tags) > 0 ||
+		len(subject.Metadata) > 0 ||
+		len(subject.Attachments) > 0 ||
+		!subject.PostedDate.IsZero() ||
+		!subject.ActualDate.IsZero() ||
+		subject.TimeHashing != envelopes.LocalTimeHashing
+}
+
+func testRoundTripTransaction(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	for name, want := range sampleTransactions() {
+		wantID := want.ID()
+		if err := subject.WriteTransaction(ctx, want); err != nil {
+			if errors.Is(err, persist.ErrUnsupported) && usesOptionalFields(want) {
+				// Not every object format has a place for every field, but it must refuse rather than drop them.
+				t.Logf("%s: skipping, because it uses fields that are not supported: %v", name, err)
+				continue
+			}
+			t.Errorf("%s: unable to write: %v", name, err)
+			continue
+		}
+
+		var got envelopes.Transaction
+		if err := subject.LoadTransaction(ctx, wantID, &got); err != nil {
+			t.Errorf("%s: unable to load: %v", name, err)
+			continue
+		}
+
+		if gotID := got.ID(); !gotID.Equal(wantID) {
+			t.Errorf("%s: ID changed after round trip\ngot:  %s\nwant: %s", name, gotID, wantID)
+		}
+
+		if !got.Equal(want) {
+			t.Errorf("%s: loaded Transaction is not Equal to the one written", name)
+		}
+	}
+}
+
+func testRoundTripState(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	described := sampleState()
+	described.Metadata = envelopes.AccountMetadata{
+		"checking": {Class: envelopes.AssetAccount, Subtype: envelopes.CheckingAccount, Institution: "Credit Union", Currency: "USD"},
+		"credit":   {Class: envelopes.LiabilityAccount, Subtype: envelopes.CreditAccount},
+		"closed":   {Closed: true},
+		"zero":     {},
+	}
+
+	testCases := map[string]envelopes.State{
+		"zero":      {},
+		"sample":    sampleState(),
+		"described": described,
+	}
+
+	for name, want := range testCases {
+		wantID := want.ID()
+		if err := subject.WriteState(ctx, want); err != nil {
+			if errors.Is(err, persist.ErrUnsupported) && !want.Metadata.Empty() {
+				// Not every object format has a place for AccountMetadata, but it must refuse rather than drop it.
+				t.Logf("%s: skipping, because account metadata is not supported: %v", name, err)
+				continue
+			}
+			t.Errorf("%s: unable to write: %v", name, err)
+			continue
+		}
+
+		var got envelopes.State
+		if err := subject.LoadState(ctx, wantID, &got); err != nil {
+			t.Errorf("%s: unable to load: %v", name, err)
+			continue
+		}
+
+		if gotID := got.ID(); !gotID.Equal(wantID) {
+			t.Errorf("%s: ID changed after round trip\ngot:  %s\nwant: %s", name, gotID, wantID)
+		}
+	}
+}
+
+func testRoundTripBudget(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	testCases := map[string]envelopes.Budget{
+		"zero":   {},
+		"sample": sampleBudget(),
+	}
+
+	for name, want := range testCases {
+		wantID := want.ID()
+		if err := subject.WriteBudget(ctx, want); err != nil {
+			t.Errorf("%s: unable to write: %v", name, err)
+			continue
+		}
+
+		var got envelopes.Budget
+		if err := subject.LoadBudget(ctx, wantID, &got); err != nil {
+			t.Errorf("%s: unable to load: %v", name, err)
+			continue
+		}
+
+		if gotID := got.ID(); !gotID.Equal(wantID) {
+			t.Errorf("%s: ID changed after round trip\ngot:  %s\nwant: %s", name, gotID, wantID)
+		}
+
+		if !got.Equal(want) {
+			t.Errorf("%s: loaded Budget is not Equal to the one written", name)
+		}
+	}
+}
+
+func testRoundTripAccounts(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	testCases := map[string]envelopes.Accounts{
+		"zero":   {},
+		"sample": sampleAccounts(),
+	}
+
+	for name, want := range testCases {
+		wantID := want.ID()
+		if err := subject.WriteAccounts(ctx, want); err != nil {
+			t.Errorf("%s: unable to write: %v", name, err)
+			continue
+		}
+
+		var got envelopes.Accounts
+		if err := subject.LoadAccounts(ctx, wantID, &got); err != nil {
+			t.Errorf("%s: unable to load: %v", name, err)
+			continue
+		}
+
+		if gotID := got.ID(); !gotID.Equal(wantID) {
+			t.Errorf("%s: ID changed after round trip\ngot:  %s\nwant: %s", name, gotID, wantID)
+		}
+	}
+}
+
+// testMutationIsolation ensures that callers can't reach into the objects a backend is holding onto, for instance by
+// changing a *big.Rat in a Balance that was shared with them.
+func testMutationIsolation(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	written := sampleTransactions()["full"]
+	id := written.ID()
+	if err := subject.WriteTransaction(ctx, written); err != nil {
+		t.Error(err)
+		return
+	}
+	mutateTransaction(written)
+
+	for i := 0; i < 2; i++ {
+		var loaded envelopes.Transaction
+		if err := subject.LoadTransaction(ctx, id, &loaded); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if got := loaded.ID(); !got.Equal(id) {
+			t.Errorf("pass %d: modifying a previously written or loaded Transaction changed what was loaded", i)
+			return
+		}
+		mutateTransaction(loaded)
+	}
+
+	budgetID := sampleBudget().ID()
+	for i := 0; i < 2; i++ {
+		var loaded envelopes.Budget
+		if err := subject.LoadBudget(ctx, budgetID, &loaded); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if got := loaded.ID(); !got.Equal(budgetID) {
+			t.Errorf("pass %d: modifying a previously written or loaded Budget changed what was loaded", i)
+			return
+		}
+		mutateBudget(&loaded)
+	}
+}
+
+// mutateTransaction changes as much of a Transaction in-place as possible, including values shared by reference.
+func mutateTransaction(subject envelopes.Transaction) {
+	for _, magnitude := range subject.Amount {
+		magnitude.SetInt64(7)
+	}
+	for i := range subject.Parents {
+		subject.Parents[i] = envelopes.ID{7}
+	}
+	if subject.State == nil {
+		return
+	}
+	if subject.State.Budget != nil {
+		mutateBudget(subject.State.Budget)
+	}
+	for name, balance := range subject.State.Accounts {
+		for _, magnitude := range balance {
+			magnitude.SetInt64(7)
+		}
+		balance["MUTATED"] = big.NewRat(7, 1)
+		subject.State.Accounts[name] = balance
+	}
+}
+
+func mutateBudget(subject *envelopes.Budget) {
+	for _, magnitude := range subject.Balance {
+		magnitude.SetInt64(7)
+	}
+	for _, child := range subject.Children {
+		mutateBudget(child)
+	}
+	if subject.Children != nil {
+		subject.Children["mutated"] = &envelopes.Budget{}
+	}
+}
+
+// testComposingObjects ensures that writing a Transaction also writes each of the objects that it is made of.
+func testComposingObjects(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	transaction := sampleTransactions()["full"]
+	if err := subject.WriteTransaction(ctx, transaction); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var state envelopes.State
+	if err := subject.LoadState(ctx, transaction.State.ID(), &state); err != nil {
+		t.Errorf("unable to load the State of a written Transaction: %v", err)
+	}
+
+	var accounts envelopes.Accounts
+	if err := subject.LoadAccounts(ctx, transaction.State.Accounts.ID(), &accounts); err != nil {
+		t.Errorf("unable to load the Accounts of a written Transaction: %v", err)
+	}
+
+	var budget envelopes.Budget
+	if err := subject.LoadBudget(ctx, transaction.State.Budget.ID(), &budget); err != nil {
+		t.Errorf("unable to load the root Budget of a written Transaction: %v", err)
+	}
+
+	child := transaction.State.Budget.Children["savings"].Children["emergency"]
+	if err := subject.LoadBudget(ctx, child.ID(), &budget); err != nil {
+		t.Errorf("unable to load a nested Budget of a written Transaction: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	missing := envelopes.Transaction{Comment: "never written"}.ID()
+
+	var transaction envelopes.Transaction
+	if err := subject.LoadTransaction(ctx, missing, &transaction); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when loading a Transaction that was never written, got: %v", err)
+	}
+
+	var state envelopes.State
+	if err := subject.LoadState(ctx, missing, &state); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when loading a State that was never written, got: %v", err)
+	}
+
+	var budget envelopes.Budget
+	if err := subject.LoadBudget(ctx, missing, &budget); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when loading a Budget that was never written, got: %v", err)
+	}
+
+	var accounts envelopes.Accounts
+	if err := subject.LoadAccounts(ctx, missing, &accounts); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when loading Accounts that were never written, got: %v", err)
+	}
+
+	var notFound persist.ErrObjectNotFound
+	if err := subject.LoadTransaction(ctx, missing, &transaction); errors.As(err, &notFound) && envelopes.ID(notFound) != missing {
+		t.Errorf("persist.ErrObjectNotFound should identify the missing object\ngot:  %s\nwant: %s", envelopes.ID(notFound), missing)
+	}
+}
+
+func testCancellation(t *testing.T, subject LoaderWriter) {
+	ctx, cancel := context.WithCancel(newContext(t))
+	cancel()
+
+	acceptable := func(err error) bool {
+		return err == nil || errors.Is(err, context.Canceled)
+	}
+
+	transaction := sampleTransactions()["full"]
+	if err := subject.WriteTransaction(ctx, transaction); !acceptable(err) {
+		t.Errorf("writing with a cancelled context returned an unexpected error: %v", err)
+	}
+
+	var loaded envelopes.Transaction
+	if err := subject.LoadTransaction(ctx, transaction.ID(), &loaded); !acceptable(err) {
+		t.Errorf("loading with a cancelled context returned an unexpected error: %v", err)
+	}
+}
+
+func testRoundTripBlob(t *testing.T, subject LoaderWriter) {
+	ctx := newContext(t)
+
+	stasher, ok := subject.(persist.Stasher)
+	if !ok {
+		t.Skip("backend can not store Blobs")
+	}
+	fetcher, ok := subject.(persist.Fetcher)
+	if !ok {
+		t.Skip("backend can not read Blobs")
+	}
+
+	testCases := map[string]envelopes.Blob{
+		"empty":  {},
+		"text":   envelopes.Blob("Thanks for shopping with us!\n"),
+		"binary": {0x00, 0xff, 0x25, 0x50, 0x44, 0x46, 0x0a, 0x00},
+	}
+
+	for name, want := range testCases {
+		id, err := persist.StashBlob(ctx, stasher, want)
+		if err != nil {
+			t.Errorf("%s: unable to stash: %v", name, err)
+			continue
+		}
+
+		got, err := persist.FetchBlob(ctx, fetcher, id)
+		if err != nil {
+			t.Errorf("%s: unable to fetch: %v", name, err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: got %q want %q", name, got, want)
+		}
+	}
+
+	if _, err := persist.FetchBlob(ctx, fetcher, envelopes.Blob("never stashed").ID()); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when fetching a Blob that was never stashed, got: %v", err)
+	}
+}
+
+func testBranches(t *testing.T, subject persist.RepositoryReaderWriter) {
+	ctx := newContext(t)
+
+	first := envelopes.Transaction{Comment: "first"}
+	second := envelopes.Transaction{Comment: "second", Parents: []envelopes.ID{first.ID()}}
+	for _, transaction := range []envelopes.Transaction{first, second} {
+		if err := subject.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	branches := map[string]envelopes.ID{
+		persist.DefaultBranch:   first.ID(),
+		"feature":               second.ID(),
+		"remotes/origin/master": first.ID(),
+	}
+
+	for name, id := range branches {
+		if err := subject.WriteBranch(ctx, name, id); err != nil {
+			t.Errorf("unable to write branch %q: %v", name, err)
+		}
+	}
+
+	// Overwriting should replace the value.
+	branches[persist.DefaultBranch] = second.ID()
+	if err := subject.WriteBranch(ctx, persist.DefaultBranch, second.ID()); err != nil {
+		t.Error(err)
+	}
+
+	for name, want := range branches {
+		got, err := subject.ReadBranch(ctx, name)
+		if err != nil {
+			t.Errorf("unable to read branch %q: %v", name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("branch %q\ngot:  %s\nwant: %s", name, got, want)
+		}
+	}
+
+	listed, err := subject.ListBranches(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	got := make([]string, 0, len(branches))
+	for name := range listed {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+
+	want := make([]string, 0, len(branches))
+	for name := range branches {
+		want = append(want, name)
+	}
+	sort.Strings(want)
+
+	if len(got) != len(want) {
+		t.Errorf("listed branches\ngot:  %v\nwant: %v", got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("listed branches\ngot:  %v\nwant: %v", got, want)
+			return
+		}
+	}
+}
+
+func testBranchNotFound(t *testing.T, subject persist.RepositoryReaderWriter) {
+	ctx := newContext(t)
+
+	if _, err := subject.ReadBranch(ctx, "never-written"); !errors.Is(err, persist.ErrNotFound) {
+		t.Errorf("expected an error matching persist.ErrNotFound when reading a branch that was never written, got: %v", err)
+	}
+}
+
+func testCurrent(t *testing.T, subject persist.RepositoryReaderWriter) {
+	ctx := newContext(t)
+
+	transaction := envelopes.Transaction{Comment: "headless"}
+	if err := subject.WriteTransaction(ctx, transaction); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, want := range []persist.RefSpec{persist.DefaultBranch, persist.RefSpec(transaction.ID().String())} {
+		if err := subject.SetCurrent(ctx, want); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		got, err := subject.Current(ctx)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("got current %q want %q", got, want)
+		}
+	}
+}
+
+// testCommit ensures that the repository cooperates with persist.Commit to advance the checked-out branch.
+func testCommit(t *testing.T, subject persist.RepositoryReaderWriter) {
+	ctx := newContext(t)
+
+	if err := subject.WriteBranch(ctx, persist.DefaultBranch, envelopes.ID{}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := subject.SetCurrent(ctx, persist.DefaultBranch); err != nil {
+		t.Error(err)
+		return
+	}
+
+	first := envelopes.Transaction{Comment: "first"}
+	if err := persist.Commit(ctx, subject, first); err != nil {
+		t.Error(err)
+		return
+	}
+
+	second := envelopes.Transaction{Comment: "second"}
+	if err := persist.Commit(ctx, subject, second); err != nil {
+		t.Error(err)
+		return
+	}
+
+	head, err := persist.Resolve(ctx, subject, persist.MostRecentTransactionAlias)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	parent, err := persist.LoadAncestor(ctx, subject, head, 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if parent.Comment != first.Comment {
+		t.Errorf("got parent %q want %q", parent.Comment, first.Comment)
+	}
+}
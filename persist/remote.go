@@ -0,0 +1,269 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marstr/envelopes"
+)
+
+// RemoteBranchPrefix is prepended to the names of branches which track the position of a branch in another repository.
+const RemoteBranchPrefix = "remotes"
+
+// ErrNonFastForward indicates that a Push would have moved a branch to a Transaction that does not descend from the
+// one the branch was already pointing at, which would discard history in the destination repository.
+type ErrNonFastForward struct {
+	Branch string
+	Old    envelopes.ID
+	New    envelopes.ID
+}
+
+func (err ErrNonFastForward) Error() string {
+	return fmt.Sprintf("updating branch %q from %s to %s is not a fast-forward", err.Branch, err.Old, err.New)
+}
+
+// RemoteBranch builds the name of the branch that tracks the position of `branch` in the remote named `remote`.
+func RemoteBranch(remote, branch string) string {
+	return strings.Join([]string{RemoteBranchPrefix, remote, branch}, "/")
+}
+
+// IsRemoteBranch determines whether a branch name refers to a remote-tracking branch.
+func IsRemoteBranch(branch string) bool {
+	return strings.HasPrefix(branch, RemoteBranchPrefix+"/")
+}
+
+type pushOptions struct {
+	Force bool
+}
+
+// PushOption modifies the behavior of Push.
+type PushOption func(options *pushOptions) error
+
+// PushForce allows Push to update a branch even if doing so is not a fast-forward.
+func PushForce() PushOption {
+	return func(options *pushOptions) error {
+		options.Force = true
+		return nil
+	}
+}
+
+// Fetch copies every Transaction reachable from the branches of `src` that is not already present in `dest`, then
+// updates the remote-tracking branches in `dest` (named according to RemoteBranch) to match the branches in `src`.
+//
+// Walking history stops at any Transaction that `dest` already has, on the assumption that its ancestors were
+// transferred along with it. Branches in `src` which are themselves remote-tracking branches are not fetched. If both
+// repositories keep an envelopes.Clearing, the one in `src` is merged into the one in `dest`, as described by
+// envelopes.Clearing.Merge.
+func Fetch(ctx context.Context, remote string, src BareRepositoryReader, dest BareRepositoryReaderWriter) error {
+	rawBranches, err := src.ListBranches(ctx)
+	if err != nil {
+		return err
+	}
+
+	branches := make(map[string]envelopes.ID)
+	for branch := range rawBranches {
+		if IsRemoteBranch(branch) {
+			continue
+		}
+		branches[branch] = envelopes.ID{}
+	}
+
+	heads := make([]envelopes.ID, 0, len(branches))
+	for branch := range branches {
+		var head envelopes.ID
+		head, err = src.ReadBranch(ctx, branch)
+		if err != nil {
+			return err
+		}
+		branches[branch] = head
+		heads = append(heads, head)
+	}
+
+	err = transferMissing(ctx, src, dest, heads...)
+	if err != nil {
+		return err
+	}
+
+	err = transferClearing(ctx, src, dest)
+	if err != nil {
+		return err
+	}
+
+	for branch, head := range branches {
+		err = dest.WriteBranch(ctx, RemoteBranch(remote, branch), head)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Push copies every Transaction reachable from `branch` in `src` that is not already present in `dest`, then points
+// `branch` in `dest` at the same Transaction it points at in `src`.
+//
+// If `dest` already has a branch with that name, and the Transaction it points at is not an ancestor of the one being
+// pushed, ErrNonFastForward is returned and `dest` is left unmodified. Use PushForce to update the branch anyway. If
+// the branch in `dest` can't be read for any reason other than it not existing, `dest` is also left unmodified.
+//
+// If both repositories keep an envelopes.Clearing, the one in `src` is merged into the one in `dest`, as described by
+// envelopes.Clearing.Merge.
+func Push(ctx context.Context, branch string, src BareRepositoryReader, dest BareRepositoryReaderWriter, options ...PushOption) error {
+	var aggregatedOptions pushOptions
+	for _, option := range options {
+		if err := option(&aggregatedOptions); err != nil {
+			return err
+		}
+	}
+
+	head, err := src.ReadBranch(ctx, branch)
+	if err != nil {
+		return err
+	}
+
+	if !aggregatedOptions.Force {
+		old, err := dest.ReadBranch(ctx, branch)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if err == nil && !old.Equal(envelopes.ID{}) {
+			var fastForward bool
+			fastForward, err = IsAncestor(ctx, src, old, head)
+			if err != nil {
+				return err
+			}
+
+			if !fastForward {
+				return ErrNonFastForward{
+					Branch: branch,
+					Old:    old,
+					New:    head,
+				}
+			}
+		}
+	}
+
+	err = transferMissing(ctx, src, dest, head)
+	if err != nil {
+		return err
+	}
+
+	err = transferClearing(ctx, src, dest)
+	if err != nil {
+		return err
+	}
+
+	return dest.WriteBranch(ctx, branch, head)
+}
+
+// IsAncestor determines whether or not `ancestor` can be reached by following the Parents of `descendant`. A
+// Transaction is considered to be its own ancestor.
+func IsAncestor(ctx context.Context, loader Loader, ancestor, descendant envelopes.ID) (bool, error) {
+	walker := Walker{Loader: loader}
+	err := walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, _ envelopes.Transaction) error {
+		if id.Equal(ancestor) {
+			return errFound{}
+		}
+		return nil
+	}, descendant)
+
+	if _, ok := err.(errFound); ok {
+		return true, nil
+	}
+	return false, err
+}
+
+// errFound allows a WalkFunc to stop a walk early once it has discovered what it was looking for.
+type errFound struct{}
+
+func (err errFound) Error() string {
+	return "found the object that was being searched for"
+}
+
+// transferMissing writes each Transaction reachable from `heads` in `src` to `dest`, stopping at those which are
+// already present in `dest`. Ancestors are written before their descendants, and the Blobs a Transaction has attached are
+// copied before it is, so that an interrupted transfer never leaves a Transaction in `dest` without its history or its
+// attachments.
+func transferMissing(ctx context.Context, src Loader, dest BareRepositoryReaderWriter, heads ...envelopes.ID) error {
+	nonEmptyHeads := make([]envelopes.ID, 0, len(heads))
+	for _, head := range heads {
+		if !head.Equal(envelopes.ID{}) {
+			nonEmptyHeads = append(nonEmptyHeads, head)
+		}
+	}
+	heads = nonEmptyHeads
+
+	missing := make(map[envelopes.ID]envelopes.Transaction)
+
+	walker := Walker{Loader: src}
+	err := walker.Walk(ctx, func(ctx context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		var existing envelopes.Transaction
+		if err := dest.LoadTransaction(ctx, id, &existing); err == nil {
+			return ErrSkipAncestors{}
+		}
+		missing[id] = transaction
+		return nil
+	}, heads...)
+	if err != nil {
+		return err
+	}
+
+	// Visit the missing Transactions depth-first, writing each one only after all of its missing parents have been
+	// written.
+	written := make(map[envelopes.ID]struct{}, len(missing))
+	var write func(envelopes.ID) error
+	write = func(id envelopes.ID) error {
+		transaction, ok := missing[id]
+		if !ok {
+			return nil
+		}
+		if _, ok = written[id]; ok {
+			return nil
+		}
+		written[id] = struct{}{}
+
+		for _, parent := range transaction.Parents {
+			if err := write(parent); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// Intentionally Left Blank
+		}
+
+		if err := copyAttachments(ctx, src, dest, transaction); err != nil {
+			return err
+		}
+
+		return dest.WriteTransaction(ctx, transaction)
+	}
+
+	for _, head := range heads {
+		if err = write(head); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
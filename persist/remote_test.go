@@ -0,0 +1,366 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+// countingRepository wraps a MockRepository, and keeps track of how many times each Transaction has been loaded or
+// written.
+type countingRepository struct {
+	*MockRepository
+	loads  map[envelopes.ID]int
+	writes map[envelopes.ID]int
+}
+
+func newCountingRepository(inner *MockRepository) *countingRepository {
+	return &countingRepository{
+		MockRepository: inner,
+		loads:          make(map[envelopes.ID]int),
+		writes:         make(map[envelopes.ID]int),
+	}
+}
+
+func (cr *countingRepository) LoadTransaction(ctx context.Context, id envelopes.ID, destination *envelopes.Transaction) error {
+	cr.loads[id]++
+	return cr.MockRepository.LoadTransaction(ctx, id, destination)
+}
+
+func (cr *countingRepository) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	cr.writes[subject.ID()]++
+	return cr.MockRepository.WriteTransaction(ctx, subject)
+}
+
+func TestFetch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMockRepository(2, 10)
+	dest := NewMockRepository(2, 10)
+
+	a := envelopes.Transaction{Comment: "a"}
+	b := envelopes.Transaction{Comment: "b", Parents: []envelopes.ID{a.ID()}}
+	for _, transaction := range []envelopes.Transaction{a, b} {
+		if err := src.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := src.WriteBranch(ctx, DefaultBranch, b.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := Fetch(ctx, "origin", src, dest); err != nil {
+		t.Error(err)
+		return
+	}
+
+	trackingBranch := RemoteBranch("origin", DefaultBranch)
+	got, err := dest.ReadBranch(ctx, trackingBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := b.ID(); !got.Equal(want) {
+		t.Errorf("unexpected remote-tracking branch value\ngot:  %s\nwant: %s", got, want)
+	}
+
+	if _, err = dest.ReadBranch(ctx, DefaultBranch); err == nil {
+		t.Errorf("fetch should not have created local branch %q", DefaultBranch)
+	}
+
+	// Extend history in the source, and make sure only the new Transaction is copied over.
+	c := envelopes.Transaction{Comment: "c", Parents: []envelopes.ID{b.ID()}}
+	if err = src.WriteTransaction(ctx, c); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = src.WriteBranch(ctx, DefaultBranch, c.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	countedSrc := newCountingRepository(src)
+	countedDest := newCountingRepository(dest)
+	if err = Fetch(ctx, "origin", countedSrc, countedDest); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if count := countedSrc.loads[a.ID()]; count != 0 {
+		t.Errorf("history behind an already present Transaction was walked %d times", count)
+	}
+
+	if len(countedDest.writes) != 1 || countedDest.writes[c.ID()] != 1 {
+		t.Errorf("expected exactly one write of the new Transaction, got: %v", countedDest.writes)
+	}
+
+	got, err = dest.ReadBranch(ctx, trackingBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := c.ID(); !got.Equal(want) {
+		t.Errorf("unexpected remote-tracking branch value\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestFetch_skipsRemoteBranches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMockRepository(2, 10)
+	dest := NewMockRepository(2, 10)
+
+	a := envelopes.Transaction{Comment: "a"}
+	if err := src.WriteTransaction(ctx, a); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := src.WriteBranch(ctx, RemoteBranch("upstream", DefaultBranch), a.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := Fetch(ctx, "origin", src, dest); err != nil {
+		t.Error(err)
+		return
+	}
+
+	branches, err := dest.ListBranches(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for branch := range branches {
+		t.Errorf("unexpected branch %q", branch)
+	}
+}
+
+func TestPush(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMockRepository(2, 10)
+	dest := NewMockRepository(2, 10)
+
+	a := envelopes.Transaction{Comment: "a"}
+	b := envelopes.Transaction{Comment: "b", Parents: []envelopes.ID{a.ID()}}
+	diverged := envelopes.Transaction{Comment: "diverged", Parents: []envelopes.ID{a.ID()}}
+	for _, transaction := range []envelopes.Transaction{a, b, diverged} {
+		if err := src.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// Pushing to a repository without the branch should just create it.
+	if err := src.WriteBranch(ctx, DefaultBranch, a.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := Push(ctx, DefaultBranch, src, dest); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Fast-forwards are allowed.
+	if err := src.WriteBranch(ctx, DefaultBranch, b.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := Push(ctx, DefaultBranch, src, dest); err != nil {
+		t.Error(err)
+		return
+	}
+	got, err := dest.ReadBranch(ctx, DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := b.ID(); !got.Equal(want) {
+		t.Errorf("unexpected branch value\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// Rewriting history is refused.
+	if err = src.WriteBranch(ctx, DefaultBranch, diverged.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+	err = Push(ctx, DefaultBranch, src, dest)
+	if _, ok := err.(ErrNonFastForward); !ok {
+		t.Errorf("expected an ErrNonFastForward, got: %v", err)
+	}
+	got, err = dest.ReadBranch(ctx, DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := b.ID(); !got.Equal(want) {
+		t.Errorf("a refused push modified the branch\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// ...unless forced.
+	if err = Push(ctx, DefaultBranch, src, dest, PushForce()); err != nil {
+		t.Error(err)
+		return
+	}
+	got, err = dest.ReadBranch(ctx, DefaultBranch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := diverged.ID(); !got.Equal(want) {
+		t.Errorf("unexpected branch value\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestPush_unreadableBranch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMockRepository(1, 10)
+	dest := &unreadableBranchRepository{MockRepository: NewMockRepository(1, 10)}
+
+	a := envelopes.Transaction{Comment: "a"}
+	if err := src.WriteTransaction(ctx, a); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := src.WriteBranch(ctx, DefaultBranch, a.ID()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err := Push(ctx, DefaultBranch, src, dest)
+	if !errors.Is(err, errUnreadableBranch) {
+		t.Errorf("expected the error reading the branch to be returned, got: %v", err)
+	}
+	if _, ok := dest.MockRepository.branches[DefaultBranch]; ok {
+		t.Errorf("a push that couldn't check for a fast-forward modified the branch")
+	}
+}
+
+var errUnreadableBranch = errors.New("branch could not be read")
+
+// unreadableBranchRepository wraps a MockRepository, and fails to read any branch for reasons other than it not
+// existing.
+type unreadableBranchRepository struct {
+	*MockRepository
+}
+
+func (ubr unreadableBranchRepository) ReadBranch(_ context.Context, _ string) (envelopes.ID, error) {
+	return envelopes.ID{}, errUnreadableBranch
+}
+
+func Test_transferMissing_parentsFirst(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMockRepository(1, 10)
+
+	// d has one parent that is much further away than the other, so a breadth-first walk would encounter a before b.
+	a := envelopes.Transaction{Comment: "a"}
+	b := envelopes.Transaction{Comment: "b", Parents: []envelopes.ID{a.ID()}}
+	c := envelopes.Transaction{Comment: "c", Parents: []envelopes.ID{b.ID()}}
+	d := envelopes.Transaction{Comment: "d", Parents: []envelopes.ID{c.ID(), a.ID()}}
+	for _, transaction := range []envelopes.Transaction{a, b, c, d} {
+		if err := src.WriteTransaction(ctx, transaction); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	dest := &orderCheckingWriter{
+		MockRepository: NewMockRepository(1, 10),
+		t:              t,
+	}
+
+	if err := transferMissing(ctx, src, dest, d.ID()); err != nil {
+		t.Error(err)
+	}
+}
+
+// orderCheckingWriter fails a test if a Transaction is written before all of its parents.
+type orderCheckingWriter struct {
+	*MockRepository
+	t *testing.T
+}
+
+func (ocw orderCheckingWriter) WriteTransaction(ctx context.Context, subject envelopes.Transaction) error {
+	for _, parent := range subject.Parents {
+		var loaded envelopes.Transaction
+		if err := ocw.MockRepository.LoadTransaction(ctx, parent, &loaded); err != nil {
+			ocw.t.Errorf("%q was written before its parent %s", subject.Comment, parent)
+		}
+	}
+	return ocw.MockRepository.WriteTransaction(ctx, subject)
+}
+
+func TestFetchPushBareClone_clearing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	src := NewMemoryRepository()
+
+	a := envelopes.Transaction{Comment: "a"}
+	b := envelopes.Transaction{Comment: "b", Parents: []envelopes.ID{a.ID()}}
+	for _, transaction := range []envelopes.Transaction{a, b} {
+		if err := src.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.WriteBranch(ctx, DefaultBranch, b.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	var original envelopes.Clearing
+	original.SetStatus(a.ID(), envelopes.Cleared)
+	if err := src.WriteClearing(ctx, original); err != nil {
+		t.Fatal(err)
+	}
+
+	cloned := NewMemoryRepository()
+	if err := BareClone(ctx, src, cloned); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cloned.ReadClearing(ctx); err != nil || !got.Equal(original) {
+		t.Errorf("BareClone didn't copy the Clearing\ngot:  %v (err: %v)\nwant: %v", got, err, original)
+	}
+
+	// Both copies go on to check different Transactions. Neither may lose the other's progress.
+	var onClone envelopes.Clearing
+	onClone.SetStatus(a.ID(), envelopes.Reconciled)
+	if err := cloned.WriteClearing(ctx, onClone); err != nil {
+		t.Fatal(err)
+	}
+	var onSrc envelopes.Clearing
+	onSrc.SetStatus(a.ID(), envelopes.Cleared)
+	onSrc.SetStatus(b.ID(), envelopes.Cleared)
+	if err := src.WriteClearing(ctx, onSrc); err != nil {
+		t.Fatal(err)
+	}
+
+	var want envelopes.Clearing
+	want.SetStatus(a.ID(), envelopes.Reconciled)
+	want.SetStatus(b.ID(), envelopes.Cleared)
+
+	if err := Fetch(ctx, "origin", src, cloned); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cloned.ReadClearing(ctx); err != nil || !got.Equal(want) {
+		t.Errorf("Fetch didn't merge the Clearing\ngot:  %v (err: %v)\nwant: %v", got, err, want)
+	}
+
+	if err := Push(ctx, DefaultBranch, cloned, src); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := src.ReadClearing(ctx); err != nil || !got.Equal(want) {
+		t.Errorf("Push didn't merge the Clearing\ngot:  %v (err: %v)\nwant: %v", got, err, want)
+	}
+}
@@ -76,7 +76,9 @@ func CloneDepth(depth uint) CloneOption {
 	}
 }
 
-// BareClone retrieves budget objects from `src` and duplicates them at `dest`.
+// BareClone retrieves budget objects from `src` and duplicates them at `dest`. The Blobs attached to each Transaction
+// are copied along with it, which requires `src` to be a Fetcher and `dest` to be a Stasher whenever there are any. If
+// both keep an envelopes.Clearing, the one in `src` is merged into the one in `dest`.
 func BareClone(ctx context.Context, src BareRepositoryReader, dest BareRepositoryWriter, options ...CloneOption) error {
 	aggregatedOptions := cloneOptions{}
 	for _, option := range options {
@@ -113,14 +115,78 @@ func bareClone(ctx context.Context, src BareRepositoryReader, dest BareRepositor
 		MaxDepth: options.Depth,
 	}
 
-	return walker.Walk(ctx, func(ctx context.Context, _ envelopes.ID, transaction envelopes.Transaction) error {
+	err = walker.Walk(ctx, func(ctx context.Context, _ envelopes.ID, transaction envelopes.Transaction) error {
+		// Blobs are copied first, so that dest never has a Transaction whose attachments it can't read.
+		if err := copyAttachments(ctx, src, dest, transaction); err != nil {
+			return err
+		}
 		return dest.WriteTransaction(ctx, transaction)
 	}, heads...)
+	if err != nil {
+		return err
+	}
+
+	return transferClearing(ctx, src, dest)
+}
+
+type commitOptions struct {
+	AdditionalParents []envelopes.ID
+	RequireBalanced   bool
+}
+
+// CommitOption customizes the behavior of CommitWithOptions.
+type CommitOption func(options *commitOptions) error
+
+// CommitAdditionalParents records more parents for a Transaction, after the one that is currently checked out. This
+// is how a merge is committed.
+func CommitAdditionalParents(parents ...envelopes.ID) CommitOption {
+	return func(options *commitOptions) error {
+		options.AdditionalParents = append(options.AdditionalParents, parents...)
+		return nil
+	}
+}
+
+// CommitRequireBalanced refuses to commit a Transaction whose State doesn't pass envelopes.State.Validate. In that
+// case, the envelopes.ErrUnbalanced describing the problem is returned, and nothing is written.
+func CommitRequireBalanced() CommitOption {
+	return func(options *commitOptions) error {
+		options.RequireBalanced = true
+		return nil
+	}
 }
 
 // Commit assigns the currently checked out commit as the parent of the provided transaction, writes that transaction,
 // then updates the reference to the currently checkout out branch as appropriate.
+//
+// If the transaction has LineItems that don't add up to its Amount, an envelopes.ErrLineItemsUnbalanced is returned and
+// nothing is written.
 func Commit(ctx context.Context, repo RepositoryReaderWriter, transaction envelopes.Transaction, additionalParents ...envelopes.ID) error {
+	return commit(ctx, repo, transaction, commitOptions{AdditionalParents: additionalParents})
+}
+
+// CommitWithOptions behaves like Commit, but allows further checks to be requested.
+func CommitWithOptions(ctx context.Context, repo RepositoryReaderWriter, transaction envelopes.Transaction, options ...CommitOption) error {
+	aggregatedOptions := commitOptions{}
+	for _, option := range options {
+		if err := option(&aggregatedOptions); err != nil {
+			return err
+		}
+	}
+
+	return commit(ctx, repo, transaction, aggregatedOptions)
+}
+
+func commit(ctx context.Context, repo RepositoryReaderWriter, transaction envelopes.Transaction, options commitOptions) error {
+	if err := transaction.ValidateLineItems(); err != nil {
+		return err
+	}
+
+	if options.RequireBalanced && transaction.State != nil {
+		if err := transaction.State.Validate(); err != nil {
+			return err
+		}
+	}
+
 	head, err := repo.Current(ctx)
 	if err != nil {
 		return err
@@ -137,7 +203,7 @@ func Commit(ctx context.Context, repo RepositoryReaderWriter, transaction envelo
 	if parent.Equal(envelopes.ID{}) {
 		transaction.Parents = []envelopes.ID{}
 	} else {
-		transaction.Parents = append([]envelopes.ID{parent}, additionalParents...)
+		transaction.Parents = append([]envelopes.ID{parent}, options.AdditionalParents...)
 	}
 	if err != nil {
 		return err
@@ -0,0 +1,118 @@
+package persist
+
+import (
+	"context"
+	"time"
+
+	"github.com/marstr/envelopes"
+)
+
+// RewriteFunc changes a Transaction while its history is being rewritten by Rewrite. By the time it is called, the
+// Transaction's Parents and Reverts already refer to the rewritten versions of those Transactions.
+type RewriteFunc func(ctx context.Context, subject *envelopes.Transaction) error
+
+// Rewrite copies the history leading up to each of heads, passing every Transaction through rewrite on the way. It
+// returns the IDs of the rewritten heads in the same order, along with the ID that each Transaction it visited was
+// rewritten to.
+//
+// A Transaction's ID depends on its parents', so every descendant of a Transaction that rewrite changes gets a new ID
+// too. Nothing is deleted and no branches are moved, so the original history stays as it was until the caller points its
+// branches at the new heads. Anything else that refers to Transactions by ID, like an envelopes.Clearing, should be
+// updated using the returned replacements, for instance with envelopes.Clearing.Remap.
+func Rewrite(ctx context.Context, loader Loader, writer Writer, rewrite RewriteFunc, heads ...envelopes.ID) ([]envelopes.ID, map[envelopes.ID]envelopes.ID, error) {
+	rewritten := map[envelopes.ID]envelopes.ID{
+		{}: {},
+	}
+
+	var visit func(envelopes.ID) (envelopes.ID, error)
+	visit = func(id envelopes.ID) (envelopes.ID, error) {
+		if replacement, ok := rewritten[id]; ok {
+			return replacement, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return envelopes.ID{}, err
+		}
+
+		var transaction envelopes.Transaction
+		err := loader.LoadTransaction(ctx, id, &transaction)
+		if err != nil {
+			return envelopes.ID{}, err
+		}
+
+		for i := range transaction.Parents {
+			transaction.Parents[i], err = visit(transaction.Parents[i])
+			if err != nil {
+				return envelopes.ID{}, err
+			}
+		}
+		for i := range transaction.Reverts {
+			transaction.Reverts[i], err = visit(transaction.Reverts[i])
+			if err != nil {
+				return envelopes.ID{}, err
+			}
+		}
+
+		err = rewrite(ctx, &transaction)
+		if err != nil {
+			return envelopes.ID{}, err
+		}
+
+		err = writer.WriteTransaction(ctx, transaction)
+		if err != nil {
+			return envelopes.ID{}, err
+		}
+
+		replacement := transaction.ID()
+		rewritten[id] = replacement
+		return replacement, nil
+	}
+
+	retval := make([]envelopes.ID, len(heads))
+	for i, head := range heads {
+		var err error
+		retval[i], err = visit(head)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	delete(rewritten, envelopes.ID{})
+	return retval, rewritten, nil
+}
+
+// NormalizeTimes is a RewriteFunc that moves history recorded before envelopes.UTCTimeHashing existed over to it, so
+// that the same instant yields the same ID no matter which time zone it was recorded in. The times themselves are kept as
+// they are; only the way they are written into IDs changes.
+func NormalizeTimes() RewriteFunc {
+	return func(_ context.Context, subject *envelopes.Transaction) error {
+		subject.TimeHashing = envelopes.UTCTimeHashing
+		return nil
+	}
+}
+
+// TimesToDates is a RewriteFunc that moves history recorded before envelopes.Date existed over to Dates. The PostedTime
+// and ActualTime of each Transaction are replaced by the PostedDate and ActualDate they fall on in loc, or in the
+// location they were recorded in if loc is nil. Transactions that already have a Date keep it, and times that were never
+// set are left alone. EnteredTime records when a Transaction was typed in, rather than when it happened, so it is kept.
+func TimesToDates(loc *time.Location) RewriteFunc {
+	convert := func(when *time.Time, date *envelopes.Date) {
+		if when.IsZero() {
+			return
+		}
+		if date.IsZero() {
+			if loc == nil {
+				*date = envelopes.DateOf(*when)
+			} else {
+				*date = envelopes.DateOf(when.In(loc))
+			}
+		}
+		*when = time.Time{}
+	}
+
+	return func(_ context.Context, subject *envelopes.Transaction) error {
+		convert(&subject.PostedTime, &subject.PostedDate)
+		convert(&subject.ActualTime, &subject.ActualDate)
+		return nil
+	}
+}
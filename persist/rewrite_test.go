@@ -0,0 +1,143 @@
+package persist_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func TestRewrite_timesToDates(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	seattle := time.FixedZone("PDT", -7*60*60)
+	first := envelopes.Transaction{
+		Merchant:   "Paycheck",
+		PostedTime: time.Date(2026, time.June, 1, 23, 30, 0, 0, seattle),
+	}
+	second := envelopes.Transaction{
+		Merchant:    "Grocer",
+		Parents:     []envelopes.ID{first.ID()},
+		PostedTime:  time.Date(2026, time.June, 3, 8, 0, 0, 0, time.UTC),
+		ActualTime:  time.Date(2026, time.June, 2, 18, 0, 0, 0, seattle),
+		EnteredTime: time.Date(2026, time.June, 4, 9, 0, 0, 0, seattle),
+	}
+	undo := envelopes.Transaction{
+		Merchant: "Grocer",
+		Parents:  []envelopes.ID{second.ID()},
+		Reverts:  []envelopes.ID{second.ID()},
+	}
+	for _, transaction := range []envelopes.Transaction{first, second, undo} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	heads, _, err := persist.Rewrite(ctx, repo, repo, persist.TimesToDates(nil), undo.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rewrittenUndo envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, heads[0], &rewrittenUndo); err != nil {
+		t.Fatal(err)
+	}
+	if len(rewrittenUndo.Parents) != 1 || len(rewrittenUndo.Reverts) != 1 || !rewrittenUndo.Parents[0].Equal(rewrittenUndo.Reverts[0]) {
+		t.Fatalf("the rewritten parent and reverted Transaction should be the same, got: %v and %v", rewrittenUndo.Parents, rewrittenUndo.Reverts)
+	}
+
+	var rewrittenSecond envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, rewrittenUndo.Parents[0], &rewrittenSecond); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rewrittenSecond.PostedDate, (envelopes.Date{Year: 2026, Month: time.June, Day: 3}); got != want {
+		t.Errorf("got posted date %s want %s", got, want)
+	}
+	if got, want := rewrittenSecond.ActualDate, (envelopes.Date{Year: 2026, Month: time.June, Day: 2}); got != want {
+		t.Errorf("got actual date %s want %s", got, want)
+	}
+	if !rewrittenSecond.PostedTime.IsZero() || !rewrittenSecond.ActualTime.IsZero() {
+		t.Errorf("times should be cleared once they've been converted")
+	}
+	if !rewrittenSecond.EnteredTime.Equal(second.EnteredTime) {
+		t.Errorf("EnteredTime should be kept")
+	}
+
+	var rewrittenFirst envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, rewrittenSecond.Parents[0], &rewrittenFirst); err != nil {
+		t.Fatal(err)
+	}
+	// Without a location, the date is read in the location the time was recorded in, rather than in UTC.
+	if got, want := rewrittenFirst.PostedDate, (envelopes.Date{Year: 2026, Month: time.June, Day: 1}); got != want {
+		t.Errorf("got posted date %s want %s", got, want)
+	}
+
+	// The original history is left alone.
+	var original envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, second.ID(), &original); err != nil {
+		t.Fatal(err)
+	}
+	if !original.Equal(second) {
+		t.Errorf("the original history should not be changed")
+	}
+}
+
+func TestRewrite_unchanged(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	first := envelopes.Transaction{Merchant: "Paycheck"}
+	second := envelopes.Transaction{Merchant: "Grocer", Parents: []envelopes.ID{first.ID()}}
+	for _, transaction := range []envelopes.Transaction{first, second} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	identity := func(context.Context, *envelopes.Transaction) error {
+		return nil
+	}
+	heads, _, err := persist.Rewrite(ctx, repo, repo, identity, second.ID(), first.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !heads[0].Equal(second.ID()) || !heads[1].Equal(first.ID()) {
+		t.Errorf("a rewrite that changes nothing should keep every ID, got: %v", heads)
+	}
+}
+
+func TestRewrite_normalizeTimes(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+
+	posted := time.Date(2026, time.June, 1, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+	inSeattle := envelopes.Transaction{Merchant: "Bank", PostedTime: posted}
+	inBerlin := envelopes.Transaction{Merchant: "Bank", PostedTime: posted.In(time.FixedZone("CEST", 2*60*60))}
+	for _, transaction := range []envelopes.Transaction{inSeattle, inBerlin} {
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	heads, _, err := persist.Rewrite(ctx, repo, repo, persist.NormalizeTimes(), inSeattle.ID(), inBerlin.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !heads[0].Equal(heads[1]) {
+		t.Errorf("the same instant recorded in two time zones should be identified the same way once normalized")
+	}
+
+	var rewritten envelopes.Transaction
+	if err = repo.LoadTransaction(ctx, heads[0], &rewritten); err != nil {
+		t.Fatal(err)
+	}
+	if rewritten.TimeHashing != envelopes.UTCTimeHashing {
+		t.Errorf("got %s want %s", rewritten.TimeHashing, envelopes.UTCTimeHashing)
+	}
+	if !rewritten.PostedTime.Equal(posted) {
+		t.Errorf("the time itself should be kept")
+	}
+}
@@ -0,0 +1,63 @@
+package persist
+
+import (
+	"context"
+
+	"github.com/marstr/envelopes"
+)
+
+// FindUnbalanced searches the history of head for the Transaction where the Accounts and Budgets of its State first
+// stopped adding up, as decided by envelopes.State.Validate. A Transaction is said to have broken that promise when
+// its own State is unbalanced, but the States of all of its parents are balanced.
+//
+// If more than one Transaction broke the promise, for instance because it was broken, fixed, and then broken again,
+// the one furthest from head is returned. If none did, the zero ID is returned without an error.
+func FindUnbalanced(ctx context.Context, loader Loader, head envelopes.ID) (envelopes.ID, error) {
+	type visited struct {
+		balanced bool
+		parents  []envelopes.ID
+	}
+
+	if head.Equal(envelopes.ID{}) {
+		return envelopes.ID{}, nil
+	}
+
+	// The Walker visits children before their parents, so whether a Transaction broke the promise can only be decided
+	// once the whole history has been seen. The order of the visits is remembered, because it is breadth-first and so
+	// can tell which Transactions are furthest from head.
+	history := make(map[envelopes.ID]visited)
+	var order []envelopes.ID
+	walker := Walker{Loader: loader}
+	err := walker.Walk(ctx, func(_ context.Context, id envelopes.ID, transaction envelopes.Transaction) error {
+		balanced := true
+		if transaction.State != nil {
+			balanced = transaction.State.Validate() == nil
+		}
+		history[id] = visited{balanced: balanced, parents: transaction.Parents}
+		order = append(order, id)
+		return nil
+	}, head)
+	if err != nil {
+		return envelopes.ID{}, err
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		current := history[order[i]]
+		if current.balanced {
+			continue
+		}
+
+		broke := true
+		for _, parent := range current.parents {
+			if !history[parent].balanced {
+				broke = false
+				break
+			}
+		}
+		if broke {
+			return order[i], nil
+		}
+	}
+
+	return envelopes.ID{}, nil
+}
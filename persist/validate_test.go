@@ -0,0 +1,158 @@
+package persist_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+	"github.com/marstr/envelopes/persist"
+)
+
+func balancedState(magnitude int64) *envelopes.State {
+	return &envelopes.State{
+		Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(magnitude, 1)}},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(magnitude, 1)}},
+	}
+}
+
+func unbalancedState(magnitude int64) *envelopes.State {
+	return &envelopes.State{
+		Budget:   &envelopes.Budget{Balance: envelopes.Balance{"USD": big.NewRat(magnitude, 1)}},
+		Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(magnitude+1, 1)}},
+	}
+}
+
+func TestCommitWithOptions_requireBalanced(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+	if err := repo.WriteBranch(ctx, persist.DefaultBranch, envelopes.ID{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetCurrent(ctx, persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	err := persist.CommitWithOptions(ctx, repo, envelopes.Transaction{State: unbalancedState(10)}, persist.CommitRequireBalanced())
+	var unbalanced envelopes.ErrUnbalanced
+	if !errors.As(err, &unbalanced) {
+		t.Errorf("got: %v want: ErrUnbalanced", err)
+	}
+	if head, err := repo.ReadBranch(ctx, persist.DefaultBranch); err != nil || !head.Equal(envelopes.ID{}) {
+		t.Errorf("an unbalanced Transaction should not have been committed")
+	}
+
+	balanced := envelopes.Transaction{State: balancedState(10)}
+	if err = persist.CommitWithOptions(ctx, repo, balanced, persist.CommitRequireBalanced()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the option, nothing is checked.
+	if err = persist.CommitWithOptions(ctx, repo, envelopes.Transaction{State: unbalancedState(10)}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFindUnbalanced(t *testing.T) {
+	ctx := context.Background()
+
+	write := func(t *testing.T, repo *persist.MemoryRepository, state *envelopes.State, parents ...envelopes.ID) envelopes.ID {
+		transaction := envelopes.Transaction{State: state, Parents: parents}
+		if err := repo.WriteTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+		return transaction.ID()
+	}
+
+	t.Run("balanced", func(t *testing.T) {
+		repo := persist.NewMemoryRepository()
+		first := write(t, repo, balancedState(1))
+		second := write(t, repo, balancedState(2), first)
+
+		got, err := persist.FindUnbalanced(ctx, repo, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(envelopes.ID{}) {
+			t.Errorf("got: %s want the zero ID", got)
+		}
+	})
+
+	t.Run("broken twice", func(t *testing.T) {
+		repo := persist.NewMemoryRepository()
+		first := write(t, repo, balancedState(1))
+		firstBreak := write(t, repo, unbalancedState(2), first)
+		stillBroken := write(t, repo, unbalancedState(3), firstBreak)
+		fixed := write(t, repo, balancedState(4), stillBroken)
+		secondBreak := write(t, repo, unbalancedState(5), fixed)
+
+		got, err := persist.FindUnbalanced(ctx, repo, secondBreak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(firstBreak) {
+			t.Errorf("got: %s want: %s", got, firstBreak)
+		}
+
+		got, err = persist.FindUnbalanced(ctx, repo, fixed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(firstBreak) {
+			t.Errorf("got: %s want: %s", got, firstBreak)
+		}
+	})
+
+	t.Run("broken by a merge", func(t *testing.T) {
+		repo := persist.NewMemoryRepository()
+		base := write(t, repo, balancedState(1))
+		left := write(t, repo, balancedState(2), base)
+		right := write(t, repo, balancedState(3), base)
+		merge := write(t, repo, unbalancedState(4), left, right)
+		after := write(t, repo, unbalancedState(5), merge)
+
+		got, err := persist.FindUnbalanced(ctx, repo, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(merge) {
+			t.Errorf("got: %s want: %s", got, merge)
+		}
+	})
+}
+
+func TestCommit_unbalancedLineItems(t *testing.T) {
+	ctx := context.Background()
+	repo := persist.NewMemoryRepository()
+	if err := repo.WriteBranch(ctx, persist.DefaultBranch, envelopes.ID{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetCurrent(ctx, persist.DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := envelopes.Transaction{
+		Amount: envelopes.Balance{"USD": big.NewRat(-10, 1)},
+		LineItems: []envelopes.LineItem{
+			{Amount: envelopes.Balance{"USD": big.NewRat(-4, 1)}, Budget: envelopes.BudgetPath{"groceries"}},
+		},
+	}
+
+	err := persist.Commit(ctx, repo, transaction)
+	var unbalanced envelopes.ErrLineItemsUnbalanced
+	if !errors.As(err, &unbalanced) {
+		t.Errorf("got: %v want: ErrLineItemsUnbalanced", err)
+	}
+	if head, err := repo.ReadBranch(ctx, persist.DefaultBranch); err != nil || !head.Equal(envelopes.ID{}) {
+		t.Errorf("a Transaction with unbalanced line items should not have been committed")
+	}
+
+	transaction.LineItems = append(transaction.LineItems, envelopes.LineItem{
+		Amount: envelopes.Balance{"USD": big.NewRat(-6, 1)},
+		Budget: envelopes.BudgetPath{"household"},
+	})
+	if err = persist.Commit(ctx, repo, transaction); err != nil {
+		t.Error(err)
+	}
+}
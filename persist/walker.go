@@ -21,6 +21,36 @@ func (err ErrSkipAncestors) Error() string {
 	return "Don't add this Transaction's parents to the list to be processed."
 }
 
+// TransactionFilter decides whether a Walker should hand a Transaction to its WalkFunc.
+type TransactionFilter func(transaction envelopes.Transaction) bool
+
+// TaggedWith matches Transactions that have the given tag.
+func TaggedWith(tag string) TransactionFilter {
+	return func(transaction envelopes.Transaction) bool {
+		return transaction.Tags.Has(tag)
+	}
+}
+
+// HasMetadata matches Transactions whose Metadata holds value for key.
+func HasMetadata(key, value string) TransactionFilter {
+	return func(transaction envelopes.Transaction) bool {
+		found, ok := transaction.Metadata[key]
+		return ok && found == value
+	}
+}
+
+// MatchAll matches Transactions that are matched by every one of filters. With no filters, every Transaction matches.
+func MatchAll(filters ...TransactionFilter) TransactionFilter {
+	return func(transaction envelopes.Transaction) bool {
+		for _, filter := range filters {
+			if !filter(transaction) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 type Walker struct {
 	// Loader fetches objects for further processing. This must be populated for Walker to function properly.
 	Loader Loader
@@ -28,6 +58,10 @@ type Walker struct {
 	// MaxDepth controls how many generations beyond the provided heads this Walker will process. If its value is '0',
 	// no restrictions are placed, and it will walk the entire envelopes.Transaction history.
 	MaxDepth uint
+
+	// Filter limits which Transactions are handed to the WalkFunc. Transactions that don't match are still walked
+	// through, so that their parents are visited. If it is nil, every Transaction is handed to the WalkFunc.
+	Filter TransactionFilter
 }
 
 func (w *Walker) Walk(ctx context.Context, action WalkFunc, heads ...envelopes.ID) error {
@@ -67,13 +101,15 @@ func (w *Walker) Walk(ctx context.Context, action WalkFunc, heads ...envelopes.I
 		}
 		processed[currentEntry.ID] = struct{}{}
 
-		err = action(ctx, currentEntry.ID, current)
-		if err != nil {
-			switch err.(type) {
-			case ErrSkipAncestors:
-				continue
-			default:
-				return err
+		if w.Filter == nil || w.Filter(current) {
+			err = action(ctx, currentEntry.ID, current)
+			if err != nil {
+				switch err.(type) {
+				case ErrSkipAncestors:
+					continue
+				default:
+					return err
+				}
 			}
 		}
 
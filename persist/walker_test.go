@@ -13,6 +13,7 @@ func TestWalker_Walk(t *testing.T) {
 	t.Run("basic fork", fork(ctx))
 	t.Run("skip when told", respectSkipAncestors(ctx))
 	t.Run("respect depth", respectDepth(ctx))
+	t.Run("filter", respectFilter(ctx))
 }
 
 func chain(ctx context.Context) func(t *testing.T) {
@@ -288,3 +289,65 @@ func respectDepth(ctx context.Context) func(*testing.T) {
 		}
 	}
 }
+
+func respectFilter(ctx context.Context) func(*testing.T) {
+	cache := NewCache(4)
+
+	write := func(transaction envelopes.Transaction) envelopes.ID {
+		if err := cache.WriteTransaction(ctx, transaction); err != nil {
+			panic(err)
+		}
+		return transaction.ID()
+	}
+
+	a := write(envelopes.Transaction{
+		Comment:  "Flight",
+		Tags:     envelopes.NewTagSet("reimbursable", "vacation-2026"),
+		Metadata: envelopes.TransactionMetadata{"trip": "Lisbon"},
+	})
+	b := write(envelopes.Transaction{
+		Comment: "Groceries",
+		Parents: []envelopes.ID{a},
+	})
+	c := write(envelopes.Transaction{
+		Comment: "Hotel",
+		Parents: []envelopes.ID{b},
+		Tags:    envelopes.NewTagSet("vacation-2026"),
+	})
+
+	return func(t *testing.T) {
+		testCases := map[string]struct {
+			filter TransactionFilter
+			want   []envelopes.ID
+		}{
+			"tag":      {TaggedWith("vacation-2026"), []envelopes.ID{c, a}},
+			"metadata": {HasMetadata("trip", "Lisbon"), []envelopes.ID{a}},
+			"all":      {MatchAll(TaggedWith("vacation-2026"), TaggedWith("reimbursable")), []envelopes.ID{a}},
+			"none":     {MatchAll(), []envelopes.ID{c, b, a}},
+		}
+
+		for name, tc := range testCases {
+			walker := Walker{Loader: cache, Filter: tc.filter}
+
+			var got []envelopes.ID
+			err := walker.Walk(ctx, func(_ context.Context, id envelopes.ID, _ envelopes.Transaction) error {
+				got = append(got, id)
+				return nil
+			}, c)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			if len(got) != len(tc.want) {
+				t.Errorf("%s: got %d transactions want %d", name, len(got), len(tc.want))
+				continue
+			}
+			for i := range got {
+				if !got[i].Equal(tc.want[i]) {
+					t.Errorf("%s: at position %d got %s want %s", name, i, got[i], tc.want[i])
+				}
+			}
+		}
+	}
+}
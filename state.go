@@ -19,7 +19,6 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"math/big"
-	"os"
 )
 
 type (
@@ -27,6 +26,10 @@ type (
 	State struct {
 		Budget   *Budget
 		Accounts Accounts
+
+		// Metadata describes the Accounts, for instance by separating the ones holding money from the ones recording
+		// debts. Accounts without any AccountDetails are treated as AssetAccounts.
+		Metadata AccountMetadata
 	}
 
 	// Impact captures the difference between two States.
@@ -56,9 +59,13 @@ func (s State) ID() (id ID) {
 	return sha1.Sum(marshaled)
 }
 
-// Equal determines whether or not each component of two States have the same balances. If any components are not
-// shared, the answer is false.
+// Equal determines whether or not each component of two States have the same balances, and their Accounts are
+// described by the same AccountMetadata. If any components are not shared, the answer is false.
 func (s State) Equal(other State) bool {
+	if !s.Metadata.Equal(other.Metadata) {
+		return false
+	}
+
 	result := s.Subtract(other)
 	if len(result.Accounts) > 0 {
 		return false
@@ -94,7 +101,17 @@ func (s State) MarshalText() ([]byte, error) {
 		return nil, err
 	}
 
-	return identityBuilder.Bytes(), nil
+	// States from before AccountMetadata existed don't have any, so leaving it out when it's empty keeps their IDs the
+	// same.
+	if !s.Metadata.Empty() {
+		_, err = fmt.Fprintf(identityBuilder, "metadata %s\n", s.Metadata.ID())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The buffer goes back into the pool as soon as this returns, so the caller needs its own copy.
+	return append([]byte(nil), identityBuilder.Bytes()...), nil
 }
 
 func (s State) String() string {
@@ -120,11 +137,22 @@ func (s State) Add(other State) Impact {
 
 // DeepCopy creates a duplicate state that can be modified without fear of modifying the original.
 func (s State) DeepCopy() State {
-	copiedBudget := s.Budget.DeepCopy()
-	return State{
-		Accounts: s.Accounts.DeepCopy(),
-		Budget:   &copiedBudget,
+	var retval State
+
+	if s.Budget != nil {
+		copiedBudget := s.Budget.DeepCopy()
+		retval.Budget = &copiedBudget
 	}
+
+	if s.Accounts != nil {
+		retval.Accounts = s.Accounts.DeepCopy()
+	}
+
+	if s.Metadata != nil {
+		retval.Metadata = s.Metadata.DeepCopy()
+	}
+
+	return retval
 }
 
 // CalculateAmount looks at the difference between two states, and boils down the changes
@@ -203,21 +231,17 @@ func findAccountAmount(original, updated State) Balance {
 func findBudgetAmount(original, updated State) Balance {
 	zero := big.NewRat(0, 1)
 	// Normalize the budgets into a flattened shape for easier comparison, more like Accounts
-	const separator = string(os.PathSeparator)
-	originalBudgets := make(map[string]Balance)
-	updatedBudgets := make(map[string]Balance)
-
-	var treeFlattener func(map[string]Balance, string, *Budget)
-	treeFlattener = func(discovered map[string]Balance, currentPath string, target *Budget) {
-		discovered[currentPath] = target.Balance
-
-		for name, subTarget := range target.Children {
-			treeFlattener(discovered, currentPath+separator+name, subTarget)
-		}
+	flatten := func(target *Budget) map[string]Balance {
+		discovered := make(map[string]Balance)
+		_ = target.Walk(func(path BudgetPath, current *Budget) error {
+			discovered[path.String()] = current.Balance
+			return nil
+		})
+		return discovered
 	}
 
-	treeFlattener(originalBudgets, separator, original.Budget)
-	treeFlattener(updatedBudgets, separator, updated.Budget)
+	originalBudgets := flatten(original.Budget)
+	updatedBudgets := flatten(updated.Budget)
 
 	// Make a list of all budget names in the updated state, so that we can find the ones which were added.
 	addedBudgets := make(map[string]struct{}, len(updatedBudgets))
@@ -22,6 +22,58 @@ import (
 	"time"
 )
 
+// TimeHashing picks how the times of a Transaction are written into its ID.
+type TimeHashing uint8
+
+// These are the values that a TimeHashing can have.
+const (
+	// LocalTimeHashing writes each time as it reads in its own location, to the second. It is the zero value, so that
+	// Transactions recorded before there was a choice keep their IDs.
+	LocalTimeHashing TimeHashing = iota
+
+	// UTCTimeHashing writes each time as it reads in UTC, to the nanosecond. The same instant yields the same ID no matter
+	// which time zone it was recorded in, and instants in the same second are told apart.
+	UTCTimeHashing
+)
+
+var timeHashingNames = [...]string{
+	LocalTimeHashing: "local",
+	UTCTimeHashing:   "utc",
+}
+
+// ErrUnknownTimeHashing indicates that text didn't name any TimeHashing.
+type ErrUnknownTimeHashing string
+
+func (err ErrUnknownTimeHashing) Error() string {
+	return fmt.Sprintf("%q is not a way of hashing times", string(err))
+}
+
+func (h TimeHashing) String() string {
+	if int(h) < len(timeHashingNames) {
+		return timeHashingNames[h]
+	}
+	return fmt.Sprintf("TimeHashing(%d)", uint8(h))
+}
+
+// MarshalText writes the name of a TimeHashing, like "utc".
+func (h TimeHashing) MarshalText() ([]byte, error) {
+	if int(h) >= len(timeHashingNames) {
+		return nil, fmt.Errorf("%d is not a way of hashing times", uint8(h))
+	}
+	return []byte(timeHashingNames[h]), nil
+}
+
+// UnmarshalText reads a TimeHashing written by MarshalText.
+func (h *TimeHashing) UnmarshalText(text []byte) error {
+	for i, name := range timeHashingNames {
+		if name == string(text) {
+			*h = TimeHashing(i)
+			return nil
+		}
+	}
+	return ErrUnknownTimeHashing(text)
+}
+
 // Transaction represents one exchange of funds and how it impacted budgets.
 type Transaction struct {
 	State       *State
@@ -35,6 +87,27 @@ type Transaction struct {
 	RecordID    BankRecordID
 	Parents     []ID
 	Reverts     []ID
+
+	// PostedDate and ActualDate record the day a Transaction happened on, for when there isn't a meaningful time of day.
+	// Unlike PostedTime and ActualTime, which are identified by how they read in the time zone they were recorded in, a
+	// Date is identified the same way everywhere. When PostedDate is set, PostedTime may be left as its zero value.
+	PostedDate Date
+	ActualDate Date
+
+	// TimeHashing picks how ActualTime, PostedTime, and EnteredTime are written into the ID. New Transactions should use
+	// UTCTimeHashing; the zero value is only kept for the sake of history recorded before it existed.
+	TimeHashing TimeHashing
+
+	// LineItems optionally breaks the Amount down into the parts that were paid for out of different Budgets. When
+	// there are any, they should add up to the Amount, which is checked by ValidateLineItems.
+	LineItems []LineItem
+
+	// Tags and Metadata label a Transaction, so that it can be found later. Neither has any effect on the State.
+	Tags     TagSet
+	Metadata TransactionMetadata
+
+	// Attachments refer to Blobs, like scanned receipts, that document this Transaction.
+	Attachments []Attachment
 }
 
 // ID fetches a SHA1 hash of this object that will uniquely identify it.
@@ -55,13 +128,62 @@ func (t Transaction) String() string {
 	return string(marshaled)
 }
 
+// DeepCopy creates a duplicate Transaction that can be modified without fear of modifying the original.
+func (t Transaction) DeepCopy() Transaction {
+	retval := t
+
+	if t.State != nil {
+		copiedState := t.State.DeepCopy()
+		retval.State = &copiedState
+	}
+
+	if t.Amount != nil {
+		retval.Amount = t.Amount.DeepCopy()
+	}
+
+	if t.Parents != nil {
+		retval.Parents = make([]ID, len(t.Parents))
+		copy(retval.Parents, t.Parents)
+	}
+
+	if t.Reverts != nil {
+		retval.Reverts = make([]ID, len(t.Reverts))
+		copy(retval.Reverts, t.Reverts)
+	}
+
+	if t.LineItems != nil {
+		retval.LineItems = make([]LineItem, len(t.LineItems))
+		for i := range t.LineItems {
+			retval.LineItems[i] = t.LineItems[i].DeepCopy()
+		}
+	}
+
+	if t.Tags != nil {
+		retval.Tags = t.Tags.DeepCopy()
+	}
+
+	if t.Metadata != nil {
+		retval.Metadata = t.Metadata.DeepCopy()
+	}
+
+	if t.Attachments != nil {
+		retval.Attachments = make([]Attachment, len(t.Attachments))
+		copy(retval.Attachments, t.Attachments)
+	}
+
+	return retval
+}
+
 // Equal determines whether two instances of Transaction share identical values.
 func (t Transaction) Equal(other Transaction) bool {
-	if t.State == nil && other.State != nil {
-		return false
-	} else if t.State == nil && other.State == nil {
-		// Intentionally Left Blank
-	} else if !t.State.Equal(*other.State) {
+	// A nil State is treated as an empty one, the same way that MarshalText treats it.
+	if t.State == nil {
+		t.State = &State{}
+	}
+	if other.State == nil {
+		other.State = &State{}
+	}
+	if !t.State.Equal(*other.State) {
 		return false
 	}
 
@@ -77,6 +199,14 @@ func (t Transaction) Equal(other Transaction) bool {
 		return false
 	}
 
+	if t.PostedDate != other.PostedDate || t.ActualDate != other.ActualDate {
+		return false
+	}
+
+	if t.TimeHashing != other.TimeHashing {
+		return false
+	}
+
 	if !t.Amount.Equal(other.Amount) {
 		return false
 	}
@@ -117,12 +247,62 @@ func (t Transaction) Equal(other Transaction) bool {
 		}
 	}
 
+	if len(t.LineItems) != len(other.LineItems) {
+		return false
+	}
+
+	for i := range t.LineItems {
+		if !t.LineItems[i].Equal(other.LineItems[i]) {
+			return false
+		}
+	}
+
+	if !t.Tags.Equal(other.Tags) {
+		return false
+	}
+
+	if !t.Metadata.Equal(other.Metadata) {
+		return false
+	}
+
+	if len(t.Attachments) != len(other.Attachments) {
+		return false
+	}
+
+	for i := range t.Attachments {
+		if t.Attachments[i] != other.Attachments[i] {
+			return false
+		}
+	}
+
 	return true
 }
 
 // MarshalText computes a string which uniquely represents this Transaction.
+//
+// How times are written depends on TimeHashing. With UTCTimeHashing, they are written in UTC with all nine decimal places
+// of the seconds, so the same instant always yields the same ID. With LocalTimeHashing, they are written as they read in
+// their own location, to the second, so the same instant recorded in two different time zones yields two different IDs,
+// as do two instants in the same second. Dates are written without a time zone. TimeHashing and Dates are only written
+// when they are set, so Transactions recorded before they existed keep their IDs.
 func (t Transaction) MarshalText() ([]byte, error) {
-	const timeFormat = time.RFC3339
+	const localTimeFormat = time.RFC3339
+	const utcTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+	var formatTime func(time.Time) string
+	switch t.TimeHashing {
+	case LocalTimeHashing:
+		formatTime = func(when time.Time) string {
+			return when.Format(localTimeFormat)
+		}
+	case UTCTimeHashing:
+		formatTime = func(when time.Time) string {
+			return when.UTC().Format(utcTimeFormat)
+		}
+	default:
+		return nil, fmt.Errorf("%d is not a way of hashing times", uint8(t.TimeHashing))
+	}
+
 	identityBuilder := identityBuilders.Get().(*bytes.Buffer)
 	identityBuilder.Reset()
 	defer identityBuilders.Put(identityBuilder)
@@ -147,23 +327,43 @@ func (t Transaction) MarshalText() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = fmt.Fprintf(identityBuilder, "posted time %s\n", t.PostedTime.Format(timeFormat))
-	if err != nil {
-		return nil, err
+	if t.TimeHashing != LocalTimeHashing {
+		_, err = fmt.Fprintf(identityBuilder, "time hashing %s\n", t.TimeHashing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.PostedDate.IsZero() || t.PostedTime != defaultTime {
+		_, err = fmt.Fprintf(identityBuilder, "posted time %s\n", formatTime(t.PostedTime))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !t.PostedDate.IsZero() {
+		_, err = fmt.Fprintf(identityBuilder, "posted date %s\n", t.PostedDate)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if t.ActualTime != defaultTime {
-		_, err = fmt.Fprintf(identityBuilder, "actual time %s\n", t.ActualTime.Format(timeFormat))
+		_, err = fmt.Fprintf(identityBuilder, "actual time %s\n", formatTime(t.ActualTime))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !t.ActualDate.IsZero() {
+		_, err = fmt.Fprintf(identityBuilder, "actual date %s\n", t.ActualDate)
 		if err != nil {
 			return nil, err
 		}
 	}
 	if t.EnteredTime != defaultTime {
-		_, err = fmt.Fprintf(identityBuilder, "entered time %s\n", t.EnteredTime.Format(timeFormat))
+		_, err = fmt.Fprintf(identityBuilder, "entered time %s\n", formatTime(t.EnteredTime))
 		if err != nil {
 			return nil, err
 		}
 	}
-	_, err = fmt.Fprintf(identityBuilder, "amount %s\n", t.Amount)
+	_, err = fmt.Fprintf(identityBuilder, "amount %s\n", t.Amount.identity())
 	if err != nil {
 		return nil, err
 	}
@@ -193,10 +393,43 @@ func (t Transaction) MarshalText() ([]byte, error) {
 			return nil, err
 		}
 	}
+	for i := range t.LineItems {
+		marshaled, err := t.LineItems[i].MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(identityBuilder, "line item %s\n", marshaled)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range t.Tags.Sorted() {
+		_, err = fmt.Fprintf(identityBuilder, "tag %q\n", tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range t.Metadata.Keys() {
+		_, err = fmt.Fprintf(identityBuilder, "metadata %q %q\n", key, t.Metadata[key])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range t.Attachments {
+		marshaled, err := t.Attachments[i].MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(identityBuilder, "attachment %s\n", marshaled)
+		if err != nil {
+			return nil, err
+		}
+	}
 	_, err = fmt.Fprintf(identityBuilder, "comment %s\n", t.Comment)
 	if err != nil {
 		return nil, err
 	}
 
-	return identityBuilder.Bytes(), nil
+	// The buffer goes back into the pool as soon as this returns, so the caller needs its own copy.
+	return append([]byte(nil), identityBuilder.Bytes()...), nil
 }
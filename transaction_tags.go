@@ -0,0 +1,120 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"sort"
+)
+
+// TagSet holds the labels that have been given to a Transaction, like "reimbursable" or "vacation-2026". Tags have no
+// order, and each one is either present or absent.
+type TagSet map[string]struct{}
+
+// NewTagSet creates a TagSet holding each of the provided tags. Empty tags are ignored.
+func NewTagSet(tags ...string) TagSet {
+	retval := make(TagSet, len(tags))
+	for _, tag := range tags {
+		retval.Add(tag)
+	}
+	return retval
+}
+
+// Add includes a tag in this TagSet. Empty tags are ignored.
+func (ts TagSet) Add(tag string) {
+	if tag == "" {
+		return
+	}
+	ts[tag] = struct{}{}
+}
+
+// Remove takes a tag out of this TagSet, if it is present.
+func (ts TagSet) Remove(tag string) {
+	delete(ts, tag)
+}
+
+// Has determines whether a tag is present in this TagSet.
+func (ts TagSet) Has(tag string) bool {
+	_, ok := ts[tag]
+	return ok
+}
+
+// Sorted fetches an alphabetically sorted list of the tags in this TagSet.
+func (ts TagSet) Sorted() []string {
+	retval := make([]string, 0, len(ts))
+	for tag := range ts {
+		retval = append(retval, tag)
+	}
+	sort.Strings(retval)
+	return retval
+}
+
+// Equal determines whether two TagSets hold the same tags. A nil TagSet is the same as an empty one.
+func (ts TagSet) Equal(other TagSet) bool {
+	if len(ts) != len(other) {
+		return false
+	}
+	for tag := range ts {
+		if !other.Has(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// DeepCopy creates a duplicate TagSet that can be modified without fear of modifying the original.
+func (ts TagSet) DeepCopy() TagSet {
+	retval := make(TagSet, len(ts))
+	for tag := range ts {
+		retval[tag] = struct{}{}
+	}
+	return retval
+}
+
+// TransactionMetadata holds arbitrary information about a Transaction that doesn't have a field of its own, like the
+// number of the check that paid for it.
+type TransactionMetadata map[string]string
+
+// Keys fetches an alphabetically sorted list of the keys in this TransactionMetadata.
+func (m TransactionMetadata) Keys() []string {
+	retval := make([]string, 0, len(m))
+	for key := range m {
+		retval = append(retval, key)
+	}
+	sort.Strings(retval)
+	return retval
+}
+
+// Equal determines whether two instances of TransactionMetadata hold the same keys and values. A nil
+// TransactionMetadata is the same as an empty one.
+func (m TransactionMetadata) Equal(other TransactionMetadata) bool {
+	if len(m) != len(other) {
+		return false
+	}
+	for key, value := range m {
+		if otherValue, ok := other[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// DeepCopy creates a duplicate TransactionMetadata that can be modified without fear of modifying the original.
+func (m TransactionMetadata) DeepCopy() TransactionMetadata {
+	retval := make(TransactionMetadata, len(m))
+	for key, value := range m {
+		retval[key] = value
+	}
+	return retval
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestTagSet(t *testing.T) {
+	subject := envelopes.NewTagSet("vacation-2026", "reimbursable", "", "reimbursable")
+	if got, want := fmt.Sprint(subject.Sorted()), "[reimbursable vacation-2026]"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	copied := subject.DeepCopy()
+	copied.Remove("reimbursable")
+	copied.Add("tax-deductible")
+	if !subject.Has("reimbursable") || subject.Has("tax-deductible") {
+		t.Errorf("DeepCopy should not share tags with the original")
+	}
+	if subject.Equal(copied) {
+		t.Errorf("TagSets with different tags should not be Equal")
+	}
+
+	if !envelopes.TagSet(nil).Equal(envelopes.NewTagSet()) {
+		t.Errorf("a nil TagSet should be Equal to an empty one")
+	}
+}
+
+func TestTransaction_tagsIdentity(t *testing.T) {
+	plain := envelopes.Transaction{Comment: "Conference hotel"}
+
+	labeled := plain
+	labeled.Tags = envelopes.NewTagSet("tax-deductible", "reimbursable")
+	labeled.Metadata = envelopes.TransactionMetadata{"check": "1042"}
+
+	reordered := plain
+	reordered.Tags = envelopes.NewTagSet("reimbursable", "tax-deductible")
+	reordered.Metadata = envelopes.TransactionMetadata{"check": "1042"}
+
+	if labeled.ID().Equal(plain.ID()) {
+		t.Errorf("tags and metadata should be part of a Transaction's ID")
+	}
+	if !labeled.ID().Equal(reordered.ID()) || !labeled.Equal(reordered) {
+		t.Errorf("the order tags were added in should not matter")
+	}
+
+	empty := plain
+	empty.Tags = envelopes.TagSet{}
+	empty.Metadata = envelopes.TransactionMetadata{}
+	if !empty.ID().Equal(plain.ID()) || !empty.Equal(plain) {
+		t.Errorf("empty tags and metadata should not change a Transaction")
+	}
+
+	modified := labeled.DeepCopy()
+	modified.Metadata["check"] = "1043"
+	if labeled.Metadata["check"] != "1042" {
+		t.Errorf("DeepCopy should not share metadata with the original")
+	}
+	if labeled.Equal(modified) || labeled.ID().Equal(modified.ID()) {
+		t.Errorf("changing metadata should change the Transaction")
+	}
+}
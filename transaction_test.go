@@ -14,6 +14,8 @@ func TestTransaction_ID(t *testing.T) {
 	defer cancel()
 	t.Run("lock", getTestTransactionIDLock(ctx))
 	t.Run("recordIdIncluded", getEnsureBankIdIncluded(ctx))
+	t.Run("datesIgnoreTimeZone", getEnsureDatesIgnoreTimeZone(ctx))
+	t.Run("utcTimesIgnoreTimeZone", getEnsureUTCTimesIgnoreTimeZone(ctx))
 }
 
 func getTestTransactionIDLock(ctx context.Context) func(*testing.T) {
@@ -209,3 +211,133 @@ func getEnsureBankIdIncluded(_ context.Context) func(*testing.T) {
 		}
 	}
 }
+
+func getEnsureDatesIgnoreTimeZone(_ context.Context) func(*testing.T) {
+	return func(t *testing.T) {
+		seattle := time.FixedZone("PDT", -7*60*60)
+		berlin := time.FixedZone("CEST", 2*60*60)
+		posted := time.Date(2026, time.June, 1, 23, 30, 0, 0, seattle)
+
+		inSeattle := envelopes.Transaction{Merchant: "Bank", PostedTime: posted}
+		inBerlin := envelopes.Transaction{Merchant: "Bank", PostedTime: posted.In(berlin)}
+		if inSeattle.ID() == inBerlin.ID() {
+			t.Errorf("times are expected to be identified by how they read in their own location")
+		}
+
+		inSeattle = envelopes.Transaction{Merchant: "Bank", PostedDate: envelopes.DateOf(posted)}
+		inBerlin = envelopes.Transaction{Merchant: "Bank", PostedDate: envelopes.DateOf(posted)}
+		if inSeattle.ID() != inBerlin.ID() {
+			t.Errorf("the same PostedDate should always yield the same ID")
+		}
+
+		withTime := inSeattle
+		withTime.PostedTime = posted
+		if withTime.ID() == inSeattle.ID() {
+			t.Errorf("a PostedTime alongside a PostedDate should still change the ID")
+		}
+
+		withActual := inSeattle
+		withActual.ActualDate = envelopes.Date{Year: 2026, Month: time.May, Day: 30}
+		if withActual.ID() == inSeattle.ID() || withActual.Equal(inSeattle) {
+			t.Errorf("an ActualDate should change the ID, and make Transactions unequal")
+		}
+	}
+}
+
+func getEnsureUTCTimesIgnoreTimeZone(_ context.Context) func(*testing.T) {
+	return func(t *testing.T) {
+		seattle := time.FixedZone("PDT", -7*60*60)
+		berlin := time.FixedZone("CEST", 2*60*60)
+		posted := time.Date(2026, time.June, 1, 23, 30, 0, 0, seattle)
+
+		inSeattle := envelopes.Transaction{Merchant: "Bank", PostedTime: posted, TimeHashing: envelopes.UTCTimeHashing}
+		inBerlin := envelopes.Transaction{Merchant: "Bank", PostedTime: posted.In(berlin), TimeHashing: envelopes.UTCTimeHashing}
+		if inSeattle.ID() != inBerlin.ID() {
+			t.Errorf("the same instant should always yield the same ID when hashing times in UTC")
+		}
+
+		later := inSeattle
+		later.PostedTime = posted.Add(time.Millisecond)
+		if later.ID() == inSeattle.ID() {
+			t.Errorf("instants in the same second should be told apart when hashing times in UTC")
+		}
+
+		local := inSeattle
+		local.TimeHashing = envelopes.LocalTimeHashing
+		if local.ID() == inSeattle.ID() || local.Equal(inSeattle) {
+			t.Errorf("TimeHashing should change the ID, and make Transactions unequal")
+		}
+
+		unknown := inSeattle
+		unknown.TimeHashing = envelopes.TimeHashing(200)
+		if _, err := unknown.MarshalText(); err == nil {
+			t.Errorf("an unknown TimeHashing should not be marshaled")
+		}
+	}
+}
+
+func TestTimeHashing_MarshalText(t *testing.T) {
+	for _, want := range []envelopes.TimeHashing{envelopes.LocalTimeHashing, envelopes.UTCTimeHashing} {
+		marshaled, err := want.MarshalText()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		var got envelopes.TimeHashing
+		if err = got.UnmarshalText(marshaled); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	}
+
+	var got envelopes.TimeHashing
+	if err := got.UnmarshalText([]byte("martian")); err == nil {
+		t.Errorf("expected an error for an unknown TimeHashing")
+	}
+}
+
+func TestTransaction_DeepCopy(t *testing.T) {
+	original := envelopes.Transaction{
+		Amount:  envelopes.Balance{"USD": big.NewRat(-1200, 100)},
+		Parents: []envelopes.ID{{1}},
+		State: &envelopes.State{
+			Budget: &envelopes.Budget{
+				Balance: envelopes.Balance{"USD": big.NewRat(3400, 100)},
+				Children: map[string]*envelopes.Budget{
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(1100, 100)}},
+				},
+			},
+			Accounts: envelopes.Accounts{"checking": {"USD": big.NewRat(4500, 100)}},
+		},
+	}
+	want := original.ID()
+
+	copied := original.DeepCopy()
+	copied.Amount["USD"].SetInt64(1)
+	copied.Parents[0] = envelopes.ID{2}
+	copied.State.Budget.Balance["USD"].SetInt64(1)
+	copied.State.Budget.Children["groceries"].Balance["USD"].SetInt64(1)
+	copied.State.Accounts["checking"]["USD"].SetInt64(1)
+
+	if got := original.ID(); !got.Equal(want) {
+		t.Error("modifying a copy of a Transaction modified the original")
+	}
+}
+
+func TestTransaction_Equal_nilState(t *testing.T) {
+	withNil := envelopes.Transaction{Comment: "nil state"}
+	withEmpty := envelopes.Transaction{Comment: "nil state", State: &envelopes.State{}}
+
+	if !withNil.Equal(withEmpty) || !withEmpty.Equal(withNil) {
+		t.Error("a nil State should be Equal to an empty one")
+	}
+
+	withEmpty.State.Accounts = envelopes.Accounts{"checking": {"USD": big.NewRat(1, 1)}}
+	if withNil.Equal(withEmpty) || withEmpty.Equal(withNil) {
+		t.Error("a nil State should not be Equal to a populated one")
+	}
+}
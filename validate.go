@@ -0,0 +1,109 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// AssetDiscrepancy records how far apart the Accounts and Budgets of a State are for a single asset.
+type AssetDiscrepancy struct {
+	Asset AssetType
+
+	// Accounts is the total of this asset across all Accounts.
+	Accounts *big.Rat
+
+	// Budget is the total of this asset across the root Budget and all of its descendants.
+	Budget *big.Rat
+}
+
+// Difference finds how much more of the asset is held in Accounts than has been assigned to Budgets. It is negative
+// when more has been budgeted than is available.
+func (d AssetDiscrepancy) Difference() *big.Rat {
+	return new(big.Rat).Sub(d.Accounts, d.Budget)
+}
+
+func (d AssetDiscrepancy) String() string {
+	const precision = 3
+	return fmt.Sprintf(
+		"%s: accounts %s budget %s difference %s",
+		d.Asset,
+		d.Accounts.FloatString(precision),
+		d.Budget.FloatString(precision),
+		d.Difference().FloatString(precision))
+}
+
+// ErrUnbalanced indicates that the Accounts of a State don't add up to the same amount as its Budgets. It lists each
+// asset that doesn't match, sorted by asset.
+type ErrUnbalanced []AssetDiscrepancy
+
+func (err ErrUnbalanced) Error() string {
+	discrepancies := make([]string, len(err))
+	for i := range err {
+		discrepancies[i] = err[i].String()
+	}
+	return "accounts and budgets are not balanced (" + strings.Join(discrepancies, "; ") + ")"
+}
+
+// Validate checks the promise at the center of envelope budgeting: that, for each asset, the money held in all
+// Accounts equals the money assigned to the root Budget and its descendants. If they don't match, an ErrUnbalanced
+// describing each asset that is off is returned.
+func (s State) Validate() error {
+	accounts := s.Accounts.Balance()
+
+	var budget Balance
+	if s.Budget != nil {
+		budget = s.Budget.RecursiveBalance()
+	}
+
+	assets := make(map[AssetType]struct{}, len(accounts)+len(budget))
+	for asset := range accounts {
+		assets[asset] = struct{}{}
+	}
+	for asset := range budget {
+		assets[asset] = struct{}{}
+	}
+
+	var discrepancies ErrUnbalanced
+	for asset := range assets {
+		current := AssetDiscrepancy{
+			Asset:    asset,
+			Accounts: new(big.Rat),
+			Budget:   new(big.Rat),
+		}
+		if magnitude, ok := accounts[asset]; ok && magnitude != nil {
+			current.Accounts.Set(magnitude)
+		}
+		if magnitude, ok := budget[asset]; ok && magnitude != nil {
+			current.Budget.Set(magnitude)
+		}
+
+		if current.Accounts.Cmp(current.Budget) != 0 {
+			discrepancies = append(discrepancies, current)
+		}
+	}
+
+	if len(discrepancies) == 0 {
+		return nil
+	}
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].Asset < discrepancies[j].Asset
+	})
+	return discrepancies
+}
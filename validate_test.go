@@ -0,0 +1,87 @@
+// Copyright 2017 Martin Strobel
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package envelopes_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/marstr/envelopes"
+)
+
+func TestState_Validate(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		if err := (envelopes.State{}).Validate(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("balanced", func(t *testing.T) {
+		subject := envelopes.State{
+			Budget: &envelopes.Budget{
+				Balance: envelopes.Balance{"USD": big.NewRat(40, 1)},
+				Children: map[string]*envelopes.Budget{
+					"groceries": {Balance: envelopes.Balance{"USD": big.NewRat(60, 1), "EUR": big.NewRat(0, 1)}},
+				},
+			},
+			Accounts: envelopes.Accounts{
+				"checking": {"USD": big.NewRat(70, 1)},
+				"savings":  {"USD": big.NewRat(30, 1)},
+			},
+		}
+		if err := subject.Validate(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unbalanced", func(t *testing.T) {
+		subject := envelopes.State{
+			Budget: &envelopes.Budget{
+				Balance: envelopes.Balance{"USD": big.NewRat(40, 1)},
+				Children: map[string]*envelopes.Budget{
+					"stocks": {Balance: envelopes.Balance{"MSFT": big.NewRat(3, 1)}},
+				},
+			},
+			Accounts: envelopes.Accounts{
+				"checking": {"USD": big.NewRat(50, 1)},
+				"cash":     {"EUR": big.NewRat(5, 1)},
+			},
+		}
+
+		err := subject.Validate()
+		var unbalanced envelopes.ErrUnbalanced
+		if !errors.As(err, &unbalanced) {
+			t.Fatalf("got: %v want: ErrUnbalanced", err)
+		}
+
+		want := []struct {
+			asset      envelopes.AssetType
+			difference *big.Rat
+		}{
+			{"EUR", big.NewRat(5, 1)},
+			{"MSFT", big.NewRat(-3, 1)},
+			{"USD", big.NewRat(10, 1)},
+		}
+		if len(unbalanced) != len(want) {
+			t.Fatalf("got %d discrepancies want %d: %v", len(unbalanced), len(want), unbalanced)
+		}
+		for i := range want {
+			if unbalanced[i].Asset != want[i].asset || unbalanced[i].Difference().Cmp(want[i].difference) != 0 {
+				t.Errorf("discrepancy %d got: %s want: %s off by %s", i, unbalanced[i], want[i].asset, want[i].difference.FloatString(3))
+			}
+		}
+	})
+}